@@ -19,6 +19,9 @@ import (
 	"sdr/api/internal/service"
 )
 
+// Identificador del dataset en el clúster
+const datasetID = "movielens"
+
 // @title Sistema Distribuido de Recomendaciones
 // @version 1.0
 // @description API para generar recomendaciones personalizadas utilizando un clúster distribuido de Workers.
@@ -90,6 +93,8 @@ func main() {
 	}
 	cluster := coordinator.NewCoordinatorClient(coordAddr)
 
+	cluster.SetDataset(datasetID, matrixData.Version, matrixData.Matrix)
+
 	mappings := &data.Mappings{
 		UserOriginalToIndex:  userOrigToIdx,
 		UserIndexToOriginal:  userIdxToOrig,
@@ -107,6 +112,29 @@ func main() {
 		genres,
 	)
 
+	// Calificaciones cargadas por la API en ejecuciones anteriores
+	svc.LoadRatings()
+
+	// Recomendaciones en caché de otras versiones del dataset
+	svc.PurgeStaleCache()
+
+	// La matriz se envía una sola vez; las solicitudes solo la referencian
+	// y los cambios de calificaciones viajan como parches
+	go func() {
+		if err := cluster.PushDataset(); err != nil {
+			log.Printf("No se pudo enviar el dataset al coordinador (se reintentará al recomendar): %v", err)
+		}
+	}()
+
+	// Factores ALS: se cargan de Mongo o se entrenan en el clúster
+	go svc.LoadOrTrainALS()
+
+	// Última búsqueda de hiperparámetros y configuración adoptada
+	svc.LoadTuning()
+
+	// Jobs asíncronos que seguían en curso al detenerse la API
+	svc.LoadJobs()
+
 	handler := httpApi.NewHandler(svc)
 	router := mux.NewRouter()
 
@@ -119,6 +147,22 @@ func main() {
 	router.HandleFunc("/users", handler.GetUsers).Methods("GET")
 	router.HandleFunc("/movies", handler.GetMovies).Methods("GET")
 	router.HandleFunc("/genres", handler.GetGenres).Methods("GET")
+	router.HandleFunc("/als", handler.ALSStatus).Methods("GET")
+	router.HandleFunc("/als/train", handler.TrainALS).Methods("POST")
+	router.HandleFunc("/tuning", handler.TuningStatus).Methods("GET")
+	router.HandleFunc("/tuning", handler.StartTuning).Methods("POST")
+	router.HandleFunc("/tuning/adopt", handler.AdoptTuning).Methods("POST")
+	router.HandleFunc("/tuning/adopt", handler.ResetTuning).Methods("DELETE")
+	router.HandleFunc("/jobs", handler.SubmitJob).Methods("POST")
+	router.HandleFunc("/jobs/{id}", handler.GetJob).Methods("GET")
+	router.HandleFunc("/jobs/{id}", handler.CancelJob).Methods("DELETE")
+	router.HandleFunc("/users/{userId}/onboarding", handler.GetOnboarding).Methods("GET")
+	router.HandleFunc("/users/{userId}/onboarding", handler.SaveOnboarding).Methods("PUT")
+	router.HandleFunc("/users/{userId}/ratings", handler.AddRatings).Methods("POST")
+	router.HandleFunc("/users/{userId}/ratings/{movieId}", handler.DeleteRating).Methods("DELETE")
+	router.HandleFunc("/cache", handler.InvalidateCache).Methods("DELETE")
+	router.HandleFunc("/cache/users/{userId}", handler.InvalidateUserCache).Methods("DELETE")
+	router.HandleFunc("/cache/genres/{genre}", handler.InvalidateGenreCache).Methods("DELETE")
 
 	// Rutas Swagger
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
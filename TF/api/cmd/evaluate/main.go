@@ -0,0 +1,175 @@
+// Command evaluate mide la calidad de las recomendaciones offline: divide
+// las calificaciones en entrenamiento y prueba, envía el entrenamiento al
+// clúster como un dataset aparte y pide al coordinador que evalúe las
+// calificaciones de prueba repartiendo los usuarios entre los workers.
+//
+// Uso (dentro del contenedor de la API):
+//
+//	./sdr-evaluate -split leave-k-out -leave 5 -mode user -metric pearson -k 30
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/data"
+	"sdr/cluster/shared/sparse"
+)
+
+// Identificador del dataset de entrenamiento en el clúster (cada ejecución
+// sube una versión nueva; los workers solo conservan las últimas)
+const evalDatasetID = "movielens-eval"
+
+func main() {
+	coordDefault := os.Getenv("COORDINATOR_ADDR")
+	if coordDefault == "" {
+		coordDefault = "sdr_coordinator:8081"
+	}
+
+	var (
+		dsPath    = flag.String("dataset", "/app/dataset", "carpeta con matriz_usuarios_peliculas.csv y los mappings")
+		coordAddr = flag.String("coordinator", coordDefault, "dirección del coordinador")
+
+		split    = flag.String("split", data.SplitRandom, "división: random, leave-k-out o temporal")
+		testFrac = flag.Float64("test-frac", 0.2, "fracción de calificaciones de prueba (random y temporal)")
+		leave    = flag.Int("leave", 1, "calificaciones retenidas por usuario (leave-k-out)")
+		ratings  = flag.String("ratings", "", "CSV con timestamps para el split temporal (por defecto <dataset>/ratings.csv)")
+		seed     = flag.Int64("seed", 42, "semilla de las divisiones al azar")
+
+		k          = flag.Int("k", 20, "vecinos (usuarios, o películas en modo item)")
+		metric     = flag.String("metric", "cosine", "métrica de similitud")
+		mode       = flag.String("mode", "user", "filtrado colaborativo: user o item")
+		norm       = flag.String("normalization", "none", "normalización: none, mean_center o zscore")
+		minOverlap = flag.Int("min-overlap", 0, "películas en común mínimas con un vecino")
+		shrinkage  = flag.Float64("shrinkage", 0, "penalización de vecinos con pocas películas en común")
+		minSim     = flag.Float64("min-similarity", 0, "similitud mínima de un vecino (sin indicar = sin mínimo)")
+		minVoters  = flag.Int("min-voters", 0, "vecinos mínimos que calificaron una película")
+
+		top       = flag.Int("top", 10, "largo de las listas para precision@k, recall@k y NDCG@k")
+		relevance = flag.Float64("relevance", 0, "calificación mínima relevante (0 = la media de cada usuario)")
+		timeout   = flag.Duration("timeout", 30*time.Minute, "plazo de la evaluación en el clúster")
+		asJSON    = flag.Bool("json", false, "imprimir el reporte en JSON")
+	)
+	flag.Parse()
+
+	matrixData, err := data.LoadUserMovieMatrix(*dsPath + "/matriz_usuarios_peliculas.csv")
+	if err != nil {
+		log.Fatalf("Load matrix: %v", err)
+	}
+	matrix := matrixData.Matrix
+
+	start := time.Now()
+	var train, test *sparse.Matrix
+	switch *split {
+	case data.SplitRandom:
+		train, test = data.SplitRandomly(matrix, *testFrac, *seed)
+	case data.SplitLeaveKOut:
+		train, test = data.SplitPerUser(matrix, *leave, *seed)
+	case data.SplitTemporal:
+		train, test, err = temporalSplit(*dsPath, *ratings, matrix, *testFrac)
+		if err != nil {
+			log.Fatalf("Split temporal: %v", err)
+		}
+	default:
+		log.Fatalf("División desconocida: %q (random, leave-k-out o temporal)", *split)
+	}
+	log.Printf("División %s: %d calificaciones de entrenamiento, %d de prueba (%s)",
+		*split, train.NNZ(), test.NNZ(), time.Since(start).Round(time.Millisecond))
+	if test.NNZ() == 0 {
+		log.Fatalf("La división no dejó calificaciones de prueba")
+	}
+
+	cluster := coordinator.NewCoordinatorClient(*coordAddr)
+	defer cluster.Close()
+	cluster.SetDataset(evalDatasetID, time.Now().UnixNano(), train)
+	if err := cluster.PushDataset(); err != nil {
+		log.Fatalf("No se pudo enviar el dataset de entrenamiento al coordinador: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	opts := coordinator.RecommendOptions{
+		K:             *k,
+		Metric:        *metric,
+		Mode:          *mode,
+		Normalization: *norm,
+		Confidence: coordinator.Confidence{
+			MinOverlap:    *minOverlap,
+			Shrinkage:     *shrinkage,
+			MinSimilarity: flagSet("min-similarity", minSim),
+			MinVoters:     *minVoters,
+		},
+	}
+	start = time.Now()
+	report, err := cluster.Evaluate(ctx, opts, coordinator.EvalParams{Test: test, TopK: *top, Relevance: *relevance})
+	if err != nil {
+		log.Fatalf("Evaluación: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if *asJSON {
+		out := map[string]any{
+			"split":      *split,
+			"options":    opts,
+			"report":     report,
+			"elapsed_ms": elapsed.Milliseconds(),
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Printf("Evaluación (%s, modo %s, métrica %s, normalización %s, K=%d) en %s\n",
+		*split, *mode, *metric, *norm, *k, elapsed.Round(time.Millisecond))
+	fmt.Printf("  usuarios evaluados   %d (%d con películas relevantes)\n", report.Users, report.RankedUsers)
+	fmt.Printf("  calificaciones       %d (cobertura %.2f%%)\n", report.TestRatings, 100*report.Coverage)
+	fmt.Printf("  RMSE                 %.4f\n", report.RMSE)
+	fmt.Printf("  MAE                  %.4f\n", report.MAE)
+	fmt.Printf("  precision@%-3d        %.4f\n", report.K, report.PrecisionAtK)
+	fmt.Printf("  recall@%-3d           %.4f\n", report.K, report.RecallAtK)
+	fmt.Printf("  NDCG@%-3d             %.4f\n", report.K, report.NDCGAtK)
+}
+
+// flagSet devuelve v si el flag name se indicó en la línea de comandos y
+// nil si no.
+func flagSet(name string, v *float64) *float64 {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	if !set {
+		return nil
+	}
+	return v
+}
+
+// temporalSplit lee los timestamps de las calificaciones y retiene las más
+// recientes.
+func temporalSplit(dsPath, ratingsPath string, matrix *sparse.Matrix, frac float64) (*sparse.Matrix, *sparse.Matrix, error) {
+	if ratingsPath == "" {
+		ratingsPath = dsPath + "/ratings.csv"
+	}
+	users, _, err := data.LoadMapping(dsPath + "/usuarios_mapping.csv")
+	if err != nil {
+		return nil, nil, fmt.Errorf("load user mapping: %w", err)
+	}
+	movies, _, err := data.LoadMapping(dsPath + "/peliculas_mapping.csv")
+	if err != nil {
+		return nil, nil, fmt.Errorf("load movie mapping: %w", err)
+	}
+	times, err := data.LoadRatingTimes(ratingsPath, users, movies, matrix.Rows, matrix.Cols)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data.SplitByTime(matrix, times, frac)
+}
@@ -17,36 +17,54 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/genres": {
-            "get": {
-                "description": "Devuelve todos los géneros únicos encontrados en las películas",
+        "/cache": {
+            "delete": {
+                "description": "Descarta todas las recomendaciones en caché (con sus métricas y explicaciones)",
                 "tags": [
-                    "Géneros"
+                    "Caché"
                 ],
-                "summary": "Lista de géneros disponibles",
+                "summary": "Vacía la caché de recomendaciones",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/service.CacheInvalidation"
+                        }
+                    },
+                    "500": {
+                        "description": "No se pudo acceder a Redis",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/health": {
-            "get": {
-                "description": "Devuelve 'ok' si el servicio está activo",
+        "/cache/users/{userId}": {
+            "delete": {
+                "description": "Descarta las recomendaciones en caché del usuario (al cargar o borrar sus calificaciones ya se descartan solas)",
                 "tags": [
-                    "Salud"
+                    "Caché"
+                ],
+                "summary": "Descarta la caché de un usuario",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID del usuario",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Verifica el estado del servicio",
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.CacheInvalidation"
+                        }
+                    },
+                    "500": {
+                        "description": "No se pudo acceder a Redis",
                         "schema": {
                             "type": "string"
                         }
@@ -54,95 +72,228 @@ const docTemplate = `{
                 }
             }
         },
-        "/movies": {
-            "get": {
-                "description": "Lista películas con filtro opcional por género y paginación",
+        "/cache/genres/{genre}": {
+            "delete": {
+                "description": "Descarta las recomendaciones en caché pedidas con ese filtro de género",
                 "tags": [
-                    "Películas"
+                    "Caché"
                 ],
-                "summary": "Lista películas",
+                "summary": "Descarta la caché de un género",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Género",
+                        "description": "Género del filtro",
                         "name": "genre",
-                        "in": "query"
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.CacheInvalidation"
+                        }
                     },
+                    "400": {
+                        "description": "Falta el género",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "No se pudo acceder a Redis",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{userId}/ratings": {
+            "post": {
+                "description": "Guarda calificaciones (de 0.5 a 5) del usuario, que puede no estar en el dataset; si ya había calificado la película se reemplaza. Se aplican enseguida a la matriz (los usuarios y las películas del catálogo que no estaban se agregan), el clúster recibe solo los cambios como una versión nueva del dataset y se descartan las recomendaciones en caché del usuario. Hasta 100 por solicitud",
+                "tags": [
+                    "Usuarios"
+                ],
+                "summary": "Carga calificaciones",
+                "parameters": [
                     {
-                        "type": "integer",
-                        "default": 1,
-                        "description": "Página",
-                        "name": "page",
-                        "in": "query"
+                        "type": "string",
+                        "description": "ID del usuario",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
                     },
                     {
-                        "type": "integer",
-                        "default": 20,
-                        "description": "Límite por página",
-                        "name": "limit",
-                        "in": "query"
+                        "description": "Calificaciones",
+                        "name": "ratings",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Rating"
+                            }
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Movie"
-                            }
+                            "$ref": "#/definitions/service.RatingsUpdate"
+                        }
+                    },
+                    "400": {
+                        "description": "Calificaciones inválidas",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/recommend/{userId}": {
-            "get": {
-                "description": "Retorna películas recomendadas para un usuario, con filtros opcionales",
+        "/users/{userId}/ratings/{movieId}": {
+            "delete": {
+                "description": "Borra la calificación del usuario para la película, también si venía del dataset original",
                 "tags": [
-                    "Recomendaciones"
+                    "Usuarios"
                 ],
-                "summary": "Genera recomendaciones filtradas",
+                "summary": "Borra una calificación",
                 "parameters": [
                     {
-                        "type": "integer",
+                        "type": "string",
                         "description": "ID del usuario",
                         "name": "userId",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "default": 10,
-                        "description": "Cantidad de recomendaciones",
-                        "name": "limit",
-                        "in": "query"
+                        "type": "string",
+                        "description": "ID de la película",
+                        "name": "movieId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.RatingsUpdate"
+                        }
+                    },
+                    "404": {
+                        "description": "El usuario no calificó esa película",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{userId}/onboarding": {
+            "get": {
+                "description": "Devuelve el perfil de onboarding del usuario",
+                "tags": [
+                    "Usuarios"
+                ],
+                "summary": "Perfil de onboarding",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID del usuario",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OnboardingProfile"
+                        }
                     },
+                    "404": {
+                        "description": "El usuario no tiene perfil",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Guarda (o reemplaza) los géneros preferidos y unas pocas películas calificadas de un usuario nuevo o con pocas calificaciones, que se usan para recomendarle mientras no tenga suficientes calificaciones propias. Admite hasta 5 géneros (de los que aparecen en /genres, por separado) y 20 películas",
+                "tags": [
+                    "Usuarios"
+                ],
+                "summary": "Guarda el perfil de onboarding",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "Género a filtrar",
-                        "name": "genre",
-                        "in": "query"
+                        "description": "ID del usuario (puede no estar en el dataset)",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Géneros y películas calificadas",
+                        "name": "profile",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.OnboardingProfile"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Movie"
-                            }
+                            "$ref": "#/definitions/models.OnboardingProfile"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Perfil inválido",
                         "schema": {
                             "type": "string"
                         }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "post": {
+                "description": "Encola en el clúster una recomendación (mismos filtros y opciones que /recommend, salvo mode=als) o los usuarios más parecidos a cada usuario, para pedidos que no entran en el plazo de una solicitud HTTP. El estado y el resultado se consultan con GET /jobs/{id}",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Envía un job asíncrono",
+                "parameters": [
+                    {
+                        "description": "Tipo de job y opciones",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.JobRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/service.Job"
+                        }
                     },
-                    "404": {
-                        "description": "Usuario no encontrado",
+                    "400": {
+                        "description": "Solicitud inválida o el clúster la rechazó",
                         "schema": {
                             "type": "string"
                         }
@@ -150,44 +301,1118 @@ const docTemplate = `{
                 }
             }
         },
-        "/users": {
+        "/jobs/{id}": {
             "get": {
-                "description": "Devuelve la lista de usuarios con paginación",
+                "description": "Devuelve el estado (queued, running, done, failed o cancelled), el último avance mientras corre y el resultado cuando termina. Los jobs terminados se conservan un día",
                 "tags": [
-                    "Usuarios"
+                    "Jobs"
                 ],
-                "summary": "Lista usuarios",
+                "summary": "Estado de un job",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "default": 1,
-                        "description": "Página",
-                        "name": "page",
-                        "in": "query"
+                        "type": "string",
+                        "description": "ID del job",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.Job"
+                        }
                     },
+                    "404": {
+                        "description": "Job no encontrado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Cancela el job en la cola o en los workers",
+                "tags": [
+                    "Jobs"
+                ],
+                "summary": "Cancela un job",
+                "parameters": [
                     {
-                        "type": "integer",
-                        "default": 20,
-                        "description": "Límite por página",
-                        "name": "limit",
-                        "in": "query"
+                        "type": "string",
+                        "description": "ID del job",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/service.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Job no encontrado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "El job ya terminó",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
+        },
+        "/als": {
+            "get": {
+                "description": "Devuelve el modelo ALS vigente (sin los factores) y si hay un entrenamiento en curso. Las calificaciones cargadas por la API crean versiones nuevas del dataset; si el modelo quedó atrás (stale), mode=als usa filtrado por usuarios y se reentrena en segundo plano, como mucho cada 10 minutos",
+                "tags": [
+                    "ALS"
+                ],
+                "summary": "Estado del modelo ALS",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.ALSStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/als/train": {
+            "post": {
+                "description": "Lanza en segundo plano el entrenamiento ALS sobre el dataset vigente; al terminar, los factores se guardan en Mongo y se usan en mode=als",
+                "tags": [
+                    "ALS"
+                ],
+                "summary": "Entrena factores ALS en el clúster",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Dimensión de los factores latentes",
+                        "name": "factors",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Iteraciones",
+                        "name": "iterations",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "default": 0.1,
+                        "description": "Regularización (mayor que 0; 0 o vacío usa el valor por defecto)",
+                        "name": "lambda",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/service.ALSStatus"
+                        }
+                    },
+                    "409": {
+                        "description": "Ya hay un entrenamiento en curso",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/genres": {
+            "get": {
+                "description": "Devuelve todos los géneros únicos encontrados en las películas",
+                "tags": [
+                    "Géneros"
+                ],
+                "summary": "Lista de géneros disponibles",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Devuelve 'ok' si el servicio está activo",
+                "tags": [
+                    "Salud"
+                ],
+                "summary": "Verifica el estado del servicio",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/movies": {
+            "get": {
+                "description": "Lista películas con filtro opcional por género y paginación",
+                "tags": [
+                    "Películas"
+                ],
+                "summary": "Lista películas",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Género",
+                        "name": "genre",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Página",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Límite por página",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Movie"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/recommend/{userId}": {
+            "get": {
+                "description": "Retorna películas recomendadas para un usuario, con filtros opcionales. Los usuarios que no están en el dataset o tienen menos de 5 calificaciones reciben una recomendación de arranque en frío (su perfil de onboarding si lo completaron, o las películas más populares en sus géneros o en general); el campo strategy indica cuál se usó (collaborative, onboarding, genre_popularity o global_popularity). Las opciones que no se indican (k, metric, mode, normalization y reglas de confianza) toman los valores de la configuración adoptada con /tuning/adopt, si la hay. Las respuestas se guardan en caché. Las solicitudes iguales que llegan mientras se calcula una comparten el mismo pedido al clúster, y una respuesta vencida se sigue sirviendo unos minutos mientras se recalcula en segundo plano (el campo cache de metrics indica el origen de la respuesta, miss, shared, hit o stale)",
+                "tags": [
+                    "Recomendaciones"
+                ],
+                "summary": "Genera recomendaciones filtradas",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del usuario",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Cantidad de recomendaciones",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Género a filtrar",
+                        "name": "genre",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "cosine",
+                        "description": "Métrica de similitud (cosine, pearson, jaccard, adjusted_cosine)",
+                        "name": "metric",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "user",
+                        "description": "Filtrado colaborativo por usuarios o por ítems en el clúster, o factores ALS (user, item, als)",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Vecinos (usuarios, o películas en modo item); sin indicar, los de la configuración adoptada o limit",
+                        "name": "k",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "none",
+                        "description": "Normalización de las calificaciones antes de comparar (none, mean_center, zscore); no aplica en modo als",
+                        "name": "normalization",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Películas en común mínimas para que un vecino cuente (0 = sin mínimo)",
+                        "name": "min_overlap",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Penaliza vecinos con pocas películas en común: similitud · n/(n+shrinkage) (0 = sin penalización)",
+                        "name": "shrinkage",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Similitud mínima de un vecino (sin indicar = sin mínimo)",
+                        "name": "min_similarity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Vecinos mínimos que calificaron una película para recomendarla (0 = sin mínimo)",
+                        "name": "min_voters",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Incluir por película los vecinos que más aportaron a su puntaje (no aplica en modo als)",
+                        "name": "explain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Movie"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/tuning": {
+            "get": {
+                "description": "Devuelve la última búsqueda con su ranking, si hay una en curso y la configuración adoptada",
+                "tags": [
+                    "Tuning"
+                ],
+                "summary": "Ranking de hiperparámetros",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.TuningStatus"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Lanza en segundo plano una búsqueda en grilla: separa las calificaciones en entrenamiento y prueba, evalúa cada combinación en el clúster y guarda el ranking en Mongo. El cuerpo es opcional; sin grilla se prueban K 10/20/50, cosine/pearson, user/item y none/mean_center",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tuning"
+                ],
+                "summary": "Busca los mejores hiperparámetros en el clúster",
+                "parameters": [
+                    {
+                        "description": "División, grilla y si adoptar la mejor combinación al terminar",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/service.TuneRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/service.TuningStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Solicitud inválida",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Ya hay una búsqueda en curso",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/tuning/adopt": {
+            "post": {
+                "description": "Las recomendaciones pasan a usar la combinación de ese puesto de la última búsqueda para las opciones que no indiquen",
+                "tags": [
+                    "Tuning"
+                ],
+                "summary": "Adopta una combinación del ranking",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Puesto en el ranking",
+                        "name": "rank",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.TunedConfig"
+                        }
+                    },
+                    "400": {
+                        "description": "No hay búsqueda o el puesto no es válido",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Las recomendaciones vuelven a los valores por defecto",
+                "tags": [
+                    "Tuning"
+                ],
+                "summary": "Descarta la configuración adoptada",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "500": {
+                        "description": "No se pudo borrar de Mongo",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "Devuelve la lista de usuarios con paginación",
+                "tags": [
+                    "Usuarios"
+                ],
+                "summary": "Lista usuarios",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Página",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Límite por página",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "service.CacheInvalidation": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Rating": {
+            "type": "object",
+            "properties": {
+                "movieId": {
+                    "type": "string"
+                },
+                "rating": {
+                    "type": "number"
+                }
+            }
+        },
+        "service.RatingsUpdate": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                },
+                "userIndex": {
+                    "type": "integer"
+                },
+                "newUser": {
+                    "type": "boolean"
+                },
+                "newMovies": {
+                    "type": "integer"
+                },
+                "ratings": {
+                    "type": "integer"
+                },
+                "datasetVersion": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OnboardingProfile": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                },
+                "genres": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ratings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.OnboardingRating"
+                    }
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.OnboardingRating": {
+            "type": "object",
+            "properties": {
+                "movieId": {
+                    "type": "string"
+                },
+                "rating": {
+                    "type": "number"
+                }
+            }
+        },
+        "service.JobRequest": {
+            "type": "object",
+            "properties": {
+                "type": {
+                    "type": "string",
+                    "description": "recommendation o similarity"
+                },
+                "userId": {
+                    "type": "string",
+                    "description": "Solo recommendation"
+                },
+                "limit": {
+                    "type": "integer",
+                    "description": "Películas a devolver (0 = 10)"
+                },
+                "genre": {
+                    "type": "string"
+                },
+                "metric": {
+                    "type": "string",
+                    "description": "cosine, pearson, jaccard o adjusted_cosine (vacío = configuración adoptada o cosine)"
+                },
+                "mode": {
+                    "type": "string",
+                    "description": "user o item"
+                },
+                "k": {
+                    "type": "integer",
+                    "description": "Vecinos (0 = configuración adoptada o limit); en similarity, vecinos por usuario (0 = 20)"
+                },
+                "normalization": {
+                    "type": "string",
+                    "description": "none, mean_center o zscore"
+                },
+                "explain": {
+                    "type": "boolean"
+                },
+                "minOverlap": {
+                    "type": "integer"
+                },
+                "shrinkage": {
+                    "type": "number"
+                },
+                "minSimilarity": {
+                    "type": "number"
+                },
+                "minVoters": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.Job": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "request": {
+                    "$ref": "#/definitions/service.JobRequest"
+                },
+                "state": {
+                    "type": "string",
+                    "description": "queued, running, done, failed o cancelled"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "datasetId": {
+                    "type": "string"
+                },
+                "datasetVersion": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "startedAt": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "progress": {
+                    "$ref": "#/definitions/models.RecommendProgress"
+                },
+                "result": {
+                    "$ref": "#/definitions/service.JobResult"
+                }
+            }
+        },
+        "models.RecommendProgress": {
+            "type": "object",
+            "description": "Último avance del clúster (solo mientras corre)",
+            "properties": {
+                "phase": {
+                    "type": "string"
+                },
+                "percent": {
+                    "type": "number"
+                },
+                "done": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "movies": {
+                    "type": "array",
+                    "description": "Top-N parcial (recomendación en modo user)",
+                    "items": {
+                        "$ref": "#/definitions/models.Movie"
+                    }
+                },
+                "workers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WorkerTiming"
+                    }
+                }
+            }
+        },
+        "models.WorkerTiming": {
+            "type": "object",
+            "properties": {
+                "worker": {
+                    "type": "string"
+                },
+                "chunks": {
+                    "type": "integer"
+                },
+                "totalMs": {
+                    "type": "integer"
+                },
+                "maxMs": {
+                    "type": "integer"
+                }
+            }
+        },
+        "service.JobResult": {
+            "type": "object",
+            "properties": {
+                "movies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Movie"
+                    }
+                },
+                "explanations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Explanation"
+                    }
+                },
+                "similarity": {
+                    "$ref": "#/definitions/service.UserNeighbors"
+                }
+            }
+        },
+        "service.UserNeighbors": {
+            "type": "object",
+            "properties": {
+                "metric": {
+                    "type": "string"
+                },
+                "normalization": {
+                    "type": "string"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.UserSimilarity"
+                    }
+                }
+            }
+        },
+        "service.UserSimilarity": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                },
+                "neighbors": {
+                    "type": "array",
+                    "description": "Usuarios más parecidos, de mayor a menor similitud",
+                    "items": {
+                        "$ref": "#/definitions/service.SimilarUser"
+                    }
+                }
+            }
+        },
+        "service.SimilarUser": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                },
+                "similarity": {
+                    "type": "number"
+                }
+            }
+        },
+        "service.TuneRequest": {
+            "type": "object",
+            "properties": {
+                "split": {
+                    "type": "string",
+                    "description": "random o leave-k-out (vacío = random)"
+                },
+                "testFrac": {
+                    "type": "number",
+                    "description": "Fracción de prueba en random (0 = 0.2)"
+                },
+                "leave": {
+                    "type": "integer",
+                    "description": "Calificaciones retenidas por usuario en leave-k-out (0 = 1)"
+                },
+                "seed": {
+                    "type": "integer",
+                    "description": "Semilla de la división (0 = 42)"
+                },
+                "topK": {
+                    "type": "integer",
+                    "description": "Largo de las listas evaluadas (0 = 10)"
+                },
+                "relevance": {
+                    "type": "number",
+                    "description": "Calificación mínima relevante (0 = media de cada usuario)"
+                },
+                "grid": {
+                    "$ref": "#/definitions/coordinator.TuneParams"
+                },
+                "adopt": {
+                    "type": "boolean",
+                    "description": "Adoptar la mejor combinación al terminar"
+                }
+            }
+        },
+        "coordinator.TuneParams": {
+            "type": "object",
+            "properties": {
+                "k": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "metrics": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "modes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "normalizations": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "minOverlap": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "shrinkage": {
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "minSimilarity": {
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "minVoters": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "objective": {
+                    "type": "string",
+                    "description": "Métrica que ordena el ranking: ndcg (por defecto), precision, recall, rmse o mae"
+                },
+                "parallel": {
+                    "type": "integer",
+                    "description": "Combinaciones evaluadas a la vez (0 = una por worker)"
+                }
+            }
+        },
+        "coordinator.TuneConfig": {
+            "type": "object",
+            "properties": {
+                "k": {
+                    "type": "integer"
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "mode": {
+                    "type": "string"
+                },
+                "normalization": {
+                    "type": "string"
+                },
+                "minOverlap": {
+                    "type": "integer"
+                },
+                "shrinkage": {
+                    "type": "number"
+                },
+                "minSimilarity": {
+                    "type": "number"
+                },
+                "minVoters": {
+                    "type": "integer"
+                }
+            }
+        },
+        "coordinator.EvalReport": {
+            "type": "object",
+            "properties": {
+                "rmse": {
+                    "type": "number"
+                },
+                "mae": {
+                    "type": "number"
+                },
+                "coverage": {
+                    "type": "number",
+                    "description": "Fracción de calificaciones de prueba predichas"
+                },
+                "precisionAtK": {
+                    "type": "number"
+                },
+                "recallAtK": {
+                    "type": "number"
+                },
+                "ndcgAtK": {
+                    "type": "number"
+                },
+                "k": {
+                    "type": "integer"
+                },
+                "users": {
+                    "type": "integer"
+                },
+                "rankedUsers": {
+                    "type": "integer"
+                },
+                "testRatings": {
+                    "type": "integer"
+                }
+            }
+        },
+        "coordinator.TuneTrial": {
+            "type": "object",
+            "properties": {
+                "rank": {
+                    "type": "integer",
+                    "description": "1 = la mejor; las fallidas van al final"
+                },
+                "config": {
+                    "$ref": "#/definitions/coordinator.TuneConfig"
+                },
+                "score": {
+                    "type": "number",
+                    "description": "Valor del objetivo"
+                },
+                "report": {
+                    "$ref": "#/definitions/coordinator.EvalReport"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "elapsedMs": {
+                    "type": "integer"
+                }
+            }
+        },
+        "coordinator.Leaderboard": {
+            "type": "object",
+            "properties": {
+                "objective": {
+                    "type": "string"
+                },
+                "topK": {
+                    "type": "integer"
+                },
+                "trials": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinator.TuneTrial"
+                    }
+                }
+            }
+        },
+        "service.TuningResult": {
+            "type": "object",
+            "properties": {
+                "datasetId": {
+                    "type": "string"
+                },
+                "datasetVersion": {
+                    "type": "integer"
+                },
+                "request": {
+                    "$ref": "#/definitions/service.TuneRequest"
+                },
+                "trainRatings": {
+                    "type": "integer"
+                },
+                "testRatings": {
+                    "type": "integer"
+                },
+                "startedAt": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "leaderboard": {
+                    "$ref": "#/definitions/coordinator.Leaderboard"
+                }
+            }
+        },
+        "service.TunedConfig": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "$ref": "#/definitions/coordinator.TuneConfig"
+                },
+                "objective": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "datasetId": {
+                    "type": "string"
+                },
+                "datasetVersion": {
+                    "type": "integer"
+                },
+                "adoptedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.TuningStatus": {
+            "type": "object",
+            "properties": {
+                "running": {
+                    "type": "boolean"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "latest": {
+                    "$ref": "#/definitions/service.TuningResult"
+                },
+                "adopted": {
+                    "$ref": "#/definitions/service.TunedConfig"
+                }
+            }
+        },
+        "service.ALSStatus": {
+            "type": "object",
+            "properties": {
+                "ready": {
+                    "type": "boolean"
+                },
+                "training": {
+                    "type": "boolean"
+                },
+                "stale": {
+                    "type": "boolean",
+                    "description": "Entrenado con una versión anterior del dataset (hubo calificaciones nuevas): mode=als usa filtrado por usuarios hasta que se reentrene en segundo plano"
+                },
+                "datasetId": {
+                    "type": "string"
+                },
+                "datasetVersion": {
+                    "type": "integer"
+                },
+                "params": {
+                    "type": "object",
+                    "properties": {
+                        "factors": {
+                            "type": "integer"
+                        },
+                        "iterations": {
+                            "type": "integer"
+                        },
+                        "lambda": {
+                            "type": "number"
+                        },
+                        "seed": {
+                            "type": "integer"
+                        }
+                    }
+                },
+                "rmse": {
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "trainedAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Explanation": {
+            "type": "object",
+            "properties": {
+                "movieId": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "neighbors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.NeighborEvidence"
+                    }
+                },
+                "because": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RatedMovieEvidence"
+                    }
+                }
+            }
+        },
+        "models.NeighborEvidence": {
+            "type": "object",
+            "properties": {
+                "userId": {
+                    "type": "string"
+                },
+                "similarity": {
+                    "type": "number"
+                },
+                "rating": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.RatedMovieEvidence": {
+            "type": "object",
+            "properties": {
+                "movie": {
+                    "$ref": "#/definitions/models.Movie"
+                },
+                "similarity": {
+                    "type": "number"
+                },
+                "rating": {
+                    "type": "number"
+                }
+            }
+        },
         "models.Movie": {
             "type": "object",
             "properties": {
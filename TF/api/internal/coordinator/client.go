@@ -1,46 +1,586 @@
 package coordinator
 
 import (
-	"encoding/json"
-	"net"
+	"context"
+	"fmt"
+	"log"
+	"sync"
 	"time"
+
+	"sdr/cluster/shared/protocol"
+	"sdr/cluster/shared/sparse"
 )
 
 type CoordinatorRequest struct {
-	Type      string      `json:"type"`
-	Matrix    [][]float64 `json:"matrix,omitempty"`
-	UserIndex int         `json:"userIndex"`
-	K         int         `json:"k,omitempty"`
+	Type           string         `json:"type"`
+	DatasetID      string         `json:"datasetId"`
+	DatasetVersion int64          `json:"datasetVersion"`
+	TargetRow      *sparse.Vector `json:"targetRow,omitempty"`
+	UserIndex      int            `json:"userIndex"`
+	K              int            `json:"k,omitempty"`
+	N              int            `json:"n,omitempty"` // películas a devolver; el clúster solo envía las N mejores
+	Metric         string         `json:"metric,omitempty"`
+	Normalization  string         `json:"normalization,omitempty"`
+	Mode           string         `json:"mode,omitempty"` // "user" o "item"
+	DeadlineMs     int64          `json:"deadlineMs,omitempty"`
+	ALS            *ALSParams     `json:"als,omitempty"`  // solo para TRAIN_ALS
+	Eval           *EvalParams    `json:"eval,omitempty"` // solo para EVALUATE y TUNE
+	Tune           *TuneParams    `json:"tune,omitempty"` // solo para TUNE
+	Explain        int            `json:"explain,omitempty"`
+	Progress       bool           `json:"progress,omitempty"` // pedir avances parciales
+	Async          bool           `json:"async,omitempty"`    // encolar como job (ver JobStatus)
+	JobID          string         `json:"jobId,omitempty"`    // solo para JOB_STATUS y JOB_CANCEL
+
+	Confidence // reglas de confianza (cero = desactivadas)
+}
+
+// Confidence son las reglas de confianza de una recomendación; cada una
+// queda desactivada en cero, salvo MinSimilarity, que se desactiva en nil.
+type Confidence struct {
+	MinOverlap    int      `json:"minOverlap,omitempty"`    // películas en común mínimas con un vecino
+	Shrinkage     float64  `json:"shrinkage,omitempty"`     // similitud · n/(n+Shrinkage), n = películas en común
+	MinSimilarity *float64 `json:"minSimilarity,omitempty"` // similitud mínima de un vecino (nil = sin mínimo)
+	MinVoters     int      `json:"minVoters,omitempty"`     // vecinos mínimos que calificaron una película
 }
 
 type CoordinatorResponse struct {
-	Indexes []int `json:"indexes"`
+	Result    []float64    `json:"result,omitempty"`    // recomendación con N = 0: vector completo
+	Neighbors [][]Neighbor `json:"neighbors,omitempty"` // similitud: K usuarios más parecidos a cada usuario
+	Indexes   []int        `json:"indexes"`
+	Items     []ScoredItem `json:"items,omitempty"`
+	Model     *FactorModel `json:"model,omitempty"`
+	Eval      *EvalReport  `json:"eval,omitempty"`
+	Tune      *Leaderboard `json:"tune,omitempty"`
+	Job       *JobStatus   `json:"job,omitempty"`
+}
+
+// Neighbor es un usuario parecido (índice interno de la matriz) con su
+// similitud.
+type Neighbor struct {
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+}
+
+// ScoredItem es una película recomendada con su puntaje predicho y, si se
+// pidió, los vecinos que más aportaron a ese puntaje.
+type ScoredItem struct {
+	Index   int            `json:"index"`
+	Score   float64        `json:"score"`
+	Because []Contribution `json:"because,omitempty"`
+}
+
+// Contribution es el aporte de un vecino a la predicción: en modo user un
+// usuario parecido que calificó la película; en modo item una película
+// parecida que calificó el usuario. Index es el índice interno de la matriz.
+type Contribution struct {
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+	Rating     float64 `json:"rating"`
+	Weight     float64 `json:"weight"`
+}
+
+// Progress es un avance parcial de una recomendación en el clúster: se
+// recibe cada vez que un worker completa un chunk, antes de la respuesta.
+type Progress struct {
+	Phase   string         `json:"phase"`   // NEIGHBORS, PARTIAL o TOP_N
+	Done    int            `json:"done"`    // chunks completados
+	Total   int            `json:"total"`   // chunks previstos
+	Percent float64        `json:"percent"` // 100·Done/Total
+	Items   []ScoredItem   `json:"items,omitempty"`
+	Workers []WorkerTiming `json:"workers"`
+}
+
+// WorkerTiming son los tiempos de los chunks que completó un worker.
+type WorkerTiming struct {
+	Worker  string `json:"worker"`
+	Chunks  int    `json:"chunks"`
+	TotalMs int64  `json:"totalMs"`
+	MaxMs   int64  `json:"maxMs"`
+}
+
+// ALSParams son los parámetros del entrenamiento ALS (cero = valor por
+// defecto del coordinador; Lambda tiene que ser mayor que cero).
+type ALSParams struct {
+	Factors    int     `json:"factors,omitempty"`
+	Iterations int     `json:"iterations,omitempty"`
+	Lambda     float64 `json:"lambda,omitempty"`
+	Seed       int64   `json:"seed,omitempty"`
+}
+
+// FactorModel son los factores latentes entrenados en el clúster: el puntaje
+// de la película j para el usuario i es UserFactors[i]·ItemFactors[j].
+type FactorModel struct {
+	DatasetID      string      `json:"datasetId"`
+	DatasetVersion int64       `json:"datasetVersion"`
+	Params         ALSParams   `json:"params"`
+	UserFactors    [][]float64 `json:"userFactors"`
+	ItemFactors    [][]float64 `json:"itemFactors"`
+	RMSE           []float64   `json:"rmse"`
+	TrainedAt      time.Time   `json:"trainedAt"` // lo completa la API
+}
+
+// EvalParams son las calificaciones retenidas de una evaluación offline:
+// el dataset vigente tiene solo las de entrenamiento y Test, con las mismas
+// dimensiones, las de prueba.
+type EvalParams struct {
+	Test      *sparse.Matrix `json:"test"`
+	TopK      int            `json:"topK,omitempty"`      // largo de las listas evaluadas (0 = 10)
+	Relevance float64        `json:"relevance,omitempty"` // calificación mínima relevante (0 = media de cada usuario)
+}
+
+// EvalReport son las métricas de una evaluación offline.
+type EvalReport struct {
+	RMSE         float64 `json:"rmse"`
+	MAE          float64 `json:"mae"`
+	Coverage     float64 `json:"coverage"` // fracción de calificaciones de prueba predichas
+	PrecisionAtK float64 `json:"precisionAtK"`
+	RecallAtK    float64 `json:"recallAtK"`
+	NDCGAtK      float64 `json:"ndcgAtK"`
+	K            int     `json:"k"`
+	Users        int     `json:"users"`
+	RankedUsers  int     `json:"rankedUsers"`
+	TestRatings  int     `json:"testRatings"`
+}
+
+// TuneParams es la grilla de una búsqueda de hiperparámetros: se evalúan
+// todas las combinaciones de los valores de cada lista. Una lista vacía
+// deja el valor de las opciones base de la búsqueda.
+type TuneParams struct {
+	K              []int     `json:"k,omitempty"`
+	Metrics        []string  `json:"metrics,omitempty"`
+	Modes          []string  `json:"modes,omitempty"` // user o item
+	Normalizations []string  `json:"normalizations,omitempty"`
+	MinOverlap     []int     `json:"minOverlap,omitempty"`
+	Shrinkage      []float64 `json:"shrinkage,omitempty"`
+	MinSimilarity  []float64 `json:"minSimilarity,omitempty"`
+	MinVoters      []int     `json:"minVoters,omitempty"`
+
+	Objective string `json:"objective,omitempty"` // ndcg (por defecto), precision, recall, rmse o mae
+	Parallel  int    `json:"parallel,omitempty"`  // combinaciones evaluadas a la vez (0 = una por worker)
+}
+
+// TuneConfig es una combinación de hiperparámetros.
+type TuneConfig struct {
+	K             int    `json:"k"`
+	Metric        string `json:"metric"`
+	Mode          string `json:"mode"`
+	Normalization string `json:"normalization"`
+
+	Confidence
+}
+
+// TuneTrial es el resultado de una combinación.
+type TuneTrial struct {
+	Rank      int         `json:"rank"` // 1 = la mejor; las fallidas van al final
+	Config    TuneConfig  `json:"config"`
+	Score     float64     `json:"score"` // valor del objetivo
+	Report    *EvalReport `json:"report,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ElapsedMs int64       `json:"elapsedMs"`
+}
+
+// Leaderboard es el ranking de una búsqueda, de la mejor combinación a la peor.
+type Leaderboard struct {
+	Objective string      `json:"objective"`
+	TopK      int         `json:"topK"`
+	Trials    []TuneTrial `json:"trials"`
+}
+
+// Estados de un job en el coordinador
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobStatus es el estado de un job asíncrono en el coordinador; Result solo
+// viene al consultar un job terminado.
+type JobStatus struct {
+	ID         string               `json:"id"`
+	Type       string               `json:"type"`
+	State      string               `json:"state"`
+	Progress   *Progress            `json:"progress,omitempty"`
+	Result     *CoordinatorResponse `json:"result,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	CreatedMs  int64                `json:"createdMs"`
+	StartedMs  int64                `json:"startedMs,omitempty"`
+	FinishedMs int64                `json:"finishedMs,omitempty"`
+}
+
+// Terminal indica si el job ya no va a cambiar de estado.
+func (j JobStatus) Terminal() bool {
+	return j.State == JobDone || j.State == JobFailed || j.State == JobCancelled
+}
+
+// Dataset es la matriz versionada (en CSR) que se envía una sola vez al
+// coordinador, que la reparte a los workers; las solicitudes solo la
+// referencian.
+type Dataset struct {
+	ID      string         `json:"id"`
+	Version int64          `json:"version"`
+	Matrix  *sparse.Matrix `json:"matrix"`
+}
+
+// DatasetRef identifica una versión de un dataset sin su matriz.
+type DatasetRef struct {
+	ID      string `json:"id"`
+	Version int64  `json:"version"`
 }
 
+// CoordinatorClient mantiene un pool de conexiones persistentes con el
+// coordinador; varias recomendaciones concurrentes comparten esas conexiones.
 type CoordinatorClient struct {
 	Addr        string
 	DialTimeout time.Duration
+	// Plazo de cada solicitud; al vencer se cancela en el coordinador y los
+	// workers. Debe ser menor que el WriteTimeout del servidor HTTP.
+	RequestTimeout time.Duration
+	pool           *protocol.Pool
+
+	mu      sync.RWMutex
+	dataset *Dataset // dataset vigente que referencian las solicitudes
 }
 
+// Conexiones persistentes abiertas hacia el coordinador
+const poolSize = 4
+
+// Plazo por defecto de una solicitud al clúster
+const defaultRequestTimeout = 25 * time.Second
+
 func NewCoordinatorClient(addr string) *CoordinatorClient {
-	return &CoordinatorClient{Addr: addr, DialTimeout: 5 * time.Second}
+	timeout := 5 * time.Second
+	return &CoordinatorClient{
+		Addr:           addr,
+		DialTimeout:    timeout,
+		RequestTimeout: defaultRequestTimeout,
+		pool:           protocol.NewPool(addr, poolSize, timeout),
+	}
+}
+
+// SetDataset fija el dataset vigente que referencian las solicitudes.
+func (c *CoordinatorClient) SetDataset(id string, version int64, matrix *sparse.Matrix) {
+	c.mu.Lock()
+	c.dataset = &Dataset{ID: id, Version: version, Matrix: matrix}
+	c.mu.Unlock()
+}
+
+// PushDataset envía el dataset vigente al coordinador. Si falla, se volverá
+// a enviar cuando el coordinador lo pida.
+func (c *CoordinatorClient) PushDataset() error {
+	c.mu.RLock()
+	ds := c.dataset
+	c.mu.RUnlock()
+
+	if ds == nil {
+		return fmt.Errorf("no hay dataset cargado")
+	}
+	return c.pushDataset(ds)
+}
+
+func (c *CoordinatorClient) pushDataset(ds *Dataset) error {
+	log.Printf("Enviando dataset %s v%d al coordinador", ds.ID, ds.Version)
+	return c.pool.Call(protocol.MsgDataset, ds, nil)
+}
+
+// ForgetDataset avisa al coordinador que el dataset de este cliente ya no
+// se usará, para que lo descarte junto con las copias de los workers. Es
+// para datasets temporales (ver WithDataset), no para el vigente.
+func (c *CoordinatorClient) ForgetDataset() error {
+	c.mu.RLock()
+	ds := c.dataset
+	c.mu.RUnlock()
+
+	if ds == nil {
+		return fmt.Errorf("no hay dataset cargado")
+	}
+
+	log.Printf("Descartando dataset %s v%d en el coordinador", ds.ID, ds.Version)
+	return c.pool.Call(protocol.MsgForget, DatasetRef{ID: ds.ID, Version: ds.Version}, nil)
+}
+
+// DatasetPatch son los cambios que llevan el dataset de BaseVersion a
+// Version: calificaciones nuevas, cambiadas o borradas (valor 0), y filas o
+// columnas nuevas al final.
+type DatasetPatch struct {
+	ID          string        `json:"id"`
+	BaseVersion int64         `json:"baseVersion"`
+	Version     int64         `json:"version"`
+	Rows        int           `json:"rows"`
+	Cols        int           `json:"cols"`
+	Cells       []sparse.Cell `json:"cells"`
+}
+
+// PushPatch envía al coordinador los cambios que llevan el dataset de
+// patch.BaseVersion a patch.Version, que ya debe ser el vigente (ver
+// SetDataset). Si el coordinador no tiene la versión base se le envía el
+// dataset vigente completo.
+func (c *CoordinatorClient) PushPatch(patch DatasetPatch) error {
+	log.Printf("Enviando cambios del dataset %s v%d -> v%d al coordinador (%d celdas)", patch.ID, patch.BaseVersion, patch.Version, len(patch.Cells))
+	err := c.pool.Call(protocol.MsgPatch, patch, nil)
+	if protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		return c.PushDataset()
+	}
+	return err
+}
+
+// NextVersion devuelve una versión de dataset posterior a version. Se basa
+// en el reloj para que, tras reiniciar la API, no se repita una versión que
+// el clúster ya tiene con otro contenido.
+func NextVersion(version int64) int64 {
+	return max(version+1, time.Now().UnixNano())
 }
 
-func (c *CoordinatorClient) RequestRecommendations(userIndex int, matrix [][]float64, k int) ([]int, error) {
-	conn, err := net.DialTimeout("tcp", c.Addr, c.DialTimeout)
-	if err != nil {
+// RecommendOptions son los parámetros de una recomendación en el clúster.
+type RecommendOptions struct {
+	K      int    // vecinos (usuarios, o películas en modo item)
+	N      int    // películas a devolver
+	Metric string // métrica de similitud (vacío = coseno)
+	Mode   string // filtrado colaborativo "user" o "item" (vacío = user)
+
+	Normalization string     // normalización de las calificaciones (vacío = ninguna)
+	Confidence    Confidence // reglas de confianza (cero = desactivadas)
+	Explain       int        // aportes a informar por película (0 = sin explicación)
+
+	// OnProgress recibe los avances parciales (top-N combinado hasta ahora y
+	// tiempos por worker) mientras el clúster trabaja; nil = sin avances.
+	// Corre en la goroutine lectora de la conexión, así que no debe bloquear.
+	OnProgress func(Progress)
+}
+
+// RequestRecommendations pide al clúster las opts.N mejores películas para
+// el usuario; las devuelve de mayor a menor puntaje. Si ctx se cancela (el
+// cliente HTTP se desconectó) o no responde dentro de RequestTimeout, la
+// solicitud se cancela en el coordinador y los workers.
+func (c *CoordinatorClient) RequestRecommendations(ctx context.Context, userIndex int, target sparse.Vector, opts RecommendOptions) ([]ScoredItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.RequestTimeout)
+	defer cancel()
+
+	req := CoordinatorRequest{
+		Type:          "RECOMMENDATION",
+		TargetRow:     &target,
+		UserIndex:     userIndex,
+		K:             opts.K,
+		N:             opts.N,
+		Metric:        opts.Metric,
+		Normalization: opts.Normalization,
+		Mode:          opts.Mode,
+		Confidence:    opts.Confidence,
+		Explain:       opts.Explain,
+		Progress:      opts.OnProgress != nil,
+	}
+
+	var onFrame func(protocol.Frame)
+	if opts.OnProgress != nil {
+		onFrame = func(f protocol.Frame) {
+			var p Progress
+			if err := f.Decode(&p); err != nil {
+				log.Printf("Avance del clúster inválido: %v", err)
+				return
+			}
+			opts.OnProgress(p)
+		}
+	}
+
+	var resp CoordinatorResponse
+	if err := c.callStream(ctx, req, &resp, onFrame); err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	req := CoordinatorRequest{Type: "RECOMMENDATION", Matrix: matrix, UserIndex: userIndex, K: k}
-	data, _ := json.Marshal(req)
-	conn.Write(data)
-	conn.(*net.TCPConn).CloseWrite()
+	if len(resp.Items) > 0 {
+		return resp.Items, nil
+	}
+	// con N = 0 el clúster solo devuelve el orden
+	items := make([]ScoredItem, len(resp.Indexes))
+	for i, idx := range resp.Indexes {
+		items[i] = ScoredItem{Index: idx}
+	}
+	return items, nil
+}
+
+// TrainALS pide al clúster entrenar factores latentes con ALS sobre el
+// dataset vigente. Puede tardar bastante más que una recomendación, así que
+// el plazo lo fija ctx.
+func (c *CoordinatorClient) TrainALS(ctx context.Context, params ALSParams) (*FactorModel, error) {
+	req := CoordinatorRequest{
+		Type: "TRAIN_ALS",
+		ALS:  &params,
+	}
 
 	var resp CoordinatorResponse
-	dec := json.NewDecoder(conn)
-	if err := dec.Decode(&resp); err != nil {
+	if err := c.call(ctx, req, &resp); err != nil {
 		return nil, err
 	}
-	return resp.Indexes, nil
+	if resp.Model == nil {
+		return nil, fmt.Errorf("el coordinador no devolvió el modelo ALS")
+	}
+	return resp.Model, nil
+}
+
+// Evaluate evalúa en el clúster las recomendaciones con las opciones de opts
+// (K, Metric, Mode, Normalization y Confidence; modos user e item): el
+// dataset vigente debe ser el de entrenamiento. El plazo lo fija ctx.
+func (c *CoordinatorClient) Evaluate(ctx context.Context, opts RecommendOptions, params EvalParams) (*EvalReport, error) {
+	req := CoordinatorRequest{
+		Type:          "EVALUATE",
+		K:             opts.K,
+		Metric:        opts.Metric,
+		Normalization: opts.Normalization,
+		Mode:          opts.Mode,
+		Confidence:    opts.Confidence,
+		Eval:          &params,
+	}
+
+	var resp CoordinatorResponse
+	if err := c.call(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Eval == nil {
+		return nil, fmt.Errorf("el coordinador no devolvió la evaluación")
+	}
+	return resp.Eval, nil
+}
+
+// Tune busca en el clúster la mejor combinación de la grilla: cada una se
+// evalúa como en Evaluate (opts son los valores de las listas vacías) y se
+// devuelve el ranking. El plazo lo fija ctx.
+func (c *CoordinatorClient) Tune(ctx context.Context, opts RecommendOptions, params EvalParams, grid TuneParams) (*Leaderboard, error) {
+	req := CoordinatorRequest{
+		Type:          "TUNE",
+		K:             opts.K,
+		Metric:        opts.Metric,
+		Normalization: opts.Normalization,
+		Mode:          opts.Mode,
+		Confidence:    opts.Confidence,
+		Eval:          &params,
+		Tune:          &grid,
+	}
+
+	var resp CoordinatorResponse
+	if err := c.call(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Tune == nil {
+		return nil, fmt.Errorf("el coordinador no devolvió el ranking de la búsqueda")
+	}
+	return resp.Tune, nil
+}
+
+// SubmitRecommendation encola en el coordinador una recomendación como job
+// y devuelve su estado inicial; el resultado se consulta con JobStatus.
+// opts.OnProgress no se usa: los avances quedan en el estado del job.
+func (c *CoordinatorClient) SubmitRecommendation(ctx context.Context, userIndex int, target sparse.Vector, opts RecommendOptions) (*JobStatus, error) {
+	return c.submit(ctx, CoordinatorRequest{
+		Type:          "RECOMMENDATION",
+		TargetRow:     &target,
+		UserIndex:     userIndex,
+		K:             opts.K,
+		N:             opts.N,
+		Metric:        opts.Metric,
+		Normalization: opts.Normalization,
+		Mode:          opts.Mode,
+		Confidence:    opts.Confidence,
+		Explain:       opts.Explain,
+	})
+}
+
+// SubmitSimilarity encola en el coordinador el cálculo de los k usuarios
+// más parecidos a cada usuario del dataset vigente (0 = los del
+// coordinador).
+func (c *CoordinatorClient) SubmitSimilarity(ctx context.Context, k int, metric, normalization string) (*JobStatus, error) {
+	return c.submit(ctx, CoordinatorRequest{
+		Type:          "SIMILARITY",
+		K:             k,
+		Metric:        metric,
+		Normalization: normalization,
+	})
+}
+
+func (c *CoordinatorClient) submit(ctx context.Context, req CoordinatorRequest) (*JobStatus, error) {
+	req.Async = true
+	return c.job(ctx, req)
+}
+
+// JobStatus consulta el estado (y, si terminó, el resultado) de un job. Si
+// el coordinador no lo conoce devuelve un RemoteError con CodeJobNotFound.
+func (c *CoordinatorClient) JobStatus(ctx context.Context, id string) (*JobStatus, error) {
+	return c.job(ctx, CoordinatorRequest{Type: "JOB_STATUS", JobID: id})
+}
+
+// CancelJob cancela un job en la cola o en los workers.
+func (c *CoordinatorClient) CancelJob(ctx context.Context, id string) (*JobStatus, error) {
+	return c.job(ctx, CoordinatorRequest{Type: "JOB_CANCEL", JobID: id})
+}
+
+func (c *CoordinatorClient) job(ctx context.Context, req CoordinatorRequest) (*JobStatus, error) {
+	var resp CoordinatorResponse
+	if err := c.call(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Job == nil {
+		return nil, fmt.Errorf("el coordinador no devolvió el estado del job")
+	}
+	return resp.Job, nil
+}
+
+// WithDataset devuelve un cliente que comparte las conexiones de c pero
+// referencia otro dataset (por ejemplo, el de entrenamiento de una
+// evaluación). No hay que cerrarlo: las conexiones son las de c.
+func (c *CoordinatorClient) WithDataset(id string, version int64, matrix *sparse.Matrix) *CoordinatorClient {
+	return &CoordinatorClient{
+		Addr:           c.Addr,
+		DialTimeout:    c.DialTimeout,
+		RequestTimeout: c.RequestTimeout,
+		pool:           c.pool,
+		dataset:        &Dataset{ID: id, Version: version, Matrix: matrix},
+	}
+}
+
+// Dataset devuelve el ID y la versión del dataset vigente.
+func (c *CoordinatorClient) Dataset() (string, int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.dataset == nil {
+		return "", 0, false
+	}
+	return c.dataset.ID, c.dataset.Version, true
+}
+
+// call envía req referenciando el dataset vigente y con el plazo de ctx.
+// Si el coordinador no tiene el dataset (se reinició o no lo recibió) se lo
+// reenvía y se repite la solicitud una vez.
+func (c *CoordinatorClient) call(ctx context.Context, req CoordinatorRequest, resp *CoordinatorResponse) error {
+	return c.callStream(ctx, req, resp, nil)
+}
+
+// callStream es como call pero entrega a onProgress los avances parciales.
+func (c *CoordinatorClient) callStream(ctx context.Context, req CoordinatorRequest, resp *CoordinatorResponse, onProgress func(protocol.Frame)) error {
+	c.mu.RLock()
+	ds := c.dataset
+	c.mu.RUnlock()
+	if ds == nil {
+		return fmt.Errorf("no hay dataset cargado")
+	}
+
+	req.DatasetID = ds.ID
+	req.DatasetVersion = ds.Version
+	req.DeadlineMs = protocol.DeadlineMs(ctx)
+
+	err := c.pool.CallStream(ctx, protocol.MsgTask, req, resp, onProgress)
+	if protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		// se reenvía la misma versión y no la vigente: req (p. ej. TargetRow)
+		// se armó con esa matriz. Si el coordinador ya tiene una más nueva
+		// descarta el envío y la solicitud vuelve a fallar
+		if err := c.pushDataset(ds); err != nil {
+			return err
+		}
+		err = c.pool.CallStream(ctx, protocol.MsgTask, req, resp, onProgress)
+	}
+	return err
+}
+
+// Close cierra las conexiones con el coordinador.
+func (c *CoordinatorClient) Close() {
+	c.pool.Close()
 }
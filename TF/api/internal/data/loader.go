@@ -1,16 +1,20 @@
 package data
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"sdr/api/internal/models"
+	"sdr/cluster/shared/sparse"
 	"strconv"
 	"strings"
 )
 
 type MatrixData struct {
-	Matrix              [][]float64
+	Version             int64          // fecha de modificación del CSV; versiona el dataset en el clúster
+	Matrix              *sparse.Matrix // calificaciones en formato CSR
 	MovieIndexToMovieID map[int]int
 	MovieIDToMovieIndex map[int]int
 }
@@ -100,23 +104,30 @@ func LoadMapping(path string) (map[string]int, map[int]string, error) {
 	return origToIdx, idxToOrig, nil
 }
 
+// LoadUserMovieMatrix lee la matriz usuario–película (CSV denso: una fila
+// por usuario, una columna por película) fila por fila y la guarda en
+// formato CSR, sin materializar nunca la matriz densa.
 func LoadUserMovieMatrix(path string) (*MatrixData, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	r := csv.NewReader(f)
-	rows, err := r.ReadAll()
+	info, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-	if len(rows) < 2 {
+	r := csv.NewReader(bufio.NewReaderSize(f, 1<<20))
+	r.ReuseRecord = true
+
+	header, err := r.Read() // header[0] == "userIndex", header[1..] are movieIndex numbers (strings)
+	if err == io.EOF {
 		return nil, fmt.Errorf("matrix file empty")
 	}
-	header := rows[0] // header[0] == "userIndex", header[1..] are movieIndex numbers (strings)
+	if err != nil {
+		return nil, err
+	}
 	numMovies := len(header) - 1
-	numUsers := len(rows) - 1
 
 	movieIndexToMovieID := map[int]int{}
 	movieIDToMovieIndex := map[int]int{}
@@ -129,25 +140,59 @@ func LoadUserMovieMatrix(path string) (*MatrixData, error) {
 		movieIDToMovieIndex[id] = i
 	}
 
-	matrix := make([][]float64, numUsers)
-	for u := 0; u < numUsers; u++ {
-		row := rows[u+1]
+	b := sparse.NewBuilder(numMovies)
+	for line := 1; ; line++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 		if len(row) != numMovies+1 {
-			return nil, fmt.Errorf("row %d length mismatch", u+1)
+			return nil, fmt.Errorf("row %d length mismatch", line)
 		}
-		matrix[u] = make([]float64, numMovies)
 		for m := 0; m < numMovies; m++ {
-			val, err := strconv.ParseFloat(row[m+1], 64)
+			field := row[m+1]
+			if field == "0" || field == "0.0" || field == "" {
+				continue // la gran mayoría: sin calificación
+			}
+			val, err := strconv.ParseFloat(field, 64)
 			if err != nil {
-				return nil, fmt.Errorf("parse float row %d col %d: %v", u+1, m+1, err)
+				return nil, fmt.Errorf("parse float row %d col %d: %v", line, m+1, err)
 			}
-			matrix[u][m] = val
+			b.Add(m, val)
 		}
+		b.EndRow()
+	}
+
+	matrix := b.Build()
+	if matrix.Rows == 0 {
+		return nil, fmt.Errorf("matrix file empty")
 	}
 
 	return &MatrixData{
+		Version:             info.ModTime().Unix(),
 		Matrix:              matrix,
 		MovieIndexToMovieID: movieIndexToMovieID,
 		MovieIDToMovieIndex: movieIDToMovieIndex,
 	}, nil
 }
+
+// Escala de las calificaciones: la matriz del CSV viene normalizada
+// min–max a [0,1] desde estrellas de 0.5 a 5 (PC3/Data/preprocesamiento.go)
+const (
+	MinRating = 0.5
+	MaxRating = 5.0
+)
+
+// minScaledRating es el valor en la matriz de una calificación de 0.5
+// estrellas: la normalización la lleva a 0, que en la matriz dispersa es
+// una calificación ausente (y en un parche, un borrado)
+const minScaledRating = 1e-4
+
+// ScaleRating lleva una calificación de 0.5 a 5 estrellas a la escala de la
+// matriz. Nunca devuelve 0.
+func ScaleRating(stars float64) float64 {
+	return max((stars-MinRating)/(MaxRating-MinRating), minScaledRating)
+}
@@ -47,3 +47,26 @@ func (m *Mappings) MovieOriginal(index int) (string, bool) {
 	orig, ok := m.MovieIndexToOriginal[index]
 	return orig, ok
 }
+
+// Clone devuelve una copia independiente de los mapeos.
+func (m *Mappings) Clone() *Mappings {
+	out := &Mappings{
+		UserOriginalToIndex:  make(map[string]int, len(m.UserOriginalToIndex)),
+		UserIndexToOriginal:  make(map[int]string, len(m.UserIndexToOriginal)),
+		MovieOriginalToIndex: make(map[string]int, len(m.MovieOriginalToIndex)),
+		MovieIndexToOriginal: make(map[int]string, len(m.MovieIndexToOriginal)),
+	}
+	for k, v := range m.UserOriginalToIndex {
+		out.UserOriginalToIndex[k] = v
+	}
+	for k, v := range m.UserIndexToOriginal {
+		out.UserIndexToOriginal[k] = v
+	}
+	for k, v := range m.MovieOriginalToIndex {
+		out.MovieOriginalToIndex[k] = v
+	}
+	for k, v := range m.MovieIndexToOriginal {
+		out.MovieIndexToOriginal[k] = v
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// DIVISIÓN ENTRENAMIENTO / PRUEBA (evaluación offline)
+// Las calificaciones de la matriz se reparten en dos matrices con las
+// mismas dimensiones: la de entrenamiento (la que usan los algoritmos) y la
+// de prueba (la que se intenta predecir).
+// ---------------------------------------------------
+
+// Estrategias de división
+const (
+	SplitRandom    = "random"      // cada calificación va a prueba con probabilidad frac
+	SplitLeaveKOut = "leave-k-out" // k calificaciones al azar de cada usuario
+	SplitTemporal  = "temporal"    // las calificaciones más recientes (requiere timestamps)
+)
+
+// SplitRandomly manda cada calificación a prueba con probabilidad frac.
+func SplitRandomly(m *sparse.Matrix, frac float64, seed int64) (train, test *sparse.Matrix) {
+	rng := rand.New(rand.NewSource(seed))
+	held := make([]bool, m.NNZ())
+	for k := range held {
+		held[k] = rng.Float64() < frac
+	}
+	return splitHeld(m, held)
+}
+
+// SplitPerUser retiene k calificaciones al azar de cada usuario con más de
+// k (así le queda al menos una para entrenar); los demás quedan enteros en
+// entrenamiento.
+func SplitPerUser(m *sparse.Matrix, k int, seed int64) (train, test *sparse.Matrix) {
+	rng := rand.New(rand.NewSource(seed))
+	held := make([]bool, m.NNZ())
+	for i := 0; i < m.Rows; i++ {
+		start, n := m.RowPtr[i], m.RowPtr[i+1]-m.RowPtr[i]
+		if n <= k {
+			continue
+		}
+		for _, p := range rng.Perm(n)[:k] {
+			held[start+p] = true
+		}
+	}
+	return splitHeld(m, held)
+}
+
+// SplitByTime retiene la fracción frac de calificaciones más recientes.
+// times tiene la misma forma que m y guarda el timestamp de cada
+// calificación; las que no tienen timestamp quedan en entrenamiento.
+func SplitByTime(m, times *sparse.Matrix, frac float64) (train, test *sparse.Matrix, err error) {
+	if times.Rows != m.Rows || times.Cols != m.Cols {
+		return nil, nil, fmt.Errorf("los timestamps son %dx%d, la matriz %dx%d", times.Rows, times.Cols, m.Rows, m.Cols)
+	}
+
+	type rated struct {
+		pos  int // posición en m.Values
+		time float64
+	}
+	var dated []rated
+	for i := 0; i < m.Rows; i++ {
+		row, stamps := m.Row(i), times.Row(i)
+		for k, j := range row.Idx {
+			if t := stamps.Get(j); t != 0 {
+				dated = append(dated, rated{pos: m.RowPtr[i] + k, time: t})
+			}
+		}
+	}
+	if len(dated) == 0 {
+		return nil, nil, fmt.Errorf("ninguna calificación de la matriz tiene timestamp")
+	}
+	sort.SliceStable(dated, func(a, b int) bool { return dated[a].time < dated[b].time })
+
+	held := make([]bool, m.NNZ())
+	for _, r := range dated[len(dated)-int(frac*float64(len(dated))):] {
+		held[r.pos] = true
+	}
+	train, test = splitHeld(m, held)
+	return train, test, nil
+}
+
+// splitHeld arma las dos matrices: held[k] indica si m.Values[k] va a prueba.
+func splitHeld(m *sparse.Matrix, held []bool) (train, test *sparse.Matrix) {
+	tr, te := sparse.NewBuilder(m.Cols), sparse.NewBuilder(m.Cols)
+	for i := 0; i < m.Rows; i++ {
+		for k := m.RowPtr[i]; k < m.RowPtr[i+1]; k++ {
+			if held[k] {
+				te.Add(m.ColIdx[k], m.Values[k])
+			} else {
+				tr.Add(m.ColIdx[k], m.Values[k])
+			}
+		}
+		tr.EndRow()
+		te.EndRow()
+	}
+	return tr.Build(), te.Build()
+}
+
+// LoadRatingTimes lee un CSV de calificaciones con timestamp (userId,movieId,
+// rating,timestamp, como el ratings.csv de MovieLens) y devuelve los
+// timestamps en una matriz rows×cols con los índices internos de users y
+// movies. Las filas de usuarios o películas que no están en la matriz se
+// ignoran.
+func LoadRatingTimes(path string, users, movies map[string]int, rows, cols int) (*sparse.Matrix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(bufio.NewReaderSize(f, 1<<20))
+	r.ReuseRecord = true
+	if _, err := r.Read(); err != nil {
+		return nil, fmt.Errorf("ratings csv header read: %w", err)
+	}
+
+	type stamp struct {
+		col  int
+		time float64
+	}
+	byUser := make([][]stamp, rows)
+	for line := 2; ; line++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("ratings csv fila %d: se esperaban 4 columnas", line)
+		}
+		u, ok := users[row[0]]
+		if !ok || u < 0 || u >= rows {
+			continue
+		}
+		j, ok := movies[row[1]]
+		if !ok || j < 0 || j >= cols {
+			continue
+		}
+		t, err := strconv.ParseFloat(row[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("ratings csv fila %d: timestamp inválido: %v", line, err)
+		}
+		byUser[u] = append(byUser[u], stamp{col: j, time: t})
+	}
+
+	b := sparse.NewBuilder(cols)
+	for _, stamps := range byUser {
+		for _, s := range stamps {
+			b.Add(s.col, s.time)
+		}
+		b.EndRow()
+	}
+	return b.Build(), nil
+}
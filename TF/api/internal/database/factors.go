@@ -0,0 +1,146 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Los factores ALS de MovieLens 20M superan el límite de 16 MB de un
+// documento, así que se guardan como JSON en GridFS (un archivo por versión
+// del dataset; solo se conserva el de la más nueva de cada dataset).
+const factorsBucket = "als_factors"
+
+func factorsFile(datasetID string, version int64) string {
+	return fmt.Sprintf("%s-v%d.json", datasetID, version)
+}
+
+func (m *MongoClient) factorsBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(m.DB, options.GridFSBucket().SetName(factorsBucket))
+}
+
+// SaveFactorModel guarda los factores entrenados para esa versión del
+// dataset, reemplazando los anteriores. Al terminar borra los de versiones
+// anteriores del mismo dataset: cada calificación cargada crea una versión y
+// solo se usan los factores de la vigente.
+func (m *MongoClient) SaveFactorModel(datasetID string, version int64, model any) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := m.factorsBucket()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	name := factorsFile(datasetID, version)
+	if err := deleteFiles(ctx, bucket, name); err != nil {
+		return err
+	}
+
+	bucket.SetWriteDeadline(deadline(ctx))
+	if _, err := bucket.UploadFromStream(name, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	return deleteOlderFactors(ctx, bucket, datasetID, version)
+}
+
+// deleteOlderFactors borra los factores de las versiones del dataset
+// anteriores a version (un entrenamiento atrasado no borra los de una
+// versión más nueva).
+func deleteOlderFactors(ctx context.Context, bucket *gridfs.Bucket, datasetID string, version int64) error {
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(datasetID) + `-v(\d+)\.json$`)
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": bson.M{"$regex": pattern.String()}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file struct {
+			ID       any    `bson:"_id"`
+			Filename string `bson:"filename"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		m := pattern.FindStringSubmatch(file.Filename)
+		if m == nil {
+			continue
+		}
+		if v, err := strconv.ParseInt(m[1], 10, 64); err != nil || v >= version {
+			continue
+		}
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// LoadFactorModel carga en out los factores de esa versión del dataset;
+// devuelve false si todavía no se entrenaron.
+func (m *MongoClient) LoadFactorModel(datasetID string, version int64, out any) (bool, error) {
+	bucket, err := m.factorsBucket()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	bucket.SetReadDeadline(deadline(ctx))
+
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStreamByName(factorsFile(datasetID, version), &buf); err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deleteFiles borra todas las versiones de un archivo del bucket.
+func deleteFiles(ctx context.Context, bucket *gridfs.Bucket, name string) error {
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": name})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file struct {
+			ID any `bson:"_id"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func deadline(ctx context.Context) time.Time {
+	d, _ := ctx.Deadline()
+	return d
+}
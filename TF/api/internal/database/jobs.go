@@ -0,0 +1,150 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Los jobs asíncronos se guardan en jobs (un documento por job, con _id =
+// ID del coordinador); sus resultados, que con los vecinos de todos los usuarios
+// pueden superar los 16 MB de un documento, van como JSON en GridFS.
+const (
+	jobsCollection = "jobs"
+	jobsBucket     = "job_results"
+)
+
+func jobResultFile(id string) string {
+	return id + ".json"
+}
+
+func (m *MongoClient) jobsBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(m.DB, options.GridFSBucket().SetName(jobsBucket))
+}
+
+// SaveJob guarda (o reemplaza) el documento de un job.
+func (m *MongoClient) SaveJob(id string, job any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := m.DB.Collection(jobsCollection).ReplaceOne(ctx, bson.M{"_id": id}, job, options.Replace().SetUpsert(true))
+	return err
+}
+
+// LoadJob carga en out el documento de un job; devuelve false si no existe.
+func (m *MongoClient) LoadJob(id string, out any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.DB.Collection(jobsCollection).FindOne(ctx, bson.M{"_id": id}).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// JobsInState carga en out (un puntero a slice) los jobs en alguno de esos
+// estados.
+func (m *MongoClient) JobsInState(out any, states ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := m.DB.Collection(jobsCollection).Find(ctx, bson.M{"state": bson.M{"$in": states}})
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
+
+// SaveJobResult guarda el resultado de un job terminado.
+func (m *MongoClient) SaveJobResult(id string, result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := m.jobsBucket()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	name := jobResultFile(id)
+	if err := deleteFiles(ctx, bucket, name); err != nil {
+		return err
+	}
+
+	bucket.SetWriteDeadline(deadline(ctx))
+	_, err = bucket.UploadFromStream(name, bytes.NewReader(data))
+	return err
+}
+
+// LoadJobResult carga en out el resultado de un job; devuelve false si no
+// hay (el job no terminó bien o ya se descartó).
+func (m *MongoClient) LoadJobResult(id string, out any) (bool, error) {
+	bucket, err := m.jobsBucket()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	bucket.SetReadDeadline(deadline(ctx))
+
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStreamByName(jobResultFile(id), &buf); err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteJobsFinishedBefore borra los jobs terminados antes de t junto con
+// sus resultados y devuelve cuántos borró.
+func (m *MongoClient) DeleteJobsFinishedBefore(t time.Time) (int, error) {
+	bucket, err := m.jobsBucket()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	coll := m.DB.Collection(jobsCollection)
+	filter := bson.M{"finishedAt": bson.M{"$lt": t}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+
+	for _, d := range docs {
+		if err := deleteFiles(ctx, bucket, jobResultFile(d.ID)); err != nil {
+			return 0, err
+		}
+	}
+	res, err := coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
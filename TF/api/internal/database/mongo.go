@@ -74,6 +74,17 @@ func (m *MongoClient) SeedUsersIfEmpty(userIdxToOrig map[int]string) error {
 	return err
 }
 
+// AddUser agrega un usuario nuevo (por ejemplo, al cargar su primera
+// calificación) a la colección users.
+func (m *MongoClient) AddUser(userIndex int, userID string) error {
+	coll := m.DB.Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := coll.UpdateOne(ctx, bson.M{"userId": userID},
+		bson.M{"$set": bson.M{"userIndex": userIndex, "userId": userID}}, options.Update().SetUpsert(true))
+	return err
+}
+
 func (m *MongoClient) SaveRecommendation(rec interface{}) error {
 	coll := m.DB.Collection("history")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
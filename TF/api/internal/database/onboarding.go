@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Perfiles de arranque en frío, uno por usuario (_id = userId)
+const onboardingCollection = "onboarding"
+
+// SaveOnboarding guarda (o reemplaza) el perfil de un usuario.
+func (m *MongoClient) SaveOnboarding(userID string, profile any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := m.DB.Collection(onboardingCollection).ReplaceOne(ctx, bson.M{"_id": userID}, profile, options.Replace().SetUpsert(true))
+	return err
+}
+
+// LoadOnboarding carga en out el perfil de un usuario; devuelve false si no
+// tiene.
+func (m *MongoClient) LoadOnboarding(userID string, out any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.DB.Collection(onboardingCollection).FindOne(ctx, bson.M{"_id": userID}).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
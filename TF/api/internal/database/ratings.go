@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"sdr/api/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Calificaciones cargadas por la API, una por usuario y película (_id =
+// "userId:movieId"); las borradas quedan con rating 0
+const ratingsCollection = "ratings"
+
+func ratingID(userID, movieID string) string {
+	return userID + ":" + movieID
+}
+
+// SaveRatings guarda (o reemplaza) las calificaciones.
+func (m *MongoClient) SaveRatings(ratings []models.UserRating) error {
+	if len(ratings) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	writes := make([]mongo.WriteModel, len(ratings))
+	for i, r := range ratings {
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": ratingID(r.UserID, r.MovieID)}).
+			SetReplacement(r).
+			SetUpsert(true)
+	}
+	_, err := m.DB.Collection(ratingsCollection).BulkWrite(ctx, writes)
+	return err
+}
+
+// LoadRatings devuelve todas las calificaciones cargadas por la API, de la
+// más vieja a la más nueva.
+func (m *MongoClient) LoadRatings() ([]models.UserRating, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}})
+	cursor, err := m.DB.Collection(ratingsCollection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.UserRating
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadUserIndexes devuelve la fila de la matriz de cada usuario de la
+// colección users (los del CSV y los que agregó la API con AddUser).
+func (m *MongoClient) LoadUserIndexes() (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cursor, err := m.DB.Collection("users").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		UserID    string `bson:"userId"`
+		UserIndex int    `bson:"userIndex"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(docs))
+	for _, d := range docs {
+		out[d.UserID] = d.UserIndex
+	}
+	return out, nil
+}
+
+// SetMovieIndex guarda la columna de la matriz que la API le asignó a una
+// película del catálogo que no tenía calificaciones en el CSV.
+func (m *MongoClient) SetMovieIndex(movieID string, movieIndex int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := m.DB.Collection("movies").UpdateOne(ctx, bson.M{"movieId": movieID},
+		bson.M{"$set": bson.M{"movieIndex": movieIndex}})
+	return err
+}
+
+// LoadMovieIndexes devuelve las columnas guardadas con SetMovieIndex.
+func (m *MongoClient) LoadMovieIndexes() (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cursor, err := m.DB.Collection("movies").Find(ctx, bson.M{"movieIndex": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		MovieID    string `bson:"movieId"`
+		MovieIndex int    `bson:"movieIndex"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(docs))
+	for _, d := range docs {
+		out[d.MovieID] = d.MovieIndex
+	}
+	return out, nil
+}
@@ -2,7 +2,11 @@ package database
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -43,3 +47,111 @@ func (r *RedisClient) SetCached(key string, value any, ttl time.Duration) error
 	}
 	return r.Client.Set(ctx, key, b, ttl).Err()
 }
+
+// Las claves en caché pueden llevar etiquetas (por ejemplo, el usuario o
+// la versión del dataset) para descartarlas juntas. Cada etiqueta es un
+// sorted set tag:<etiqueta> con sus claves puntuadas por su vencimiento, así
+// las vencidas se podan al escribir y el set no crece sin control.
+const tagPrefix = "tag:"
+
+// SetCachedTagged es como SetCached pero además agrega key a cada etiqueta.
+func (r *RedisClient) SetCachedTagged(key string, value any, ttl time.Duration, tags ...string) error {
+	ctx := context.Background()
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expires := float64(now.Add(ttl).Unix())
+	pipe := r.Client.TxPipeline()
+	pipe.Set(ctx, key, b, ttl)
+	for _, tag := range tags {
+		tagKey := tagPrefix + tag
+		pipe.ZAdd(ctx, tagKey, redis.Z{Score: expires, Member: key})
+		pipe.ZRemRangeByScore(ctx, tagKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+		pipe.Expire(ctx, tagKey, ttl) // con un mismo TTL, la clave recién agregada vence última
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// InvalidateTag borra las claves con esa etiqueta y devuelve cuántas
+// borró. De la etiqueta se quitan solo las claves leídas: una que
+// SetCachedTagged agregue mientras tanto conserva su etiqueta (Redis borra
+// el conjunto cuando queda vacío).
+func (r *RedisClient) InvalidateTag(tag string) (int, error) {
+	ctx := context.Background()
+	tagKey := tagPrefix + tag
+
+	keys, err := r.Client.ZRange(ctx, tagKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for start := 0; start < len(keys); start += 500 {
+		batch := keys[start:min(start+500, len(keys))]
+		members := make([]any, len(batch))
+		for i, key := range batch {
+			members[i] = key
+		}
+
+		pipe := r.Client.TxPipeline()
+		del := pipe.Del(ctx, batch...)
+		pipe.ZRem(ctx, tagKey, members...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return deleted, err
+		}
+		deleted += int(del.Val())
+	}
+	return deleted, nil
+}
+
+// Tags devuelve las etiquetas que empiezan con prefix.
+func (r *RedisClient) Tags(prefix string) ([]string, error) {
+	ctx := context.Background()
+	var tags []string
+	iter := r.Client.Scan(ctx, 0, tagPrefix+prefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		tags = append(tags, strings.TrimPrefix(iter.Val(), tagPrefix))
+	}
+	return tags, iter.Err()
+}
+
+// Los locks son claves lock:<nombre> con un token al azar de quien los tomó
+// y un TTL, para que se liberen solos si ese proceso muere.
+const lockPrefix = "lock:"
+
+// unlockScript borra el lock solo si sigue siendo de quien lo suelta (pudo
+// vencer y tomarlo otro).
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// TryLock toma el lock name por ttl si está libre. Devuelve el token para
+// soltarlo con Unlock, o "" si lo tiene otro.
+func (r *RedisClient) TryLock(name string, ttl time.Duration) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b[:])
+	ok, err := r.Client.SetNX(context.Background(), lockPrefix+name, token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// Unlock suelta el lock name si todavía es el de token.
+func (r *RedisClient) Unlock(name, token string) error {
+	return unlockScript.Run(context.Background(), r.Client, []string{lockPrefix + name}, token).Err()
+}
+
+// Locked informa si alguien tiene el lock name.
+func (r *RedisClient) Locked(name string) (bool, error) {
+	n, err := r.Client.Exists(context.Background(), lockPrefix+name).Result()
+	return n > 0, err
+}
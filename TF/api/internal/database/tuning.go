@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Las búsquedas de hiperparámetros se guardan completas (un documento por
+// búsqueda, con su ranking); la configuración adoptada vive en settings.
+const (
+	tuningCollection   = "tuning"
+	settingsCollection = "settings"
+)
+
+// SaveTuning guarda el resultado de una búsqueda de hiperparámetros.
+func (m *MongoClient) SaveTuning(result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := m.DB.Collection(tuningCollection).InsertOne(ctx, result)
+	return err
+}
+
+// LatestTuning carga en out la última búsqueda terminada (por finishedAt);
+// devuelve false si todavía no hay ninguna.
+func (m *MongoClient) LatestTuning(out any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "finishedAt", Value: -1}})
+	err := m.DB.Collection(tuningCollection).FindOne(ctx, bson.M{}, opts).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveSetting guarda (o reemplaza) el valor de una configuración de la API.
+func (m *MongoClient) SaveSetting(id string, value any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	doc := bson.M{"_id": id, "value": value, "updatedAt": time.Now()}
+	_, err := m.DB.Collection(settingsCollection).ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// LoadSetting carga en out el valor de una configuración; devuelve false si
+// no existe.
+func (m *MongoClient) LoadSetting(id string, out any) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Value bson.Raw `bson:"value"`
+	}
+	err := m.DB.Collection(settingsCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, bson.Unmarshal(doc.Value, out)
+}
+
+// DeleteSetting borra una configuración (no falla si no existe).
+func (m *MongoClient) DeleteSetting(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := m.DB.Collection(settingsCollection).DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
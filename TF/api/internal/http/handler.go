@@ -1,11 +1,19 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/models"
 	"sdr/api/internal/service"
 
 	"github.com/gorilla/mux"
@@ -27,56 +35,110 @@ var upgrader = websocket.Upgrader{
 }
 
 // @Summary Genera recomendaciones filtradas
-// @Description Retorna películas recomendadas para un usuario, con filtros opcionales
+// @Description Retorna películas recomendadas para un usuario, con filtros opcionales. Los usuarios que no están en el dataset o tienen menos de 5 calificaciones reciben una recomendación de arranque en frío: su perfil de onboarding si lo completaron, o las películas más populares en sus géneros o en general; el campo strategy indica cuál se usó (collaborative, onboarding, genre_popularity o global_popularity). Las opciones que no se indican (k, metric, mode, normalization y reglas de confianza) toman los valores de la configuración adoptada con /tuning/adopt, si la hay
 // @Tags Recomendaciones
 // @Param userId path int true "ID del usuario"
 // @Param limit query int false "Cantidad de recomendaciones" default(10)
 // @Param genre query string false "Género a filtrar"
+// @Param metric query string false "Métrica de similitud (cosine, pearson, jaccard, adjusted_cosine)" default(cosine)
+// @Param mode query string false "Filtrado colaborativo por usuarios o por ítems en el clúster, o factores ALS (user, item, als)" default(user)
+// @Param k query int false "Vecinos (usuarios, o películas en modo item); sin indicar, los de la configuración adoptada o limit"
+// @Param normalization query string false "Normalización de las calificaciones antes de comparar (none, mean_center, zscore); no aplica en modo als" default(none)
+// @Param min_overlap query int false "Películas en común mínimas para que un vecino cuente (0 = sin mínimo)"
+// @Param shrinkage query number false "Penaliza vecinos con pocas películas en común: similitud · n/(n+shrinkage) (0 = sin penalización)"
+// @Param min_similarity query number false "Similitud mínima de un vecino (sin indicar = sin mínimo)"
+// @Param min_voters query int false "Vecinos mínimos que calificaron una película para recomendarla (0 = sin mínimo)"
+// @Param explain query bool false "Incluir por película los vecinos que más aportaron a su puntaje (no aplica en modo als)" default(false)
 // @Success 200 {array} models.Movie
 // @Failure 400 {string} string "Bad Request"
-// @Failure 404 {string} string "Usuario no encontrado"
 // @Router /recommend/{userId} [get]
 func (h *Handler) Recommend(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userId := vars["userId"]
 
-	limitQuery := r.URL.Query().Get("limit")
-	genre := r.URL.Query().Get("genre")
-
-	limit := 10
-	if limitQuery != "" {
-		if v, err := strconv.Atoi(limitQuery); err == nil {
-			limit = v
-		}
-	}
+	params := h.Service.WithDefaults(recommendParams(r))
 
-	out, err := h.Service.Recommend(userId, limit, genre)
+	rec, err := h.Service.Recommend(r.Context(), userId, params)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Try to get metrics from Redis (if available)
-	var metrics map[string]interface{}
-	if h.Service.Redis != nil {
-		if found, _ := h.Service.Redis.GetCached(fmt.Sprintf("rec:%s:%s:%d:metrics", userId, genre, limit), &metrics); found {
-			// ok
-		} else {
-			metrics = nil
-		}
-	}
-
 	resp := map[string]any{
-		"movies":  out,
-		"metrics": metrics,
+		"movies":   rec.Movies,
+		"strategy": rec.Strategy,
+		"metrics":  rec.Metrics,
+	}
+	if params.Explain {
+		resp["explanations"] = rec.Explanations
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-// RecommendWS upgrades the connection to a WebSocket and sends recommendations
-// as a JSON payload. Path/query parameters are the same as the HTTP endpoint.
+// recommendParams lee los parámetros de consulta comunes de /recommend y
+// /ws/recommend.
+func recommendParams(r *http.Request) service.RecommendParams {
+	q := r.URL.Query()
+
+	limit := 10
+	if limitQuery := q.Get("limit"); limitQuery != "" {
+		if v, err := strconv.Atoi(limitQuery); err == nil {
+			limit = v
+		}
+	}
+
+	return service.RecommendParams{
+		Limit:         limit,
+		Genre:         q.Get("genre"),
+		Metric:        q.Get("metric"),
+		Mode:          q.Get("mode"),
+		K:             queryInt(q, "k"),
+		Normalization: q.Get("normalization"),
+		Confidence: coordinator.Confidence{
+			MinOverlap:    queryInt(q, "min_overlap"),
+			Shrinkage:     queryFloat(q, "shrinkage"),
+			MinSimilarity: queryOptFloat(q, "min_similarity"),
+			MinVoters:     queryInt(q, "min_voters"),
+		},
+		Explain: queryBool(q, "explain"),
+	}
+}
+
+// queryInt lee un parámetro entero (0 si falta o no es válido).
+func queryInt(q url.Values, name string) int {
+	v, _ := strconv.Atoi(q.Get(name))
+	return v
+}
+
+// queryBool lee un parámetro booleano (false si falta o no es válido).
+func queryBool(q url.Values, name string) bool {
+	v, _ := strconv.ParseBool(q.Get(name))
+	return v
+}
+
+// queryFloat lee un parámetro decimal (0 si falta o no es válido).
+func queryFloat(q url.Values, name string) float64 {
+	v, _ := strconv.ParseFloat(q.Get(name), 64)
+	return v
+}
+
+// queryOptFloat lee un parámetro decimal opcional (nil si falta o no es
+// válido), para los que 0 es un valor con sentido.
+func queryOptFloat(q url.Values, name string) *float64 {
+	v, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// RecommendWS upgrades the connection to a WebSocket and streams the
+// recommendation: one "progress" message each time a worker finishes its part
+// (progress %, current top-N and per-worker timings) and then a "final"
+// message with the same payload as the HTTP endpoint. Path/query parameters
+// are the same as the HTTP endpoint.
 func (h *Handler) RecommendWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -88,35 +150,42 @@ func (h *Handler) RecommendWS(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userId := vars["userId"]
 
-	limitQuery := r.URL.Query().Get("limit")
-	genre := r.URL.Query().Get("genre")
+	params := h.Service.WithDefaults(recommendParams(r))
 
-	limit := 10
-	if limitQuery != "" {
-		if v, err := strconv.Atoi(limitQuery); err == nil {
-			limit = v
+	// Después del upgrade r.Context() ya no se entera de que el cliente se
+	// fue: el cliente no envía mensajes, así que una lectura fallida es que
+	// cerró la conexión y se aborta el trabajo en el clúster
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				cancel()
+				return
+			}
 		}
-	}
+	}()
 
-	out, err := h.Service.Recommend(userId, limit, genre)
+	stream := newProgressStream(conn)
+	rec, err := h.Service.RecommendStream(ctx, userId, params, stream.send)
+	workers := stream.close()
 	if err != nil {
 		// send error message over WS and close
-		_ = conn.WriteJSON(map[string]string{"error": err.Error()})
+		_ = conn.WriteJSON(map[string]string{"type": "error", "error": err.Error()})
 		return
 	}
-	// Try to get metrics from Redis
-	var metrics map[string]interface{}
-	if h.Service.Redis != nil {
-		if found, _ := h.Service.Redis.GetCached(fmt.Sprintf("rec:%s:%s:%d:metrics", userId, genre, limit), &metrics); found {
-			// ok
-		} else {
-			metrics = nil
-		}
-	}
 
 	resp := map[string]any{
-		"movies":  out,
-		"metrics": metrics,
+		"type":     "final",
+		"movies":   rec.Movies,
+		"strategy": rec.Strategy,
+		"metrics":  rec.Metrics,
+	}
+	if params.Explain {
+		resp["explanations"] = rec.Explanations
+	}
+	if len(workers) > 0 {
+		resp["workers"] = workers
 	}
 
 	// enviar el objeto como JSON
@@ -125,6 +194,411 @@ func (h *Handler) RecommendWS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Avances que pueden quedar en cola para un cliente WebSocket lento; si se
+// llena, los intermedios se descartan (el final siempre se envía)
+const wsProgressBuffer = 16
+
+// progressStream escribe en el WebSocket los avances de una recomendación
+// desde su propia goroutine, para no bloquear la conexión con el
+// coordinador que los produce.
+type progressStream struct {
+	mu     sync.Mutex
+	closed bool
+	last   []models.WorkerTiming
+	ch     chan models.RecommendProgress
+	done   chan struct{}
+}
+
+func newProgressStream(conn *websocket.Conn) *progressStream {
+	s := &progressStream{
+		ch:   make(chan models.RecommendProgress, wsProgressBuffer),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for u := range s.ch {
+			if err := conn.WriteJSON(u); err != nil {
+				log.Printf("No se pudo enviar el avance por WebSocket: %v", err)
+			}
+		}
+	}()
+	return s
+}
+
+// send encola un avance sin bloquear.
+func (s *progressStream) send(u models.RecommendProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return // llegó tarde, la recomendación ya terminó
+	}
+	s.last = u.Workers
+	select {
+	case s.ch <- u:
+	default:
+	}
+}
+
+// close espera a que se escriban los avances encolados y devuelve los
+// últimos tiempos por worker (nil si no hubo avances).
+func (s *progressStream) close() []models.WorkerTiming {
+	s.mu.Lock()
+	s.closed = true
+	close(s.ch)
+	last := s.last
+	s.mu.Unlock()
+
+	<-s.done
+	return last
+}
+
+// @Summary Entrena factores ALS en el clúster
+// @Description Lanza en segundo plano el entrenamiento ALS sobre el dataset vigente; al terminar, los factores se guardan en Mongo y se usan en mode=als
+// @Tags ALS
+// @Param factors query int false "Dimensión de los factores latentes" default(20)
+// @Param iterations query int false "Iteraciones" default(10)
+// @Param lambda query number false "Regularización (mayor que 0; 0 o vacío usa el valor por defecto)" default(0.1)
+// @Success 202 {object} service.ALSStatus
+// @Failure 409 {string} string "Ya hay un entrenamiento en curso"
+// @Router /als/train [post]
+func (h *Handler) TrainALS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var params coordinator.ALSParams
+	params.Factors, _ = strconv.Atoi(q.Get("factors"))
+	params.Iterations, _ = strconv.Atoi(q.Get("iterations"))
+	params.Lambda, _ = strconv.ParseFloat(q.Get("lambda"), 64)
+
+	if h.Service.ALSStatus().Training {
+		http.Error(w, service.ErrTrainingInProgress.Error(), http.StatusConflict)
+		return
+	}
+	go func() {
+		if err := h.Service.TrainALS(params); err != nil {
+			log.Printf("Entrenamiento ALS falló: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.Service.ALSStatus())
+}
+
+// @Summary Estado del modelo ALS
+// @Description Devuelve el modelo ALS vigente (sin los factores) y si hay un entrenamiento en curso. Las calificaciones cargadas por la API crean versiones nuevas del dataset; si el modelo quedó atrás (stale), mode=als usa filtrado por usuarios y se reentrena en segundo plano, como mucho cada 10 minutos
+// @Tags ALS
+// @Success 200 {object} service.ALSStatus
+// @Router /als [get]
+func (h *Handler) ALSStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Service.ALSStatus())
+}
+
+// @Summary Busca los mejores hiperparámetros en el clúster
+// @Description Lanza en segundo plano una búsqueda en grilla: separa las calificaciones en entrenamiento y prueba, evalúa cada combinación en el clúster y guarda el ranking en Mongo. El cuerpo es opcional; sin grilla se prueban K 10/20/50, cosine/pearson, user/item y none/mean_center
+// @Tags Tuning
+// @Accept json
+// @Param request body service.TuneRequest false "División, grilla y si adoptar la mejor combinación al terminar"
+// @Success 202 {object} service.TuningStatus
+// @Failure 400 {string} string "Solicitud inválida"
+// @Failure 409 {string} string "Ya hay una búsqueda en curso"
+// @Router /tuning [post]
+func (h *Handler) StartTuning(w http.ResponseWriter, r *http.Request) {
+	var req service.TuneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "cuerpo inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := req.Complete()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.Service.TuningStatus().Running {
+		http.Error(w, service.ErrTuningInProgress.Error(), http.StatusConflict)
+		return
+	}
+	go func() {
+		if err := h.Service.Tune(req); err != nil {
+			log.Printf("Búsqueda de hiperparámetros falló: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.Service.TuningStatus())
+}
+
+// @Summary Ranking de hiperparámetros
+// @Description Devuelve la última búsqueda con su ranking, si hay una en curso y la configuración adoptada
+// @Tags Tuning
+// @Success 200 {object} service.TuningStatus
+// @Router /tuning [get]
+func (h *Handler) TuningStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Service.TuningStatus())
+}
+
+// @Summary Adopta una combinación del ranking
+// @Description Las recomendaciones pasan a usar la combinación de ese puesto de la última búsqueda para las opciones que no indiquen
+// @Tags Tuning
+// @Param rank query int false "Puesto en el ranking" default(1)
+// @Success 200 {object} service.TunedConfig
+// @Failure 400 {string} string "No hay búsqueda o el puesto no es válido"
+// @Router /tuning/adopt [post]
+func (h *Handler) AdoptTuning(w http.ResponseWriter, r *http.Request) {
+	rank := 1
+	if v := r.URL.Query().Get("rank"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "rank inválido", http.StatusBadRequest)
+			return
+		}
+		rank = n
+	}
+
+	adopted, err := h.Service.AdoptTuning(rank)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adopted)
+}
+
+// @Summary Descarta la configuración adoptada
+// @Description Las recomendaciones vuelven a los valores por defecto
+// @Tags Tuning
+// @Success 204
+// @Failure 500 {string} string "No se pudo borrar de Mongo"
+// @Router /tuning/adopt [delete]
+func (h *Handler) ResetTuning(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.ResetTuning(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Envía un job asíncrono
+// @Description Encola en el clúster una recomendación (mismos filtros y opciones que /recommend, salvo mode=als) o los usuarios más parecidos a cada usuario, para pedidos que no entran en el plazo de una solicitud HTTP. El estado y el resultado se consultan con GET /jobs/{id}
+// @Tags Jobs
+// @Accept json
+// @Param request body service.JobRequest true "Tipo de job y opciones"
+// @Success 202 {object} service.Job
+// @Failure 400 {string} string "Solicitud inválida o el clúster la rechazó"
+// @Router /jobs [post]
+func (h *Handler) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req service.JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "cuerpo inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.Service.SubmitJob(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// @Summary Estado de un job
+// @Description Devuelve el estado (queued, running, done, failed o cancelled), el último avance mientras corre y el resultado cuando termina. Los jobs terminados se conservan un día
+// @Tags Jobs
+// @Param id path string true "ID del job"
+// @Success 200 {object} service.Job
+// @Failure 404 {string} string "Job no encontrado"
+// @Router /jobs/{id} [get]
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.Service.Job(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), jobErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// @Summary Cancela un job
+// @Description Cancela el job en la cola o en los workers
+// @Tags Jobs
+// @Param id path string true "ID del job"
+// @Success 200 {object} service.Job
+// @Failure 404 {string} string "Job no encontrado"
+// @Failure 409 {string} string "El job ya terminó"
+// @Router /jobs/{id} [delete]
+func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.Service.CancelJob(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), jobErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrJobFinished):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// @Summary Guarda el perfil de onboarding
+// @Description Guarda (o reemplaza) los géneros preferidos y unas pocas películas calificadas de un usuario nuevo o con pocas calificaciones, que se usan para recomendarle mientras no tenga suficientes calificaciones propias. Admite hasta 5 géneros (de los que aparecen en /genres, por separado) y 20 películas
+// @Tags Usuarios
+// @Param userId path string true "ID del usuario (puede no estar en el dataset)"
+// @Param profile body models.OnboardingProfile true "Géneros y películas calificadas"
+// @Success 200 {object} models.OnboardingProfile
+// @Failure 400 {string} string "Perfil inválido"
+// @Router /users/{userId}/onboarding [put]
+func (h *Handler) SaveOnboarding(w http.ResponseWriter, r *http.Request) {
+	var profile models.OnboardingProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "cuerpo inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.Service.SaveOnboarding(mux.Vars(r)["userId"], profile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// @Summary Perfil de onboarding
+// @Description Devuelve el perfil de onboarding del usuario
+// @Tags Usuarios
+// @Param userId path string true "ID del usuario"
+// @Success 200 {object} models.OnboardingProfile
+// @Failure 404 {string} string "El usuario no tiene perfil"
+// @Router /users/{userId}/onboarding [get]
+func (h *Handler) GetOnboarding(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.Service.Onboarding(mux.Vars(r)["userId"])
+	if errors.Is(err, service.ErrNoOnboarding) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// @Summary Carga calificaciones
+// @Description Guarda calificaciones (de 0.5 a 5) del usuario, que puede no estar en el dataset; si ya había calificado la película se reemplaza. Se aplican enseguida a la matriz (los usuarios y las películas del catálogo que no estaban se agregan), el clúster recibe solo los cambios como una versión nueva del dataset y se descartan las recomendaciones en caché del usuario. Hasta 100 por solicitud
+// @Tags Usuarios
+// @Param userId path string true "ID del usuario"
+// @Param ratings body []models.Rating true "Calificaciones"
+// @Success 200 {object} service.RatingsUpdate
+// @Failure 400 {string} string "Calificaciones inválidas"
+// @Router /users/{userId}/ratings [post]
+func (h *Handler) AddRatings(w http.ResponseWriter, r *http.Request) {
+	var ratings []models.Rating
+	if err := json.NewDecoder(r.Body).Decode(&ratings); err != nil {
+		http.Error(w, "cuerpo inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	update, err := h.Service.AddRatings(mux.Vars(r)["userId"], ratings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(update)
+}
+
+// @Summary Borra una calificación
+// @Description Borra la calificación del usuario para la película, también si venía del dataset original
+// @Tags Usuarios
+// @Param userId path string true "ID del usuario"
+// @Param movieId path string true "ID de la película"
+// @Success 200 {object} service.RatingsUpdate
+// @Failure 404 {string} string "El usuario no calificó esa película"
+// @Router /users/{userId}/ratings/{movieId} [delete]
+func (h *Handler) DeleteRating(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	update, err := h.Service.DeleteRating(vars["userId"], vars["movieId"])
+	if errors.Is(err, service.ErrRatingNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(update)
+}
+
+// @Summary Vacía la caché de recomendaciones
+// @Description Descarta todas las recomendaciones en caché (con sus métricas y explicaciones)
+// @Tags Caché
+// @Success 200 {object} service.CacheInvalidation
+// @Failure 500 {string} string "No se pudo acceder a Redis"
+// @Router /cache [delete]
+func (h *Handler) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	writeInvalidation(w, h.Service.InvalidateCache)
+}
+
+// @Summary Descarta la caché de un usuario
+// @Description Descarta las recomendaciones en caché del usuario (al cargar o borrar sus calificaciones ya se descartan solas)
+// @Tags Caché
+// @Param userId path string true "ID del usuario"
+// @Success 200 {object} service.CacheInvalidation
+// @Failure 500 {string} string "No se pudo acceder a Redis"
+// @Router /cache/users/{userId} [delete]
+func (h *Handler) InvalidateUserCache(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	writeInvalidation(w, func() (*service.CacheInvalidation, error) {
+		return h.Service.InvalidateUserCache(userID)
+	})
+}
+
+// @Summary Descarta la caché de un género
+// @Description Descarta las recomendaciones en caché pedidas con ese filtro de género
+// @Tags Caché
+// @Param genre path string true "Género del filtro"
+// @Success 200 {object} service.CacheInvalidation
+// @Failure 400 {string} string "Falta el género"
+// @Failure 500 {string} string "No se pudo acceder a Redis"
+// @Router /cache/genres/{genre} [delete]
+func (h *Handler) InvalidateGenreCache(w http.ResponseWriter, r *http.Request) {
+	genre := mux.Vars(r)["genre"]
+	if strings.TrimSpace(genre) == "" {
+		http.Error(w, "falta el género", http.StatusBadRequest)
+		return
+	}
+	writeInvalidation(w, func() (*service.CacheInvalidation, error) {
+		return h.Service.InvalidateGenreCache(genre)
+	})
+}
+
+func writeInvalidation(w http.ResponseWriter, invalidate func() (*service.CacheInvalidation, error)) {
+	inv, err := invalidate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inv)
+}
+
 // @Summary Verifica el estado del servicio
 // @Description Devuelve 'ok' si el servicio está activo
 // @Tags Salud
@@ -9,6 +9,22 @@ func NewRouter(h *Handler) *mux.Router {
 	r.HandleFunc("/movies", h.GetMovies).Methods("GET")
 	r.HandleFunc("/genres", h.GetGenres).Methods("GET")
 	r.HandleFunc("/recommend/{userId}", h.Recommend).Methods("GET")
+	r.HandleFunc("/als", h.ALSStatus).Methods("GET")
+	r.HandleFunc("/als/train", h.TrainALS).Methods("POST")
+	r.HandleFunc("/tuning", h.TuningStatus).Methods("GET")
+	r.HandleFunc("/tuning", h.StartTuning).Methods("POST")
+	r.HandleFunc("/tuning/adopt", h.AdoptTuning).Methods("POST")
+	r.HandleFunc("/tuning/adopt", h.ResetTuning).Methods("DELETE")
+	r.HandleFunc("/jobs", h.SubmitJob).Methods("POST")
+	r.HandleFunc("/jobs/{id}", h.GetJob).Methods("GET")
+	r.HandleFunc("/jobs/{id}", h.CancelJob).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/onboarding", h.GetOnboarding).Methods("GET")
+	r.HandleFunc("/users/{userId}/onboarding", h.SaveOnboarding).Methods("PUT")
+	r.HandleFunc("/users/{userId}/ratings", h.AddRatings).Methods("POST")
+	r.HandleFunc("/users/{userId}/ratings/{movieId}", h.DeleteRating).Methods("DELETE")
+	r.HandleFunc("/cache", h.InvalidateCache).Methods("DELETE")
+	r.HandleFunc("/cache/users/{userId}", h.InvalidateUserCache).Methods("DELETE")
+	r.HandleFunc("/cache/genres/{genre}", h.InvalidateGenreCache).Methods("DELETE")
 
 	return r
 }
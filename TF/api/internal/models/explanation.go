@@ -0,0 +1,28 @@
+package models
+
+// Explanation dice por qué se recomendó una película.
+type Explanation struct {
+	MovieID string  `json:"movieId"`
+	Score   float64 `json:"score"` // calificación predicha
+
+	// modo user: usuarios parecidos que la calificaron
+	Neighbors []NeighborEvidence `json:"neighbors,omitempty"`
+	// modo item: películas parecidas que el usuario calificó ("porque
+	// calificaste bien X")
+	Because []RatedMovieEvidence `json:"because,omitempty"`
+}
+
+// NeighborEvidence es un usuario parecido que calificó la película.
+type NeighborEvidence struct {
+	UserID     string  `json:"userId"`
+	Similarity float64 `json:"similarity"`
+	Rating     float64 `json:"rating"` // su calificación de la película recomendada
+}
+
+// RatedMovieEvidence es una película que el usuario calificó y que se parece
+// a la recomendada.
+type RatedMovieEvidence struct {
+	Movie      Movie   `json:"movie"`
+	Similarity float64 `json:"similarity"`
+	Rating     float64 `json:"rating"` // calificación del usuario
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OnboardingProfile es el perfil corto que un usuario nuevo (o con pocas
+// calificaciones) completa al registrarse: géneros que le gustan y unas
+// pocas películas calificadas.
+type OnboardingProfile struct {
+	UserID    string             `json:"userId" bson:"_id"`
+	Genres    []string           `json:"genres" bson:"genres"`
+	Ratings   []OnboardingRating `json:"ratings" bson:"ratings"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// OnboardingRating es una película calificada en el perfil (0.5 a 5).
+type OnboardingRating struct {
+	MovieID string  `json:"movieId" bson:"movieId"`
+	Rating  float64 `json:"rating" bson:"rating"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// RecommendProgress es un avance parcial de una recomendación: el WebSocket
+// lo envía cada vez que un worker completa su parte, antes del mensaje final.
+type RecommendProgress struct {
+	Type    string  `json:"type"`    // siempre "progress"
+	Phase   string  `json:"phase"`   // fase del clúster: NEIGHBORS, PARTIAL o TOP_N
+	Percent float64 `json:"percent"` // 0 a 100
+	Done    int     `json:"done"`    // partes completadas
+	Total   int     `json:"total"`   // partes previstas
+
+	// Movies es el top-N con las listas de los workers que ya respondieron
+	// (ya filtrado por género); vacío hasta la fase TOP_N.
+	Movies  []Movie        `json:"movies,omitempty"`
+	Workers []WorkerTiming `json:"workers"`
+}
+
+// WorkerTiming son los tiempos de las partes que resolvió un worker.
+type WorkerTiming struct {
+	Worker  string `json:"worker"`
+	Chunks  int    `json:"chunks"`
+	TotalMs int64  `json:"totalMs"` // suma de los tiempos de sus partes
+	MaxMs   int64  `json:"maxMs"`   // la parte más lenta
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Rating es una calificación que envía un usuario (0.5 a 5).
+type Rating struct {
+	MovieID string  `json:"movieId" bson:"movieId"`
+	Rating  float64 `json:"rating" bson:"rating"`
+}
+
+// UserRating es una calificación cargada por la API, que se aplica sobre
+// las de matriz_usuarios_peliculas.csv al arrancar. Rating 0 indica que se
+// borró (también si venía del CSV).
+type UserRating struct {
+	UserID    string    `json:"userId" bson:"userId"`
+	MovieID   string    `json:"movieId" bson:"movieId"`
+	Rating    float64   `json:"rating" bson:"rating"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+
+	// versión del dataset que resultó del cambio; al arrancar se reusa la
+	// del último para no recalcular lo que el clúster ya tiene
+	DatasetVersion int64 `json:"datasetVersion,omitempty" bson:"datasetVersion,omitempty"`
+}
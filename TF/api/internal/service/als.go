@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/cluster/shared/compute"
+)
+
+// Plazo de un entrenamiento ALS en el clúster
+const alsTrainTimeout = 15 * time.Minute
+
+// Cada cuánto se reentrena, como mucho, un modelo ALS que quedó atrás de
+// las calificaciones cargadas por la API
+const alsRetrainInterval = 10 * time.Minute
+
+// ErrTrainingInProgress indica que ya hay un entrenamiento ALS en curso.
+var ErrTrainingInProgress = errors.New("ya hay un entrenamiento ALS en curso")
+
+// alsState guarda los factores vigentes con los que se atiende mode=als.
+type alsState struct {
+	mu        sync.RWMutex
+	model     *coordinator.FactorModel
+	training  bool
+	lastErr   error
+	retriedAt time.Time // último reentrenamiento lanzado por alsStale
+}
+
+// ALSStatus resume el modelo ALS vigente (sin los factores).
+type ALSStatus struct {
+	Ready          bool                  `json:"ready"`
+	Training       bool                  `json:"training"`
+	Stale          bool                  `json:"stale"` // entrenado con una versión anterior del dataset: mode=als usa filtrado por usuarios
+	DatasetID      string                `json:"datasetId,omitempty"`
+	DatasetVersion int64                 `json:"datasetVersion,omitempty"`
+	Params         coordinator.ALSParams `json:"params"`
+	RMSE           []float64             `json:"rmse,omitempty"`
+	TrainedAt      time.Time             `json:"trainedAt,omitempty"`
+	Error          string                `json:"error,omitempty"`
+}
+
+// LoadOrTrainALS carga de Mongo los factores del dataset vigente o, si no
+// existen, los entrena en el clúster. Pensado para correr en segundo plano
+// al arrancar: reintenta mientras el clúster no tenga workers.
+func (s *RecommendationService) LoadOrTrainALS() {
+	id, version, ok := s.Cluster.Dataset()
+	if !ok {
+		return
+	}
+
+	var model coordinator.FactorModel
+	found, err := s.Mongo.LoadFactorModel(id, version, &model)
+	if err != nil {
+		log.Printf("No se pudieron leer los factores ALS de Mongo: %v", err)
+	}
+	if found {
+		s.setALS(&model)
+		log.Printf("Factores ALS de %s v%d cargados de Mongo", id, version)
+		return
+	}
+
+	backoff := 5 * time.Second
+	for attempt := 1; attempt <= 5; attempt++ {
+		err := s.TrainALS(coordinator.ALSParams{})
+		if err == nil || errors.Is(err, ErrTrainingInProgress) {
+			return
+		}
+		log.Printf("Entrenamiento ALS inicial falló (intento %d): %v", attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// TrainALS entrena factores nuevos en el clúster, los guarda en Mongo y los
+// pone en uso. Devuelve ErrTrainingInProgress si ya hay uno en curso.
+func (s *RecommendationService) TrainALS(params coordinator.ALSParams) error {
+	s.als.mu.Lock()
+	if s.als.training {
+		s.als.mu.Unlock()
+		return ErrTrainingInProgress
+	}
+	s.als.training = true
+	s.als.mu.Unlock()
+
+	model, err := s.trainALS(params)
+
+	s.als.mu.Lock()
+	s.als.training = false
+	s.als.lastErr = err
+	s.als.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	s.setALS(model)
+	return nil
+}
+
+func (s *RecommendationService) trainALS(params coordinator.ALSParams) (*coordinator.FactorModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), alsTrainTimeout)
+	defer cancel()
+
+	start := time.Now()
+	model, err := s.Cluster.TrainALS(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	model.TrainedAt = time.Now()
+	log.Printf("Factores ALS de %s v%d entrenados en %s (RMSE final %.4f)",
+		model.DatasetID, model.DatasetVersion, time.Since(start).Round(time.Millisecond), lastOr(model.RMSE, 0))
+
+	if err := s.Mongo.SaveFactorModel(model.DatasetID, model.DatasetVersion, model); err != nil {
+		log.Printf("No se pudieron guardar los factores ALS en Mongo: %v", err)
+	}
+	return model, nil
+}
+
+func (s *RecommendationService) setALS(model *coordinator.FactorModel) {
+	s.als.mu.Lock()
+	s.als.model = model
+	s.als.lastErr = nil
+	s.als.mu.Unlock()
+}
+
+// ALSStatus describe el modelo ALS vigente y si hay un entrenamiento en curso.
+func (s *RecommendationService) ALSStatus() ALSStatus {
+	s.als.mu.RLock()
+	defer s.als.mu.RUnlock()
+
+	st := ALSStatus{Training: s.als.training}
+	if s.als.lastErr != nil {
+		st.Error = s.als.lastErr.Error()
+	}
+	if m := s.als.model; m != nil {
+		st.Ready = true
+		st.Stale = s.alsOutdated(m)
+		st.DatasetID = m.DatasetID
+		st.DatasetVersion = m.DatasetVersion
+		st.Params = m.Params
+		st.RMSE = m.RMSE
+		st.TrainedAt = m.TrainedAt
+	}
+	return st
+}
+
+// alsOutdated indica si model se entrenó con otra versión del dataset (las
+// calificaciones cargadas por la API crean versiones nuevas).
+func (s *RecommendationService) alsOutdated(model *coordinator.FactorModel) bool {
+	id, version, _ := s.Cluster.Dataset()
+	return model.DatasetID != id || model.DatasetVersion != version
+}
+
+// alsStale indica si hay un modelo ALS pero de otra versión del dataset; en
+// ese caso lanza en segundo plano un reentrenamiento, a lo sumo uno cada
+// alsRetrainInterval.
+func (s *RecommendationService) alsStale() bool {
+	s.als.mu.Lock()
+	model := s.als.model
+	if model == nil || !s.alsOutdated(model) {
+		s.als.mu.Unlock()
+		return false
+	}
+	retrain := !s.als.training && time.Since(model.TrainedAt) >= alsRetrainInterval &&
+		time.Since(s.als.retriedAt) >= alsRetrainInterval
+	if retrain {
+		s.als.retriedAt = time.Now()
+	}
+	s.als.mu.Unlock()
+
+	if retrain {
+		go func() {
+			if err := s.TrainALS(model.Params); err != nil && !errors.Is(err, ErrTrainingInProgress) {
+				log.Printf("No se pudo reentrenar el modelo ALS: %v", err)
+			}
+		}()
+	}
+	return true
+}
+
+// recommendALS puntúa las películas no vistas con el producto punto de los
+// factores del usuario y de cada película, y devuelve las n mejores.
+func (s *RecommendationService) recommendALS(idx, n int) ([]coordinator.ScoredItem, error) {
+	s.als.mu.RLock()
+	model := s.als.model
+	s.als.mu.RUnlock()
+
+	if model == nil {
+		return nil, fmt.Errorf("el modelo ALS todavía no está disponible")
+	}
+	if s.alsOutdated(model) {
+		return nil, fmt.Errorf("el modelo ALS es de una versión anterior del dataset")
+	}
+	matrix, _ := s.dataset()
+	if idx >= len(model.UserFactors) || idx >= matrix.Rows {
+		return nil, fmt.Errorf("el modelo ALS no tiene factores para el usuario %d", idx)
+	}
+
+	movies, scores := compute.FactorTopN(model.UserFactors[idx], model.ItemFactors, matrix.Row(idx), n)
+	items := make([]coordinator.ScoredItem, len(movies))
+	for i := range movies {
+		items[i] = coordinator.ScoredItem{Index: movies[i], Score: scores[i]}
+	}
+	return items, nil
+}
+
+func lastOr(values []float64, def float64) float64 {
+	if len(values) == 0 {
+		return def
+	}
+	return values[len(values)-1]
+}
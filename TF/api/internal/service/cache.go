@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Cada recomendación en caché (con sus métricas y explicaciones) lleva
+// etiquetas para descartarla junto con otras: la de todas las
+// recomendaciones, la del usuario, la del filtro de género y la de la
+// versión del dataset con la que se calculó. Las calificaciones nuevas de
+// un usuario descartan solo sus entradas; las de los demás, calculadas con
+// la versión anterior, se siguen sirviendo hasta su TTL o hasta que se
+// descarten las de versiones viejas (PurgeStaleCache).
+const cacheTagAll = "rec"
+
+func userCacheTag(userID string) string {
+	return cacheTagAll + ":user:" + userID
+}
+
+func genreCacheTag(genre string) string {
+	return cacheTagAll + ":genre:" + genre
+}
+
+func datasetCacheTag(id string, version int64) string {
+	return fmt.Sprintf("%s:dataset:%s:%d", cacheTagAll, id, version)
+}
+
+// CacheInvalidation informa cuántas claves se borraron de la caché.
+type CacheInvalidation struct {
+	Deleted int `json:"deleted"`
+}
+
+// cacheTags son las etiquetas de una recomendación del usuario con p.
+func (s *RecommendationService) cacheTags(userIdStr string, p RecommendParams) []string {
+	tags := []string{cacheTagAll, userCacheTag(userIdStr)}
+	if p.Genre != "" {
+		tags = append(tags, genreCacheTag(p.Genre))
+	}
+	if id, version, ok := s.Cluster.Dataset(); ok {
+		tags = append(tags, datasetCacheTag(id, version))
+	}
+	return tags
+}
+
+// InvalidateUserCache descarta las recomendaciones en caché del usuario.
+func (s *RecommendationService) InvalidateUserCache(userID string) (*CacheInvalidation, error) {
+	n, err := s.Redis.InvalidateTag(userCacheTag(strings.TrimSpace(userID)))
+	return &CacheInvalidation{Deleted: n}, err
+}
+
+// InvalidateGenreCache descarta las recomendaciones en caché pedidas con
+// ese filtro de género.
+func (s *RecommendationService) InvalidateGenreCache(genre string) (*CacheInvalidation, error) {
+	genre = strings.TrimSpace(strings.ToLower(genre))
+	if genre == "" {
+		return nil, fmt.Errorf("falta el género")
+	}
+	n, err := s.Redis.InvalidateTag(genreCacheTag(genre))
+	return &CacheInvalidation{Deleted: n}, err
+}
+
+// InvalidateCache descarta todas las recomendaciones en caché.
+func (s *RecommendationService) InvalidateCache() (*CacheInvalidation, error) {
+	return s.invalidateTags(func(string) bool { return true })
+}
+
+// PurgeStaleCache descarta las recomendaciones calculadas con otras
+// versiones del dataset. Se llama al arrancar, cuando el dataset pudo
+// cambiar desde la última ejecución.
+func (s *RecommendationService) PurgeStaleCache() {
+	id, version, ok := s.Cluster.Dataset()
+	if !ok {
+		return
+	}
+	current := datasetCacheTag(id, version)
+	prefix := cacheTagAll + ":dataset:"
+	inv, err := s.invalidateTags(func(tag string) bool {
+		return strings.HasPrefix(tag, prefix) && tag != current
+	})
+	if err != nil {
+		log.Printf("No se pudieron descartar las recomendaciones en caché de versiones anteriores: %v", err)
+		return
+	}
+	if inv.Deleted > 0 {
+		log.Printf("Descartadas %d claves en caché de versiones anteriores del dataset %s", inv.Deleted, id)
+	}
+}
+
+// invalidateTags descarta las claves de las etiquetas de recomendaciones
+// que cumplen match.
+func (s *RecommendationService) invalidateTags(match func(tag string) bool) (*CacheInvalidation, error) {
+	tags, err := s.Redis.Tags(cacheTagAll)
+	if err != nil {
+		return nil, err
+	}
+	inv := &CacheInvalidation{}
+	for _, tag := range tags {
+		if !match(tag) {
+			continue
+		}
+		n, err := s.Redis.InvalidateTag(tag)
+		inv.Deleted += n
+		if err != nil {
+			return inv, err
+		}
+	}
+	return inv, nil
+}
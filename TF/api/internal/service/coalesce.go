@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sdr/api/internal/models"
+)
+
+// Una recomendación que no está en caché se calcula una sola vez aunque
+// lleguen a la vez varias solicitudes iguales (mismo usuario, filtros y
+// límite): las de esta réplica esperan el mismo cálculo (flightGroup) y las
+// de otras réplicas, que no pueden tomar el lock de Redis de quien la
+// calcula, esperan a que aparezca en la caché. Las entradas se guardan
+// StaleTTL más allá de su vigencia (CacheTTL): vencidas se siguen sirviendo
+// mientras una sola solicitud las recalcula en segundo plano.
+
+// Duración del lock de Redis de un cálculo: más que el plazo de una
+// solicitud al clúster, así no lo toma otra réplica mientras sigue en curso
+const cacheLockTTL = 30 * time.Second
+
+// Cada cuánto se mira la caché mientras otra réplica calcula
+const cachePollInterval = 100 * time.Millisecond
+
+// Origen de la respuesta, informado en las métricas (campo cache)
+const (
+	CacheMiss   = "miss"   // se calculó para esta solicitud
+	CacheShared = "shared" // se esperó el cálculo de otra solicitud igual
+	CacheHit    = "hit"
+	CacheStale  = "stale" // vencida; se está recalculando en segundo plano
+)
+
+// errCacheBusy indica que otra réplica ya está recalculando la entrada.
+var errCacheBusy = errors.New("otra réplica está calculando la recomendación")
+
+// cachedRecommendation es una recomendación guardada en Redis.
+type cachedRecommendation struct {
+	Movies       []models.Movie         `json:"movies"`
+	Explanations []models.Explanation   `json:"explanations,omitempty"`
+	Strategy     string                 `json:"strategy"`
+	Metrics      map[string]interface{} `json:"metrics"`
+	FreshUntil   time.Time              `json:"freshUntil"`
+}
+
+// recommendFunc calcula una recomendación, informando los avances a
+// onProgress (nunca nil).
+type recommendFunc func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error)
+
+// cacheRequest es una recomendación que se busca en caché o se calcula.
+type cacheRequest struct {
+	key     string // clave en Redis
+	userID  string
+	params  RecommendParams
+	compute recommendFunc
+}
+
+// flight identifica el cálculo en curso: la misma clave con la misma
+// versión del dataset, así una solicitud posterior a un cambio de
+// calificaciones no se suma a un cálculo con los datos anteriores.
+func (r cacheRequest) flight(s *RecommendationService) string {
+	id, version, _ := s.Cluster.Dataset()
+	return fmt.Sprintf("%s@%s:%d", r.key, id, version)
+}
+
+// cachedRecommend devuelve la recomendación de req desde la caché o, si no
+// está, la calcula compartiendo el cálculo con las solicitudes iguales en
+// curso. onProgress puede ser nil.
+func (s *RecommendationService) cachedRecommend(ctx context.Context, req cacheRequest, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+	var entry cachedRecommendation
+	if found, _ := s.Redis.GetCached(req.key, &entry); found {
+		if time.Now().Before(entry.FreshUntil) {
+			return entry.recommendation(CacheHit), nil
+		}
+		s.revalidate(req)
+		return entry.recommendation(CacheStale), nil
+	}
+
+	rec, shared, err := s.flights.do(ctx, req.flight(s), onProgress, func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+		return s.fillCache(ctx, req, true, onProgress)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		return withCacheStatus(rec, CacheShared), nil
+	}
+	return rec, nil
+}
+
+// revalidate recalcula en segundo plano una entrada vencida, salvo que ya
+// lo esté haciendo esta u otra réplica.
+func (s *RecommendationService) revalidate(req cacheRequest) {
+	key := req.flight(s) + ":revalidate"
+	if s.flights.running(key) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cacheLockTTL)
+		defer cancel()
+		_, _, err := s.flights.do(ctx, key, nil, func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+			return s.fillCache(ctx, req, false, onProgress)
+		})
+		if err != nil && !errors.Is(err, errCacheBusy) {
+			log.Printf("No se pudo recalcular la recomendación en caché %s: %v", req.key, err)
+		}
+	}()
+}
+
+// fillCache calcula la recomendación de req y la guarda en caché, con el
+// lock de Redis tomado para que las otras réplicas no la calculen a la vez.
+// Si el lock lo tiene otra réplica, con wait espera a que guarde su
+// resultado (y lo calcula igual si no aparece) y sin wait devuelve
+// errCacheBusy. Si Redis no responde se calcula sin lock.
+func (s *RecommendationService) fillCache(ctx context.Context, req cacheRequest, wait bool, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+	lock := req.flight(s)
+	token, err := s.Redis.TryLock(lock, cacheLockTTL)
+	if err == nil && token == "" {
+		if !wait {
+			return nil, errCacheBusy
+		}
+		if rec, ok := s.awaitCache(ctx, req.key, lock); ok {
+			return rec, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		token, _ = s.Redis.TryLock(lock, cacheLockTTL)
+	}
+	if token != "" {
+		defer func() {
+			if err := s.Redis.Unlock(lock, token); err != nil {
+				log.Printf("No se pudo soltar el lock %s: %v", lock, err)
+			}
+		}()
+	}
+
+	// las etiquetas llevan la versión del dataset con la que se calcula; si
+	// cambia en el medio, la caché del usuario pudo haberse invalidado y el
+	// resultado no se guarda
+	_, version, _ := s.Cluster.Dataset()
+	tags := s.cacheTags(req.userID, req.params)
+	rec, err := req.compute(ctx, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	if _, now, _ := s.Cluster.Dataset(); now == version {
+		entry := cachedRecommendation{
+			Movies:       rec.Movies,
+			Explanations: rec.Explanations,
+			Strategy:     rec.Strategy,
+			Metrics:      rec.Metrics,
+			FreshUntil:   time.Now().Add(s.CacheTTL),
+		}
+		_ = s.Redis.SetCachedTagged(req.key, entry, s.CacheTTL+s.StaleTTL, tags...)
+	}
+	return withCacheStatus(rec, CacheMiss), nil
+}
+
+// awaitCache espera a que la réplica que tiene el lock guarde la
+// recomendación en key. Devuelve false si el lock se soltó o venció sin
+// que aparezca, o si ctx se canceló.
+func (s *RecommendationService) awaitCache(ctx context.Context, key, lock string) (*Recommendation, bool) {
+	ticker := time.NewTicker(cachePollInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(cacheLockTTL)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-ticker.C:
+		}
+		var entry cachedRecommendation
+		if found, _ := s.Redis.GetCached(key, &entry); found {
+			return entry.recommendation(CacheShared), true
+		}
+		if held, err := s.Redis.Locked(lock); err != nil || !held {
+			// pudo guardarla justo antes de soltar el lock
+			if found, _ := s.Redis.GetCached(key, &entry); found {
+				return entry.recommendation(CacheShared), true
+			}
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func (e cachedRecommendation) recommendation(status string) *Recommendation {
+	return withCacheStatus(&Recommendation{
+		Movies:       e.Movies,
+		Explanations: e.Explanations,
+		Strategy:     e.Strategy,
+		Metrics:      e.Metrics,
+	}, status)
+}
+
+// withCacheStatus devuelve una copia de rec con el origen de la respuesta
+// en las métricas (las de rec pueden estar compartidas con otras
+// solicitudes).
+func withCacheStatus(rec *Recommendation, status string) *Recommendation {
+	metrics := make(map[string]interface{}, len(rec.Metrics)+1)
+	for k, v := range rec.Metrics {
+		metrics[k] = v
+	}
+	metrics["cache"] = status
+	out := *rec
+	out.Metrics = metrics
+	return &out
+}
+
+// ---------------------------------------------------------
+//    Cálculos compartidos entre solicitudes iguales
+// ---------------------------------------------------------
+
+// flightGroup agrupa las solicitudes concurrentes con la misma clave para
+// que compartan un solo cálculo. A diferencia de singleflight, el cálculo
+// corre con su propio contexto, que se cancela recién cuando se van todas
+// las solicitudes que lo esperan, y sus avances llegan a todas.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done   chan struct{}
+	rec    *Recommendation
+	err    error
+	cancel context.CancelCauseFunc
+
+	// protegidos por flightGroup.mu
+	waiters   int
+	nextSub   int
+	listeners map[int]func(models.RecommendProgress)
+}
+
+// running informa si hay un cálculo en curso con esa clave.
+func (g *flightGroup) running(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.flights[key]
+	return ok
+}
+
+// do ejecuta fn, o se suma a la ejecución en curso con la misma clave, y
+// espera su resultado; shared indica que la inició otra solicitud. Si ctx
+// se cancela antes, devuelve su error; fn se cancela (con la misma causa)
+// solo si no queda ninguna solicitud esperándola. onProgress (puede ser nil)
+// recibe los avances desde que se suma.
+func (g *flightGroup) do(ctx context.Context, key string, onProgress func(models.RecommendProgress), fn recommendFunc) (rec *Recommendation, shared bool, err error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if !shared {
+		// el cálculo conserva los valores de ctx pero no su cancelación
+		fctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel, listeners: make(map[int]func(models.RecommendProgress))}
+		g.flights[key] = f
+		go g.run(fctx, key, f, fn)
+	}
+	f.waiters++
+	sub := -1
+	if onProgress != nil {
+		sub = f.nextSub
+		f.nextSub++
+		f.listeners[sub] = onProgress
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.rec, shared, f.err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	f.waiters--
+	delete(f.listeners, sub)
+	if f.waiters == 0 {
+		// las solicitudes que lleguen desde ahora inician otro cálculo
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		f.cancel(context.Cause(ctx))
+	}
+	g.mu.Unlock()
+	return nil, shared, ctx.Err()
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn recommendFunc) {
+	defer func() {
+		g.mu.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		g.mu.Unlock()
+		f.cancel(nil)
+		close(f.done)
+	}()
+
+	f.rec, f.err = fn(ctx, func(pr models.RecommendProgress) {
+		g.mu.Lock()
+		listeners := make([]func(models.RecommendProgress), 0, len(f.listeners))
+		for _, l := range f.listeners {
+			listeners = append(listeners, l)
+		}
+		g.mu.Unlock()
+		for _, l := range listeners {
+			l(pr)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"sdr/api/internal/models"
+)
+
+const testFlight = "rec:u1@ml:1"
+
+// waitWaiters espera a que n solicitudes estén esperando el cálculo de key.
+func waitWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		g.mu.Lock()
+		f := g.flights[key]
+		got := 0
+		if f != nil {
+			got = f.waiters
+		}
+		g.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d solicitudes esperando %s, se esperaban %d", got, key, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlightGroupSharesOneRun(t *testing.T) {
+	var g flightGroup
+	var mu sync.Mutex
+	runs := 0
+	release := make(chan struct{})
+	want := &Recommendation{Strategy: "cf"}
+	fn := func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		<-release
+		return want, nil
+	}
+
+	const callers = 5
+	type result struct {
+		rec    *Recommendation
+		shared bool
+		err    error
+	}
+	results := make(chan result, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			rec, shared, err := g.do(context.Background(), testFlight, nil, fn)
+			results <- result{rec, shared, err}
+		}()
+	}
+	waitWaiters(t, &g, testFlight, callers)
+	close(release)
+
+	started := 0
+	for i := 0; i < callers; i++ {
+		r := <-results
+		if r.err != nil || r.rec != want {
+			t.Errorf("do = %v, %v; se esperaba el resultado del cálculo compartido", r.rec, r.err)
+		}
+		if !r.shared {
+			started++
+		}
+	}
+	if runs != 1 || started != 1 {
+		t.Errorf("%d cálculos iniciados por %d solicitudes, se esperaba uno solo", runs, started)
+	}
+	if g.running(testFlight) {
+		t.Error("el cálculo terminado no debería seguir registrado")
+	}
+}
+
+func TestFlightGroupCancelsAfterLastWaiter(t *testing.T) {
+	var g flightGroup
+	running := make(chan context.Context, 2)
+	fn := func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+		running <- ctx
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancelCause(context.Background())
+	defer cancel1()
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		go func() {
+			_, _, err := g.do(ctx, testFlight, nil, fn)
+			errs <- err
+		}()
+	}
+	waitWaiters(t, &g, testFlight, 2)
+	fctx := <-running
+
+	// se va una: el cálculo sigue para la otra
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("la solicitud cancelada devolvió %v", err)
+	}
+	if fctx.Err() != nil {
+		t.Fatal("el cálculo se canceló aunque otra solicitud lo sigue esperando")
+	}
+	if !g.running(testFlight) {
+		t.Error("el cálculo debería seguir registrado para la solicitud que queda")
+	}
+
+	// se va la última: se cancela con su causa
+	cause := errors.New("el cliente se desconectó")
+	cancel2(cause)
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("la última solicitud devolvió %v", err)
+	}
+	select {
+	case <-fctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("el cálculo no se canceló al irse la última solicitud")
+	}
+	if got := context.Cause(fctx); got != cause {
+		t.Errorf("causa de la cancelación = %v, se esperaba %v", got, cause)
+	}
+
+	// la siguiente solicitud inicia otro cálculo
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	go g.do(ctx3, testFlight, nil, fn)
+	select {
+	case <-running:
+	case <-time.After(2 * time.Second):
+		t.Error("una solicitud posterior debería iniciar otro cálculo")
+	}
+	cancel3()
+}
+
+func TestFlightGroupLateJoinerGetsProgress(t *testing.T) {
+	var g flightGroup
+	step := make(chan struct{})
+	fn := func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+		onProgress(models.RecommendProgress{Phase: "NEIGHBORS", Percent: 30})
+		<-step
+		onProgress(models.RecommendProgress{Phase: "TOP_N", Percent: 90})
+		return &Recommendation{}, nil
+	}
+
+	// recorder guarda las fases recibidas y avisa de cada una
+	type recorder struct {
+		mu     sync.Mutex
+		phases []string
+		got    chan struct{}
+	}
+	listen := func(r *recorder) func(models.RecommendProgress) {
+		return func(pr models.RecommendProgress) {
+			r.mu.Lock()
+			r.phases = append(r.phases, pr.Phase)
+			r.mu.Unlock()
+			r.got <- struct{}{}
+		}
+	}
+	first := &recorder{got: make(chan struct{}, 2)}
+	late := &recorder{got: make(chan struct{}, 2)}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		g.do(context.Background(), testFlight, listen(first), fn)
+		done <- struct{}{}
+	}()
+	<-first.got
+
+	// se suma con el cálculo ya avanzado: recibe los avances desde ahí
+	go func() {
+		if _, shared, _ := g.do(context.Background(), testFlight, listen(late), fn); !shared {
+			t.Error("la solicitud tardía debería compartir el cálculo en curso")
+		}
+		done <- struct{}{}
+	}()
+	waitWaiters(t, &g, testFlight, 2)
+	close(step)
+	<-done
+	<-done
+
+	if len(first.phases) != 2 {
+		t.Errorf("la primera solicitud recibió %v, se esperaban las dos fases", first.phases)
+	}
+	if len(late.phases) != 1 || late.phases[0] != "TOP_N" {
+		t.Errorf("la solicitud tardía recibió %v, se esperaba solo TOP_N", late.phases)
+	}
+}
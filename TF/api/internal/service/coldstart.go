@@ -0,0 +1,353 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/data"
+	"sdr/api/internal/models"
+	"sdr/cluster/shared/sparse"
+)
+
+// Estrategias de recomendación según lo que se sabe del usuario: filtrado
+// colaborativo con suficientes calificaciones; si no, de menos a más
+// información, popularidad global (ninguna calificación), popularidad en
+// sus géneros (unas pocas) o su perfil de onboarding (si lo completó).
+const (
+	StrategyCollaborative    = "collaborative"
+	StrategyGlobalPopularity = "global_popularity"
+	StrategyGenrePopularity  = "genre_popularity"
+	StrategyOnboarding       = "onboarding"
+)
+
+// Calificaciones mínimas para usar filtrado colaborativo: con menos, los
+// vecinos más parecidos son ruido
+const defaultMinCFRatings = 5
+
+// Calificaciones ficticias con la media global que se suman a cada película
+// al ordenar por popularidad, para que una película con dos cincos no
+// supere a una con cientos de calificaciones altas
+const popularityPrior = 10
+
+// Géneros preferidos que se usan en la popularidad por género; un género
+// elegido en el perfil pesa como una calificación máxima (1 en la escala de
+// la matriz)
+const (
+	coldStartGenres       = 3
+	onboardingGenreWeight = 1.0
+)
+
+// Límites de un perfil de onboarding (es un perfil corto)
+const (
+	maxOnboardingGenres  = 5
+	maxOnboardingRatings = 20
+)
+
+var ErrNoOnboarding = errors.New("el usuario no tiene perfil de onboarding")
+
+// coldStartPlan es la estrategia elegida para un usuario y lo que necesita.
+type coldStartPlan struct {
+	strategy string
+	index    int           // índice del usuario en la matriz, -1 si no está
+	row      sparse.Vector // sus calificaciones (más las del perfil en onboarding)
+	popular  bool          // ordenar por popularidad en vez de pedir al clúster
+	genres   []string      // géneros preferidos (vacío = popularidad global)
+	profile  *models.OnboardingProfile
+}
+
+// cacheSuffix distingue en la caché las recomendaciones de arranque en frío
+// (y cada versión del perfil) de las colaborativas.
+func (c coldStartPlan) cacheSuffix() string {
+	switch {
+	case c.strategy == StrategyCollaborative:
+		return ""
+	case c.profile != nil:
+		return fmt.Sprintf(":%s:%d", c.strategy, c.profile.UpdatedAt.UnixNano())
+	default:
+		return ":" + c.strategy
+	}
+}
+
+// coldStart elige la estrategia del usuario según cuántas calificaciones
+// tiene. Con menos de MinCFRatings se usa su perfil de onboarding si lo
+// tiene: sus películas se suman a la fila y, si con ellas alcanza, se pide
+// al clúster como un usuario más; si no, popularidad en sus géneros. Sin
+// perfil, popularidad en los géneros que calificó o, si no calificó nada
+// (o no está en el dataset), popularidad global.
+func (s *RecommendationService) coldStart(userIdStr string) (coldStartPlan, error) {
+	matrix, mappings := s.dataset()
+	plan := coldStartPlan{strategy: StrategyCollaborative, index: -1, row: sparse.Vector{Dim: matrix.Cols}}
+	if idx, ok := mappings.UserOriginalToIndex[userIdStr]; ok {
+		plan.index = idx
+		plan.row = matrix.Row(idx)
+	}
+	if plan.row.NNZ() >= s.MinCFRatings {
+		return plan, nil
+	}
+
+	var profile models.OnboardingProfile
+	found, err := s.Mongo.LoadOnboarding(userIdStr, &profile)
+	if err != nil {
+		// sin Mongo se sigue con lo que hay en la matriz
+		log.Printf("No se pudo cargar el perfil de onboarding de %s: %v", userIdStr, err)
+	}
+	if found {
+		plan.strategy = StrategyOnboarding
+		plan.profile = &profile
+		plan.row = withProfile(plan.row, profile, mappings)
+		if plan.row.NNZ() >= s.MinCFRatings {
+			return plan, nil
+		}
+		plan.popular = true
+		plan.genres = s.preferredGenres(plan.row, profile.Genres)
+		return plan, nil
+	}
+
+	plan.popular = true
+	if plan.row.NNZ() > 0 {
+		plan.genres = s.preferredGenres(plan.row, nil)
+	}
+	if len(plan.genres) > 0 {
+		plan.strategy = StrategyGenrePopularity
+	} else {
+		plan.strategy = StrategyGlobalPopularity
+	}
+	return plan, nil
+}
+
+// withProfile suma a la fila las películas del perfil que el usuario no
+// calificó en el dataset, llevadas a la escala de la matriz.
+func withProfile(row sparse.Vector, profile models.OnboardingProfile, mappings *data.Mappings) sparse.Vector {
+	ratings := make(map[int]float64, row.NNZ()+len(profile.Ratings))
+	for _, r := range profile.Ratings {
+		if j, ok := mappings.MovieOriginalToIndex[r.MovieID]; ok {
+			ratings[j] = data.ScaleRating(r.Rating)
+		}
+	}
+	for k, j := range row.Idx {
+		ratings[j] = row.Val[k]
+	}
+
+	out := sparse.Vector{Dim: row.Dim}
+	for j := range ratings {
+		out.Idx = append(out.Idx, j)
+	}
+	sort.Ints(out.Idx)
+	out.Val = make([]float64, len(out.Idx))
+	for k, j := range out.Idx {
+		out.Val[k] = ratings[j]
+	}
+	return out
+}
+
+// preferredGenres devuelve los géneros con más peso: la suma de las
+// calificaciones de las películas de cada género más los elegidos en el
+// perfil.
+func (s *RecommendationService) preferredGenres(row sparse.Vector, chosen []string) []string {
+	weight := make(map[string]float64)
+	for k, j := range row.Idx {
+		mv, ok := s.movieByIndex(j)
+		if !ok {
+			continue
+		}
+		for _, g := range movieGenres(mv) {
+			weight[g] += row.Val[k]
+		}
+	}
+	for _, g := range chosen {
+		weight[g] += onboardingGenreWeight
+	}
+
+	genres := make([]string, 0, len(weight))
+	for g := range weight {
+		genres = append(genres, g)
+	}
+	sort.Slice(genres, func(a, b int) bool {
+		if weight[genres[a]] != weight[genres[b]] {
+			return weight[genres[a]] > weight[genres[b]]
+		}
+		return genres[a] < genres[b]
+	})
+	if len(genres) > coldStartGenres {
+		genres = genres[:coldStartGenres]
+	}
+	return genres
+}
+
+// movieGenres separa los géneros de una película ("adventure|animation").
+func movieGenres(mv models.Movie) []string {
+	var out []string
+	for _, g := range strings.Split(mv.Genre, "|") {
+		if g != "" && g != "(no genres listed)" {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// popularItems devuelve las n películas más populares que el usuario no
+// calificó, de alguno de los géneros del plan (si tiene) y del filtro genre.
+func (s *RecommendationService) popularItems(plan coldStartPlan, genre string, n int) []coordinator.ScoredItem {
+	rated := make(map[int]bool, plan.row.NNZ())
+	for _, j := range plan.row.Idx {
+		rated[j] = true
+	}
+
+	var items []coordinator.ScoredItem
+	for _, it := range s.popularMovies() {
+		if len(items) >= n {
+			break
+		}
+		if rated[it.Index] {
+			continue
+		}
+		mv, ok := s.movieByIndex(it.Index)
+		if !ok || (genre != "" && !strings.Contains(strings.ToLower(mv.Genre), genre)) {
+			continue
+		}
+		if len(plan.genres) > 0 && !hasAnyGenre(mv, plan.genres) {
+			continue
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+func hasAnyGenre(mv models.Movie, genres []string) bool {
+	for _, g := range movieGenres(mv) {
+		for _, want := range genres {
+			if g == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// popularityState guarda el ranking de popularidad, que se calcula una vez
+// por matriz.
+type popularityState struct {
+	mu     sync.Mutex
+	ranked []coordinator.ScoredItem
+}
+
+// popularMovies devuelve todas las películas calificadas ordenadas por
+// popularidad: la media de sus calificaciones suavizada hacia la media
+// global con popularityPrior calificaciones.
+func (s *RecommendationService) popularMovies() []coordinator.ScoredItem {
+	s.popularity.mu.Lock()
+	defer s.popularity.mu.Unlock()
+
+	if s.popularity.ranked != nil {
+		return s.popularity.ranked
+	}
+
+	m, _ := s.dataset()
+	counts := make([]int, m.Cols)
+	sums := make([]float64, m.Cols)
+	for k, j := range m.ColIdx {
+		counts[j]++
+		sums[j] += m.Values[k]
+	}
+	global := 0.0
+	if len(m.Values) > 0 {
+		for _, v := range m.Values {
+			global += v
+		}
+		global /= float64(len(m.Values))
+	}
+
+	ranked := make([]coordinator.ScoredItem, 0, m.Cols)
+	for j := range counts {
+		if counts[j] == 0 {
+			continue
+		}
+		score := (sums[j] + popularityPrior*global) / float64(counts[j]+popularityPrior)
+		ranked = append(ranked, coordinator.ScoredItem{Index: j, Score: score})
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].Score > ranked[b].Score })
+
+	s.popularity.ranked = ranked
+	return ranked
+}
+
+// SaveOnboarding valida y guarda el perfil de onboarding del usuario (que
+// puede no estar todavía en el dataset).
+func (s *RecommendationService) SaveOnboarding(userID string, profile models.OnboardingProfile) (*models.OnboardingProfile, error) {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		return nil, fmt.Errorf("falta el usuario")
+	}
+	if len(profile.Genres) == 0 && len(profile.Ratings) == 0 {
+		return nil, fmt.Errorf("el perfil necesita al menos un género o una película calificada")
+	}
+	if len(profile.Genres) > maxOnboardingGenres {
+		return nil, fmt.Errorf("el perfil admite hasta %d géneros", maxOnboardingGenres)
+	}
+	if len(profile.Ratings) > maxOnboardingRatings {
+		return nil, fmt.Errorf("el perfil admite hasta %d películas calificadas", maxOnboardingRatings)
+	}
+
+	known := s.knownGenres()
+	genres := make([]string, 0, len(profile.Genres))
+	seen := make(map[string]bool)
+	for _, g := range profile.Genres {
+		g = strings.TrimSpace(strings.ToLower(g))
+		if !known[g] {
+			return nil, fmt.Errorf("género desconocido: %q", g)
+		}
+		if !seen[g] {
+			seen[g] = true
+			genres = append(genres, g)
+		}
+	}
+	_, mappings := s.dataset()
+	for _, r := range profile.Ratings {
+		if _, ok := mappings.MovieOriginalToIndex[r.MovieID]; !ok {
+			return nil, fmt.Errorf("película desconocida: %q", r.MovieID)
+		}
+		if r.Rating < data.MinRating || r.Rating > data.MaxRating {
+			return nil, fmt.Errorf("la calificación de %s debe estar entre %g y %g", r.MovieID, data.MinRating, data.MaxRating)
+		}
+	}
+
+	out := models.OnboardingProfile{UserID: userID, Genres: genres, Ratings: profile.Ratings, UpdatedAt: time.Now()}
+	if err := s.Mongo.SaveOnboarding(userID, out); err != nil {
+		return nil, err
+	}
+	// las claves ya distinguen cada versión del perfil; esto solo libera las viejas
+	if _, err := s.InvalidateUserCache(userID); err != nil {
+		log.Printf("No se pudo invalidar la caché del usuario %s: %v", userID, err)
+	}
+	return &out, nil
+}
+
+// Onboarding devuelve el perfil de onboarding del usuario.
+func (s *RecommendationService) Onboarding(userID string) (*models.OnboardingProfile, error) {
+	var profile models.OnboardingProfile
+	found, err := s.Mongo.LoadOnboarding(userID, &profile)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNoOnboarding
+	}
+	return &profile, nil
+}
+
+// knownGenres son los géneros sueltos de todas las películas.
+func (s *RecommendationService) knownGenres() map[string]bool {
+	known := make(map[string]bool)
+	for _, mv := range s.Movies {
+		for _, g := range movieGenres(mv) {
+			known[g] = true
+		}
+	}
+	return known
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/models"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/protocol"
+)
+
+// Tipos de job asíncrono
+const (
+	JobRecommendation = "recommendation"
+	JobSimilarity     = "similarity"
+)
+
+// Cada cuánto se consulta al coordinador un job en curso, plazo de cada
+// consulta y cuánto se conservan en Mongo los jobs terminados
+const (
+	jobPollInterval   = time.Second
+	jobCallTimeout    = 10 * time.Second
+	jobRetention      = 24 * time.Hour
+	jobExpireInterval = time.Hour
+)
+
+// Películas por defecto de un job de recomendación sin limit
+const defaultJobLimit = 10
+
+var (
+	ErrJobNotFound = errors.New("job no encontrado")
+	ErrJobFinished = errors.New("el job ya terminó")
+)
+
+// JobRequest es un job asíncrono: una recomendación (con los mismos filtros
+// y opciones que GET /recommend) o los usuarios más parecidos a cada
+// usuario (solo metric, normalization y k).
+type JobRequest struct {
+	Type          string `json:"type" bson:"type"`                                       // recommendation o similarity
+	UserID        string `json:"userId,omitempty" bson:"userId,omitempty"`               // solo recommendation
+	Limit         int    `json:"limit,omitempty" bson:"limit,omitempty"`                 // 0 = 10
+	Genre         string `json:"genre,omitempty" bson:"genre,omitempty"`                 // filtro opcional
+	Metric        string `json:"metric,omitempty" bson:"metric,omitempty"`               // vacío = configuración adoptada o cosine
+	Mode          string `json:"mode,omitempty" bson:"mode,omitempty"`                   // user o item (als no necesita job)
+	K             int    `json:"k,omitempty" bson:"k,omitempty"`                         // 0 = configuración adoptada o limit (similarity: 20)
+	Normalization string `json:"normalization,omitempty" bson:"normalization,omitempty"` // vacío = configuración adoptada o none
+	Explain       bool   `json:"explain,omitempty" bson:"explain,omitempty"`
+
+	coordinator.Confidence `bson:",inline"`
+}
+
+// Job es un job asíncrono: lo ejecuta el coordinador y la API guarda su
+// estado y su resultado en Mongo, así que sobrevive a reinicios de la API.
+type Job struct {
+	ID             string                    `json:"id" bson:"_id"`
+	Request        JobRequest                `json:"request" bson:"request"`
+	State          string                    `json:"state" bson:"state"` // queued, running, done, failed o cancelled
+	Error          string                    `json:"error,omitempty" bson:"error,omitempty"`
+	DatasetID      string                    `json:"datasetId" bson:"datasetId"`
+	DatasetVersion int64                     `json:"datasetVersion" bson:"datasetVersion"`
+	CreatedAt      time.Time                 `json:"createdAt" bson:"createdAt"`
+	StartedAt      *time.Time                `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt     *time.Time                `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	Progress       *models.RecommendProgress `json:"progress,omitempty" bson:"-"` // último avance (solo en curso)
+	Result         *JobResult                `json:"result,omitempty" bson:"-"`   // solo si terminó bien (en GridFS)
+}
+
+// JobResult es el resultado de un job: películas (y explicaciones) de una
+// recomendación o los vecinos de cada usuario.
+type JobResult struct {
+	Movies       []models.Movie       `json:"movies,omitempty"`
+	Explanations []models.Explanation `json:"explanations,omitempty"`
+	Similarity   *UserNeighbors       `json:"similarity,omitempty"`
+}
+
+// UserNeighbors son los usuarios más parecidos a cada usuario del dataset
+// (la matriz de similitud completa no entra en memoria con muchos
+// usuarios).
+type UserNeighbors struct {
+	Metric        string           `json:"metric"`
+	Normalization string           `json:"normalization"`
+	Users         []UserSimilarity `json:"users"`
+}
+
+// UserSimilarity son los usuarios más parecidos a UserID, de mayor a menor
+// similitud.
+type UserSimilarity struct {
+	UserID    string        `json:"userId"`
+	Neighbors []SimilarUser `json:"neighbors"`
+}
+
+// SimilarUser es un usuario parecido con su similitud.
+type SimilarUser struct {
+	UserID     string  `json:"userId"`
+	Similarity float64 `json:"similarity"`
+}
+
+func (j *Job) terminal() bool {
+	return j.State == coordinator.JobDone || j.State == coordinator.JobFailed || j.State == coordinator.JobCancelled
+}
+
+// jobParams son las opciones de recomendación del job, completadas con la
+// configuración adoptada.
+func (s *RecommendationService) jobParams(req JobRequest) RecommendParams {
+	return s.WithDefaults(RecommendParams{
+		Limit:         req.Limit,
+		Genre:         req.Genre,
+		Metric:        req.Metric,
+		Mode:          req.Mode,
+		K:             req.K,
+		Normalization: req.Normalization,
+		Confidence:    req.Confidence,
+		Explain:       req.Explain,
+	}).normalize()
+}
+
+// SubmitJob valida req, lo encola en el coordinador y guarda el job en
+// Mongo; un watcher lo sigue hasta que termina y guarda su resultado.
+func (s *RecommendationService) SubmitJob(req JobRequest) (*Job, error) {
+	req.Type = strings.TrimSpace(strings.ToLower(req.Type))
+	if req.Limit == 0 {
+		req.Limit = defaultJobLimit
+	}
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("limit no puede ser negativo")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobCallTimeout)
+	defer cancel()
+
+	var status *coordinator.JobStatus
+	var err error
+	switch req.Type {
+	case JobRecommendation:
+		matrix, mappings := s.dataset()
+		idx, ok := mappings.UserOriginalToIndex[req.UserID]
+		if !ok {
+			return nil, fmt.Errorf("user not found")
+		}
+		p := s.jobParams(req)
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if p.Mode == ModeALS {
+			return nil, fmt.Errorf("el modo als se resuelve en la API; usa GET /recommend")
+		}
+		// se guardan las opciones efectivas, por si cambia la configuración adoptada
+		req.Genre, req.Metric, req.Mode, req.K, req.Normalization = p.Genre, p.Metric, p.Mode, p.K, p.Normalization
+		req.Confidence = p.Confidence
+		status, err = s.Cluster.SubmitRecommendation(ctx, idx, matrix.Row(idx), clusterOptions(p))
+	case JobSimilarity:
+		if req.K < 0 {
+			return nil, fmt.Errorf("k no puede ser negativo")
+		}
+		req = JobRequest{
+			Type:          JobSimilarity,
+			Metric:        compute.NormalizeMetric(req.Metric),
+			Normalization: compute.NormalizationName(req.Normalization),
+			K:             req.K,
+		}
+		status, err = s.Cluster.SubmitSimilarity(ctx, req.K, req.Metric, req.Normalization)
+	default:
+		return nil, fmt.Errorf("tipo de job desconocido: %q (recommendation o similarity)", req.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	datasetID, version, _ := s.Cluster.Dataset()
+	job := &Job{
+		ID:             status.ID,
+		Request:        req,
+		State:          status.State,
+		DatasetID:      datasetID,
+		DatasetVersion: version,
+		CreatedAt:      msTime(status.CreatedMs),
+	}
+	if err := s.Mongo.SaveJob(job.ID, job); err != nil {
+		// sin el documento no se podría consultar: se cancela en el clúster
+		if _, cerr := s.Cluster.CancelJob(ctx, job.ID); cerr != nil {
+			log.Printf("No se pudo cancelar el job %s: %v", job.ID, cerr)
+		}
+		return nil, fmt.Errorf("no se pudo guardar el job: %w", err)
+	}
+
+	go s.watchJob(job)
+	return job, nil
+}
+
+// Job devuelve el estado del job: si sigue en curso se consulta al
+// coordinador (con su último avance); si terminó, se carga de Mongo con su
+// resultado.
+func (s *RecommendationService) Job(id string) (*Job, error) {
+	job, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.terminal() {
+		if job.State == coordinator.JobDone {
+			var result JobResult
+			if ok, err := s.Mongo.LoadJobResult(id, &result); err != nil {
+				return nil, err
+			} else if ok {
+				job.Result = &result
+			}
+		}
+		return job, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobCallTimeout)
+	defer cancel()
+	status, err := s.Cluster.JobStatus(ctx, id)
+	if err != nil {
+		// el watcher lo dará por fallido si el coordinador lo perdió
+		log.Printf("No se pudo consultar el job %s en el coordinador: %v", id, err)
+		return job, nil
+	}
+	s.applyJobStatus(job, status)
+	return job, nil
+}
+
+// CancelJob cancela un job en curso. Devuelve ErrJobFinished si ya terminó.
+func (s *RecommendationService) CancelJob(id string) (*Job, error) {
+	job, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.terminal() {
+		return job, ErrJobFinished
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobCallTimeout)
+	defer cancel()
+	status, err := s.Cluster.CancelJob(ctx, id)
+	switch {
+	case protocol.IsCode(err, protocol.CodeJobNotFound):
+		// el coordinador ya no lo tiene: queda cancelado aquí
+		now := time.Now()
+		job.State, job.FinishedAt = coordinator.JobCancelled, &now
+	case err != nil:
+		return nil, err
+	default:
+		s.applyJobStatus(job, status)
+	}
+	if job.State == coordinator.JobDone {
+		// terminó justo antes de cancelarlo; el watcher guarda el resultado
+		return job, ErrJobFinished
+	}
+	if err := s.Mongo.SaveJob(id, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// LoadJobs retoma el seguimiento de los jobs que seguían en curso cuando la
+// API se detuvo y empieza a descartar los terminados hace más de un día.
+func (s *RecommendationService) LoadJobs() {
+	var pending []*Job
+	if err := s.Mongo.JobsInState(&pending, coordinator.JobQueued, coordinator.JobRunning); err != nil {
+		log.Printf("No se pudieron cargar los jobs en curso: %v", err)
+	}
+	for _, job := range pending {
+		log.Printf("Retomando el job %s (%s)", job.ID, job.State)
+		go s.watchJob(job)
+	}
+
+	go func() {
+		for {
+			n, err := s.Mongo.DeleteJobsFinishedBefore(time.Now().Add(-jobRetention))
+			if err != nil {
+				log.Printf("No se pudieron descartar los jobs viejos: %v", err)
+			} else if n > 0 {
+				log.Printf("%d jobs terminados descartados", n)
+			}
+			time.Sleep(jobExpireInterval)
+		}
+	}()
+}
+
+// watchJob consulta el job en el coordinador hasta que termina y guarda su
+// estado y su resultado en Mongo.
+func (s *RecommendationService) watchJob(job *Job) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), jobCallTimeout)
+		status, err := s.Cluster.JobStatus(ctx, job.ID)
+		cancel()
+
+		if protocol.IsCode(err, protocol.CodeJobNotFound) {
+			now := time.Now()
+			job.State, job.FinishedAt = coordinator.JobFailed, &now
+			job.Error = "el coordinador ya no tiene el job (¿se reinició?)"
+			s.saveJob(job)
+			return
+		}
+		if err != nil {
+			// el coordinador puede estar caído un momento; se reintenta
+			continue
+		}
+
+		started := job.StartedAt
+		s.applyJobStatus(job, status)
+		if !job.terminal() {
+			if started == nil && job.StartedAt != nil {
+				s.saveJob(job)
+			}
+			continue
+		}
+
+		if job.Result != nil {
+			if err := s.Mongo.SaveJobResult(job.ID, job.Result); err != nil {
+				job.State, job.Error = coordinator.JobFailed, "no se pudo guardar el resultado: "+err.Error()
+			}
+		}
+		s.saveJob(job)
+		log.Printf("Job %s terminado: %s", job.ID, job.State)
+		return
+	}
+}
+
+func (s *RecommendationService) saveJob(job *Job) {
+	if err := s.Mongo.SaveJob(job.ID, job); err != nil {
+		log.Printf("No se pudo guardar el job %s en Mongo: %v", job.ID, err)
+	}
+}
+
+func (s *RecommendationService) loadJob(id string) (*Job, error) {
+	var job Job
+	ok, err := s.Mongo.LoadJob(id, &job)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// applyJobStatus copia en job el estado del coordinador y, si terminó bien,
+// convierte su resultado.
+func (s *RecommendationService) applyJobStatus(job *Job, status *coordinator.JobStatus) {
+	job.State = status.State
+	job.Error = status.Error
+	if status.StartedMs > 0 {
+		t := msTime(status.StartedMs)
+		job.StartedAt = &t
+	}
+	if status.FinishedMs > 0 {
+		t := msTime(status.FinishedMs)
+		job.FinishedAt = &t
+	}
+
+	job.Progress = nil
+	if status.Progress != nil && !job.terminal() {
+		update := s.progressUpdate(*status.Progress, job.Request.Genre, job.Request.Limit)
+		job.Progress = &update
+	}
+
+	if status.State == coordinator.JobDone && status.Result != nil {
+		job.Result = s.jobResult(job.Request, status.Result)
+	}
+}
+
+// jobResult convierte la respuesta del clúster en películas reales o en los
+// vecinos de cada usuario con sus IDs.
+func (s *RecommendationService) jobResult(req JobRequest, resp *coordinator.CoordinatorResponse) *JobResult {
+	if req.Type == JobSimilarity {
+		sim := &UserNeighbors{Metric: req.Metric, Normalization: req.Normalization, Users: make([]UserSimilarity, len(resp.Neighbors))}
+		_, mappings := s.dataset()
+		for i, nbs := range resp.Neighbors {
+			id, _ := mappings.UserOriginal(i)
+			u := UserSimilarity{UserID: id, Neighbors: make([]SimilarUser, len(nbs))}
+			for k, nb := range nbs {
+				u.Neighbors[k].UserID, _ = mappings.UserOriginal(nb.Index)
+				u.Neighbors[k].Similarity = nb.Similarity
+			}
+			sim.Users[i] = u
+		}
+		return &JobResult{Similarity: sim}
+	}
+
+	// las opciones ya son las efectivas, no se completan otra vez
+	p := RecommendParams{
+		Limit:   req.Limit,
+		Genre:   req.Genre,
+		Mode:    req.Mode,
+		Explain: req.Explain,
+	}
+	movies, explanations := s.moviesFromItems(resp.Items, p)
+	return &JobResult{Movies: movies, Explanations: explanations}
+}
+
+func msTime(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
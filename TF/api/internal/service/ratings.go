@@ -0,0 +1,327 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/data"
+	"sdr/api/internal/models"
+	"sdr/cluster/shared/sparse"
+)
+
+// Calificaciones que se aceptan en una misma solicitud
+const maxRatingsPerRequest = 100
+
+var ErrRatingNotFound = errors.New("el usuario no calificó esa película")
+
+// RatingsUpdate resume el resultado de cargar o borrar calificaciones.
+type RatingsUpdate struct {
+	UserID         string `json:"userId"`
+	UserIndex      int    `json:"userIndex"`
+	NewUser        bool   `json:"newUser,omitempty"`   // se agregó como fila nueva de la matriz
+	NewMovies      int    `json:"newMovies,omitempty"` // películas del catálogo agregadas como columnas nuevas
+	Ratings        int    `json:"ratings"`             // calificaciones del usuario tras el cambio
+	DatasetVersion int64  `json:"datasetVersion"`
+}
+
+// AddRatings guarda calificaciones (nuevas o que reemplazan a las
+// anteriores) del usuario, que puede no estar todavía en el dataset. Las
+// películas deben estar en el catálogo; si no tenían calificaciones se
+// agregan a la matriz.
+func (s *RecommendationService) AddRatings(userID string, ratings []models.Rating) (*RatingsUpdate, error) {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		return nil, fmt.Errorf("falta el usuario")
+	}
+	if len(ratings) == 0 {
+		return nil, fmt.Errorf("no hay calificaciones")
+	}
+	if len(ratings) > maxRatingsPerRequest {
+		return nil, fmt.Errorf("se admiten hasta %d calificaciones por solicitud", maxRatingsPerRequest)
+	}
+
+	now := time.Now()
+	changes := make([]models.UserRating, len(ratings))
+	for i, r := range ratings {
+		id, err := strconv.Atoi(r.MovieID)
+		if _, ok := s.Movies[id]; err != nil || !ok {
+			return nil, fmt.Errorf("película desconocida: %q", r.MovieID)
+		}
+		if r.Rating < data.MinRating || r.Rating > data.MaxRating {
+			return nil, fmt.Errorf("la calificación de %s debe estar entre %g y %g", r.MovieID, data.MinRating, data.MaxRating)
+		}
+		changes[i] = models.UserRating{UserID: userID, MovieID: r.MovieID, Rating: r.Rating, UpdatedAt: now}
+	}
+	return s.applyRatings(userID, changes)
+}
+
+// DeleteRating borra una calificación del usuario (también si venía del
+// CSV). Devuelve ErrRatingNotFound si no la tiene.
+func (s *RecommendationService) DeleteRating(userID, movieID string) (*RatingsUpdate, error) {
+	matrix, mappings := s.dataset()
+	i, okUser := mappings.UserOriginalToIndex[userID]
+	j, okMovie := mappings.MovieOriginalToIndex[movieID]
+	if !okUser || !okMovie || matrix.Get(i, j) == 0 {
+		return nil, ErrRatingNotFound
+	}
+	return s.applyRatings(userID, []models.UserRating{{UserID: userID, MovieID: movieID, UpdatedAt: time.Now()}})
+}
+
+// applyRatings guarda los cambios de un usuario en Mongo y recién entonces
+// los aplica: reemplaza la matriz y los mapeos por copias con los cambios,
+// envía al clúster solo las celdas cambiadas como una versión nueva del
+// dataset y descarta las recomendaciones en caché del usuario.
+func (s *RecommendationService) applyRatings(userID string, changes []models.UserRating) (*RatingsUpdate, error) {
+	s.updates.Lock()
+	defer s.updates.Unlock()
+
+	_, baseVersion, ok := s.Cluster.Dataset()
+	if !ok {
+		return nil, fmt.Errorf("no hay dataset cargado")
+	}
+	version := coordinator.NextVersion(baseVersion)
+	for i := range changes {
+		changes[i].DatasetVersion = version
+	}
+	if err := s.Mongo.SaveRatings(changes); err != nil {
+		return nil, fmt.Errorf("no se pudieron guardar las calificaciones: %w", err)
+	}
+
+	base, _ := s.dataset()
+	next, err := s.patchRatings(changes, version, nil)
+	if err != nil {
+		return nil, err
+	}
+	patch := coordinator.DatasetPatch{
+		ID:          next.id,
+		BaseVersion: next.baseVersion,
+		Version:     next.version,
+		Rows:        next.matrix.Rows,
+		Cols:        next.matrix.Cols,
+		Cells:       next.cells,
+	}
+	// si falla, el coordinador pedirá el dataset completo en la próxima solicitud
+	if err := s.Cluster.PushPatch(patch); err != nil {
+		log.Printf("No se pudieron enviar los cambios del dataset al coordinador: %v", err)
+	}
+
+	s.saveIndexes(next)
+	if _, err := s.InvalidateUserCache(userID); err != nil {
+		log.Printf("No se pudo invalidar la caché del usuario %s: %v", userID, err)
+	}
+
+	idx := next.mappings.UserOriginalToIndex[userID]
+	return &RatingsUpdate{
+		UserID:         userID,
+		UserIndex:      idx,
+		NewUser:        len(next.newUsers) > 0,
+		NewMovies:      next.matrix.Cols - base.Cols,
+		Ratings:        next.matrix.Row(idx).NNZ(),
+		DatasetVersion: next.version,
+	}, nil
+}
+
+// LoadRatings aplica sobre la matriz del CSV las calificaciones cargadas
+// por la API en ejecuciones anteriores. Se llama al arrancar, antes de
+// enviar el dataset al clúster.
+func (s *RecommendationService) LoadRatings() {
+	ratings, err := s.Mongo.LoadRatings()
+	if err != nil {
+		log.Printf("No se pudieron leer las calificaciones cargadas de Mongo: %v", err)
+		return
+	}
+	if len(ratings) == 0 {
+		return
+	}
+
+	// las filas y columnas que la API agregó salen de Mongo y no del orden
+	// de las calificaciones: un usuario cuya única calificación se borró no
+	// aporta ninguna, pero su fila tiene que seguir ocupada
+	saved := &savedIndexes{}
+	if saved.users, err = s.Mongo.LoadUserIndexes(); err != nil {
+		log.Printf("No se pudieron leer los índices de usuarios de Mongo: %v", err)
+		return
+	}
+	if saved.movies, err = s.Mongo.LoadMovieIndexes(); err != nil {
+		log.Printf("No se pudieron leer los índices de películas de Mongo: %v", err)
+		return
+	}
+
+	s.updates.Lock()
+	defer s.updates.Unlock()
+
+	_, baseVersion, ok := s.Cluster.Dataset()
+	if !ok {
+		log.Printf("No se pudieron aplicar las calificaciones cargadas: no hay dataset cargado")
+		return
+	}
+	next, err := s.patchRatings(ratings, replayVersion(ratings, baseVersion), saved)
+	if err != nil {
+		log.Printf("No se pudieron aplicar las calificaciones cargadas: %v", err)
+		return
+	}
+	s.saveIndexes(next)
+	log.Printf("%d calificaciones cargadas por la API aplicadas al dataset %s v%d (%d usuarios nuevos)",
+		len(ratings), next.id, next.version, len(next.newUsers))
+}
+
+// replayVersion devuelve la versión con la que se aplican al arrancar las
+// calificaciones guardadas: la del último cambio, que el clúster ya conoce
+// con ese mismo contenido, así un reinicio sin calificaciones nuevas
+// conserva los factores ALS y la caché de esa versión. Si ninguna la tiene
+// registrada (se guardaron antes de registrarla) se usa una nueva.
+func replayVersion(ratings []models.UserRating, baseVersion int64) int64 {
+	var last int64
+	for _, r := range ratings {
+		last = max(last, r.DatasetVersion)
+	}
+	if last > baseVersion {
+		return last
+	}
+	return coordinator.NextVersion(baseVersion)
+}
+
+// ratingsPatch es el dataset que resulta de aplicar calificaciones.
+type ratingsPatch struct {
+	id                   string
+	baseVersion, version int64
+	matrix               *sparse.Matrix
+	mappings             *data.Mappings
+	cloned               bool // mappings ya es una copia propia
+	cells                []sparse.Cell
+	newUsers             []int // índices de los usuarios agregados
+	newMovies            []int // índices de las películas agregadas
+}
+
+// savedIndexes son las filas y columnas guardadas en Mongo de los usuarios
+// y películas que la API agregó en ejecuciones anteriores.
+type savedIndexes struct {
+	users, movies map[string]int
+}
+
+// patchRatings aplica los cambios sobre copias de la matriz y los mapeos
+// vigentes y las pone en uso como la versión version del dataset (no la
+// envía al clúster). Los usuarios y películas que no estaban se agregan al
+// final; los borrados de calificaciones que no existen se ignoran. Si saved
+// no es nil, antes se restauran en sus índices los usuarios y películas
+// agregados en ejecuciones anteriores.
+func (s *RecommendationService) patchRatings(changes []models.UserRating, version int64, saved *savedIndexes) (*ratingsPatch, error) {
+	id, baseVersion, ok := s.Cluster.Dataset()
+	if !ok {
+		return nil, fmt.Errorf("no hay dataset cargado")
+	}
+	matrix, mappings := s.dataset()
+
+	next := &ratingsPatch{id: id, baseVersion: baseVersion, version: version, mappings: mappings}
+	rows, cols := matrix.Rows, matrix.Cols
+	if saved != nil {
+		rows = next.restore(saved.users, rows, true)
+		cols = next.restore(saved.movies, cols, false)
+	}
+	for _, r := range changes {
+		i, okUser := next.mappings.UserOriginalToIndex[r.UserID]
+		j, okMovie := next.mappings.MovieOriginalToIndex[r.MovieID]
+		if r.Rating == 0 && (!okUser || !okMovie) {
+			continue
+		}
+		if !okUser {
+			next.clone()
+			i, rows = rows, rows+1
+			next.mappings.UserOriginalToIndex[r.UserID] = i
+			next.mappings.UserIndexToOriginal[i] = r.UserID
+			next.newUsers = append(next.newUsers, i)
+		}
+		if !okMovie {
+			next.clone()
+			j, cols = cols, cols+1
+			next.mappings.MovieOriginalToIndex[r.MovieID] = j
+			next.mappings.MovieIndexToOriginal[j] = r.MovieID
+			next.newMovies = append(next.newMovies, j)
+		}
+		// en Mongo quedan las estrellas; la matriz usa la escala del CSV
+		val := 0.0
+		if r.Rating != 0 {
+			val = data.ScaleRating(r.Rating)
+		}
+		next.cells = append(next.cells, sparse.Cell{Row: i, Col: j, Val: val})
+	}
+
+	var err error
+	next.matrix, err = matrix.Apply(rows, cols, next.cells)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.Matrix, s.Mappings = next.matrix, next.mappings
+	s.Cluster.SetDataset(id, next.version, next.matrix)
+	s.mu.Unlock()
+
+	// el ranking de popularidad se recalcula con la matriz nueva
+	s.popularity.mu.Lock()
+	s.popularity.ranked = nil
+	s.popularity.mu.Unlock()
+	return next, nil
+}
+
+// clone reemplaza los mapeos por una copia propia antes de modificarlos.
+func (p *ratingsPatch) clone() {
+	if !p.cloned {
+		p.mappings = p.mappings.Clone()
+		p.cloned = true
+	}
+}
+
+// restore agrega a los mapeos los usuarios (o películas) guardados con
+// índice n en adelante, en orden, y devuelve el nuevo total. Se detiene en
+// el primer índice que falte: los siguientes se vuelven a asignar al final
+// cuando aparezcan sus calificaciones.
+func (p *ratingsPatch) restore(saved map[string]int, n int, users bool) int {
+	byIndex := make(map[int]string)
+	for id, idx := range saved {
+		if idx >= n {
+			byIndex[idx] = id
+		}
+	}
+	start := n
+	for {
+		id, ok := byIndex[n]
+		if !ok {
+			break
+		}
+		p.clone()
+		if users {
+			p.mappings.UserOriginalToIndex[id] = n
+			p.mappings.UserIndexToOriginal[n] = id
+		} else {
+			p.mappings.MovieOriginalToIndex[id] = n
+			p.mappings.MovieIndexToOriginal[n] = id
+		}
+		n++
+	}
+	if skipped := len(byIndex) - (n - start); skipped > 0 {
+		log.Printf("Falta el índice guardado %d: %d índices siguientes se reasignarán", n, skipped)
+	}
+	return n
+}
+
+// saveIndexes guarda en Mongo las filas y columnas que se agregaron.
+func (s *RecommendationService) saveIndexes(p *ratingsPatch) {
+	for _, idx := range p.newUsers {
+		id, _ := p.mappings.UserOriginal(idx)
+		if err := s.Mongo.AddUser(idx, id); err != nil {
+			log.Printf("No se pudo agregar el usuario %s a Mongo: %v", id, err)
+		}
+	}
+	for _, idx := range p.newMovies {
+		id, _ := p.mappings.MovieOriginal(idx)
+		if err := s.Mongo.SetMovieIndex(id, idx); err != nil {
+			log.Printf("No se pudo guardar el índice de la película %s en Mongo: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/data"
+	"sdr/api/internal/models"
+	"sdr/cluster/shared/sparse"
+)
+
+func TestReplayVersion(t *testing.T) {
+	const base = 1_700_000_000 // fecha del CSV
+
+	// se reusa la versión del último cambio aunque no sea la del último
+	// documento (los reemplazos conservan su versión)
+	ratings := []models.UserRating{
+		{UserID: "u1", MovieID: "1", Rating: 4, DatasetVersion: 30},
+		{UserID: "u2", MovieID: "2", Rating: 0, DatasetVersion: 50},
+		{UserID: "u1", MovieID: "3", Rating: 2, DatasetVersion: 40},
+	}
+	for i := range ratings {
+		ratings[i].DatasetVersion += base
+	}
+	if got := replayVersion(ratings, base); got != base+50 {
+		t.Errorf("replayVersion = %d, se esperaba %d", got, base+50)
+	}
+	if replayVersion(ratings, base) != replayVersion(ratings, base) {
+		t.Error("dos arranques con las mismas calificaciones deberían dar la misma versión")
+	}
+
+	// guardadas antes de registrar la versión: una nueva, posterior al CSV
+	legacy := []models.UserRating{{UserID: "u1", MovieID: "1", Rating: 4}}
+	if got := replayVersion(legacy, base); got <= base {
+		t.Errorf("replayVersion sin versiones = %d, se esperaba una posterior a %d", got, base)
+	}
+}
+
+// testService arma un servicio con el dataset del CSV: usuarios u0 y u1,
+// películas 10 y 20.
+func testService() *RecommendationService {
+	mappings := data.NewMappings()
+	for i, id := range []string{"u0", "u1"} {
+		mappings.UserOriginalToIndex[id] = i
+		mappings.UserIndexToOriginal[i] = id
+	}
+	for j, id := range []string{"10", "20"} {
+		mappings.MovieOriginalToIndex[id] = j
+		mappings.MovieIndexToOriginal[j] = id
+	}
+	matrix := sparse.FromDense([][]float64{{1, 0.5}, {0, 0.8}})
+	cluster := coordinator.NewCoordinatorClient("127.0.0.1:0")
+	cluster.SetDataset("ml", 100, matrix)
+	return &RecommendationService{Mappings: mappings, Matrix: matrix, Cluster: cluster}
+}
+
+func TestPatchRatingsRestoresSavedIndexes(t *testing.T) {
+	s := testService()
+	csvMappings := s.Mappings
+
+	// en ejecuciones anteriores la API agregó a "nuevo", a "borrado" (cuya
+	// única calificación se borró), a "huerfano" en la fila 5 (la 4 se
+	// perdió) y la película 30
+	saved := &savedIndexes{
+		users:  map[string]int{"u0": 0, "u1": 1, "nuevo": 2, "borrado": 3, "huerfano": 5},
+		movies: map[string]int{"10": 0, "20": 1, "30": 2},
+	}
+	ratings := []models.UserRating{
+		{UserID: "nuevo", MovieID: "30", Rating: 4},
+		{UserID: "borrado", MovieID: "10", Rating: 0},
+		{UserID: "huerfano", MovieID: "20", Rating: 2},
+	}
+
+	next, err := s.patchRatings(ratings, 150, saved)
+	if err != nil {
+		t.Fatalf("patchRatings: %v", err)
+	}
+
+	// los guardados vuelven a su índice; después del hueco se reasigna al
+	// final, y solo ese cuenta como agregado
+	for id, want := range map[string]int{"nuevo": 2, "borrado": 3, "huerfano": 4} {
+		if got, ok := next.mappings.UserIndex(id); !ok || got != want {
+			t.Errorf("usuario %s en la fila %d (%t), se esperaba %d", id, got, ok, want)
+		}
+	}
+	if got, ok := next.mappings.MovieIndex("30"); !ok || got != 2 {
+		t.Errorf("película 30 en la columna %d (%t), se esperaba 2", got, ok)
+	}
+	if !reflect.DeepEqual(next.newUsers, []int{4}) || len(next.newMovies) != 0 {
+		t.Errorf("agregados: usuarios %v, películas %v; se esperaba solo el usuario 4", next.newUsers, next.newMovies)
+	}
+
+	if next.matrix.Rows != 5 || next.matrix.Cols != 3 {
+		t.Fatalf("matriz de %dx%d, se esperaba 5x3", next.matrix.Rows, next.matrix.Cols)
+	}
+	if got := next.matrix.Get(2, 2); got != data.ScaleRating(4) {
+		t.Errorf("calificación de nuevo a la película 30 = %g, se esperaba %g", got, data.ScaleRating(4))
+	}
+	if got := next.matrix.Get(4, 1); got != data.ScaleRating(2) {
+		t.Errorf("calificación de huerfano a la película 20 = %g, se esperaba %g", got, data.ScaleRating(2))
+	}
+	if next.matrix.Row(3).NNZ() != 0 {
+		t.Error("la fila de borrado debería seguir ocupada pero vacía")
+	}
+
+	// queda en uso con la versión pedida, sin tocar los mapeos del CSV
+	if _, version, _ := s.Cluster.Dataset(); version != 150 || next.baseVersion != 100 {
+		t.Errorf("versión %d sobre %d, se esperaba 150 sobre 100", version, next.baseVersion)
+	}
+	if matrix, mappings := s.dataset(); matrix != next.matrix || mappings != next.mappings {
+		t.Error("el servicio debería usar la matriz y los mapeos nuevos")
+	}
+	if len(csvMappings.UserOriginalToIndex) != 2 || len(csvMappings.MovieOriginalToIndex) != 2 {
+		t.Error("los mapeos anteriores no deberían modificarse")
+	}
+}
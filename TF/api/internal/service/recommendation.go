@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/process"
@@ -14,24 +18,50 @@ import (
 	"sdr/api/internal/data"
 	"sdr/api/internal/database"
 	"sdr/api/internal/models"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/sparse"
 )
 
+// Factor de candidatas extra que se piden al clúster cuando hay filtro de
+// género, ya que el filtro se aplica después en la API
+const genreOverfetch = 20
+
+// Vecinos (o películas calificadas, en modo item) que se informan por
+// película cuando se piden explicaciones
+const explainContributors = 3
+
 type RecommendationService struct {
 	Movies   map[int]models.Movie
-	Mappings *data.Mappings
-	Matrix   [][]float64
+	Mappings *data.Mappings // se leen con dataset(): cambian al cargar calificaciones
+	Matrix   *sparse.Matrix // calificaciones usuario–película (CSR), ídem
 	Redis    *database.RedisClient
 	Mongo    *database.MongoClient
 	Cluster  *coordinator.CoordinatorClient
 	CacheTTL time.Duration
 
+	// StaleTTL es cuánto se sigue sirviendo una recomendación vencida
+	// mientras se recalcula en segundo plano
+	StaleTTL time.Duration
+
 	Genres []string // <- géneros precargados
+
+	// MinCFRatings es cuántas calificaciones necesita un usuario para
+	// filtrado colaborativo; con menos se usa arranque en frío
+	MinCFRatings int
+
+	mu      sync.RWMutex // protege Matrix y Mappings
+	updates sync.Mutex   // serializa las cargas de calificaciones
+
+	als        alsState        // factores ALS para mode=als
+	tuning     tuneState       // búsquedas de hiperparámetros y configuración adoptada
+	popularity popularityState // ranking de popularidad para arranque en frío
+	flights    flightGroup     // recomendaciones en cálculo, compartidas entre solicitudes iguales
 }
 
 func NewRecommendationService(
 	movies map[int]models.Movie,
 	mappings *data.Mappings,
-	matrix [][]float64,
+	matrix *sparse.Matrix,
 	redis *database.RedisClient,
 	mongo *database.MongoClient,
 	cluster *coordinator.CoordinatorClient,
@@ -45,33 +75,169 @@ func NewRecommendationService(
 		Mongo:    mongo,
 		Cluster:  cluster,
 		CacheTTL: time.Hour,
+		StaleTTL: 10 * time.Minute,
 		Genres:   genres,
+
+		MinCFRatings: defaultMinCFRatings,
+	}
+}
+
+// Modos de recomendación: filtrado colaborativo por usuarios o por ítems en
+// el clúster, o producto punto con los factores ALS ya entrenados
+const (
+	ModeUser = "user"
+	ModeItem = "item"
+	ModeALS  = "als"
+)
+
+// RecommendParams son los filtros y opciones de una recomendación.
+type RecommendParams struct {
+	Limit  int
+	Genre  string // filtro opcional
+	Metric string // cosine, pearson, jaccard, adjusted_cosine (vacío = cosine)
+	Mode   string // user, item o als (vacío = user)
+	K      int    // vecinos (0 = los de la configuración adoptada o, sin ella, Limit)
+
+	// Normalization es la normalización de las calificaciones antes de
+	// comparar: none, mean_center o zscore (vacío = none). En modo als no
+	// aplica.
+	Normalization string
+
+	// Confidence son las reglas de confianza de las predicciones (vecinos con
+	// pocas películas en común, poco parecidos o películas con pocos votos).
+	// En modo als no aplican.
+	Confidence coordinator.Confidence
+
+	// Explain pide, por cada película, los vecinos que más aportaron a su
+	// puntaje. En modo als no aplica.
+	Explain bool
+}
+
+// normalize pasa los textos a minúsculas y completa los valores por defecto.
+func (p RecommendParams) normalize() RecommendParams {
+	p.Genre = strings.TrimSpace(strings.ToLower(p.Genre))
+	p.Metric = compute.NormalizeMetric(p.Metric)
+	p.Mode = strings.TrimSpace(strings.ToLower(p.Mode))
+	if p.Mode == "" {
+		p.Mode = ModeUser
+	}
+	p.Normalization = compute.NormalizationName(p.Normalization)
+	if p.Mode == ModeALS {
+		p.Normalization = compute.NormalizationNone
+		p.K = 0
+		p.Confidence = coordinator.Confidence{}
+		p.Explain = false
 	}
+	return p
+}
+
+func (p RecommendParams) validate() error {
+	if _, err := compute.LookupMetric(p.Metric); err != nil {
+		return err
+	}
+	if _, err := compute.LookupNormalization(p.Normalization); err != nil {
+		return err
+	}
+	if p.K < 0 {
+		return fmt.Errorf("k no puede ser negativo")
+	}
+	c := p.Confidence
+	if c.MinOverlap < 0 || c.Shrinkage < 0 || c.MinVoters < 0 ||
+		(c.MinSimilarity != nil && (*c.MinSimilarity < -1 || *c.MinSimilarity > 1)) {
+		return fmt.Errorf("reglas de confianza inválidas: min_overlap, shrinkage y min_voters no pueden ser negativos y min_similarity debe estar entre -1 y 1")
+	}
+	switch p.Mode {
+	case ModeUser, ModeItem, ModeALS:
+	default:
+		return fmt.Errorf("modo de recomendación desconocido: %q (user, item o als)", p.Mode)
+	}
+	return nil
+}
+
+// RecommendCacheKey es la clave de Redis de una recomendación con sus filtros
+// (se guarda con sus explicaciones y métricas de ejecución).
+func RecommendCacheKey(userIdStr string, p RecommendParams) string {
+	p = p.normalize()
+	c := p.Confidence
+	minSim := "-" // sin mínimo, distinto de un mínimo 0
+	if c.MinSimilarity != nil {
+		minSim = strconv.FormatFloat(*c.MinSimilarity, 'g', -1, 64)
+	}
+	return fmt.Sprintf("rec:%s:%s:%d:%d:%s:%s:%s:%d:%g:%s:%d:%t", userIdStr, p.Genre, p.Limit, p.K, p.Metric, p.Mode, p.Normalization,
+		c.MinOverlap, c.Shrinkage, minSim, c.MinVoters, p.Explain)
 }
 
 // ---------------------------------------------------------
 //    Nueva función Recommend con filtros opcionales
 // ---------------------------------------------------------
 
-func (s *RecommendationService) Recommend(userIdStr string, limit int, genre string) ([]models.Movie, error) {
+// Recommendation es el resultado de una recomendación.
+type Recommendation struct {
+	Movies       []models.Movie
+	Explanations []models.Explanation // solo con Explain, una por película en el mismo orden
+	Strategy     string               // estrategia usada (ver Strategy*)
+	Metrics      map[string]interface{}
+}
 
-	// 1. Map userIdStr → índice interno
-	idx, ok := s.Mappings.UserOriginalToIndex[userIdStr]
-	if !ok {
-		return nil, fmt.Errorf("user not found")
-	}
+// Recommend pide al clúster las recomendaciones del usuario con los filtros
+// y opciones de p. Los usuarios desconocidos o con pocas calificaciones
+// reciben una recomendación de arranque en frío (ver coldStart). Si
+// p.Explain, devuelve también una explicación por película. Las
+// solicitudes iguales que llegan mientras se calcula comparten el mismo
+// pedido al clúster. Si ctx se cancela (el cliente se desconectó) deja de
+// esperar; cuando no queda nadie esperando, el trabajo se aborta en el
+// clúster y no se guarda en caché ni en el historial, solo queda registrada
+// la cancelación.
+func (s *RecommendationService) Recommend(ctx context.Context, userIdStr string, p RecommendParams) (*Recommendation, error) {
+	return s.RecommendStream(ctx, userIdStr, p, nil)
+}
 
-	// Normalizar género para evitar problemas de comparación
-	genre = strings.TrimSpace(strings.ToLower(genre))
+// RecommendStream es como Recommend pero entrega a onProgress los avances
+// parciales del clúster mientras trabaja (solo en modo user; en item, als o
+// con la respuesta en caché no hay avances, y si se suma a un cálculo en
+// curso recibe solo los que faltan). onProgress corre en la
+// goroutine lectora de la conexión con el coordinador, así que no debe
+// bloquear.
+func (s *RecommendationService) RecommendStream(ctx context.Context, userIdStr string, p RecommendParams, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+
+	// Completar con la configuración adoptada y normalizar filtros para
+	// evitar problemas de comparación
+	p = s.WithDefaults(p).normalize()
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
 
-	// 2. Cache key mejorado: incluye filtros
-	cacheKey := fmt.Sprintf("rec:%s:%s:%d", userIdStr, genre, limit)
+	// 1. Map userIdStr → índice interno (-1 si no está en el dataset) y
+	// elegir la estrategia según cuántas calificaciones tiene
+	cold, err := s.coldStart(userIdStr)
+	if err != nil {
+		return nil, err
+	}
+	if cold.strategy == StrategyOnboarding && p.Mode == ModeALS {
+		p.Mode = ModeUser // el perfil no tiene factores ALS
+	}
+	if p.Mode == ModeALS && s.alsStale() {
+		p.Mode = ModeUser // los factores no incluyen las calificaciones nuevas
+	}
 
-	var cached []models.Movie
-	found, _ := s.Redis.GetCached(cacheKey, &cached)
-	if found {
-		return cached, nil
+	// 2. Cache key mejorado: incluye filtros, métrica, modo y estrategia.
+	// Las solicitudes iguales en curso comparten el cálculo (ver coalesce.go)
+	req := cacheRequest{
+		key:    RecommendCacheKey(userIdStr, p) + cold.cacheSuffix(),
+		userID: userIdStr,
+		params: p,
+		compute: func(ctx context.Context, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+			return s.recommend(ctx, userIdStr, p, cold, onProgress)
+		},
 	}
+	return s.cachedRecommend(ctx, req, onProgress)
+}
+
+// recommend calcula la recomendación del usuario (sin pasar por la caché) y
+// la guarda en el historial.
+func (s *RecommendationService) recommend(ctx context.Context, userIdStr string, p RecommendParams, cold coldStartPlan, onProgress func(models.RecommendProgress)) (*Recommendation, error) {
+	limit, genre := p.Limit, p.Genre
+	var err error
 
 	// Prepare metrics
 	start := time.Now()
@@ -87,44 +253,35 @@ func (s *RecommendationService) Recommend(userIdStr string, limit int, genre str
 		}
 	}
 
-	// 3. Pedir a los workers las recomendaciones base
-	movieIdxs, err := s.Cluster.RequestRecommendations(idx, s.Matrix, limit)
+	// 3. Pedir a los workers las recomendaciones base. En modo als se
+	// puntúan aquí mismo con los factores ya entrenados.
+	opts := clusterOptions(p)
+	if onProgress != nil {
+		opts.OnProgress = func(pr coordinator.Progress) {
+			onProgress(s.progressUpdate(pr, genre, limit))
+		}
+	}
+	var items []coordinator.ScoredItem
+	switch {
+	case cold.popular:
+		items = s.popularItems(cold, genre, opts.N)
+	case p.Mode == ModeALS:
+		items, err = s.recommendALS(cold.index, opts.N)
+	default:
+		items, err = s.Cluster.RequestRecommendations(ctx, cold.index, cold.row, opts)
+	}
+	if ctx.Err() != nil {
+		// se fueron todos los clientes que la esperaban: ni caché ni
+		// historial, solo la cancelación
+		s.recordCancelled(userIdStr, p, time.Since(start), context.Cause(ctx))
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var results []models.Movie
-
 	// 4. Convertir índices → Movies reales con filtro opcional
-	for _, mi := range movieIdxs {
-
-		movieIDStr := s.Mappings.MovieIndexToOriginal[mi]
-		movieID, err := strconv.Atoi(movieIDStr)
-		if err != nil {
-			continue
-		}
-
-		mv, ok := s.Movies[movieID]
-		if !ok {
-			continue
-		}
-
-		// Aplicar filtro de género si corresponde
-		if genre != "" {
-			if !strings.Contains(strings.ToLower(mv.Genre), genre) {
-				continue
-			}
-		}
-
-		results = append(results, mv)
-
-		if len(results) >= limit {
-			break
-		}
-	}
-
-	// 5. Cache final
-	_ = s.Redis.SetCached(cacheKey, results, s.CacheTTL)
+	results, explanations := s.moviesFromItems(items, p)
 
 	// finish metrics
 	var memEnd runtime.MemStats
@@ -152,6 +309,7 @@ func (s *RecommendationService) Recommend(userIdStr string, limit int, genre str
 
 	metrics := map[string]interface{}{
 		"elapsed_ms":          elapsed.Milliseconds(),
+		"strategy":            cold.strategy,
 		"num_cpu":             runtime.NumCPU(),
 		"num_goroutine":       runtime.NumGoroutine(),
 		"cpu_user_seconds":    cpuEndUser - cpuStartUser,
@@ -166,23 +324,180 @@ func (s *RecommendationService) Recommend(userIdStr string, limit int, genre str
 
 	// 6. Guardar historial en Mongo (incluye metrics)
 	hist := map[string]interface{}{
-		"userId":  userIdStr,
-		"date":    time.Now(),
-		"genre":   genre,
-		"limit":   limit,
-		"movies":  results,
-		"metrics": metrics,
+		"userId":   userIdStr,
+		"date":     time.Now(),
+		"genre":    genre,
+		"metric":   p.Metric,
+		"mode":     p.Mode,
+		"norm":     p.Normalization,
+		"rules":    p.Confidence,
+		"k":        p.K,
+		"limit":    limit,
+		"strategy": cold.strategy,
+		"movies":   results,
+		"metrics":  metrics,
 	}
 	_ = s.Mongo.SaveRecommendation(hist)
 
-	// Build response object: include movies + metrics so handlers can return both
-	// We return the movies slice as before; handlers will call another method to fetch metrics if needed.
-	// For now, embed metrics by returning a custom wrapper via a separate method.
+	return &Recommendation{Movies: results, Explanations: explanations, Strategy: cold.strategy, Metrics: metrics}, nil
+}
+
+// recordCancelled guarda en el historial una recomendación abortada porque
+// el cliente se desconectó (o venció su plazo) antes de terminar, con el
+// tiempo que alcanzó a correr.
+func (s *RecommendationService) recordCancelled(userIdStr string, p RecommendParams, elapsed time.Duration, cause error) {
+	reason := "client_disconnected"
+	if errors.Is(cause, context.DeadlineExceeded) {
+		reason = "deadline_exceeded"
+	}
+	log.Printf("Recomendación para el usuario %s cancelada tras %s: %v", userIdStr, elapsed, cause)
+
+	hist := map[string]interface{}{
+		"userId":    userIdStr,
+		"date":      time.Now(),
+		"genre":     p.Genre,
+		"metric":    p.Metric,
+		"mode":      p.Mode,
+		"norm":      p.Normalization,
+		"rules":     p.Confidence,
+		"k":         p.K,
+		"limit":     p.Limit,
+		"cancelled": true,
+		"metrics": map[string]interface{}{
+			"elapsed_ms":    elapsed.Milliseconds(),
+			"cancelled":     true,
+			"cancel_reason": reason,
+		},
+	}
+	_ = s.Mongo.SaveRecommendation(hist)
+}
+
+// clusterOptions son las opciones del clúster para p ya normalizado: solo
+// se piden las N mejores películas, o más con filtro de género porque
+// varias se descartarán en moviesFromItems.
+func clusterOptions(p RecommendParams) coordinator.RecommendOptions {
+	k := p.K
+	if k == 0 {
+		k = p.Limit
+	}
+	n := p.Limit
+	if p.Genre != "" {
+		n = p.Limit * genreOverfetch
+	}
+	opts := coordinator.RecommendOptions{
+		K:             k,
+		N:             n,
+		Metric:        p.Metric,
+		Mode:          p.Mode,
+		Normalization: p.Normalization,
+		Confidence:    p.Confidence,
+	}
+	if p.Explain {
+		opts.Explain = explainContributors
+	}
+	return opts
+}
+
+// moviesFromItems convierte las películas que devolvió el clúster en
+// películas reales, con el filtro de género y el límite de p; si p.Explain
+// devuelve también sus explicaciones (en el mismo orden).
+func (s *RecommendationService) moviesFromItems(items []coordinator.ScoredItem, p RecommendParams) ([]models.Movie, []models.Explanation) {
+	var results []models.Movie
+	var explanations []models.Explanation
+
+	for _, it := range items {
+		mv, ok := s.movieByIndex(it.Index)
+		if !ok {
+			continue
+		}
+
+		// Aplicar filtro de género si corresponde
+		if p.Genre != "" && !strings.Contains(strings.ToLower(mv.Genre), p.Genre) {
+			continue
+		}
+
+		results = append(results, mv)
+		if p.Explain {
+			explanations = append(explanations, s.explanation(mv, it, p.Mode))
+		}
 
-	// To keep backward compatibility with existing callers, return movies and store metrics in Redis as additional key
-	_ = s.Redis.SetCached(cacheKey+":metrics", metrics, s.CacheTTL)
+		if len(results) >= p.Limit {
+			break
+		}
+	}
+	return results, explanations
+}
+
+// progressUpdate traduce un avance del clúster: el top-N parcial pasa a
+// películas reales con el mismo filtro de género y límite que el final.
+func (s *RecommendationService) progressUpdate(pr coordinator.Progress, genre string, limit int) models.RecommendProgress {
+	update := models.RecommendProgress{
+		Type:    "progress",
+		Phase:   pr.Phase,
+		Percent: pr.Percent,
+		Done:    pr.Done,
+		Total:   pr.Total,
+		Workers: make([]models.WorkerTiming, len(pr.Workers)),
+	}
+	for i, w := range pr.Workers {
+		update.Workers[i] = models.WorkerTiming(w)
+	}
+	for _, it := range pr.Items {
+		mv, ok := s.movieByIndex(it.Index)
+		if !ok || (genre != "" && !strings.Contains(strings.ToLower(mv.Genre), genre)) {
+			continue
+		}
+		update.Movies = append(update.Movies, mv)
+		if len(update.Movies) >= limit {
+			break
+		}
+	}
+	return update
+}
+
+// dataset devuelve la matriz y los mapeos vigentes. Las calificaciones
+// nuevas los reemplazan por copias en vez de modificarlos, así que se
+// pueden leer sin lock.
+func (s *RecommendationService) dataset() (*sparse.Matrix, *data.Mappings) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Matrix, s.Mappings
+}
+
+// movieByIndex devuelve la película de un índice interno de la matriz.
+func (s *RecommendationService) movieByIndex(mi int) (models.Movie, bool) {
+	_, mappings := s.dataset()
+	movieID, err := strconv.Atoi(mappings.MovieIndexToOriginal[mi])
+	if err != nil {
+		return models.Movie{}, false
+	}
+	mv, ok := s.Movies[movieID]
+	return mv, ok
+}
+
+// explanation traduce los aportes que informó el clúster para una película
+// a usuarios (modo user) o películas calificadas (modo item) reales.
+func (s *RecommendationService) explanation(mv models.Movie, it coordinator.ScoredItem, mode string) models.Explanation {
+	e := models.Explanation{MovieID: mv.MovieID, Score: it.Score}
+	_, mappings := s.dataset()
+
+	for _, c := range it.Because {
+		if mode == ModeItem {
+			rated, ok := s.movieByIndex(c.Index)
+			if !ok {
+				continue
+			}
+			e.Because = append(e.Because, models.RatedMovieEvidence{Movie: rated, Similarity: c.Similarity, Rating: c.Rating})
+			continue
+		}
+		userID, ok := mappings.UserOriginal(c.Index)
+		if !ok {
+			continue
+		}
+		e.Neighbors = append(e.Neighbors, models.NeighborEvidence{UserID: userID, Similarity: c.Similarity, Rating: c.Rating})
+	}
 
-	return results, nil
+	return e
 }
 
 func (s *RecommendationService) GetUsers(page, limit int) ([]string, error) {
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sdr/api/internal/coordinator"
+	"sdr/api/internal/data"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/sparse"
+)
+
+// Plazo de una búsqueda de hiperparámetros en el clúster
+const tuneTimeout = time.Hour
+
+// Vecinos de una recomendación sin K ni configuración adoptada: el limit
+// por defecto, como antes de que existiera la búsqueda
+const defaultTuneK = 10
+
+// Clave en Mongo de la configuración adoptada
+const adoptedSetting = "recommend_defaults"
+
+// ErrTuningInProgress indica que ya hay una búsqueda de hiperparámetros en curso.
+var ErrTuningInProgress = errors.New("ya hay una búsqueda de hiperparámetros en curso")
+
+// defaultTuneGrid es la grilla que se usa cuando la solicitud no trae
+// ninguna lista.
+var defaultTuneGrid = coordinator.TuneParams{
+	K:              []int{10, 20, 50},
+	Metrics:        []string{compute.MetricCosine, compute.MetricPearson},
+	Modes:          []string{ModeUser, ModeItem},
+	Normalizations: []string{compute.NormalizationNone, compute.NormalizationMeanCenter},
+}
+
+// TuneRequest es una búsqueda de hiperparámetros: cómo separar las
+// calificaciones de prueba, la grilla y si adoptar la mejor combinación.
+type TuneRequest struct {
+	Split     string                 `json:"split" bson:"split"`         // random o leave-k-out (vacío = random)
+	TestFrac  float64                `json:"testFrac" bson:"testFrac"`   // fracción de prueba en random (0 = 0.2)
+	Leave     int                    `json:"leave" bson:"leave"`         // calificaciones retenidas por usuario en leave-k-out (0 = 1)
+	Seed      int64                  `json:"seed" bson:"seed"`           // semilla de la división (0 = 42)
+	TopK      int                    `json:"topK" bson:"topK"`           // largo de las listas evaluadas (0 = 10)
+	Relevance float64                `json:"relevance" bson:"relevance"` // calificación mínima relevante (0 = media de cada usuario)
+	Grid      coordinator.TuneParams `json:"grid" bson:"grid"`           // sin listas = grilla por defecto
+	Adopt     bool                   `json:"adopt" bson:"adopt"`         // adoptar la mejor combinación al terminar
+}
+
+// TuningResult es una búsqueda terminada con su ranking.
+type TuningResult struct {
+	DatasetID      string                  `json:"datasetId" bson:"datasetId"`
+	DatasetVersion int64                   `json:"datasetVersion" bson:"datasetVersion"`
+	Request        TuneRequest             `json:"request" bson:"request"`
+	TrainRatings   int                     `json:"trainRatings" bson:"trainRatings"`
+	TestRatings    int                     `json:"testRatings" bson:"testRatings"`
+	StartedAt      time.Time               `json:"startedAt" bson:"startedAt"`
+	FinishedAt     time.Time               `json:"finishedAt" bson:"finishedAt"`
+	Leaderboard    coordinator.Leaderboard `json:"leaderboard" bson:"leaderboard"`
+}
+
+// TunedConfig es la configuración adoptada: completa las opciones que una
+// recomendación no especifica (K, métrica, modo, normalización y reglas de
+// confianza).
+type TunedConfig struct {
+	Config         coordinator.TuneConfig `json:"config" bson:"config"`
+	Objective      string                 `json:"objective" bson:"objective"`
+	Score          float64                `json:"score" bson:"score"`
+	DatasetID      string                 `json:"datasetId" bson:"datasetId"`
+	DatasetVersion int64                  `json:"datasetVersion" bson:"datasetVersion"`
+	AdoptedAt      time.Time              `json:"adoptedAt" bson:"adoptedAt"`
+}
+
+// TuningStatus resume la última búsqueda y la configuración adoptada.
+type TuningStatus struct {
+	Running bool          `json:"running"`
+	Error   string        `json:"error,omitempty"`
+	Latest  *TuningResult `json:"latest,omitempty"`
+	Adopted *TunedConfig  `json:"adopted,omitempty"`
+}
+
+// tuneState guarda la última búsqueda y la configuración adoptada.
+type tuneState struct {
+	mu      sync.RWMutex
+	running bool
+	lastErr error
+	latest  *TuningResult
+	adopted *TunedConfig
+}
+
+// LoadTuning carga de Mongo la última búsqueda y la configuración adoptada.
+func (s *RecommendationService) LoadTuning() {
+	var latest TuningResult
+	if found, err := s.Mongo.LatestTuning(&latest); err != nil {
+		log.Printf("No se pudo leer la última búsqueda de hiperparámetros de Mongo: %v", err)
+	} else if found {
+		s.tuning.mu.Lock()
+		s.tuning.latest = &latest
+		s.tuning.mu.Unlock()
+	}
+
+	var adopted TunedConfig
+	if found, err := s.Mongo.LoadSetting(adoptedSetting, &adopted); err != nil {
+		log.Printf("No se pudo leer la configuración adoptada de Mongo: %v", err)
+	} else if found {
+		s.tuning.mu.Lock()
+		s.tuning.adopted = &adopted
+		s.tuning.mu.Unlock()
+		c := adopted.Config
+		log.Printf("Configuración adoptada: modo %s, métrica %s, normalización %s, K=%d", c.Mode, c.Metric, c.Normalization, c.K)
+	}
+}
+
+// Tune busca en el clúster la mejor combinación de hiperparámetros: separa
+// las calificaciones en entrenamiento y prueba, envía el entrenamiento como
+// un dataset aparte, evalúa la grilla y guarda el ranking en Mongo. Si
+// req.Adopt, adopta la mejor combinación. Devuelve ErrTuningInProgress si ya
+// hay una búsqueda en curso.
+func (s *RecommendationService) Tune(req TuneRequest) error {
+	s.tuning.mu.Lock()
+	if s.tuning.running {
+		s.tuning.mu.Unlock()
+		return ErrTuningInProgress
+	}
+	s.tuning.running = true
+	s.tuning.mu.Unlock()
+
+	result, err := s.tune(req)
+
+	s.tuning.mu.Lock()
+	s.tuning.running = false
+	s.tuning.lastErr = err
+	if err == nil {
+		s.tuning.latest = result
+	}
+	s.tuning.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if req.Adopt {
+		_, err = s.AdoptTuning(1)
+	}
+	return err
+}
+
+func (s *RecommendationService) tune(req TuneRequest) (*TuningResult, error) {
+	req, err := req.Complete()
+	if err != nil {
+		return nil, err
+	}
+	id, version, ok := s.Cluster.Dataset()
+	if !ok {
+		return nil, fmt.Errorf("no hay dataset cargado")
+	}
+
+	matrix, _ := s.dataset()
+	var train, test *sparse.Matrix
+	switch req.Split {
+	case data.SplitRandom:
+		train, test = data.SplitRandomly(matrix, req.TestFrac, req.Seed)
+	case data.SplitLeaveKOut:
+		train, test = data.SplitPerUser(matrix, req.Leave, req.Seed)
+	}
+	if test.NNZ() == 0 {
+		return nil, fmt.Errorf("la división no dejó calificaciones de prueba")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tuneTimeout)
+	defer cancel()
+
+	result := &TuningResult{
+		DatasetID:      id,
+		DatasetVersion: version,
+		Request:        req,
+		TrainRatings:   train.NNZ(),
+		TestRatings:    test.NNZ(),
+		StartedAt:      time.Now(),
+	}
+	log.Printf("Búsqueda de hiperparámetros sobre %s v%d (división %s: %d de entrenamiento, %d de prueba)",
+		id, version, req.Split, result.TrainRatings, result.TestRatings)
+
+	// el entrenamiento va como otro dataset para no reemplazar el vigente
+	cluster := s.Cluster.WithDataset(id+"-tune", time.Now().UnixNano(), train)
+	if err := cluster.PushDataset(); err != nil {
+		return nil, fmt.Errorf("no se pudo enviar el dataset de entrenamiento: %w", err)
+	}
+	// cada búsqueda usa una versión nueva: al terminar se descarta para no
+	// acumular copias del entrenamiento en el coordinador y los workers
+	defer func() {
+		if err := cluster.ForgetDataset(); err != nil {
+			log.Printf("No se pudo descartar el dataset de entrenamiento: %v", err)
+		}
+	}()
+	base := s.defaultOptions()
+	board, err := cluster.Tune(ctx, base, coordinator.EvalParams{Test: test, TopK: req.TopK, Relevance: req.Relevance}, req.Grid)
+	if err != nil {
+		return nil, err
+	}
+	result.Leaderboard = *board
+	result.FinishedAt = time.Now()
+
+	if len(board.Trials) > 0 && board.Trials[0].Error == "" {
+		best := board.Trials[0]
+		c := best.Config
+		log.Printf("Búsqueda terminada en %s: mejor %s=%.4f con modo %s, métrica %s, normalización %s, K=%d",
+			result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond), board.Objective, best.Score,
+			c.Mode, c.Metric, c.Normalization, c.K)
+	}
+	if err := s.Mongo.SaveTuning(result); err != nil {
+		log.Printf("No se pudo guardar la búsqueda de hiperparámetros en Mongo: %v", err)
+	}
+	return result, nil
+}
+
+// Complete completa los valores por defecto y valida la división.
+func (req TuneRequest) Complete() (TuneRequest, error) {
+	if req.Split == "" {
+		req.Split = data.SplitRandom
+	}
+	switch req.Split {
+	case data.SplitRandom:
+		if req.TestFrac == 0 {
+			req.TestFrac = 0.2
+		}
+		if req.TestFrac <= 0 || req.TestFrac >= 1 {
+			return req, fmt.Errorf("testFrac debe estar entre 0 y 1")
+		}
+	case data.SplitLeaveKOut:
+		if req.Leave == 0 {
+			req.Leave = 1
+		}
+		if req.Leave < 0 {
+			return req, fmt.Errorf("leave no puede ser negativo")
+		}
+	default:
+		return req, fmt.Errorf("división no soportada: %q (random o leave-k-out)", req.Split)
+	}
+	if req.Seed == 0 {
+		req.Seed = 42
+	}
+	g := req.Grid
+	if len(g.K)+len(g.Metrics)+len(g.Modes)+len(g.Normalizations)+
+		len(g.MinOverlap)+len(g.Shrinkage)+len(g.MinSimilarity)+len(g.MinVoters) == 0 {
+		defaults := defaultTuneGrid
+		defaults.Objective, defaults.Parallel = g.Objective, g.Parallel
+		req.Grid = defaults
+	}
+	return req, nil
+}
+
+// AdoptTuning adopta la combinación de ese puesto de la última búsqueda: a
+// partir de ahí completa las opciones que no especifiquen las
+// recomendaciones. Se guarda en Mongo para sobrevivir reinicios.
+func (s *RecommendationService) AdoptTuning(rank int) (*TunedConfig, error) {
+	s.tuning.mu.RLock()
+	latest := s.tuning.latest
+	s.tuning.mu.RUnlock()
+
+	if latest == nil {
+		return nil, fmt.Errorf("todavía no hay ninguna búsqueda de hiperparámetros")
+	}
+	trials := latest.Leaderboard.Trials
+	if rank < 1 || rank > len(trials) {
+		return nil, fmt.Errorf("puesto fuera de rango: %d (1 a %d)", rank, len(trials))
+	}
+	trial := trials[rank-1]
+	if trial.Error != "" {
+		return nil, fmt.Errorf("la combinación del puesto %d falló: %s", rank, trial.Error)
+	}
+
+	adopted := &TunedConfig{
+		Config:         trial.Config,
+		Objective:      latest.Leaderboard.Objective,
+		Score:          trial.Score,
+		DatasetID:      latest.DatasetID,
+		DatasetVersion: latest.DatasetVersion,
+		AdoptedAt:      time.Now(),
+	}
+	if err := s.Mongo.SaveSetting(adoptedSetting, adopted); err != nil {
+		return nil, fmt.Errorf("no se pudo guardar la configuración adoptada: %w", err)
+	}
+
+	s.tuning.mu.Lock()
+	s.tuning.adopted = adopted
+	s.tuning.mu.Unlock()
+
+	c := adopted.Config
+	log.Printf("Configuración adoptada (puesto %d, %s=%.4f): modo %s, métrica %s, normalización %s, K=%d",
+		rank, adopted.Objective, adopted.Score, c.Mode, c.Metric, c.Normalization, c.K)
+	return adopted, nil
+}
+
+// ResetTuning descarta la configuración adoptada: las recomendaciones
+// vuelven a los valores por defecto.
+func (s *RecommendationService) ResetTuning() error {
+	if err := s.Mongo.DeleteSetting(adoptedSetting); err != nil {
+		return err
+	}
+	s.tuning.mu.Lock()
+	s.tuning.adopted = nil
+	s.tuning.mu.Unlock()
+	return nil
+}
+
+// TuningStatus describe la última búsqueda, si hay una en curso y la
+// configuración adoptada.
+func (s *RecommendationService) TuningStatus() TuningStatus {
+	s.tuning.mu.RLock()
+	defer s.tuning.mu.RUnlock()
+
+	st := TuningStatus{Running: s.tuning.running, Latest: s.tuning.latest, Adopted: s.tuning.adopted}
+	if s.tuning.lastErr != nil {
+		st.Error = s.tuning.lastErr.Error()
+	}
+	return st
+}
+
+// defaultOptions son las opciones de una recomendación que no especifica
+// ninguna: las de la configuración adoptada o, sin ella, las de siempre.
+func (s *RecommendationService) defaultOptions() coordinator.RecommendOptions {
+	s.tuning.mu.RLock()
+	adopted := s.tuning.adopted
+	s.tuning.mu.RUnlock()
+
+	if adopted == nil {
+		return coordinator.RecommendOptions{K: defaultTuneK, Metric: compute.MetricCosine, Mode: ModeUser, Normalization: compute.NormalizationNone}
+	}
+	c := adopted.Config
+	return coordinator.RecommendOptions{
+		K:             c.K,
+		Metric:        c.Metric,
+		Mode:          c.Mode,
+		Normalization: c.Normalization,
+		Confidence:    c.Confidence,
+	}
+}
+
+// WithDefaults completa las opciones que p no especifica (K, métrica, modo,
+// normalización y cada regla de confianza en cero, o en nil MinSimilarity)
+// con la configuración adoptada. Sin configuración adoptada p no cambia (K
+// queda en Limit).
+func (s *RecommendationService) WithDefaults(p RecommendParams) RecommendParams {
+	s.tuning.mu.RLock()
+	adopted := s.tuning.adopted
+	s.tuning.mu.RUnlock()
+
+	if adopted == nil {
+		return p
+	}
+	c := adopted.Config
+	if p.K == 0 {
+		p.K = c.K
+	}
+	if p.Metric == "" {
+		p.Metric = c.Metric
+	}
+	if p.Mode == "" {
+		p.Mode = c.Mode
+	}
+	if p.Normalization == "" {
+		p.Normalization = c.Normalization
+	}
+	if p.Confidence.MinOverlap == 0 {
+		p.Confidence.MinOverlap = c.MinOverlap
+	}
+	if p.Confidence.Shrinkage == 0 {
+		p.Confidence.Shrinkage = c.Shrinkage
+	}
+	if p.Confidence.MinSimilarity == nil {
+		p.Confidence.MinSimilarity = c.MinSimilarity
+	}
+	if p.Confidence.MinVoters == 0 {
+		p.Confidence.MinVoters = c.MinVoters
+	}
+	return p
+}
@@ -4,7 +4,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sdr/cluster/coordinator/internal/datastore"
+	"sdr/cluster/coordinator/internal/dispatcher"
+	"sdr/cluster/coordinator/internal/jobs"
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/coordinator/internal/tcpclient"
 	"sdr/cluster/coordinator/internal/tcpserver"
+	"strconv"
+	"time"
 )
 
 func main() {
@@ -13,8 +20,41 @@ func main() {
 		port = "8081"
 	}
 
+	// Latidos de los workers: intervalo y tiempo sin latidos antes de desalojarlos
+	interval := durationEnv("HEARTBEAT_INTERVAL", 2*time.Second)
+	timeout := durationEnv("HEARTBEAT_TIMEOUT", 3*interval)
+
+	reg := registry.New(interval, timeout)
+	reg.OnEvict = func(w registry.Worker) {
+		tcpclient.Forget(w.Addr)
+	}
+	go reg.Run(nil)
+
+	datasets := datastore.New()
+	disp := dispatcher.New(reg, datasets)
+	datasets.OnDrop = disp.DropDataset
+	disp.MaxRetries = intEnv("CHUNK_MAX_RETRIES", disp.MaxRetries)
+	disp.SpeculativeFraction = floatEnv("SPECULATIVE_FRACTION", disp.SpeculativeFraction)
+	disp.MinSpeculativeDelay = durationEnv("SPECULATIVE_MIN_DELAY", disp.MinSpeculativeDelay)
+	disp.ItemNeighbors = intEnv("ITEM_NEIGHBORS", disp.ItemNeighbors)
+	disp.ItemModelRefresh = durationEnv("ITEM_MODEL_REFRESH", disp.ItemModelRefresh)
+
+	// Jobs asíncronos: cuántos corren a la vez, su plazo y cuánto se
+	// conservan después de terminar
+	jm := jobs.New(disp.Process)
+	jm.Acquire = disp.AcquireDataset
+	jm.MaxRunning = intEnv("JOB_MAX_RUNNING", jm.MaxRunning)
+	jm.Timeout = durationEnv("JOB_TIMEOUT", jm.Timeout)
+	jm.Retention = durationEnv("JOB_RETENTION", jm.Retention)
+	go jm.Run(nil)
+
 	addr := fmt.Sprintf("0.0.0.0:%s", port)
-	srv := &tcpserver.TCPServer{Addr: addr}
+	srv := &tcpserver.TCPServer{
+		Addr:       addr,
+		Dispatcher: disp,
+		Registry:   reg,
+		Jobs:       jm,
+	}
 
 	log.Printf("Iniciando coordinador (TCP) en %s", addr)
 	if err := srv.Run(); err != nil {
@@ -22,5 +62,44 @@ func main() {
 	}
 }
 
+// durationEnv lee una duración (p. ej. "2s") de una variable de entorno
+func durationEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("valor inválido para %s (%q), usando %s", name, v, def)
+		return def
+	}
+	return d
+}
 
+// intEnv lee un entero no negativo de una variable de entorno
+func intEnv(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("valor inválido para %s (%q), usando %d", name, v, def)
+		return def
+	}
+	return n
+}
 
+// floatEnv lee un número entre 0 y 1 de una variable de entorno
+func floatEnv(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		log.Printf("valor inválido para %s (%q), usando %g", name, v, def)
+		return def
+	}
+	return f
+}
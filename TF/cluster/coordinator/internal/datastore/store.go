@@ -0,0 +1,170 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// Store guarda en el coordinador la última versión de cada dataset, para
+// poder reenviarla a los workers que se registren más tarde o se reinicien.
+// Una versión reemplazada se conserva mientras alguna solicitud o job la
+// tenga retenida (ver Acquire), así lo que quedó fijado a ella termina
+// aunque mientras tanto lleguen calificaciones nuevas.
+type Store struct {
+	mu       sync.RWMutex
+	datasets map[string]*models.Dataset            // última versión de cada dataset
+	retired  map[models.DatasetRef]*models.Dataset // versiones reemplazadas que siguen en uso
+	users    map[models.DatasetRef]int             // retenciones vigentes de cada versión
+
+	// OnDrop se llama (fuera del lock) con cada versión que deja de
+	// guardarse, para descartarla también en los workers
+	OnDrop func(ref models.DatasetRef)
+}
+
+func New() *Store {
+	return &Store{
+		datasets: make(map[string]*models.Dataset),
+		retired:  make(map[models.DatasetRef]*models.Dataset),
+		users:    make(map[models.DatasetRef]int),
+	}
+}
+
+// Put reemplaza la versión guardada del dataset si ds es posterior.
+// Devuelve false si ya estaba guardada esa versión u otra más nueva (un
+// envío atrasado o reintentado no pisa la vigente).
+func (s *Store) Put(ds *models.Dataset) bool {
+	s.mu.Lock()
+	cur, ok := s.datasets[ds.ID]
+	if ok && ds.Version <= cur.Version {
+		s.mu.Unlock()
+		return false
+	}
+	s.datasets[ds.ID] = ds
+
+	var dropped []models.DatasetRef
+	if ok {
+		dropped = s.retire(cur)
+	}
+	s.mu.Unlock()
+
+	s.drop(dropped)
+	return true
+}
+
+// Forget descarta la versión vigente de un dataset que ya no se usará (p. ej.
+// el de entrenamiento de una búsqueda de hiperparámetros). Si alguna
+// solicitud todavía la retiene, se descarta cuando la suelte.
+func (s *Store) Forget(ref models.DatasetRef) {
+	s.mu.Lock()
+	cur, ok := s.datasets[ref.ID]
+	if !ok || cur.Version != ref.Version {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.datasets, ref.ID)
+	dropped := s.retire(cur)
+	s.mu.Unlock()
+
+	s.drop(dropped)
+}
+
+// retire aparta una versión que dejó de ser la vigente: si alguien la
+// retiene se conserva hasta que la suelte, si no se devuelve para
+// descartarla (con el lock tomado).
+func (s *Store) retire(ds *models.Dataset) []models.DatasetRef {
+	ref := models.DatasetRef{ID: ds.ID, Version: ds.Version}
+	if s.users[ref] > 0 {
+		s.retired[ref] = ds
+		return nil
+	}
+	return []models.DatasetRef{ref}
+}
+
+// Get devuelve el dataset pedido. Si el coordinador no tiene esa versión
+// devuelve un RemoteError con CodeDatasetMissing para que la API la envíe.
+func (s *Store) Get(ref models.DatasetRef) (*models.Dataset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookup(ref)
+}
+
+// Acquire es como Get pero además retiene la versión hasta que se llame a
+// release: si mientras tanto llega una versión más nueva, la pedida se
+// conserva para los chunks que todavía la usan. release puede llamarse más
+// de una vez.
+func (s *Store) Acquire(ref models.DatasetRef) (ds *models.Dataset, release func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds, err = s.lookup(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.users[ref]++
+
+	var once sync.Once
+	return ds, func() { once.Do(func() { s.release(ref) }) }, nil
+}
+
+func (s *Store) release(ref models.DatasetRef) {
+	s.mu.Lock()
+	s.users[ref]--
+	var dropped []models.DatasetRef
+	if s.users[ref] <= 0 {
+		delete(s.users, ref)
+		if _, ok := s.retired[ref]; ok {
+			delete(s.retired, ref)
+			dropped = append(dropped, ref)
+		}
+	}
+	s.mu.Unlock()
+
+	s.drop(dropped)
+}
+
+// Has indica si hay alguna versión vigente de ese dataset.
+func (s *Store) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.datasets[id]
+	return ok
+}
+
+// All devuelve la última versión de cada dataset guardado.
+func (s *Store) All() []*models.Dataset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*models.Dataset, 0, len(s.datasets))
+	for _, ds := range s.datasets {
+		out = append(out, ds)
+	}
+	return out
+}
+
+// lookup busca la versión entre las vigentes y las retenidas (con el lock
+// tomado).
+func (s *Store) lookup(ref models.DatasetRef) (*models.Dataset, error) {
+	if ds, ok := s.datasets[ref.ID]; ok && ds.Version == ref.Version {
+		return ds, nil
+	}
+	if ds, ok := s.retired[ref]; ok {
+		return ds, nil
+	}
+	return nil, &protocol.RemoteError{
+		Code:    protocol.CodeDatasetMissing,
+		Message: fmt.Sprintf("dataset %s versión %d no disponible en el coordinador", ref.ID, ref.Version),
+	}
+}
+
+func (s *Store) drop(refs []models.DatasetRef) {
+	if s.OnDrop == nil {
+		return
+	}
+	for _, ref := range refs {
+		s.OnDrop(ref)
+	}
+}
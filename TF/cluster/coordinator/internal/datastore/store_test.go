@@ -0,0 +1,123 @@
+package datastore
+
+import (
+	"testing"
+
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"sdr/cluster/shared/sparse"
+)
+
+func dataset(version int64) *models.Dataset {
+	return &models.Dataset{ID: "ml", Version: version, Matrix: sparse.FromDense([][]float64{{float64(version)}})}
+}
+
+func ref(version int64) models.DatasetRef {
+	return models.DatasetRef{ID: "ml", Version: version}
+}
+
+func TestPutKeepsNewest(t *testing.T) {
+	s := New()
+	var dropped []int64
+	s.OnDrop = func(r models.DatasetRef) { dropped = append(dropped, r.Version) }
+
+	if !s.Put(dataset(2)) {
+		t.Fatal("Put de la primera versión devolvió false")
+	}
+	if s.Put(dataset(1)) || s.Put(dataset(2)) {
+		t.Error("una versión vieja o repetida no debe reemplazar a la vigente")
+	}
+	if !s.Put(dataset(3)) {
+		t.Fatal("Put de una versión nueva devolvió false")
+	}
+
+	// sin nadie que la use, la versión reemplazada se descarta enseguida
+	if _, err := s.Get(ref(2)); !protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		t.Errorf("Get(v2) = %v, se esperaba %s", err, protocol.CodeDatasetMissing)
+	}
+	if len(dropped) != 1 || dropped[0] != 2 {
+		t.Errorf("descartadas = %v, se esperaba [2]", dropped)
+	}
+	if all := s.All(); len(all) != 1 || all[0].Version != 3 {
+		t.Errorf("All devolvió %d datasets, se esperaba solo v3", len(all))
+	}
+}
+
+func TestAcquireRetainsReplacedVersion(t *testing.T) {
+	s := New()
+	var dropped []int64
+	s.OnDrop = func(r models.DatasetRef) { dropped = append(dropped, r.Version) }
+
+	s.Put(dataset(1))
+	_, releaseA, err := s.Acquire(ref(1))
+	if err != nil {
+		t.Fatalf("Acquire(v1): %v", err)
+	}
+	ds, releaseB, err := s.Acquire(ref(1))
+	if err != nil || ds.Version != 1 {
+		t.Fatalf("Acquire(v1) = %v, %v", ds, err)
+	}
+
+	// llegan dos versiones nuevas mientras v1 sigue en uso
+	s.Put(dataset(2))
+	s.Put(dataset(3))
+	if _, err := s.Get(ref(1)); err != nil {
+		t.Errorf("v1 retenida debe seguir disponible: %v", err)
+	}
+	if _, err := s.Get(ref(2)); err == nil {
+		t.Error("v2 no estaba retenida y debía descartarse")
+	}
+	if _, _, err := s.Acquire(ref(2)); !protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		t.Errorf("Acquire(v2) = %v, se esperaba %s", err, protocol.CodeDatasetMissing)
+	}
+
+	// se descarta recién cuando la suelta el último, una sola vez
+	releaseA()
+	releaseA()
+	if _, err := s.Get(ref(1)); err != nil {
+		t.Errorf("v1 sigue retenida por otra solicitud: %v", err)
+	}
+	releaseB()
+	if _, err := s.Get(ref(1)); err == nil {
+		t.Error("v1 debía descartarse al soltarla")
+	}
+	if len(dropped) != 2 || dropped[0] != 2 || dropped[1] != 1 {
+		t.Errorf("descartadas = %v, se esperaba [2 1]", dropped)
+	}
+
+	// soltar la versión vigente no la descarta
+	_, release, _ := s.Acquire(ref(3))
+	release()
+	if _, err := s.Get(ref(3)); err != nil {
+		t.Errorf("la versión vigente no debe descartarse: %v", err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	s := New()
+	var dropped []int64
+	s.OnDrop = func(r models.DatasetRef) { dropped = append(dropped, r.Version) }
+
+	s.Put(dataset(5))
+	s.Forget(ref(4)) // no es la vigente: no cambia nada
+	if _, err := s.Get(ref(5)); err != nil {
+		t.Fatalf("Forget de otra versión descartó la vigente: %v", err)
+	}
+
+	// retenida por una solicitud: se descarta recién al soltarla
+	_, release, _ := s.Acquire(ref(5))
+	s.Forget(ref(5))
+	if len(s.All()) != 0 {
+		t.Error("la versión olvidada no debe reenviarse a los workers nuevos")
+	}
+	if _, err := s.Get(ref(5)); err != nil {
+		t.Errorf("la solicitud en curso debe poder seguir usándola: %v", err)
+	}
+	if len(dropped) != 0 {
+		t.Errorf("descartadas = %v antes de soltarla, se esperaba ninguna", dropped)
+	}
+	release()
+	if len(dropped) != 1 || dropped[0] != 5 {
+		t.Errorf("descartadas = %v, se esperaba [5]", dropped)
+	}
+}
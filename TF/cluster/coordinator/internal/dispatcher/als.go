@@ -0,0 +1,133 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+)
+
+// Valores por defecto del entrenamiento ALS
+var defaultALS = models.ALSParams{
+	Factors:    20,
+	Iterations: 10,
+	Lambda:     0.1,
+	Seed:       42,
+}
+
+// -------------------------------------------
+// ENTRENAR FACTORES LATENTES (ALS distribuido)
+// Cada iteración tiene dos fases: con los factores de las películas fijos,
+// los workers resuelven los de sus bloques de usuarios; luego, con los de
+// los usuarios fijos, los de sus bloques de películas. El coordinador junta
+// cada lado y lo difunde como fijo en la fase siguiente.
+// -------------------------------------------
+func (d *Dispatcher) processTrainALS(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	params := defaultALS
+	if msg.ALS != nil {
+		params = withALSDefaults(*msg.ALS)
+	}
+	log.Printf("Iniciando entrenamiento ALS (k=%d, %d iteraciones, lambda=%g)...\n", params.Factors, params.Iterations, params.Lambda)
+
+	ref := models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion}
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	if ds.Matrix.NNZ() == 0 {
+		return models.CoordinatorResponse{}, fmt.Errorf("dataset %s v%d vacío", ref.ID, ref.Version)
+	}
+	users, movies := ds.Matrix.Rows, ds.Matrix.Cols
+
+	workers := d.Registry.Live()
+	if len(workers) == 0 {
+		return models.CoordinatorResponse{}, fmt.Errorf("no hay workers registrados")
+	}
+
+	model := &models.FactorModel{
+		DatasetID:      ref.ID,
+		DatasetVersion: ref.Version,
+		Params:         params,
+		ItemFactors:    compute.InitFactors(movies, params.Factors, params.Seed),
+	}
+
+	start := time.Now()
+	for it := 1; it <= params.Iterations; it++ {
+		model.UserFactors, _, err = d.alsPhase(ctx, models.PhaseALSUsers, ref, users, model.ItemFactors, params.Lambda, workers)
+		if err != nil {
+			return models.CoordinatorResponse{}, err
+		}
+
+		var rmse float64
+		model.ItemFactors, rmse, err = d.alsPhase(ctx, models.PhaseALSItems, ref, movies, model.UserFactors, params.Lambda, workers)
+		if err != nil {
+			return models.CoordinatorResponse{}, err
+		}
+		model.RMSE = append(model.RMSE, rmse)
+		log.Printf("ALS iteración %d/%d: RMSE de entrenamiento %.4f\n", it, params.Iterations, rmse)
+	}
+
+	log.Printf("Entrenamiento ALS completado en %s, enviando factores a la API...\n", time.Since(start).Round(time.Millisecond))
+	return models.CoordinatorResponse{Model: model}, nil
+}
+
+// alsPhase reparte las rows filas de un lado entre los workers con los
+// factores del otro lado fijos y junta los factores resultantes. Devuelve
+// también el RMSE de entrenamiento con los factores nuevos.
+func (d *Dispatcher) alsPhase(ctx context.Context, phase models.ChunkPhase, ref models.DatasetRef, rows int,
+	fixed [][]float64, lambda float64, workers []registry.Worker) ([][]float64, float64, error) {
+
+	// un chunk por worker: los factores fijos viajan una vez por worker
+	chunks := splitChunks(rows, len(workers), models.Chunk{
+		Phase:   phase,
+		Dataset: ref,
+		Fixed:   fixed,
+		Lambda:  lambda,
+	})
+	results, err := d.runChunks(ctx, chunks, workers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	factors := make([][]float64, rows)
+	var sse float64
+	var count int
+	for i, r := range results {
+		c := chunks[i]
+		if len(r.Factors) != c.End-c.Start {
+			return nil, 0, fmt.Errorf("chunk %d (%s) incompleto: %d factores, se esperaban %d", c.ID, phase, len(r.Factors), c.End-c.Start)
+		}
+		copy(factors[c.Start:c.End], r.Factors)
+		sse += r.Loss
+		count += r.Count
+	}
+
+	rmse := 0.0
+	if count > 0 {
+		rmse = math.Sqrt(sse / float64(count))
+	}
+	return factors, rmse, nil
+}
+
+// withALSDefaults completa los parámetros no indicados. Una lambda en cero
+// o negativa también usa la de por defecto (ver models.ALSParams).
+func withALSDefaults(p models.ALSParams) models.ALSParams {
+	if p.Factors <= 0 {
+		p.Factors = defaultALS.Factors
+	}
+	if p.Iterations <= 0 {
+		p.Iterations = defaultALS.Iterations
+	}
+	if p.Lambda <= 0 {
+		p.Lambda = defaultALS.Lambda
+	}
+	if p.Seed == 0 {
+		p.Seed = defaultALS.Seed
+	}
+	return p
+}
@@ -0,0 +1,311 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// Estado de un chunk dentro de una solicitud
+type chunkStatus string
+
+const (
+	chunkPending chunkStatus = "PENDING"
+	chunkRunning chunkStatus = "RUNNING"
+	chunkDone    chunkStatus = "DONE"
+	chunkFailed  chunkStatus = "FAILED"
+)
+
+// Cada cuánto se revisa si hay chunks rezagados que convenga duplicar
+const speculationCheck = 50 * time.Millisecond
+
+// chunkRun registra el seguimiento de un chunk: en qué workers se intentó,
+// cuántas veces, cuántas copias siguen en vuelo y con qué resultado.
+type chunkRun struct {
+	index       int // posición en los chunks de la solicitud
+	chunk       models.Chunk
+	status      chunkStatus
+	worker      registry.Worker // worker del intento principal
+	started     time.Time       // inicio del intento principal
+	attempts    int
+	inflight    int  // copias en vuelo (principal + especulativa)
+	speculated  bool // ya se lanzó una copia especulativa del intento actual
+	tried       map[string]bool
+	result      models.WorkerResult
+	err         error
+	ctx         context.Context
+	cancel      context.CancelFunc // cancela todas las copias del chunk
+	retryQueued bool
+}
+
+// attempt es el resultado de un envío de un chunk a un worker.
+type attempt struct {
+	run         *chunkRun
+	worker      registry.Worker
+	speculative bool
+	elapsed     time.Duration
+	resp        models.WorkerResult
+	err         error
+}
+
+// runChunks envía cada chunk a un worker en paralelo y devuelve los resultados
+// en el mismo orden.
+//
+//   - Un chunk fallido se reintenta en otro worker vivo hasta MaxRetries veces;
+//     solo si no puede completarse en ninguno se devuelve error.
+//   - Cuando ya terminó una fracción SpeculativeFraction de los chunks, los
+//     chunks que llevan más tiempo del esperado se duplican en un worker
+//     ocioso; gana la primera copia en terminar y la otra se cancela.
+//   - Si ctx se cancela o vence, se cancelan todas las copias en vuelo (los
+//     workers reciben MsgCancel) y se devuelve el error de ctx.
+func (d *Dispatcher) runChunks(ctx context.Context, chunks []models.Chunk, workers []registry.Worker) ([]models.WorkerResult, error) {
+	return d.runChunksObserved(ctx, chunks, workers, nil)
+}
+
+// runChunksObserved es como runChunks pero llama a observe (si no es nil)
+// con cada chunk apenas se completa, en el orden en que terminan; observe
+// corre en el bucle de la solicitud, así que no debe bloquear.
+func (d *Dispatcher) runChunksObserved(ctx context.Context, chunks []models.Chunk, workers []registry.Worker, observe chunkObserver) ([]models.WorkerResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("solicitud cancelada: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // corta cualquier copia que siga en vuelo
+
+	events := make(chan attempt)
+	retries := make(chan *chunkRun)
+	busy := make(map[string]int) // copias en vuelo por worker en esta solicitud
+	var latencies []time.Duration
+
+	launch := func(run *chunkRun, w registry.Worker, speculative bool) {
+		run.status = chunkRunning
+		run.inflight++
+		run.tried[w.ID] = true
+		busy[w.ID]++
+		if !speculative {
+			run.attempts++
+			run.worker = w
+			run.started = time.Now()
+		}
+
+		c := run.chunk
+		c.DeadlineMs = protocol.DeadlineMs(ctx)
+		log.Printf("Enviando chunk %d (%s, rango %d-%d) a %s (intento %d, especulativo=%t)\n",
+			c.ID, c.Phase, c.Start, c.End, w.Addr, run.attempts, speculative)
+
+		go func() {
+			start := time.Now()
+			resp, err := d.sendChunk(run.ctx, w, c)
+			a := attempt{run: run, worker: w, speculative: speculative, elapsed: time.Since(start), resp: resp, err: err}
+			select {
+			case events <- a:
+			case <-ctx.Done(): // la solicitud ya terminó
+			}
+		}()
+	}
+
+	runs := make([]*chunkRun, len(chunks))
+	for i, c := range chunks {
+		runCtx, runCancel := context.WithCancel(ctx)
+		runs[i] = &chunkRun{
+			index:  i,
+			chunk:  c,
+			status: chunkPending,
+			tried:  make(map[string]bool),
+			ctx:    runCtx,
+			cancel: runCancel,
+		}
+		launch(runs[i], workers[c.ID%len(workers)], false)
+	}
+
+	ticker := time.NewTicker(speculationCheck)
+	defer ticker.Stop()
+
+	done := 0
+	for done < len(runs) {
+		select {
+		case a := <-events:
+			run := a.run
+			run.inflight--
+			busy[a.worker.ID]--
+
+			if run.status == chunkDone {
+				continue // la otra copia ya había ganado
+			}
+
+			if a.err == nil {
+				d.Registry.RecordLatency(a.worker.ID, a.elapsed)
+				latencies = append(latencies, a.elapsed)
+				run.status = chunkDone
+				run.result = a.resp
+				run.cancel()
+				done++
+				if a.speculative {
+					log.Printf("Copia especulativa del chunk %d en %s ganó (%s)\n", run.chunk.ID, a.worker.ID, a.elapsed)
+				}
+				if observe != nil {
+					observe(run.index, a.worker, a.elapsed, a.resp)
+				}
+				continue
+			}
+
+			if errors.Is(a.err, context.Canceled) || ctx.Err() != nil {
+				continue // copia cancelada o solicitud vencida (lo atiende ctx.Done)
+			}
+			log.Printf("Chunk %d falló en %s: %v\n", run.chunk.ID, a.worker.Addr, a.err)
+			run.err = a.err
+
+			// si la otra copia sigue en vuelo, todavía puede completarse
+			if run.inflight > 0 || run.retryQueued {
+				continue
+			}
+			if run.attempts > d.MaxRetries {
+				return nil, chunkError(run)
+			}
+			run.retryQueued = true
+			run.speculated = false // el reintento también puede quedar rezagado
+			go func(run *chunkRun) {
+				// pequeña espera para no martillar un clúster que se está recuperando
+				time.Sleep(time.Duration(run.attempts) * 100 * time.Millisecond)
+				select {
+				case retries <- run:
+				case <-ctx.Done():
+				}
+			}(run)
+
+		case run := <-retries:
+			run.retryQueued = false
+			if run.status == chunkDone {
+				continue
+			}
+			next, ok := d.pickWorker(run.tried, busy)
+			if !ok {
+				return nil, chunkError(run)
+			}
+			log.Printf("Reasignando chunk %d de %s a %s\n", run.chunk.ID, run.worker.ID, next.ID)
+			launch(run, next, false)
+
+		case <-ticker.C:
+			d.speculate(runs, done, latencies, busy, launch)
+
+		case <-ctx.Done():
+			log.Printf("Solicitud cancelada con %d de %d chunks completados: %v\n", done, len(runs), ctx.Err())
+			return nil, fmt.Errorf("solicitud cancelada: %w", ctx.Err())
+		}
+	}
+
+	results := make([]models.WorkerResult, len(runs))
+	for i, run := range runs {
+		results[i] = run.result
+	}
+
+	return results, nil
+}
+
+// speculate duplica los chunks rezagados en workers ociosos una vez que la
+// mayoría de los chunks terminó.
+func (d *Dispatcher) speculate(runs []*chunkRun, done int, latencies []time.Duration, busy map[string]int,
+	launch func(*chunkRun, registry.Worker, bool)) {
+
+	if d.SpeculativeFraction <= 0 || len(runs) < 2 || len(latencies) == 0 {
+		return
+	}
+	// con pocos chunks se permite al menos uno pendiente (p. ej. 2 de 3 listos)
+	remaining := float64(len(runs) - done)
+	if remaining > math.Max(1, (1-d.SpeculativeFraction)*float64(len(runs))) {
+		return
+	}
+
+	threshold := d.stragglerThreshold(latencies)
+	for _, run := range runs {
+		if run.status != chunkRunning || run.speculated || run.inflight != 1 {
+			continue
+		}
+		if time.Since(run.started) < threshold {
+			continue
+		}
+
+		w, ok := d.idleWorker(run.worker.ID, busy)
+		if !ok {
+			return // no hay workers ociosos para nadie más
+		}
+
+		log.Printf("Chunk %d rezagado en %s (%s > %s), lanzando copia especulativa en %s\n",
+			run.chunk.ID, run.worker.ID, time.Since(run.started).Round(time.Millisecond), threshold, w.ID)
+		run.speculated = true
+		launch(run, w, true)
+	}
+}
+
+// stragglerThreshold estima a partir de cuánto tiempo un chunk se considera
+// rezagado: 1.5 veces la mediana de los chunks ya completados en esta
+// solicitud (los chunks de una misma fase tienen tamaños parecidos).
+func (d *Dispatcher) stragglerThreshold(latencies []time.Duration) time.Duration {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	threshold := sorted[len(sorted)/2] * 3 / 2
+	if threshold < d.MinSpeculativeDelay {
+		threshold = d.MinSpeculativeDelay
+	}
+	return threshold
+}
+
+// idleWorker elige un worker vivo sin chunks de esta solicitud en vuelo y con
+// capacidad libre, prefiriendo el de menor latencia mediana. Se descartan los
+// workers cuyo p99 histórico indica que también suelen quedar rezagados.
+func (d *Dispatcher) idleWorker(exclude string, busy map[string]int) (registry.Worker, bool) {
+	fleetP95, hasFleet := d.Registry.FleetPercentile(95)
+
+	var candidates []registry.Worker
+	for _, w := range d.Registry.Live() {
+		if w.ID == exclude || busy[w.ID] > 0 || w.Load >= w.Capacity {
+			continue
+		}
+		if hasFleet && w.P99 > 2*fleetP95 {
+			continue
+		}
+		candidates = append(candidates, w)
+	}
+	if len(candidates) == 0 {
+		return registry.Worker{}, false
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].P50 < candidates[j].P50 })
+	return candidates[0], true
+}
+
+// pickWorker elige un worker vivo donde el chunk aún no falló, primero los
+// que no tienen chunks de esta solicitud en vuelo. Si ya falló en todos,
+// vuelve a probar con el menos cargado que siga vivo.
+func (d *Dispatcher) pickWorker(tried map[string]bool, busy map[string]int) (registry.Worker, bool) {
+	live := d.Registry.Live()
+	if len(live) == 0 {
+		return registry.Worker{}, false
+	}
+
+	sort.SliceStable(live, func(i, j int) bool { return busy[live[i].ID] < busy[live[j].ID] })
+	for _, w := range live {
+		if !tried[w.ID] {
+			return w, true
+		}
+	}
+
+	return live[0], true
+}
+
+func chunkError(run *chunkRun) error {
+	run.status = chunkFailed
+	c := run.chunk
+	return fmt.Errorf("chunk %d (%s, rango %d-%d) no pudo completarse en ningún worker tras %d intentos: %w",
+		c.ID, c.Phase, c.Start, c.End, run.attempts, run.err)
+}
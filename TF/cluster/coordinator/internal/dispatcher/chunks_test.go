@@ -0,0 +1,286 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+var testDataset = models.DatasetRef{ID: "ml", Version: 1}
+
+// fakeWorker atiende chunks por TCP como un worker real pero delega la
+// respuesta en handle (o en result, si calcula algo). Anota qué chunks
+// recibió y cuántos se cancelaron.
+type fakeWorker struct {
+	id     string
+	num    int // posición en el clúster de prueba
+	handle func(ctx context.Context, c models.Chunk) error
+	result func(ctx context.Context, c models.Chunk) (models.WorkerResult, error)
+
+	mu       sync.Mutex
+	received []int
+	canceled int
+}
+
+func (f *fakeWorker) serve(ctx context.Context, req protocol.Frame) (any, error) {
+	var task models.WorkerTask
+	if err := req.Decode(&task); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.received = append(f.received, task.Chunk.ID)
+	f.mu.Unlock()
+
+	if f.result != nil {
+		r, err := f.result(ctx, task.Chunk)
+		r.ChunkID = task.Chunk.ID
+		return r, err
+	}
+	err := f.handle(ctx, task.Chunk)
+	if ctx.Err() != nil {
+		f.mu.Lock()
+		f.canceled++
+		f.mu.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// la posición del worker viaja en la respuesta para saber quién la resolvió
+	return models.WorkerResult{ChunkID: task.Chunk.ID, Neighbors: []models.Neighbor{{Index: f.num}}}, nil
+}
+
+func (f *fakeWorker) calls() (received []int, canceled int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.received...), f.canceled
+}
+
+// newTestCluster levanta los workers falsos, los registra con el dataset de
+// prueba ya cargado y devuelve un dispatcher que los usa.
+func newTestCluster(t *testing.T, workers ...*fakeWorker) (*Dispatcher, []registry.Worker) {
+	t.Helper()
+	reg := registry.New(time.Second, time.Minute)
+	for i, f := range workers {
+		f.num = i
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("no se pudo escuchar: %v", err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go protocol.Serve(ln, f.serve)
+
+		reg.Register(models.WorkerRegistration{ID: f.id, Addr: ln.Addr().String(), Capacity: 4})
+		reg.SetDataset(f.id, testDataset)
+	}
+
+	d := New(reg, nil)
+	d.MinSpeculativeDelay = 20 * time.Millisecond
+
+	// mismo orden en que se declararon, para saber dónde cae cada chunk
+	live := make([]registry.Worker, 0, len(workers))
+	byID := make(map[string]registry.Worker)
+	for _, w := range reg.Live() {
+		byID[w.ID] = w
+	}
+	for _, f := range workers {
+		live = append(live, byID[f.id])
+	}
+	return d, live
+}
+
+func testChunks(n int) []models.Chunk {
+	chunks := make([]models.Chunk, n)
+	for i := range chunks {
+		chunks[i] = models.Chunk{ID: i, Phase: models.PhaseNeighbors, Start: i * 10, End: (i + 1) * 10, Dataset: testDataset}
+	}
+	return chunks
+}
+
+func ok(ctx context.Context, c models.Chunk) error { return nil }
+
+func failing(ctx context.Context, c models.Chunk) error { return errors.New("worker roto") }
+
+// answeredBy devuelve, por chunk, el ID del worker que lo resolvió.
+func answeredBy(results []models.WorkerResult, workers []registry.Worker) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		if len(r.Neighbors) > 0 {
+			out[i] = workers[r.Neighbors[0].Index].ID
+		}
+	}
+	return out
+}
+
+func TestRunChunksRetriesOnAnotherWorker(t *testing.T) {
+	broken := &fakeWorker{id: "roto", handle: failing}
+	healthy := &fakeWorker{id: "sano", handle: ok}
+	d, workers := newTestCluster(t, broken, healthy)
+	d.SpeculativeFraction = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// el chunk 0 cae primero en el worker roto y el 1 en el sano
+	results, err := d.runChunks(ctx, testChunks(2), workers)
+	if err != nil {
+		t.Fatalf("runChunks: %v", err)
+	}
+
+	if got := answeredBy(results, workers); got[0] != "sano" || got[1] != "sano" {
+		t.Errorf("chunks resueltos por %v, se esperaba [sano sano]", got)
+	}
+	if results[0].ChunkID != 0 || results[1].ChunkID != 1 {
+		t.Errorf("resultados fuera de orden: chunks %d y %d", results[0].ChunkID, results[1].ChunkID)
+	}
+	if got, _ := broken.calls(); len(got) != 1 {
+		t.Errorf("el worker roto recibió %v, se esperaba un solo intento", got)
+	}
+}
+
+func TestRunChunksExhaustsRetries(t *testing.T) {
+	a := &fakeWorker{id: "a", handle: failing}
+	b := &fakeWorker{id: "b", handle: failing}
+	d, workers := newTestCluster(t, a, b)
+	d.SpeculativeFraction = 0
+	d.MaxRetries = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := d.runChunks(ctx, testChunks(1), workers)
+	if err == nil {
+		t.Fatal("se esperaba error al agotar los reintentos")
+	}
+	if !strings.Contains(err.Error(), "tras 3 intentos") || !strings.Contains(err.Error(), "worker roto") {
+		t.Errorf("error = %q, se esperaba el conteo de intentos y la última causa", err)
+	}
+
+	// el primer intento y los dos reintentos se reparten entre los workers
+	gotA, _ := a.calls()
+	gotB, _ := b.calls()
+	if len(gotA)+len(gotB) != 3 || len(gotB) == 0 {
+		t.Errorf("intentos: a=%v b=%v, se esperaban 3 en total y al menos uno en b", gotA, gotB)
+	}
+}
+
+func TestRunChunksRetriesSameWorkerWhenAlone(t *testing.T) {
+	var mu sync.Mutex
+	failures := 1
+	flaky := &fakeWorker{id: "inestable", handle: func(ctx context.Context, c models.Chunk) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("falla pasajera")
+		}
+		return nil
+	}}
+	d, workers := newTestCluster(t, flaky)
+	d.SpeculativeFraction = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// sin otro worker vivo el reintento vuelve al mismo
+	results, err := d.runChunks(ctx, testChunks(1), workers)
+	if err != nil {
+		t.Fatalf("runChunks: %v", err)
+	}
+	if results[0].ChunkID != 0 {
+		t.Errorf("resultado del chunk %d, se esperaba el 0", results[0].ChunkID)
+	}
+	if got, _ := flaky.calls(); len(got) != 2 {
+		t.Errorf("el worker recibió %v, se esperaban dos intentos", got)
+	}
+}
+
+// hang bloquea el chunk hasta que lo cancelen.
+func hang(ctx context.Context, c models.Chunk) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunChunksSpeculatesStraggler(t *testing.T) {
+	fast := []*fakeWorker{{id: "r1", handle: ok}, {id: "r2", handle: ok}, {id: "r3", handle: ok}}
+	slow := &fakeWorker{id: "lento", handle: hang}
+	d, workers := newTestCluster(t, fast[0], fast[1], fast[2], slow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// el chunk 3 cae en el worker lento; con 3 de 4 listos se duplica
+	results, err := d.runChunks(ctx, testChunks(4), workers)
+	if err != nil {
+		t.Fatalf("runChunks: %v", err)
+	}
+	if got := answeredBy(results, workers)[3]; got == "lento" || got == "" {
+		t.Errorf("el chunk rezagado lo resolvió %q, se esperaba una copia en otro worker", got)
+	}
+
+	// la copia perdedora se cancela en el worker lento
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, canceled := slow.calls(); canceled == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("el worker lento no recibió la cancelación de su copia")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunChunksSpeculatesAgainAfterRetry(t *testing.T) {
+	// el chunk 3 falla tarde en su primer intento y en la copia especulativa;
+	// el reintento queda rezagado y solo termina si se vuelve a duplicar
+	var mu sync.Mutex
+	calls := 0
+	straggler := func(ctx context.Context, c models.Chunk) error {
+		if c.ID != 3 {
+			return nil
+		}
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+
+		switch n {
+		case 1, 2:
+			select {
+			case <-time.After(60 * time.Millisecond):
+				return errors.New("falla tardía")
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case 3:
+			return hang(ctx, c)
+		default:
+			return nil
+		}
+	}
+	var workers []*fakeWorker
+	for _, id := range []string{"r1", "r2", "r3", "r4", "r5"} {
+		workers = append(workers, &fakeWorker{id: id, handle: straggler})
+	}
+	d, live := newTestCluster(t, workers...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := d.runChunks(ctx, testChunks(4), live); err != nil {
+		t.Fatalf("runChunks: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 4 {
+		t.Errorf("el chunk 3 se envió %d veces, se esperaban 4 (intento, copia, reintento y su copia)", calls)
+	}
+}
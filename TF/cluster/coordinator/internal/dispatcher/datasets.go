@@ -0,0 +1,209 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/coordinator/internal/tcpclient"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// PutDataset guarda una nueva versión del dataset enviada por la API y la
+// reparte en segundo plano a todos los workers vivos.
+func (d *Dispatcher) PutDataset(ds *models.Dataset) {
+	if !d.Datasets.Put(ds) {
+		log.Printf("Dataset %s v%d ya estaba cargado (o hay una versión más nueva)", ds.ID, ds.Version)
+		return
+	}
+	log.Printf("Nuevo dataset %s v%d (%d usuarios, %d calificaciones), enviando a los workers", ds.ID, ds.Version, ds.Matrix.Rows, ds.Matrix.NNZ())
+	d.distribute(ds, nil, nil)
+}
+
+// PatchDataset arma una nueva versión del dataset aplicando los cambios de
+// la API sobre la versión que el coordinador ya tiene, y la reparte en
+// segundo plano: como parche a los workers que tienen la versión base y
+// completa al resto. Si el coordinador no tiene la base devuelve un error
+// CodeDatasetMissing para que la API envíe la versión nueva completa.
+func (d *Dispatcher) PatchDataset(patch *models.DatasetPatch) error {
+	if _, err := d.Datasets.Get(models.DatasetRef{ID: patch.ID, Version: patch.Version}); err == nil {
+		log.Printf("Dataset %s v%d ya estaba cargado", patch.ID, patch.Version)
+		return nil
+	}
+	// la base se retiene hasta que los workers reciban el parche: si se
+	// descartara antes, tendrían que recibir la versión completa
+	base, release, err := d.Datasets.Acquire(patch.Base())
+	if err != nil {
+		return err
+	}
+	ds, err := patch.Apply(base)
+	if err != nil {
+		release()
+		return err
+	}
+	if !d.Datasets.Put(ds) {
+		release()
+		return nil
+	}
+	log.Printf("Dataset %s v%d -> v%d con %d cambios (%d usuarios, %d calificaciones), enviando a los workers",
+		ds.ID, patch.BaseVersion, ds.Version, len(patch.Cells), ds.Matrix.Rows, ds.Matrix.NNZ())
+	d.distribute(ds, patch, release)
+	return nil
+}
+
+// distribute envía la nueva versión a todos los workers vivos (con patch, si
+// no es nil, a los que tengan su versión base) y llama a done, si no es
+// nil, cuando terminaron todos los envíos.
+func (d *Dispatcher) distribute(ds *models.Dataset, patch *models.DatasetPatch, done func()) {
+	ref := models.DatasetRef{ID: ds.ID, Version: ds.Version}
+	var wg sync.WaitGroup
+	for _, w := range d.Registry.Live() {
+		wg.Add(1)
+		go func(w registry.Worker) {
+			defer wg.Done()
+			if patch != nil && d.patchWorker(w, patch) {
+				return
+			}
+			if err := d.ensureDataset(context.Background(), w, ref); err != nil {
+				log.Printf("No se pudo enviar el dataset a %s: %v", w.ID, err)
+			}
+		}(w)
+	}
+	if done != nil {
+		go func() {
+			wg.Wait()
+			done()
+		}()
+	}
+}
+
+// patchWorker envía el parche al worker si tiene la versión base. Devuelve
+// false si hay que enviarle la versión completa.
+func (d *Dispatcher) patchWorker(w registry.Worker, patch *models.DatasetPatch) bool {
+	ref := models.DatasetRef{ID: patch.ID, Version: patch.Version}
+
+	lock := d.pushLock(w.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if d.Registry.HasDataset(w.ID, ref) {
+		return true
+	}
+	if !d.Registry.HasDataset(w.ID, patch.Base()) {
+		return false
+	}
+	if err := tcpclient.PushPatch(context.Background(), w.Addr, patch); err != nil {
+		if protocol.IsCode(err, protocol.CodeDatasetMissing) {
+			d.Registry.ForgetDataset(w.ID, patch.Base())
+		}
+		log.Printf("No se pudo aplicar el parche en %s, se enviará el dataset completo: %v", w.ID, err)
+		return false
+	}
+	d.Registry.SetDataset(w.ID, ref)
+	return true
+}
+
+// AcquireDataset retiene la versión del dataset que referencia msg hasta
+// que se llame a release (ver datastore.Store.Acquire). Si el coordinador
+// no la tiene devuelve un error CodeDatasetMissing.
+func (d *Dispatcher) AcquireDataset(msg models.TaskMessage) (release func(), err error) {
+	_, release, err = d.Datasets.Acquire(models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion})
+	return release, err
+}
+
+// ForgetDataset descarta una versión que la API ya no usará, en el
+// coordinador y (al soltarla la última solicitud) en los workers.
+func (d *Dispatcher) ForgetDataset(ref models.DatasetRef) {
+	log.Printf("La API dejó de usar el dataset %s v%d", ref.ID, ref.Version)
+	d.Datasets.Forget(ref)
+}
+
+// DropDataset descarta una versión que el coordinador ya no guarda (ver
+// datastore.Store.OnDrop): las copias de los workers y, si no quedó otra
+// versión del dataset, sus modelos item–item (los de una versión reemplazada
+// se siguen usando hasta recalcularlos). El aviso va a todos los workers vivos, no solo a los que el
+// registro cree que la tienen, para no dejar copias olvidadas en memoria.
+func (d *Dispatcher) DropDataset(ref models.DatasetRef) {
+	if !d.Datasets.Has(ref.ID) {
+		d.items.forget(ref.ID)
+	}
+	for _, w := range d.Registry.Live() {
+		d.Registry.ForgetDataset(w.ID, ref)
+		go func(w registry.Worker) {
+			if err := tcpclient.ForgetDataset(context.Background(), w.Addr, ref); err != nil {
+				log.Printf("No se pudo descartar el dataset en %s: %v", w.ID, err)
+			}
+		}(w)
+	}
+	log.Printf("Dataset %s v%d descartado", ref.ID, ref.Version)
+}
+
+// SyncWorker envía a un worker recién registrado todos los datasets cargados.
+func (d *Dispatcher) SyncWorker(workerID string) {
+	for _, w := range d.Registry.Live() {
+		if w.ID != workerID {
+			continue
+		}
+		for _, ds := range d.Datasets.All() {
+			ref := models.DatasetRef{ID: ds.ID, Version: ds.Version}
+			if err := d.ensureDataset(context.Background(), w, ref); err != nil {
+				log.Printf("No se pudo enviar el dataset a %s: %v", w.ID, err)
+			}
+		}
+	}
+}
+
+// sendChunk envía un chunk a un worker asegurándose antes de que tenga la
+// versión del dataset que referencia. Si el worker la perdió (por ejemplo,
+// se reinició) se la reenvía y se repite el envío una vez.
+func (d *Dispatcher) sendChunk(ctx context.Context, w registry.Worker, c models.Chunk) (models.WorkerResult, error) {
+	if err := d.ensureDataset(ctx, w, c.Dataset); err != nil {
+		return models.WorkerResult{}, err
+	}
+
+	task := models.WorkerTask{Chunk: c}
+	resp, err := tcpclient.SendTask(ctx, w.Addr, task)
+	if protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		d.Registry.ForgetDataset(w.ID, c.Dataset)
+		if err := d.ensureDataset(ctx, w, c.Dataset); err != nil {
+			return models.WorkerResult{}, err
+		}
+		resp, err = tcpclient.SendTask(ctx, w.Addr, task)
+	}
+	return resp, err
+}
+
+// ensureDataset envía el dataset al worker si todavía no lo tiene. Los envíos
+// a un mismo worker se serializan para no mandar la matriz dos veces.
+func (d *Dispatcher) ensureDataset(ctx context.Context, w registry.Worker, ref models.DatasetRef) error {
+	if d.Registry.HasDataset(w.ID, ref) {
+		return nil
+	}
+
+	lock := d.pushLock(w.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if d.Registry.HasDataset(w.ID, ref) {
+		return nil // otro chunk lo envió mientras esperábamos
+	}
+
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Enviando dataset %s v%d a %s", ds.ID, ds.Version, w.ID)
+	if err := tcpclient.PushDataset(ctx, w.Addr, ds); err != nil {
+		return err
+	}
+	d.Registry.SetDataset(w.ID, ref)
+	return nil
+}
+
+func (d *Dispatcher) pushLock(workerID string) *sync.Mutex {
+	l, _ := d.pushLocks.LoadOrStore(workerID, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
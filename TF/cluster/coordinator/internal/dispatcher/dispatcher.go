@@ -1,103 +1,295 @@
 package dispatcher
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
-	"sdr/cluster/coordinator/internal/tcpclient"
+	"sdr/cluster/coordinator/internal/datastore"
+	"sdr/cluster/coordinator/internal/registry"
 	"sdr/cluster/shared/compute"
 	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/sparse"
 )
 
-// Lista de direcciones de los Workers en la red Docker
-var workerAddrs = []string{
-	"sdr_worker1:9000",
-	"sdr_worker2:9000",
-	"sdr_worker3:9000",
-	"sdr_worker4:9000",
-	"sdr_worker5:9000",
-	"sdr_worker6:9000",
-	"sdr_worker7:9000",
-	"sdr_worker8:9000",
+// Valores por defecto de reintentos y ejecución especulativa
+const (
+	defaultMaxRetries          = 3
+	defaultSpeculativeFraction = 0.75
+	defaultMinSpeculativeDelay = 200 * time.Millisecond
+)
+
+// Dispatcher reparte las solicitudes entre los workers vivos del registro.
+type Dispatcher struct {
+	Registry *registry.Registry
+	Datasets *datastore.Store
+
+	// Reintentos de un chunk fallido; cada reintento se reasigna
+	// a otro worker vivo si lo hay
+	MaxRetries int
+
+	// Fracción de chunks completados a partir de la cual los rezagados se
+	// duplican en workers ociosos (0 desactiva la ejecución especulativa)
+	SpeculativeFraction float64
+	// Tiempo mínimo que debe llevar un chunk antes de considerarlo rezagado
+	MinSpeculativeDelay time.Duration
+
+	// Vecinos por película que se precalculan en el modo item; el K de
+	// cada solicitud puede usar menos, no más
+	ItemNeighbors int
+	// Cada cuánto se recalcula, como mucho, el modelo item–item de un
+	// dataset que cambió; mientras tanto se usa el último calculado
+	ItemModelRefresh time.Duration
+
+	pushLocks sync.Map // por ID de worker: *sync.Mutex para envíos de datasets
+	items     itemModels
 }
 
-// Process es el punto de entrada del coordinador para procesar solicitudes
-func Process(msg models.TaskMessage) (models.CoordinatorResponse, error) {
+func New(reg *registry.Registry, datasets *datastore.Store) *Dispatcher {
+	return &Dispatcher{
+		Registry:            reg,
+		Datasets:            datasets,
+		MaxRetries:          defaultMaxRetries,
+		SpeculativeFraction: defaultSpeculativeFraction,
+		MinSpeculativeDelay: defaultMinSpeculativeDelay,
+		ItemNeighbors:       defaultItemNeighbors,
+		ItemModelRefresh:    defaultItemModelRefresh,
+	}
+}
+
+// Process es el punto de entrada del coordinador para procesar solicitudes.
+// Si ctx se cancela o vence, se cancelan los chunks en vuelo en los workers.
+func (d *Dispatcher) Process(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	// validar la métrica y la normalización antes de repartir nada a los workers
+	if err := Validate(msg); err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	msg.Metric = compute.NormalizeMetric(msg.Metric)
+	msg.Normalization = compute.NormalizationName(msg.Normalization)
+
+	// la versión queda retenida hasta terminar aunque llegue otra más nueva
+	_, release, err := d.Datasets.Acquire(models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion})
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	defer release()
+
 	switch msg.Type {
 	case models.RequestSimilarity:
-		return processSimilarity(msg)
+		return d.processSimilarity(ctx, msg)
 	case models.RequestRecommendation:
-		return processRecommendation(msg)
+		switch msg.Mode {
+		case "", models.ModeUser:
+			return d.processRecommendation(ctx, msg)
+		case models.ModeItem:
+			return d.processItemRecommendation(ctx, msg)
+		default:
+			return models.CoordinatorResponse{}, fmt.Errorf("modo de recomendación no reconocido: %s", msg.Mode)
+		}
+	case models.RequestTrainALS:
+		return d.processTrainALS(ctx, msg)
+	case models.RequestEvaluate:
+		return d.processEvaluate(ctx, msg)
+	case models.RequestTune:
+		return d.processTune(ctx, msg)
 	default:
 		return models.CoordinatorResponse{}, fmt.Errorf("tipo de solicitud no reconocido: %s", msg.Type)
 	}
 }
 
+// Validate revisa las opciones comunes de msg (métrica, normalización,
+// reglas de confianza y explicación) sin procesarlo.
+func Validate(msg models.TaskMessage) error {
+	if _, err := compute.LookupMetric(msg.Metric); err != nil {
+		return err
+	}
+	if _, err := compute.LookupNormalization(msg.Normalization); err != nil {
+		return err
+	}
+	if err := validateConfidence(msg.Confidence); err != nil {
+		return err
+	}
+	if msg.Explain < 0 {
+		return fmt.Errorf("explain no puede ser negativo: %d", msg.Explain)
+	}
+	return nil
+}
+
 // -------------------------------------------
-// PROCESAR SIMILITUD (local o distribuido)
+// PROCESAR SIMILITUD (distribuido por bloques)
+// La matriz n×n se divide en t×t bloques; como es simétrica solo se envían
+// los bloques (bi, bj) con bi <= bj. Cada worker devuelve los K vecinos de
+// cada usuario del bloque (de ambos lados) y el coordinador se queda con
+// los K mejores de cada usuario: la matriz completa no se arma nunca.
 // -------------------------------------------
-func processSimilarity(msg models.TaskMessage) (models.CoordinatorResponse, error) {
-	// Por simplicidad, lo mantenemos local
-	result := compute.CosineSimilarityMatrix(msg.Matrix)
+func (d *Dispatcher) processSimilarity(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	log.Printf("Iniciando processSimilarity (métrica %s, normalización %s)...\n", msg.Metric, msg.Normalization)
+
+	ref := models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion}
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	workers := d.Registry.Live()
+	if len(workers) == 0 {
+		return models.CoordinatorResponse{}, fmt.Errorf("no hay workers registrados")
+	}
+
+	k := msg.K
+	if k <= 0 {
+		k = defaultSimilarityK
+	}
+	n := ds.Matrix.Rows
+	blocks := splitBlocks(n, blocksPerSide(n, len(workers)), models.Chunk{
+		Phase:         models.PhaseSimilarityBlock,
+		Dataset:       ref,
+		K:             k,
+		Metric:        msg.Metric,
+		Normalization: msg.Normalization,
+	})
+	log.Printf("Matriz de similitud %dx%d dividida en %d bloques (%d vecinos por usuario)\n", n, n, len(blocks), k)
+
+	prog := newProgress(ctx, msg, len(blocks))
+	results, err := d.runChunksObserved(ctx, blocks, workers, prog.observer(models.PhaseSimilarityBlock))
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	neighbors := make([][]models.Neighbor, n)
+	for i, r := range results {
+		b := blocks[i]
+		rows, cols := b.End-b.Start, b.ColEnd-b.ColStart
+		want := rows
+		if b.Start != b.ColStart {
+			want += cols
+		}
+		if len(r.BlockNeighbors) != want {
+			return models.CoordinatorResponse{}, fmt.Errorf("bloque %d incompleto: vecinos de %d usuarios, se esperaban %d", b.ID, len(r.BlockNeighbors), want)
+		}
+		for ri, nbs := range r.BlockNeighbors {
+			u := b.Start + ri
+			if ri >= rows {
+				u = b.ColStart + ri - rows
+			}
+			neighbors[u] = topNeighbors(append(neighbors[u], nbs...), k)
+		}
+	}
 
 	return models.CoordinatorResponse{
-		Result: result,
+		Neighbors: neighbors,
 	}, nil
 }
 
 // -------------------------------------------
 // PROCESAR RECOMENDACIÓN (distribuido)
+// Fase 1: cada worker calcula similitudes para su rango de usuarios y
+// devuelve sus K mejores vecinos locales.
+// Fase 2 (N > 0): cada worker predice un rango de películas con todos los
+// vecinos globales y devuelve sus N mejores; el coordinador las combina
+// con un merge k-way.
+// Fase 2 (N = 0): cada worker calcula las sumas ponderadas parciales con
+// los vecinos globales de su rango de usuarios; el coordinador las suma y
+// devuelve el vector completo de predicciones.
 // -------------------------------------------
-func processRecommendation(msg models.TaskMessage) (models.CoordinatorResponse, error) {
-	log.Println("Iniciando processRecommendation...")
-	var wg sync.WaitGroup
-	results := make(chan []float64, len(workerAddrs))
-
-	// Enviar la tarea a los 8 Workers en paralelo
-	for _, addr := range workerAddrs {
-		wg.Add(1)
-		go func(a string) {
-			defer wg.Done()
-			log.Printf("Intentando conectar con worker %s...\n", a)
-			resp, err := tcpclient.SendTask(a, msg)
-			if err != nil {
-				log.Printf("Error comunicando con %s: %v\n", a, err)
-				return
-			}
-			log.Printf("Respuesta recibida de %s con %d resultados\n", a, len(resp.Result))
-			if len(resp.Result) > 0 {
-				results <- resp.Result
-			}
-		}(addr)
+func (d *Dispatcher) processRecommendation(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	log.Printf("Iniciando processRecommendation (métrica %s, normalización %s)...\n", msg.Metric, msg.Normalization)
+
+	ref := models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion}
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	n := ds.Matrix.Rows
+	target, err := targetRow(ds, msg)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	stats, err := targetStats(*target, msg.Normalization)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	workers := d.Registry.Live()
+	if len(workers) == 0 {
+		return models.CoordinatorResponse{}, fmt.Errorf("no hay workers registrados")
+	}
+	chunks := splitChunks(n, len(workers), models.Chunk{
+		Dataset:       ref,
+		Target:        target,
+		UserIndex:     msg.UserIndex,
+		K:             msg.K,
+		Metric:        msg.Metric,
+		Normalization: msg.Normalization,
+		Confidence:    msg.Confidence,
+	})
+
+	// avances parciales (si se pidieron): fase 1 más una lista por worker en
+	// la fase 2 (o una suma parcial por rango con N = 0)
+	prog := newProgress(ctx, msg, len(chunks)+min(len(workers), target.Dim))
+
+	// Fase 1: vecinos locales por rango
+	for i := range chunks {
+		chunks[i].Phase = models.PhaseNeighbors
+	}
+	results, err := d.runChunksObserved(ctx, chunks, workers, prog.observer(models.PhaseNeighbors))
+	if err != nil {
+		return models.CoordinatorResponse{}, err
 	}
 
-	wg.Wait()
-	close(results)
-	log.Println("Todos los goroutines completados, combinando resultados...")
+	var candidates []models.Neighbor
+	for _, r := range results {
+		candidates = append(candidates, r.Neighbors...)
+	}
+	neighbors := topNeighbors(candidates, msg.K)
+	log.Printf("Fase 1 completada: %d candidatos, %d vecinos globales\n", len(candidates), len(neighbors))
 
-	// Combinar resultados parciales (promedio)
-	var combined []float64
-	count := 0
-	for r := range results {
-		if combined == nil {
-			combined = make([]float64, len(r))
+	if msg.N > 0 {
+		return d.recommendTopN(ctx, msg, ref, target, stats, neighbors, workers, prog)
+	}
+
+	// Fase 2: sumas parciales solo en los chunks que contienen vecinos
+	var partial []models.Chunk
+	for _, c := range chunks {
+		c.Phase = models.PhasePartial
+		c.Neighbors = nil
+		for _, nb := range neighbors {
+			if nb.Index >= c.Start && nb.Index < c.End {
+				c.Neighbors = append(c.Neighbors, nb)
+			}
 		}
-		for i := range r {
-			combined[i] += r[i]
+		if len(c.Neighbors) > 0 {
+			partial = append(partial, c)
 		}
-		count++
 	}
-
-	if count == 0 {
-		log.Println("No se recibieron resultados de ningún worker.")
-		return models.CoordinatorResponse{}, fmt.Errorf("no se recibieron resultados de los workers")
+	prog.expectMore(len(partial))
+	results, err = d.runChunksObserved(ctx, partial, workers, prog.observer(models.PhasePartial))
+	if err != nil {
+		return models.CoordinatorResponse{}, err
 	}
 
-	for i := range combined {
-		combined[i] /= float64(count)
+	// Combinar numeradores, denominadores y votantes parciales (dispersos)
+	num := make([]float64, target.Dim)
+	den := make([]float64, target.Dim)
+	voters := make([]float64, target.Dim)
+	for _, r := range results {
+		err := addPartials(num, r.Numerators)
+		if err == nil {
+			err = addPartials(den, r.Denominators)
+		}
+		if err == nil {
+			err = addPartials(voters, r.Voters)
+		}
+		if err != nil {
+			return models.CoordinatorResponse{}, err
+		}
 	}
 
+	// de vuelta a la escala del usuario antes de ordenar
+	combined := compute.PredictFromNormalizedSums(*target, stats, num, den, voters, compute.Confidence(msg.Confidence))
 	indexes := compute.SortIndexesByScore(combined)
 	log.Println("Recomendaciones combinadas, enviando respuesta a la API...")
 
@@ -106,3 +298,204 @@ func processRecommendation(msg models.TaskMessage) (models.CoordinatorResponse,
 		Indexes: indexes,
 	}, nil
 }
+
+// recommendTopN reparte las películas entre los workers, cada uno devuelve
+// sus N mejores candidatas y el coordinador se queda con las N mejores. Con
+// avances, cada lista que llega se combina con las anteriores y se envía el
+// top-N parcial.
+func (d *Dispatcher) recommendTopN(ctx context.Context, msg models.TaskMessage, ref models.DatasetRef, target *sparse.Vector,
+	stats compute.RowStats, neighbors []models.Neighbor, workers []registry.Worker, prog *progress) (models.CoordinatorResponse, error) {
+
+	chunks := splitChunks(target.Dim, len(workers), models.Chunk{
+		Phase:         models.PhaseTopN,
+		Dataset:       ref,
+		Target:        target,
+		UserIndex:     msg.UserIndex,
+		K:             msg.K,
+		N:             msg.N,
+		Neighbors:     neighbors,
+		Normalization: msg.Normalization,
+		Confidence:    msg.Confidence,
+		Explain:       msg.Explain,
+	})
+	prog.expectMore(len(chunks))
+
+	var observe chunkObserver
+	if prog != nil {
+		received := make([][]models.ScoredItem, len(chunks))
+		observe = func(i int, w registry.Worker, elapsed time.Duration, r models.WorkerResult) {
+			received[i] = r.Items
+			partial := mergeTopN(received, msg.N)
+			for j, it := range partial {
+				partial[j] = models.ScoredItem{Index: it.Index, Score: stats.Denormalize(it.Score)}
+			}
+			prog.chunkDone(models.PhaseTopN, w, elapsed, partial)
+		}
+	}
+	results, err := d.runChunksObserved(ctx, chunks, workers, observe)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	lists := make([][]models.ScoredItem, len(results))
+	for i, r := range results {
+		lists[i] = r.Items
+	}
+	items := mergeTopN(lists, msg.N)
+
+	// los workers puntúan en la escala normalizada (mismo orden); los aportes
+	// de cada candidata quedan en esa escala
+	indexes := make([]int, len(items))
+	for i, it := range items {
+		indexes[i] = it.Index
+		items[i].Score = stats.Denormalize(it.Score)
+	}
+	log.Printf("Top-%d combinado a partir de %d listas parciales, enviando respuesta a la API...\n", msg.N, len(lists))
+
+	return models.CoordinatorResponse{
+		Indexes: indexes,
+		Items:   items,
+	}, nil
+}
+
+// splitChunks divide las n filas de la matriz en rangos [Start, End)
+// contiguos, uno por worker (o menos si hay menos usuarios que workers).
+// Los demás campos de cada chunk se copian de base.
+func splitChunks(n, parts int, base models.Chunk) []models.Chunk {
+	if parts > n {
+		parts = n
+	}
+	if parts < 1 {
+		parts = 1
+	}
+
+	size := n / parts
+	rest := n % parts
+	chunks := make([]models.Chunk, 0, parts)
+
+	start := 0
+	for id := 0; id < parts; id++ {
+		end := start + size
+		if id < rest {
+			end++ // repartir el resto entre los primeros chunks
+		}
+		c := base
+		c.ID = id
+		c.Start = start
+		c.End = end
+		chunks = append(chunks, c)
+		start = end
+	}
+
+	return chunks
+}
+
+// Bloques de similitud que se buscan por worker, para repartir mejor la carga
+// (los bloques diagonales cuestan la mitad) y que haya margen para reintentos.
+const blocksPerWorker = 4
+
+// Vecinos por usuario de una similitud sin K
+const defaultSimilarityK = 20
+
+// blocksPerSide elige en cuántos tramos se corta cada lado de la matriz:
+// el menor t tal que los t(t+1)/2 bloques del triángulo superior alcancen
+// para blocksPerWorker bloques por worker (sin superar n).
+func blocksPerSide(n, workers int) int {
+	t := 1
+	for t < n && t*(t+1)/2 < blocksPerWorker*workers {
+		t++
+	}
+	return t
+}
+
+// splitBlocks genera los bloques (bi, bj) con bi <= bj de una matriz n×n
+// cortada en t tramos por lado. Los demás campos se copian de base.
+func splitBlocks(n, t int, base models.Chunk) []models.Chunk {
+	ranges := splitChunks(n, t, models.Chunk{})
+
+	var blocks []models.Chunk
+	for bi := range ranges {
+		for bj := bi; bj < len(ranges); bj++ {
+			c := base
+			c.ID = len(blocks)
+			c.Start, c.End = ranges[bi].Start, ranges[bi].End
+			c.ColStart, c.ColEnd = ranges[bj].Start, ranges[bj].End
+			blocks = append(blocks, c)
+		}
+	}
+
+	return blocks
+}
+
+// topNeighbors selecciona los K vecinos globales con mayor similitud
+// a partir de los mejores vecinos locales de cada chunk.
+func topNeighbors(candidates []models.Neighbor, k int) []models.Neighbor {
+	sims := make([]float64, len(candidates))
+	for i, c := range candidates {
+		sims[i] = c.Similarity
+	}
+
+	idxs := compute.TopKIndexes(sims, k)
+	out := make([]models.Neighbor, len(idxs))
+	for i, j := range idxs {
+		out[i] = candidates[j]
+	}
+
+	return out
+}
+
+// targetRow devuelve la fila del usuario objetivo: la que envió la API o,
+// si no envió ninguna, la del dataset. Un usuario fuera del dataset
+// (UserIndex -1) debe enviar su fila.
+func targetRow(ds *models.Dataset, msg models.TaskMessage) (*sparse.Vector, error) {
+	outside := msg.UserIndex == -1 && msg.TargetRow != nil
+	if !outside && (msg.UserIndex < 0 || msg.UserIndex >= ds.Matrix.Rows) {
+		return nil, fmt.Errorf("índice de usuario fuera de rango: %d", msg.UserIndex)
+	}
+	if msg.TargetRow == nil {
+		row := ds.Matrix.Row(msg.UserIndex)
+		return &row, nil
+	}
+	if msg.TargetRow.Dim != ds.Matrix.Cols {
+		return nil, fmt.Errorf("la fila del usuario tiene %d películas, el dataset %d", msg.TargetRow.Dim, ds.Matrix.Cols)
+	}
+	return msg.TargetRow, nil
+}
+
+// targetStats es la transformación de la fila del usuario objetivo con la
+// normalización pedida; sirve para devolver las predicciones a su escala.
+func targetStats(target sparse.Vector, norm string) (compute.RowStats, error) {
+	n, err := compute.LookupNormalization(norm)
+	if err != nil {
+		return compute.RowStats{}, err
+	}
+	return n(target), nil
+}
+
+// validateConfidence rechaza reglas de confianza negativas.
+func validateConfidence(c models.Confidence) error {
+	if c.MinOverlap < 0 || c.Shrinkage < 0 || c.MinVoters < 0 {
+		return fmt.Errorf("reglas de confianza inválidas: minOverlap, shrinkage y minVoters no pueden ser negativos")
+	}
+	if m := c.MinSimilarity; m != nil && (*m < -1 || *m > 1) {
+		return fmt.Errorf("reglas de confianza inválidas: minSimilarity debe estar entre -1 y 1")
+	}
+	return nil
+}
+
+// addPartials suma al vector denso acc las sumas parciales de un worker.
+func addPartials(acc []float64, partial *sparse.Vector) error {
+	if partial == nil {
+		return nil
+	}
+	if partial.Dim != len(acc) || len(partial.Idx) != len(partial.Val) {
+		return fmt.Errorf("sumas parciales de %d películas, se esperaban %d", partial.Dim, len(acc))
+	}
+	for k, i := range partial.Idx {
+		if i < 0 || i >= len(acc) {
+			return fmt.Errorf("película %d fuera de rango en las sumas parciales", i)
+		}
+		acc[i] += partial.Val[k]
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+)
+
+// Largo por defecto de las listas evaluadas (precision@k, recall@k, NDCG@k)
+const defaultEvalTopK = 10
+
+// -------------------------------------------
+// EVALUACIÓN OFFLINE (distribuida)
+// El dataset referenciado tiene las calificaciones de entrenamiento y la
+// solicitud trae las de prueba. Los usuarios se reparten entre los workers:
+// cada uno predice las calificaciones de prueba de los suyos (todos los
+// workers tienen el dataset completo) y devuelve sus sumas; el coordinador
+// las junta en las métricas finales. En modo item el modelo item–item se
+// calcula antes en el clúster (el de esa misma versión) y viaja en cada
+// chunk.
+// -------------------------------------------
+func (d *Dispatcher) processEvaluate(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	if msg.Eval == nil || msg.Eval.Test == nil {
+		return models.CoordinatorResponse{}, fmt.Errorf("la evaluación no trae calificaciones de prueba")
+	}
+	params := *msg.Eval
+	if params.TopK <= 0 {
+		params.TopK = defaultEvalTopK
+	}
+	if msg.Mode == "" {
+		msg.Mode = models.ModeUser
+	}
+	log.Printf("Iniciando evaluación (modo %s, métrica %s, normalización %s, K=%d, top-%d)...\n",
+		msg.Mode, msg.Metric, msg.Normalization, msg.K, params.TopK)
+
+	ref := models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion}
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	test := params.Test
+	if err := test.Validate(); err != nil {
+		return models.CoordinatorResponse{}, fmt.Errorf("calificaciones de prueba inválidas: %w", err)
+	}
+	if test.Rows != ds.Matrix.Rows || test.Cols != ds.Matrix.Cols {
+		return models.CoordinatorResponse{}, fmt.Errorf("las calificaciones de prueba son %dx%d, el dataset %dx%d",
+			test.Rows, test.Cols, ds.Matrix.Rows, ds.Matrix.Cols)
+	}
+
+	base := models.Chunk{
+		Phase:         models.PhaseEvaluate,
+		Dataset:       ref,
+		K:             msg.K,
+		Metric:        msg.Metric,
+		Normalization: msg.Normalization,
+		Confidence:    msg.Confidence,
+		Mode:          msg.Mode,
+		TopK:          params.TopK,
+		Relevance:     params.Relevance,
+	}
+	switch msg.Mode {
+	case models.ModeUser:
+	case models.ModeItem:
+		model, err := d.itemModel(ctx, ref, msg.Metric, msg.Normalization, true)
+		if err != nil {
+			return models.CoordinatorResponse{}, err
+		}
+		neighbors, sims := fitNeighbors(model.neighbors, model.sims, ds.Matrix.Cols, msg.K)
+		base.ItemModel = make([][]models.Neighbor, len(neighbors))
+		for movie := range neighbors {
+			base.ItemModel[movie] = make([]models.Neighbor, len(neighbors[movie]))
+			for i, j := range neighbors[movie] {
+				base.ItemModel[movie][i] = models.Neighbor{Index: j, Similarity: sims[movie][i]}
+			}
+		}
+	default:
+		return models.CoordinatorResponse{}, fmt.Errorf("modo de evaluación no soportado: %s (user o item)", msg.Mode)
+	}
+
+	workers := d.Registry.Live()
+	if len(workers) == 0 {
+		return models.CoordinatorResponse{}, fmt.Errorf("no hay workers registrados")
+	}
+
+	// en modo item cada chunk lleva el modelo completo: un chunk por worker
+	parts := blocksPerWorker * len(workers)
+	if msg.Mode == models.ModeItem {
+		parts = len(workers)
+	}
+	chunks := splitChunks(ds.Matrix.Rows, parts, base)
+	for i := range chunks {
+		chunks[i].Test = test.RowRange(chunks[i].Start, chunks[i].End)
+	}
+
+	start := time.Now()
+	results, err := d.runChunks(ctx, chunks, workers)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	var sums compute.EvalSums
+	for i, r := range results {
+		if r.Eval == nil {
+			return models.CoordinatorResponse{}, fmt.Errorf("chunk %d sin resultado de evaluación", chunks[i].ID)
+		}
+		sums.Add(compute.EvalSums(*r.Eval))
+	}
+	report := models.EvalReport(sums.Report(params.TopK))
+	log.Printf("Evaluación completada en %s: RMSE %.4f, MAE %.4f, P@%d %.4f, R@%d %.4f, NDCG@%d %.4f (%d usuarios)\n",
+		time.Since(start).Round(time.Millisecond), report.RMSE, report.MAE,
+		report.K, report.PrecisionAtK, report.K, report.RecallAtK, report.K, report.NDCGAtK, report.Users)
+
+	return models.CoordinatorResponse{Eval: &report}, nil
+}
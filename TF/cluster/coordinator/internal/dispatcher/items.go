@@ -0,0 +1,322 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+)
+
+// Vecinos por película que se precalculan en el modo item
+const defaultItemNeighbors = 50
+
+// Cada cuánto se recalcula, como mucho, un modelo item–item que quedó atrás
+// de las calificaciones cargadas por la API
+const defaultItemModelRefresh = 10 * time.Minute
+
+// itemModel son las películas más parecidas a cada película de una versión
+// del dataset con una métrica, calculadas una vez en el clúster.
+type itemModel struct {
+	ref       models.DatasetRef  // versión con la que se calcula
+	done      chan struct{}      // se cierra cuando termina el cálculo
+	cancel    context.CancelFunc // interrumpe el cálculo si ya no sirve
+	neighbors [][]int
+	sims      [][]float64
+	err       error
+}
+
+// itemModelKey identifica los modelos de un dataset con una métrica y una
+// normalización, de cualquier versión.
+type itemModelKey struct {
+	datasetID string
+	metric    string
+	norm      string
+}
+
+// itemModelSet son los modelos de un itemModelKey. Cada calificación que
+// carga la API crea una versión del dataset, pero las películas parecidas
+// cambian poco: las recomendaciones usan el último modelo calculado aunque
+// sea de una versión anterior, y se recalcula en segundo plano como mucho
+// cada ItemModelRefresh.
+type itemModelSet struct {
+	versions  map[int64]*itemModel // listos o en cálculo
+	latest    *itemModel           // el más nuevo ya calculado
+	refreshed time.Time            // cuándo empezó el último cálculo
+}
+
+// itemModels guarda los modelos item–item ya calculados (o en cálculo).
+type itemModels struct {
+	mu   sync.Mutex
+	sets map[itemModelKey]*itemModelSet
+}
+
+// forget descarta los modelos de un dataset que ya no está en el
+// coordinador e interrumpe los que se estén calculando.
+func (m *itemModels) forget(datasetID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, set := range m.sets {
+		if key.datasetID != datasetID {
+			continue
+		}
+		for _, model := range set.versions {
+			model.cancel()
+		}
+		delete(m.sets, key)
+	}
+}
+
+// -------------------------------------------
+// PROCESAR RECOMENDACIÓN EN MODO ITEM
+// Las similitudes película–película se calculan repartiendo las películas
+// entre los workers (fase ITEM_NEIGHBORS) la primera vez que se piden para
+// un dataset y una métrica (ver itemModelSet); cada recomendación después
+// solo pondera las calificaciones del propio usuario a las películas vecinas.
+// -------------------------------------------
+func (d *Dispatcher) processItemRecommendation(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	log.Printf("Iniciando processItemRecommendation (métrica %s, normalización %s)...\n", msg.Metric, msg.Normalization)
+
+	ref := models.DatasetRef{ID: msg.DatasetID, Version: msg.DatasetVersion}
+	ds, err := d.Datasets.Get(ref)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	target, err := targetRow(ds, msg)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	stats, err := targetStats(*target, msg.Normalization)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	model, err := d.itemModel(ctx, ref, msg.Metric, msg.Normalization, false)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	if model.ref != ref {
+		log.Printf("Usando el modelo item–item de %s v%d para v%d\n", model.ref.ID, model.ref.Version, ref.Version)
+	}
+
+	// K limita los vecinos por película (el modelo guarda ItemNeighbors)
+	neighbors, sims := fitNeighbors(model.neighbors, model.sims, target.Dim, msg.K)
+
+	if msg.N > 0 {
+		idxs, scores := compute.ItemBasedTopN(*target, stats, neighbors, sims, msg.N, compute.Confidence(msg.Confidence))
+		items := make([]models.ScoredItem, len(idxs))
+		for i := range idxs {
+			items[i] = models.ScoredItem{Index: idxs[i], Score: scores[i]}
+			if msg.Explain > 0 {
+				cs := compute.ItemContributions(*target, stats, neighbors[idxs[i]], sims[idxs[i]], msg.Explain, compute.Confidence(msg.Confidence))
+				items[i].Because = contributions(cs)
+			}
+		}
+		log.Printf("Top-%d por ítems calculado, enviando respuesta a la API...\n", msg.N)
+		return models.CoordinatorResponse{Indexes: idxs, Items: items}, nil
+	}
+
+	preds, _ := compute.ItemBasedPredictions(*target, stats, neighbors, sims, compute.Confidence(msg.Confidence))
+	return models.CoordinatorResponse{
+		Result:  preds,
+		Indexes: compute.SortIndexesByScore(preds),
+	}, nil
+}
+
+// itemModel devuelve un modelo item–item de ese dataset, métrica y
+// normalización. Con exact, el de esa misma versión (las evaluaciones
+// comparan contra calificaciones de prueba que no pueden estar en el
+// modelo); si no, el último ya calculado, que se recalcula en segundo plano
+// si quedó atrás. Si no hay ninguno se calcula en el clúster y las
+// solicitudes concurrentes esperan el mismo cálculo; si ctx vence antes, la
+// solicitud se abandona pero el cálculo sigue para las siguientes.
+func (d *Dispatcher) itemModel(ctx context.Context, ref models.DatasetRef, metric, norm string, exact bool) (*itemModel, error) {
+	key := itemModelKey{datasetID: ref.ID, metric: metric, norm: norm}
+
+	d.items.mu.Lock()
+	if d.items.sets == nil {
+		d.items.sets = make(map[itemModelKey]*itemModelSet)
+	}
+	set, ok := d.items.sets[key]
+	if !ok {
+		set = &itemModelSet{versions: make(map[int64]*itemModel)}
+		d.items.sets[key] = set
+	}
+
+	if latest := set.latest; latest != nil && (latest.ref == ref || !exact) {
+		if latest.ref.Version < ref.Version && time.Since(set.refreshed) >= d.ItemModelRefresh {
+			if _, building := set.versions[ref.Version]; !building {
+				d.startItemModel(key, set, ref)
+			}
+		}
+		d.items.mu.Unlock()
+		return latest, nil
+	}
+	m, ok := set.versions[ref.Version]
+	if !ok {
+		m = d.startItemModel(key, set, ref)
+	}
+	d.items.mu.Unlock()
+
+	select {
+	case <-m.done:
+		if m.err != nil {
+			return nil, m.err
+		}
+		return m, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("solicitud cancelada esperando el modelo item–item: %w", ctx.Err())
+	}
+}
+
+// startItemModel lanza el cálculo del modelo de esa versión (con el lock
+// tomado).
+func (d *Dispatcher) startItemModel(key itemModelKey, set *itemModelSet, ref models.DatasetRef) *itemModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &itemModel{ref: ref, done: make(chan struct{}), cancel: cancel}
+	set.versions[ref.Version] = m
+	set.refreshed = time.Now()
+	go d.buildItemModel(ctx, key, m)
+	return m
+}
+
+// buildItemModel reparte las películas entre los workers y junta los
+// vecinos de cada una.
+func (d *Dispatcher) buildItemModel(ctx context.Context, key itemModelKey, m *itemModel) {
+	defer close(m.done)
+	defer d.finishItemModel(key, m)
+	start := time.Now()
+
+	// el cálculo puede seguir después de la solicitud que lo pidió: retiene
+	// la versión por su cuenta
+	ds, release, err := d.Datasets.Acquire(m.ref)
+	if err == nil {
+		defer release()
+		if ds.Matrix.Rows == 0 {
+			err = fmt.Errorf("dataset %s v%d vacío", m.ref.ID, m.ref.Version)
+		}
+	}
+	if err != nil {
+		m.err = err
+		return
+	}
+
+	workers := d.Registry.Live()
+	if len(workers) == 0 {
+		m.err = fmt.Errorf("no hay workers registrados")
+		return
+	}
+
+	movies := ds.Matrix.Cols
+	chunks := splitChunks(movies, blocksPerWorker*len(workers), models.Chunk{
+		Phase:         models.PhaseItemNeighbors,
+		Dataset:       m.ref,
+		K:             d.ItemNeighbors,
+		Metric:        key.metric,
+		Normalization: key.norm,
+	})
+	log.Printf("Calculando modelo item–item de %s v%d (%s, %s): %d películas en %d chunks\n",
+		m.ref.ID, m.ref.Version, key.metric, key.norm, movies, len(chunks))
+
+	results, err := d.runChunks(ctx, chunks, workers)
+	if err != nil {
+		m.err = fmt.Errorf("error calculando el modelo item–item: %w", err)
+		return
+	}
+
+	neighbors := make([][]int, movies)
+	sims := make([][]float64, movies)
+	for i, r := range results {
+		c := chunks[i]
+		if len(r.ItemNeighbors) != c.End-c.Start {
+			m.err = fmt.Errorf("chunk %d incompleto: %d películas, se esperaban %d", c.ID, len(r.ItemNeighbors), c.End-c.Start)
+			return
+		}
+		for j, nbs := range r.ItemNeighbors {
+			movie := c.Start + j
+			neighbors[movie] = make([]int, len(nbs))
+			sims[movie] = make([]float64, len(nbs))
+			for x, nb := range nbs {
+				neighbors[movie][x] = nb.Index
+				sims[movie][x] = nb.Similarity
+			}
+		}
+	}
+	m.neighbors, m.sims = neighbors, sims
+
+	log.Printf("Modelo item–item de %s v%d (%s, %s) listo en %s\n", m.ref.ID, m.ref.Version, key.metric, key.norm, time.Since(start).Round(time.Millisecond))
+}
+
+// finishItemModel registra el resultado de un cálculo. Si falló se
+// descarta para reintentarlo luego; si es el más nuevo reemplaza a los
+// anteriores e interrumpe los de versiones anteriores que sigan en curso.
+func (d *Dispatcher) finishItemModel(key itemModelKey, m *itemModel) {
+	m.cancel()
+	if m.err != nil {
+		log.Printf("No se pudo calcular el modelo item–item de %s v%d: %v\n", m.ref.ID, m.ref.Version, m.err)
+	}
+
+	d.items.mu.Lock()
+	defer d.items.mu.Unlock()
+
+	set := d.items.sets[key]
+	if set == nil || set.versions[m.ref.Version] != m {
+		return // el dataset se descartó mientras tanto
+	}
+	if m.err != nil {
+		delete(set.versions, m.ref.Version)
+		return
+	}
+	if set.latest != nil && set.latest.ref.Version > m.ref.Version {
+		delete(set.versions, m.ref.Version) // solo lo usa la evaluación que lo pidió
+		return
+	}
+	set.latest = m
+	for v, old := range set.versions {
+		if v < m.ref.Version {
+			old.cancel()
+			delete(set.versions, v)
+		}
+	}
+}
+
+// fitNeighbors adapta los vecinos del modelo a una fila de dim películas:
+// con un modelo de una versión anterior, las películas agregadas después
+// quedan sin vecinas hasta recalcularlo; con uno más nuevo, se descartan las
+// vecinas que la fila no tiene. Con k > 0 deja como mucho k vecinas por
+// película (ya vienen ordenadas de mayor a menor similitud).
+func fitNeighbors(neighbors [][]int, sims [][]float64, dim, k int) ([][]int, [][]float64) {
+	outN := make([][]int, dim)
+	outS := make([][]float64, dim)
+	for i := 0; i < dim && i < len(neighbors); i++ {
+		ns, ss := neighbors[i], sims[i]
+		if len(neighbors) > dim {
+			ns, ss = nil, nil
+			for x, j := range neighbors[i] {
+				if j < dim {
+					ns = append(ns, j)
+					ss = append(ss, sims[i][x])
+				}
+			}
+		}
+		if k > 0 && len(ns) > k {
+			ns, ss = ns[:k], ss[:k]
+		}
+		outN[i], outS[i] = ns, ss
+	}
+	return outN, outS
+}
+
+// contributions pasa los aportes al formato de los mensajes.
+func contributions(cs []compute.Contribution) []models.Contribution {
+	out := make([]models.Contribution, len(cs))
+	for i, c := range cs {
+		out[i] = models.Contribution(c)
+	}
+	return out
+}
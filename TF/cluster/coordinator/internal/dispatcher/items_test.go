@@ -0,0 +1,156 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"sdr/cluster/coordinator/internal/datastore"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/sparse"
+)
+
+// itemWorker resuelve la fase ITEM_NEIGHBORS con una sola vecina por
+// película cuya similitud es la versión del dataset, para saber de qué
+// versión salió cada modelo. Cuenta los cálculos por versión (el chunk 0 de
+// cada uno).
+type itemWorker struct {
+	mu     sync.Mutex
+	builds map[int64]int
+}
+
+func (w *itemWorker) fake(id string) *fakeWorker {
+	return &fakeWorker{id: id, result: func(ctx context.Context, c models.Chunk) (models.WorkerResult, error) {
+		if c.Phase != models.PhaseItemNeighbors {
+			return models.WorkerResult{}, fmt.Errorf("fase inesperada %s", c.Phase)
+		}
+		if c.ID == 0 {
+			w.mu.Lock()
+			w.builds[c.Dataset.Version]++
+			w.mu.Unlock()
+		}
+		var r models.WorkerResult
+		for movie := c.Start; movie < c.End; movie++ {
+			r.ItemNeighbors = append(r.ItemNeighbors, []models.Neighbor{{Index: 0, Similarity: float64(c.Dataset.Version)}})
+		}
+		return r, nil
+	}}
+}
+
+func (w *itemWorker) count(version int64) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.builds[version]
+}
+
+func TestItemModelServesLatestAndRefreshesInBackground(t *testing.T) {
+	builds := &itemWorker{builds: make(map[int64]int)}
+	fake := builds.fake("w0")
+	d, workers := newTestCluster(t, fake)
+	d.SpeculativeFraction = 0
+	d.Datasets = datastore.New()
+
+	v1 := testDataset
+	v2 := models.DatasetRef{ID: testDataset.ID, Version: 2}
+	d.Datasets.Put(&models.Dataset{ID: v1.ID, Version: v1.Version, Matrix: sparse.FromDense([][]float64{{1, 2, 3}})})
+	key := itemModelKey{datasetID: v1.ID, metric: compute.MetricCosine, norm: compute.NormalizationNone}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	get := func(ref models.DatasetRef, exact bool) *itemModel {
+		t.Helper()
+		m, err := d.itemModel(ctx, ref, key.metric, key.norm, exact)
+		if err != nil {
+			t.Fatalf("itemModel(v%d, %t): %v", ref.Version, exact, err)
+		}
+		return m
+	}
+
+	// sin modelos, la primera solicitud espera el cálculo
+	if m := get(v1, false); m.ref != v1 || m.sims[0][0] != 1 {
+		t.Fatalf("modelo de v%d con similitud %v, se esperaba el de v1", m.ref.Version, m.sims)
+	}
+
+	// llega una versión nueva (con una película más) que se retiene para
+	// evaluarla después
+	_, release, err := d.Datasets.Acquire(v1)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+	d.Datasets.Put(&models.Dataset{ID: v2.ID, Version: v2.Version, Matrix: sparse.FromDense([][]float64{{1, 2, 3, 4}})})
+	d.Registry.SetDataset(workers[0].ID, v2)
+
+	// dentro del intervalo se sirve el modelo anterior sin recalcular
+	d.ItemModelRefresh = time.Hour
+	if m := get(v2, false); m.ref != v1 {
+		t.Errorf("modelo de v%d, se esperaba el de v1 sin esperar", m.ref.Version)
+	}
+	d.items.mu.Lock()
+	_, building := d.items.sets[key].versions[v2.Version]
+	d.items.mu.Unlock()
+	if building {
+		t.Error("no debería recalcularse antes de ItemModelRefresh")
+	}
+
+	// vencido el intervalo se sigue sirviendo el anterior mientras se
+	// recalcula una sola vez en segundo plano
+	d.ItemModelRefresh = 0
+	for i := 0; i < 3; i++ {
+		get(v2, false)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for get(v2, false).ref != v2 {
+		if time.Now().After(deadline) {
+			t.Fatal("el modelo de v2 no reemplazó al de v1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := builds.count(v2.Version); n != 1 {
+		t.Errorf("v2 se calculó %d veces, se esperaba una", n)
+	}
+
+	// la evaluación de v1 necesita su propio modelo, que no reemplaza al de v2
+	if m := get(v1, true); m.ref != v1 || m.sims[0][0] != 1 {
+		t.Errorf("modelo exacto de v%d, se esperaba el de v1", m.ref.Version)
+	}
+	if n := builds.count(v1.Version); n != 2 {
+		t.Errorf("v1 se calculó %d veces, se esperaban dos", n)
+	}
+	d.items.mu.Lock()
+	set := d.items.sets[key]
+	if set.latest.ref != v2 || len(set.versions) != 1 {
+		t.Errorf("último modelo v%d con %d versiones guardadas, se esperaba solo v2", set.latest.ref.Version, len(set.versions))
+	}
+	d.items.mu.Unlock()
+}
+
+func TestFitNeighbors(t *testing.T) {
+	neighbors := [][]int{{1, 2}, {2, 0}, {0, 1}}
+	sims := [][]float64{{0.9, 0.5}, {0.8, 0.7}, {0.6, 0.4}}
+
+	tests := []struct {
+		name      string
+		dim, k    int
+		neighbors [][]int
+		sims      [][]float64
+	}{
+		{"misma dimensión", 3, 0, neighbors, sims},
+		{"k acota", 3, 1, [][]int{{1}, {2}, {0}}, [][]float64{{0.9}, {0.8}, {0.6}}},
+		// la película 3 se agregó después del modelo
+		{"modelo anterior", 4, 0, [][]int{{1, 2}, {2, 0}, {0, 1}, nil}, [][]float64{{0.9, 0.5}, {0.8, 0.7}, {0.6, 0.4}, nil}},
+		// la película 2 todavía no existe en la fila
+		{"modelo más nuevo", 2, 0, [][]int{{1}, {0}}, [][]float64{{0.9}, {0.7}}},
+	}
+
+	for _, tt := range tests {
+		gotN, gotS := fitNeighbors(neighbors, sims, tt.dim, tt.k)
+		if !reflect.DeepEqual(gotN, tt.neighbors) || !reflect.DeepEqual(gotS, tt.sims) {
+			t.Errorf("%s: fitNeighbors = %v %v, se esperaba %v %v", tt.name, gotN, gotS, tt.neighbors, tt.sims)
+		}
+	}
+}
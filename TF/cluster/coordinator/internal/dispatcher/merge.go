@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"container/heap"
+
+	"sdr/cluster/shared/models"
+)
+
+// mergeTopN combina las listas top-N de cada worker (cada una ordenada de
+// mayor a menor) con un merge k-way: el heap guarda la cabeza de cada lista
+// y en cada paso se extrae la mejor y se avanza en su lista.
+func mergeTopN(lists [][]models.ScoredItem, n int) []models.ScoredItem {
+	h := &cursorHeap{}
+	for i, l := range lists {
+		if len(l) > 0 {
+			h.cursors = append(h.cursors, cursor{list: i})
+		}
+	}
+	h.lists = lists
+	heap.Init(h)
+
+	out := make([]models.ScoredItem, 0, n)
+	for len(out) < n && h.Len() > 0 {
+		c := h.cursors[0]
+		out = append(out, lists[c.list][c.pos])
+
+		if c.pos+1 < len(lists[c.list]) {
+			h.cursors[0].pos++
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+
+	return out
+}
+
+// cursor apunta a la siguiente candidata de una lista
+type cursor struct {
+	list int
+	pos  int
+}
+
+// cursorHeap es un max-heap de cursores según el puntaje al que apuntan.
+type cursorHeap struct {
+	lists   [][]models.ScoredItem
+	cursors []cursor
+}
+
+func (h cursorHeap) Len() int { return len(h.cursors) }
+func (h cursorHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	return h.lists[a.list][a.pos].Score > h.lists[b.list][b.pos].Score
+}
+func (h cursorHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *cursorHeap) Push(x any) { h.cursors = append(h.cursors, x.(cursor)) }
+
+func (h *cursorHeap) Pop() any {
+	last := len(h.cursors) - 1
+	c := h.cursors[last]
+	h.cursors = h.cursors[:last]
+	return c
+}
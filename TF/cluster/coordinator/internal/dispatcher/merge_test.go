@@ -0,0 +1,57 @@
+package dispatcher
+
+import (
+	"reflect"
+	"testing"
+
+	"sdr/cluster/shared/models"
+)
+
+// items arma una lista de candidatas a partir de pares índice, puntaje.
+func items(pairs ...float64) []models.ScoredItem {
+	out := make([]models.ScoredItem, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out = append(out, models.ScoredItem{Index: int(pairs[i]), Score: pairs[i+1]})
+	}
+	return out
+}
+
+func TestMergeTopN(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists [][]models.ScoredItem
+		n     int
+		want  []models.ScoredItem
+	}{
+		{"sin listas", nil, 3, items()},
+		{"listas vacías", [][]models.ScoredItem{nil, {}}, 3, items()},
+		{"n 0", [][]models.ScoredItem{items(1, 0.9)}, 0, items()},
+		{"una lista", [][]models.ScoredItem{items(1, 0.9, 2, 0.5, 3, 0.1)}, 2, items(1, 0.9, 2, 0.5)},
+		{"intercala", [][]models.ScoredItem{items(1, 0.9, 2, 0.4), items(3, 0.8, 4, 0.7, 5, 0.1), nil, items(6, 0.5)}, 4, items(1, 0.9, 3, 0.8, 4, 0.7, 6, 0.5)},
+		{"menos candidatas que n", [][]models.ScoredItem{items(1, 0.2), items(2, 0.6)}, 5, items(2, 0.6, 1, 0.2)},
+		{"puntajes negativos", [][]models.ScoredItem{items(1, -0.1, 2, -0.5), items(3, 0, 4, -0.3)}, 3, items(3, 0, 1, -0.1, 4, -0.3)},
+	}
+
+	for _, tt := range tests {
+		if got := mergeTopN(tt.lists, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeTopN = %v, se esperaba %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTopNeighbors(t *testing.T) {
+	candidates := []models.Neighbor{{Index: 4, Similarity: 0.2}, {Index: 7, Similarity: 0.9}, {Index: 1, Similarity: -0.3}, {Index: 2, Similarity: 0.5}}
+
+	got := topNeighbors(candidates, 2)
+	want := []models.Neighbor{{Index: 7, Similarity: 0.9}, {Index: 2, Similarity: 0.5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topNeighbors(2) = %v, se esperaba %v", got, want)
+	}
+
+	if got := topNeighbors(candidates, 10); len(got) != len(candidates) || got[3].Index != 1 {
+		t.Errorf("topNeighbors(10) = %v, se esperaban los 4 vecinos con el 1 al final", got)
+	}
+	if got := topNeighbors(candidates, 0); len(got) != 0 {
+		t.Errorf("topNeighbors(0) = %v, se esperaba una lista vacía", got)
+	}
+}
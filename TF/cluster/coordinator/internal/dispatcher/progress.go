@@ -0,0 +1,92 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"sdr/cluster/coordinator/internal/registry"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// chunkObserver recibe cada chunk completado de runChunksObserved: i es su
+// posición en chunks, w el worker de la copia que ganó.
+type chunkObserver func(i int, w registry.Worker, elapsed time.Duration, r models.WorkerResult)
+
+// progress acumula el avance de una solicitud que pidió Progress y lo envía
+// a la API. Un *progress nil (la solicitud no lo pidió) no hace nada, así
+// que los process* lo usan sin preguntar.
+type progress struct {
+	ctx     context.Context
+	done    int
+	total   int
+	workers map[string]*models.WorkerTiming
+}
+
+// newProgress devuelve el seguimiento de la solicitud, o nil si no pidió
+// avances; total es la cantidad de chunks prevista.
+func newProgress(ctx context.Context, msg models.TaskMessage, total int) *progress {
+	if !msg.Progress {
+		return nil
+	}
+	return &progress{ctx: ctx, total: total, workers: make(map[string]*models.WorkerTiming)}
+}
+
+// expectMore ajusta la cantidad de chunks prevista al conocer los de la
+// fase siguiente: los ya completados más n.
+func (p *progress) expectMore(n int) {
+	if p != nil {
+		p.total = p.done + n
+	}
+}
+
+// chunkDone registra un chunk completado y envía el avance con items (el
+// top-N parcial, o nil si la fase no tiene uno).
+func (p *progress) chunkDone(phase models.ChunkPhase, w registry.Worker, elapsed time.Duration, items []models.ScoredItem) {
+	if p == nil {
+		return
+	}
+	p.done++
+	t, ok := p.workers[w.ID]
+	if !ok {
+		t = &models.WorkerTiming{Worker: w.ID}
+		p.workers[w.ID] = t
+	}
+	ms := elapsed.Milliseconds()
+	t.Chunks++
+	t.TotalMs += ms
+	t.MaxMs = max(t.MaxMs, ms)
+
+	update := models.Progress{Phase: phase, Done: p.done, Total: p.total, Items: items, Workers: p.timings()}
+	if p.total > 0 {
+		update.Percent = 100 * float64(p.done) / float64(p.total)
+	}
+	// los avances son de mejor esfuerzo: si la API ya no escucha, la
+	// respuesta final lo dirá
+	if err := protocol.Progress(p.ctx, update); err != nil {
+		log.Printf("No se pudo enviar el avance de la solicitud: %v\n", err)
+	}
+}
+
+// observer devuelve el chunkObserver que registra cada chunk de esa fase
+// sin top-N parcial (nil si la solicitud no pidió avances).
+func (p *progress) observer(phase models.ChunkPhase) chunkObserver {
+	if p == nil {
+		return nil
+	}
+	return func(_ int, w registry.Worker, elapsed time.Duration, _ models.WorkerResult) {
+		p.chunkDone(phase, w, elapsed, nil)
+	}
+}
+
+// timings devuelve los tiempos por worker ordenados por ID.
+func (p *progress) timings() []models.WorkerTiming {
+	out := make([]models.WorkerTiming, 0, len(p.workers))
+	for _, t := range p.workers {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Worker < out[b].Worker })
+	return out
+}
@@ -0,0 +1,137 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"sdr/cluster/coordinator/internal/datastore"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/sparse"
+)
+
+// randomRatings arma una matriz usuario–película con ~60% de calificaciones
+// al azar (distintas entre sí, para que no haya empates entre vecinos).
+func randomRatings(users, movies int, seed int64) *sparse.Matrix {
+	r := rand.New(rand.NewSource(seed))
+	dense := make([][]float64, users)
+	for i := range dense {
+		dense[i] = make([]float64, movies)
+		for j := range dense[i] {
+			if r.Float64() < 0.6 {
+				dense[i][j] = 0.1 + 0.9*r.Float64()
+			}
+		}
+	}
+	return sparse.FromDense(dense)
+}
+
+// computingWorker resuelve las fases de la recomendación por usuarios con
+// compute, como un worker real sin normalización ni reglas de confianza.
+func computingWorker(id string, matrix *sparse.Matrix) *fakeWorker {
+	sim, _ := compute.LookupMetric(compute.MetricCosine)
+	return &fakeWorker{id: id, result: func(ctx context.Context, c models.Chunk) (models.WorkerResult, error) {
+		var r models.WorkerResult
+		target := *c.Target
+		switch c.Phase {
+		case models.PhaseNeighbors:
+			idxs, sims := compute.ConfidentNeighbors(sim(matrix), matrix, target, c.Start, c.End, c.UserIndex, c.K, compute.Confidence{})
+			for i := range idxs {
+				r.Neighbors = append(r.Neighbors, models.Neighbor{Index: idxs[i], Similarity: sims[i]})
+			}
+		case models.PhasePartial:
+			idxs, sims := splitTestNeighbors(c.Neighbors)
+			num, den, voters := compute.PartialWeightedSums(matrix, target, idxs, sims)
+			n, d, v := sparse.FromDenseVector(num), sparse.FromDenseVector(den), sparse.FromDenseVector(voters)
+			r.Numerators, r.Denominators, r.Voters = &n, &d, &v
+		case models.PhaseTopN:
+			idxs, sims := splitTestNeighbors(c.Neighbors)
+			movies, scores := compute.TopNPredictions(matrix, target, idxs, sims, c.Start, c.End, c.N, compute.Confidence{})
+			for i := range movies {
+				r.Items = append(r.Items, models.ScoredItem{Index: movies[i], Score: scores[i]})
+			}
+		default:
+			return r, fmt.Errorf("fase inesperada %s", c.Phase)
+		}
+		return r, nil
+	}}
+}
+
+func splitTestNeighbors(nbs []models.Neighbor) ([]int, []float64) {
+	idxs := make([]int, len(nbs))
+	sims := make([]float64, len(nbs))
+	for i, nb := range nbs {
+		idxs[i], sims[i] = nb.Index, nb.Similarity
+	}
+	return idxs, sims
+}
+
+func TestRecommendationMatchesSingleNode(t *testing.T) {
+	const users, movies, user, k, n = 30, 40, 7, 5, 4
+	matrix := randomRatings(users, movies, 3)
+
+	// referencia en un solo nodo
+	want := compute.PredictRatings(matrix, compute.CosineSimilarityForUser(matrix, user), user, k)
+	candidates := append([]float64(nil), want...)
+	rated := matrix.Row(user)
+	for _, j := range rated.Idx {
+		candidates[j] = math.Inf(-1)
+	}
+	wantTop := compute.TopKIndexes(candidates, n)
+
+	for _, workers := range []int{1, 2, 3, 5} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			fakes := make([]*fakeWorker, workers)
+			for i := range fakes {
+				fakes[i] = computingWorker(fmt.Sprintf("w%d", i), matrix)
+			}
+			d, _ := newTestCluster(t, fakes...)
+			d.SpeculativeFraction = 0
+			d.Datasets = datastore.New()
+			d.Datasets.Put(&models.Dataset{ID: testDataset.ID, Version: testDataset.Version, Matrix: matrix})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			msg := models.TaskMessage{
+				Type:           models.RequestRecommendation,
+				DatasetID:      testDataset.ID,
+				DatasetVersion: testDataset.Version,
+				UserIndex:      user,
+				K:              k,
+			}
+
+			// N = 0: vector completo a partir de las sumas parciales
+			resp, err := d.Process(ctx, msg)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(resp.Result) != movies {
+				t.Fatalf("se recibieron %d predicciones, se esperaban %d", len(resp.Result), movies)
+			}
+			for j := range want {
+				if math.Abs(resp.Result[j]-want[j]) > 1e-9 {
+					t.Fatalf("predicción de la película %d = %g, en un solo nodo %g", j, resp.Result[j], want[j])
+				}
+			}
+
+			// N > 0: top-N combinado a partir de los rangos de películas
+			msg.N = n
+			resp, err = d.Process(ctx, msg)
+			if err != nil {
+				t.Fatalf("Process con N: %v", err)
+			}
+			if len(resp.Items) != n {
+				t.Fatalf("top-%d devolvió %d películas", n, len(resp.Items))
+			}
+			for i, it := range resp.Items {
+				if it.Index != wantTop[i] || math.Abs(it.Score-want[it.Index]) > 1e-9 {
+					t.Errorf("top[%d] = película %d (%g), en un solo nodo %d (%g)", i, it.Index, it.Score, wantTop[i], want[wantTop[i]])
+				}
+			}
+		})
+	}
+}
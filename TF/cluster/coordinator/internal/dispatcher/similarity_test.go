@@ -0,0 +1,151 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"sdr/cluster/coordinator/internal/datastore"
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/sparse"
+)
+
+func TestSplitBlocksCoverUpperTriangle(t *testing.T) {
+	for _, tc := range []struct{ n, sides int }{{7, 1}, {7, 2}, {7, 3}, {10, 4}, {5, 5}} {
+		blocks := splitBlocks(tc.n, tc.sides, models.Chunk{K: 3})
+		if len(blocks) != tc.sides*(tc.sides+1)/2 {
+			t.Errorf("n=%d, %d tramos: %d bloques, se esperaban %d", tc.n, tc.sides, len(blocks), tc.sides*(tc.sides+1)/2)
+		}
+
+		// cada par (u, v) con u <= v cae en exactamente un bloque
+		covered := make(map[[2]int]int)
+		for i, b := range blocks {
+			if b.ID != i || b.K != 3 {
+				t.Errorf("bloque %d con ID %d y K %d", i, b.ID, b.K)
+			}
+			if b.Start > b.ColStart {
+				t.Errorf("bloque %d debajo de la diagonal: filas %d-%d, columnas %d-%d", i, b.Start, b.End, b.ColStart, b.ColEnd)
+			}
+			for u := b.Start; u < b.End; u++ {
+				for v := b.ColStart; v < b.ColEnd; v++ {
+					if u <= v {
+						covered[[2]int{u, v}]++
+					}
+				}
+			}
+		}
+		for u := 0; u < tc.n; u++ {
+			for v := u; v < tc.n; v++ {
+				if covered[[2]int{u, v}] != 1 {
+					t.Fatalf("n=%d, %d tramos: el par (%d,%d) aparece en %d bloques", tc.n, tc.sides, u, v, covered[[2]int{u, v}])
+				}
+			}
+		}
+	}
+
+	// con más workers se corta en más tramos, nunca más que usuarios
+	if got := blocksPerSide(100, 1); got*(got+1)/2 < blocksPerWorker {
+		t.Errorf("blocksPerSide(100, 1) = %d, no alcanza %d bloques", got, blocksPerWorker)
+	}
+	if got := blocksPerSide(3, 50); got != 3 {
+		t.Errorf("blocksPerSide(3, 50) = %d, se esperaba 3", got)
+	}
+}
+
+// blockWorker resuelve los bloques de similitud por fuerza bruta: los K
+// vecinos de cada fila entre las columnas y, fuera de la diagonal, los de
+// cada columna entre las filas.
+func blockWorker(id string, matrix *sparse.Matrix) *fakeWorker {
+	metric, _ := compute.LookupMetric(compute.MetricCosine)
+	sim := metric(matrix)
+	return &fakeWorker{id: id, result: func(ctx context.Context, c models.Chunk) (models.WorkerResult, error) {
+		if c.Phase != models.PhaseSimilarityBlock {
+			return models.WorkerResult{}, fmt.Errorf("fase inesperada %s", c.Phase)
+		}
+		values := compute.SimilarityBlock(sim, matrix, c.Start, c.End, c.ColStart, c.ColEnd)
+		cols := c.ColEnd - c.ColStart
+		best := func(self, first, n int, at func(i int) float64) []models.Neighbor {
+			var all []models.Neighbor
+			for i := 0; i < n; i++ {
+				if first+i != self {
+					all = append(all, models.Neighbor{Index: first + i, Similarity: at(i)})
+				}
+			}
+			return topNeighbors(all, c.K)
+		}
+
+		var r models.WorkerResult
+		for row := 0; row < c.End-c.Start; row++ {
+			r.BlockNeighbors = append(r.BlockNeighbors, best(c.Start+row, c.ColStart, cols, func(j int) float64 { return values[row*cols+j] }))
+		}
+		if c.Start != c.ColStart {
+			for col := 0; col < cols; col++ {
+				r.BlockNeighbors = append(r.BlockNeighbors, best(c.ColStart+col, c.Start, c.End-c.Start, func(i int) float64 { return values[i*cols+col] }))
+			}
+		}
+		return r, nil
+	}}
+}
+
+func TestSimilarityMatchesAllPairs(t *testing.T) {
+	const users, movies, k = 29, 15, 4
+	matrix := randomRatings(users, movies, 5)
+
+	// referencia: todos contra todos
+	metric, _ := compute.LookupMetric(compute.MetricCosine)
+	full := compute.SimilarityBlock(metric(matrix), matrix, 0, users, 0, users)
+	want := make([][]models.Neighbor, users)
+	for u := range want {
+		var all []models.Neighbor
+		for v := 0; v < users; v++ {
+			if v != u {
+				all = append(all, models.Neighbor{Index: v, Similarity: full[u*users+v]})
+			}
+		}
+		want[u] = topNeighbors(all, k)
+	}
+
+	// 1 worker: 3 tramos de 10, 10 y 9; 3 workers: 5 tramos de 6, 6, 6, 6 y 5
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			fakes := make([]*fakeWorker, workers)
+			for i := range fakes {
+				fakes[i] = blockWorker(fmt.Sprintf("w%d", i), matrix)
+			}
+			d, _ := newTestCluster(t, fakes...)
+			d.SpeculativeFraction = 0
+			d.Datasets = datastore.New()
+			d.Datasets.Put(&models.Dataset{ID: testDataset.ID, Version: testDataset.Version, Matrix: matrix})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			resp, err := d.Process(ctx, models.TaskMessage{
+				Type:           models.RequestSimilarity,
+				DatasetID:      testDataset.ID,
+				DatasetVersion: testDataset.Version,
+				K:              k,
+			})
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+
+			if len(resp.Neighbors) != users {
+				t.Fatalf("vecinos de %d usuarios, se esperaban %d", len(resp.Neighbors), users)
+			}
+			for u := range want {
+				got := resp.Neighbors[u]
+				if len(got) != len(want[u]) {
+					t.Fatalf("el usuario %d tiene %d vecinos, se esperaban %d", u, len(got), len(want[u]))
+				}
+				for i := range want[u] {
+					if got[i].Index != want[u][i].Index || math.Abs(got[i].Similarity-want[u][i].Similarity) > 1e-12 {
+						t.Fatalf("vecinos del usuario %d = %v, se esperaba %v", u, got, want[u])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+)
+
+// Combinaciones máximas de una búsqueda de hiperparámetros
+const maxTuneTrials = 256
+
+// Objetivos del ranking
+const (
+	ObjectiveNDCG      = "ndcg"
+	ObjectivePrecision = "precision"
+	ObjectiveRecall    = "recall"
+	ObjectiveRMSE      = "rmse"
+	ObjectiveMAE       = "mae"
+)
+
+// -------------------------------------------
+// BÚSQUEDA DE HIPERPARÁMETROS (TUNE)
+// Se arma el producto cartesiano de la grilla y cada combinación se evalúa
+// como una EVALUATE (repartida por usuarios entre los workers) sobre las
+// mismas calificaciones de prueba. Varias combinaciones se evalúan a la vez
+// para que los workers no queden ociosos entre una y otra; los modelos
+// item–item y las similitudes de los workers se reutilizan entre las
+// combinaciones que comparten métrica y normalización.
+// -------------------------------------------
+func (d *Dispatcher) processTune(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+	if msg.Tune == nil {
+		return models.CoordinatorResponse{}, fmt.Errorf("la búsqueda no trae la grilla de parámetros")
+	}
+	if msg.Eval == nil || msg.Eval.Test == nil {
+		return models.CoordinatorResponse{}, fmt.Errorf("la búsqueda no trae calificaciones de prueba")
+	}
+	grid := *msg.Tune
+	objective := grid.Objective
+	if objective == "" {
+		objective = ObjectiveNDCG
+	}
+	if _, err := objectiveScore(objective, models.EvalReport{}); err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+	configs, err := tuneConfigs(msg, grid)
+	if err != nil {
+		return models.CoordinatorResponse{}, err
+	}
+
+	parallel := grid.Parallel
+	if parallel <= 0 {
+		parallel = len(d.Registry.Live())
+	}
+	parallel = max(1, min(parallel, len(configs)))
+	topK := msg.Eval.TopK
+	if topK <= 0 {
+		topK = defaultEvalTopK
+	}
+	log.Printf("Iniciando búsqueda de hiperparámetros: %d combinaciones, %d a la vez, objetivo %s@%d\n",
+		len(configs), parallel, objective, topK)
+
+	start := time.Now()
+	trials := make([]models.TuneTrial, len(configs))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return models.CoordinatorResponse{}, fmt.Errorf("búsqueda cancelada: %w", ctx.Err())
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			trials[i] = d.runTrial(ctx, msg, cfg, objective)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return models.CoordinatorResponse{}, fmt.Errorf("búsqueda cancelada: %w", err)
+	}
+
+	rankTrials(trials, objective)
+	board := models.Leaderboard{Objective: objective, TopK: topK, Trials: trials}
+	if best := trials[0]; best.Error == "" {
+		log.Printf("Búsqueda completada en %s: mejor %s=%.4f con modo %s, métrica %s, normalización %s, K=%d\n",
+			time.Since(start).Round(time.Millisecond), objective, best.Score,
+			best.Config.Mode, best.Config.Metric, best.Config.Normalization, best.Config.K)
+	} else {
+		log.Printf("Búsqueda completada en %s: ninguna combinación se pudo evaluar\n", time.Since(start).Round(time.Millisecond))
+	}
+
+	return models.CoordinatorResponse{Tune: &board}, nil
+}
+
+// runTrial evalúa una combinación; un error queda registrado en el
+// resultado y no detiene la búsqueda.
+func (d *Dispatcher) runTrial(ctx context.Context, msg models.TaskMessage, cfg models.TuneConfig, objective string) models.TuneTrial {
+	trial := models.TuneTrial{Config: cfg}
+	start := time.Now()
+
+	msg.Type = models.RequestEvaluate
+	msg.K = cfg.K
+	msg.Metric = cfg.Metric
+	msg.Mode = cfg.Mode
+	msg.Normalization = cfg.Normalization
+	msg.Confidence = cfg.Confidence
+	msg.Tune = nil
+
+	resp, err := d.processEvaluate(ctx, msg)
+	trial.ElapsedMs = time.Since(start).Milliseconds()
+	switch {
+	case err != nil:
+		trial.Error = err.Error()
+	case resp.Eval.Coverage == 0:
+		trial.Report = resp.Eval
+		trial.Error = "no se pudo predecir ninguna calificación de prueba"
+	default:
+		trial.Report = resp.Eval
+		trial.Score, _ = objectiveScore(objective, *resp.Eval)
+	}
+	return trial
+}
+
+// tuneConfigs arma el producto cartesiano de la grilla, validando cada
+// valor. En modo item MinOverlap y Shrinkage no se aplican, así que se
+// anulan y las combinaciones repetidas se descartan.
+func tuneConfigs(msg models.TaskMessage, grid models.TuneParams) ([]models.TuneConfig, error) {
+	ks := orDefault(grid.K, msg.K)
+	metrics := orDefault(grid.Metrics, msg.Metric)
+	modes := orDefault(grid.Modes, msg.Mode)
+	norms := orDefault(grid.Normalizations, msg.Normalization)
+	overlaps := orDefault(grid.MinOverlap, msg.MinOverlap)
+	shrinkages := orDefault(grid.Shrinkage, msg.Shrinkage)
+	minSims := []*float64{msg.MinSimilarity}
+	if len(grid.MinSimilarity) > 0 {
+		minSims = make([]*float64, len(grid.MinSimilarity))
+		for i := range grid.MinSimilarity {
+			minSims[i] = &grid.MinSimilarity[i]
+		}
+	}
+	voters := orDefault(grid.MinVoters, msg.MinVoters)
+
+	total := len(ks) * len(metrics) * len(modes) * len(norms) * len(overlaps) * len(shrinkages) * len(minSims) * len(voters)
+	if total > maxTuneTrials {
+		return nil, fmt.Errorf("la grilla tiene %d combinaciones, el máximo es %d", total, maxTuneTrials)
+	}
+
+	for _, k := range ks {
+		if k < 0 {
+			return nil, fmt.Errorf("K no puede ser negativo: %d", k)
+		}
+	}
+	for i, m := range metrics {
+		if _, err := compute.LookupMetric(m); err != nil {
+			return nil, err
+		}
+		metrics[i] = compute.NormalizeMetric(m)
+	}
+	for i, mode := range modes {
+		switch mode {
+		case "":
+			modes[i] = models.ModeUser
+		case models.ModeUser, models.ModeItem:
+		default:
+			return nil, fmt.Errorf("modo de evaluación no soportado: %s (user o item)", mode)
+		}
+	}
+	for i, n := range norms {
+		if _, err := compute.LookupNormalization(n); err != nil {
+			return nil, err
+		}
+		norms[i] = compute.NormalizationName(n)
+	}
+
+	// MinSimilarity es un puntero: se compara por su valor
+	type configKey struct {
+		cfg       models.TuneConfig
+		minSim    float64
+		hasMinSim bool
+	}
+	seen := make(map[configKey]bool)
+	var configs []models.TuneConfig
+	for _, k := range ks {
+		for _, metric := range metrics {
+			for _, mode := range modes {
+				for _, norm := range norms {
+					for _, overlap := range overlaps {
+						for _, shrinkage := range shrinkages {
+							for _, minSim := range minSims {
+								for _, minVoters := range voters {
+									cfg := models.TuneConfig{
+										K: k, Metric: metric, Mode: mode, Normalization: norm,
+										Confidence: models.Confidence{
+											MinOverlap:    overlap,
+											Shrinkage:     shrinkage,
+											MinSimilarity: minSim,
+											MinVoters:     minVoters,
+										},
+									}
+									if err := validateConfidence(cfg.Confidence); err != nil {
+										return nil, err
+									}
+									if mode == models.ModeItem {
+										cfg.MinOverlap, cfg.Shrinkage = 0, 0
+									}
+									key := configKey{cfg: cfg}
+									if minSim != nil {
+										key.cfg.MinSimilarity, key.minSim, key.hasMinSim = nil, *minSim, true
+									}
+									if !seen[key] {
+										seen[key] = true
+										configs = append(configs, cfg)
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return configs, nil
+}
+
+// orDefault copia values o, si está vacía, devuelve solo def.
+func orDefault[T any](values []T, def T) []T {
+	if len(values) == 0 {
+		return []T{def}
+	}
+	return append([]T(nil), values...)
+}
+
+// objectiveScore devuelve el valor del objetivo en el reporte.
+func objectiveScore(objective string, r models.EvalReport) (float64, error) {
+	switch objective {
+	case ObjectiveNDCG:
+		return r.NDCGAtK, nil
+	case ObjectivePrecision:
+		return r.PrecisionAtK, nil
+	case ObjectiveRecall:
+		return r.RecallAtK, nil
+	case ObjectiveRMSE:
+		return r.RMSE, nil
+	case ObjectiveMAE:
+		return r.MAE, nil
+	default:
+		return 0, fmt.Errorf("objetivo no reconocido: %s (ndcg, precision, recall, rmse o mae)", objective)
+	}
+}
+
+// rankTrials ordena de la mejor combinación a la peor (RMSE y MAE de menor
+// a mayor, el resto de mayor a menor; las fallidas al final) y numera.
+func rankTrials(trials []models.TuneTrial, objective string) {
+	lowerIsBetter := objective == ObjectiveRMSE || objective == ObjectiveMAE
+	sort.SliceStable(trials, func(a, b int) bool {
+		ta, tb := trials[a], trials[b]
+		if (ta.Error == "") != (tb.Error == "") {
+			return ta.Error == ""
+		}
+		if lowerIsBetter {
+			return ta.Score < tb.Score
+		}
+		return ta.Score > tb.Score
+	})
+	for i := range trials {
+		trials[i].Rank = i + 1
+	}
+}
@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"sdr/cluster/shared/models"
+)
+
+var tuneBase = models.TaskMessage{K: 10, Metric: "cosine", Normalization: "none"}
+
+func TestTuneConfigsEmptyGrid(t *testing.T) {
+	configs, err := tuneConfigs(tuneBase, models.TuneParams{})
+	if err != nil {
+		t.Fatalf("tuneConfigs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("una grilla vacía dio %d combinaciones, se esperaba 1", len(configs))
+	}
+	if configs[0].K != 10 || configs[0].MinSimilarity != nil {
+		t.Errorf("la combinación no es la de la solicitud: %+v", configs[0])
+	}
+}
+
+func TestTuneConfigsMinSimilarityZero(t *testing.T) {
+	configs, err := tuneConfigs(tuneBase, models.TuneParams{MinSimilarity: []float64{0, 0.2, 0.2}})
+	if err != nil {
+		t.Fatalf("tuneConfigs: %v", err)
+	}
+
+	// 0 es un valor de la grilla y el 0.2 repetido se descarta
+	var got []float64
+	for _, c := range configs {
+		if c.MinSimilarity == nil {
+			t.Fatalf("combinación sin MinSimilarity: %+v", c)
+		}
+		got = append(got, *c.MinSimilarity)
+	}
+	if len(got) != 2 || got[0] != 0 || got[1] != 0.2 {
+		t.Errorf("MinSimilarity de las combinaciones = %v, se esperaba [0 0.2]", got)
+	}
+}
+
+func TestTuneConfigsItemModeIgnoresMinOverlap(t *testing.T) {
+	grid := models.TuneParams{
+		Modes:      []models.CFMode{models.ModeUser, models.ModeItem},
+		MinOverlap: []int{0, 3},
+	}
+	configs, err := tuneConfigs(tuneBase, grid)
+	if err != nil {
+		t.Fatalf("tuneConfigs: %v", err)
+	}
+	// 2 overlaps en modo user y una sola combinación en modo item
+	if len(configs) != 3 {
+		t.Errorf("tuneConfigs devolvió %d combinaciones, se esperaban 3", len(configs))
+	}
+}
+
+func TestTuneConfigsRejectsInvalidGrid(t *testing.T) {
+	for _, grid := range []models.TuneParams{
+		{MinSimilarity: []float64{1.5}},
+		{K: []int{-1}},
+	} {
+		if _, err := tuneConfigs(tuneBase, grid); err == nil {
+			t.Errorf("tuneConfigs(%+v) no devolvió error", grid)
+		}
+	}
+}
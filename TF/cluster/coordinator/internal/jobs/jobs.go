@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// Valores por defecto del administrador de jobs
+const (
+	defaultMaxRunning = 2
+	defaultTimeout    = 30 * time.Minute
+	defaultRetention  = time.Hour
+)
+
+// ProcessFunc procesa la solicitud de un job (Dispatcher.Process).
+type ProcessFunc func(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error)
+
+// AcquireFunc retiene la versión del dataset que referencia msg hasta que se
+// llame a release (Dispatcher.AcquireDataset).
+type AcquireFunc func(msg models.TaskMessage) (release func(), err error)
+
+// Manager ejecuta en segundo plano las solicitudes Async y guarda su estado
+// para que la API lo consulte con JOB_STATUS. Los jobs viven en memoria: si
+// el coordinador se reinicia se pierden y la API los da por fallidos.
+type Manager struct {
+	Process ProcessFunc
+	// Acquire (si no es nil) retiene la versión del dataset desde que el job
+	// se encola hasta que termina: aunque espere en la cola mientras llegan
+	// calificaciones nuevas, se ejecuta sobre la versión con que se pidió
+	Acquire AcquireFunc
+
+	MaxRunning int           // jobs en ejecución a la vez; el resto espera en cola
+	Timeout    time.Duration // plazo de cada job desde que empieza a ejecutarse (0 = sin plazo)
+	Retention  time.Duration // tiempo que se conserva un job terminado
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	slots chan struct{}
+	once  sync.Once
+}
+
+type job struct {
+	status  models.JobStatus
+	cancel  context.CancelFunc
+	release func() // suelta la versión del dataset (nil = no retenida)
+}
+
+func New(process ProcessFunc) *Manager {
+	return &Manager{
+		Process:    process,
+		MaxRunning: defaultMaxRunning,
+		Timeout:    defaultTimeout,
+		Retention:  defaultRetention,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Submit encola msg como job y devuelve su estado inicial. El job se
+// ejecuta con avances activados (el último queda en su estado) y con su
+// propio plazo, no con el de la solicitud que lo envió.
+func (m *Manager) Submit(msg models.TaskMessage) (models.JobStatus, error) {
+	m.once.Do(func() { m.slots = make(chan struct{}, max(m.MaxRunning, 1)) })
+
+	id, err := newID()
+	if err != nil {
+		return models.JobStatus{}, err
+	}
+
+	var release func()
+	if m.Acquire != nil {
+		if release, err = m.Acquire(msg); err != nil {
+			return models.JobStatus{}, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: models.JobStatus{
+			ID:        id,
+			Type:      msg.Type,
+			State:     models.JobQueued,
+			CreatedMs: time.Now().UnixMilli(),
+		},
+		cancel:  cancel,
+		release: release,
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = j
+	status := j.status
+	m.mu.Unlock()
+
+	msg.Async = false
+	msg.Progress = true
+	msg.DeadlineMs = 0
+	go m.run(ctx, j, msg)
+
+	log.Printf("Job %s (%s) encolado", id, msg.Type)
+	return status, nil
+}
+
+// run espera un lugar libre y procesa el job.
+func (m *Manager) run(ctx context.Context, j *job, msg models.TaskMessage) {
+	defer j.cancel()
+	if j.release != nil {
+		defer j.release()
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		return // cancelado en la cola; Cancel ya lo marcó
+	}
+
+	m.mu.Lock()
+	if j.status.State != models.JobQueued {
+		m.mu.Unlock()
+		return
+	}
+	j.status.State = models.JobRunning
+	j.status.StartedMs = time.Now().UnixMilli()
+	m.mu.Unlock()
+
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+	ctx = protocol.WithProgress(ctx, func(v any) error {
+		if p, ok := v.(models.Progress); ok {
+			m.mu.Lock()
+			j.status.Progress = &p
+			m.mu.Unlock()
+		}
+		return nil
+	})
+
+	start := time.Now()
+	resp, err := m.Process(ctx, msg)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j.status.State == models.JobCancelled {
+		log.Printf("Job %s cancelado después de %s", j.status.ID, time.Since(start))
+		return
+	}
+	j.status.FinishedMs = time.Now().UnixMilli()
+	if err != nil {
+		j.status.State = models.JobFailed
+		j.status.Error = err.Error()
+		log.Printf("Job %s falló después de %s: %v", j.status.ID, time.Since(start), err)
+		return
+	}
+	j.status.State = models.JobDone
+	j.status.Result = &resp
+	log.Printf("Job %s terminado en %s", j.status.ID, time.Since(start))
+}
+
+// Status devuelve el estado del job, con el resultado si ya terminó. Si el
+// job no existe devuelve un RemoteError con CodeJobNotFound.
+func (m *Manager) Status(id string) (models.JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return models.JobStatus{}, notFound(id)
+	}
+	return j.status, nil
+}
+
+// Cancel cancela el job (en la cola o en los workers) y devuelve su estado.
+// Un job ya terminado no cambia.
+func (m *Manager) Cancel(id string) (models.JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return models.JobStatus{}, notFound(id)
+	}
+	if !j.status.State.Terminal() {
+		j.status.State = models.JobCancelled
+		j.status.FinishedMs = time.Now().UnixMilli()
+		j.cancel()
+		log.Printf("Job %s cancelado", id)
+	}
+	status := j.status
+	status.Result = nil
+	return status, nil
+}
+
+// Run descarta periódicamente los jobs terminados hace más de Retention,
+// hasta que se cierre stop.
+func (m *Manager) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(max(m.Retention/10, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+func (m *Manager) expire() {
+	limit := time.Now().Add(-m.Retention).UnixMilli()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, j := range m.jobs {
+		if j.status.State.Terminal() && j.status.FinishedMs < limit {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func notFound(id string) error {
+	return &protocol.RemoteError{
+		Code:    protocol.CodeJobNotFound,
+		Message: fmt.Sprintf("job %s no encontrado en el coordinador", id),
+	}
+}
+
+// newID genera un ID aleatorio de 16 caracteres hexadecimales.
+func newID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error generando el ID del job: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// holds cuenta las versiones retenidas por los jobs, como lo haría el
+// almacén de datasets del coordinador.
+type holds struct {
+	mu   sync.Mutex
+	refs map[int64]int
+}
+
+func (h *holds) acquire(msg models.TaskMessage) (func(), error) {
+	if msg.DatasetVersion == 0 {
+		return nil, &protocol.RemoteError{Code: protocol.CodeDatasetMissing, Message: "sin dataset"}
+	}
+	h.mu.Lock()
+	h.refs[msg.DatasetVersion]++
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			h.refs[msg.DatasetVersion]--
+			h.mu.Unlock()
+		})
+	}, nil
+}
+
+func (h *holds) count(version int64) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.refs[version]
+}
+
+// waitState espera a que el job llegue al estado pedido.
+func waitState(t *testing.T, m *Manager, id string, state models.JobState) models.JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st, err := m.Status(id)
+		if err != nil {
+			t.Fatalf("Status(%s): %v", id, err)
+		}
+		if st.State == state {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("el job %s quedó en %s, se esperaba %s", id, st.State, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobsHoldDatasetVersion(t *testing.T) {
+	h := &holds{refs: make(map[int64]int)}
+	finish := make(chan struct{})
+	var seen []int64
+	var mu sync.Mutex
+
+	m := New(func(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+		mu.Lock()
+		seen = append(seen, msg.DatasetVersion)
+		mu.Unlock()
+		<-finish
+		return models.CoordinatorResponse{}, nil
+	})
+	m.MaxRunning = 1
+	m.Acquire = h.acquire
+
+	msg := models.TaskMessage{Type: models.RequestRecommendation, DatasetID: "ml", DatasetVersion: 3}
+	running, err := m.Submit(msg)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitState(t, m, running.ID, models.JobRunning)
+
+	// el segundo espera en la cola con su versión retenida
+	queued, _ := m.Submit(msg)
+	cancelled, _ := m.Submit(msg)
+	if got := h.count(3); got != 3 {
+		t.Errorf("retenciones de v3 = %d, se esperaban 3", got)
+	}
+
+	// cancelar en la cola suelta la versión sin ejecutarlo
+	m.Cancel(cancelled.ID)
+	deadline := time.Now().Add(2 * time.Second)
+	for h.count(3) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("retenciones de v3 = %d tras cancelar, se esperaban 2", h.count(3))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(finish)
+	waitState(t, m, running.ID, models.JobDone)
+	waitState(t, m, queued.ID, models.JobDone)
+	deadline = time.Now().Add(2 * time.Second)
+	for h.count(3) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("retenciones de v3 = %d al terminar, se esperaba 0", h.count(3))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 {
+		t.Errorf("se procesaron %d jobs, se esperaban 2 (el cancelado no)", len(seen))
+	}
+}
+
+func TestSubmitWithoutDataset(t *testing.T) {
+	h := &holds{refs: make(map[int64]int)}
+	m := New(func(ctx context.Context, msg models.TaskMessage) (models.CoordinatorResponse, error) {
+		t.Error("no debía procesarse un job sin dataset")
+		return models.CoordinatorResponse{}, nil
+	})
+	m.Acquire = h.acquire
+
+	_, err := m.Submit(models.TaskMessage{Type: models.RequestSimilarity, DatasetID: "ml"})
+	if !protocol.IsCode(err, protocol.CodeDatasetMissing) {
+		t.Fatalf("Submit = %v, se esperaba %s para que la API reenvíe el dataset", err, protocol.CodeDatasetMissing)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.jobs) != 0 {
+		t.Errorf("quedaron %d jobs registrados, se esperaba ninguno", len(m.jobs))
+	}
+}
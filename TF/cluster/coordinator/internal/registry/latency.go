@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"sort"
+	"time"
+)
+
+// Cantidad de latencias recientes que se guardan por worker
+const latencySamples = 128
+
+// latencyWindow guarda las últimas latencias observadas (buffer circular).
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencyWindow) add(d time.Duration) {
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// percentile devuelve el percentil p (0-100) de las muestras guardadas.
+func (l *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	if l == nil || len(l.samples) == 0 {
+		return 0, false
+	}
+
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i], true
+}
+
+// RecordLatency registra cuánto tardó un worker en completar un chunk.
+func (r *Registry) RecordLatency(id string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.latencies[id]
+	if !ok {
+		w = &latencyWindow{}
+		r.latencies[id] = w
+	}
+	w.add(d)
+	r.fleet.add(d)
+}
+
+// Percentile devuelve el percentil p de las latencias recientes de un worker.
+func (r *Registry) Percentile(id string, p float64) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latencies[id].percentile(p)
+}
+
+// FleetPercentile devuelve el percentil p de las latencias de todo el clúster.
+func (r *Registry) FleetPercentile(p float64) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fleet.percentile(p)
+}
@@ -0,0 +1,197 @@
+package registry
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"sdr/cluster/shared/models"
+)
+
+// Worker es el estado que el coordinador conoce de un worker registrado.
+type Worker struct {
+	ID       string
+	Addr     string
+	Capacity int
+	Load     int
+	LastSeen time.Time
+
+	// Latencias recientes por chunk (cero si aún no hay muestras)
+	P50, P95, P99 time.Duration
+}
+
+// Registry guarda los workers vivos. Los workers se registran al arrancar,
+// envían latidos periódicos y se eliminan si dejan de enviarlos.
+type Registry struct {
+	HeartbeatInterval time.Duration
+	Timeout           time.Duration // sin latidos por más de este tiempo => worker desalojado
+
+	mu        sync.Mutex
+	workers   map[string]*Worker
+	latencies map[string]*latencyWindow             // por ID de worker
+	datasets  map[string]map[models.DatasetRef]bool // por ID de worker: versiones en memoria
+	fleet     latencyWindow                         // todas las muestras del clúster
+
+	// OnEvict se llama (fuera del lock) con cada worker desalojado
+	OnEvict func(w Worker)
+}
+
+func New(heartbeatInterval, timeout time.Duration) *Registry {
+	return &Registry{
+		HeartbeatInterval: heartbeatInterval,
+		Timeout:           timeout,
+		workers:           make(map[string]*Worker),
+		latencies:         make(map[string]*latencyWindow),
+		datasets:          make(map[string]map[models.DatasetRef]bool),
+	}
+}
+
+// Register agrega (o actualiza) un worker.
+func (r *Registry) Register(reg models.WorkerRegistration) {
+	if reg.Capacity < 1 {
+		reg.Capacity = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.workers[reg.ID] = &Worker{
+		ID:       reg.ID,
+		Addr:     reg.Addr,
+		Capacity: reg.Capacity,
+		LastSeen: time.Now(),
+	}
+	r.datasets[reg.ID] = make(map[models.DatasetRef]bool) // un worker recién registrado no tiene datos
+	log.Printf("Worker %s registrado en %s (capacidad %d, %d workers vivos)", reg.ID, reg.Addr, reg.Capacity, len(r.workers))
+}
+
+// Heartbeat actualiza la carga del worker. Si el worker no está registrado
+// (por ejemplo, fue desalojado) devuelve error para que vuelva a registrarse.
+func (r *Registry) Heartbeat(hb models.Heartbeat) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.workers[hb.ID]
+	if !ok {
+		return fmt.Errorf("worker no registrado: %s", hb.ID)
+	}
+
+	w.Load = hb.Load
+	if hb.Capacity > 0 {
+		w.Capacity = hb.Capacity
+	}
+	w.LastSeen = time.Now()
+
+	// el latido pudo salir antes de un envío que ya se registró con
+	// SetDataset: además de las versiones que informa se conservan las
+	// conocidas más nuevas que la última informada de cada dataset. Las
+	// demás ya no están en el worker.
+	newest := make(map[string]int64)
+	held := make(map[models.DatasetRef]bool, len(hb.Datasets))
+	for _, ref := range hb.Datasets {
+		held[ref] = true
+		newest[ref.ID] = max(newest[ref.ID], ref.Version)
+	}
+	for ref := range r.datasets[hb.ID] {
+		if v, ok := newest[ref.ID]; !ok || ref.Version > v {
+			held[ref] = true
+		}
+	}
+	r.datasets[hb.ID] = held
+	return nil
+}
+
+// HasDataset indica si el worker tiene en memoria esa versión del dataset.
+func (r *Registry) HasDataset(workerID string, ref models.DatasetRef) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.datasets[workerID][ref]
+}
+
+// SetDataset registra que el worker recibió esa versión del dataset.
+func (r *Registry) SetDataset(workerID string, ref models.DatasetRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if held, ok := r.datasets[workerID]; ok {
+		held[ref] = true
+	}
+}
+
+// ForgetDataset marca que el worker no tiene esa versión (p. ej. porque se
+// reinició y la tarea volvió con CodeDatasetMissing, o porque se le pidió
+// descartarla).
+func (r *Registry) ForgetDataset(workerID string, ref models.DatasetRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.datasets[workerID], ref)
+}
+
+// Live devuelve una copia de los workers vivos, primero los menos cargados
+// (carga relativa a su capacidad).
+func (r *Registry) Live() []Worker {
+	r.mu.Lock()
+	out := make([]Worker, 0, len(r.workers))
+	for _, w := range r.workers {
+		c := *w
+		lat := r.latencies[w.ID]
+		c.P50, _ = lat.percentile(50)
+		c.P95, _ = lat.percentile(95)
+		c.P99, _ = lat.percentile(99)
+		out = append(out, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		li := float64(out[i].Load) / float64(out[i].Capacity)
+		lj := float64(out[j].Load) / float64(out[j].Capacity)
+		if li != lj {
+			return li < lj
+		}
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+// Run desaloja periódicamente a los workers que no enviaron latidos a tiempo.
+func (r *Registry) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.evictExpired()
+		}
+	}
+}
+
+func (r *Registry) evictExpired() {
+	now := time.Now()
+	var evicted []Worker
+
+	r.mu.Lock()
+	for id, w := range r.workers {
+		if now.Sub(w.LastSeen) > r.Timeout {
+			evicted = append(evicted, *w)
+			delete(r.workers, id)
+			delete(r.latencies, id)
+			delete(r.datasets, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, w := range evicted {
+		log.Printf("Worker %s (%s) desalojado: sin latidos desde %s", w.ID, w.Addr, w.LastSeen.Format(time.RFC3339))
+		if r.OnEvict != nil {
+			r.OnEvict(w)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"sdr/cluster/shared/models"
+)
+
+func TestRegisterAndLive(t *testing.T) {
+	r := New(time.Second, time.Minute)
+	r.Register(models.WorkerRegistration{ID: "w1", Addr: "a:1", Capacity: 4})
+	r.Register(models.WorkerRegistration{ID: "w2", Addr: "a:2"}) // sin capacidad => 1
+
+	if err := r.Heartbeat(models.Heartbeat{ID: "w1", Load: 3}); err != nil {
+		t.Fatalf("Heartbeat w1: %v", err)
+	}
+
+	live := r.Live()
+	if len(live) != 2 {
+		t.Fatalf("Live devolvió %d workers, se esperaban 2", len(live))
+	}
+	// w2 no tiene carga y va primero aunque tenga menos capacidad
+	if live[0].ID != "w2" || live[0].Capacity != 1 {
+		t.Errorf("primer worker = %s (capacidad %d), se esperaba w2 con capacidad 1", live[0].ID, live[0].Capacity)
+	}
+	if live[1].ID != "w1" || live[1].Load != 3 {
+		t.Errorf("segundo worker = %s (carga %d), se esperaba w1 con carga 3", live[1].ID, live[1].Load)
+	}
+
+	if err := r.Heartbeat(models.Heartbeat{ID: "desconocido"}); err == nil {
+		t.Error("se esperaba error por latido de un worker no registrado")
+	}
+}
+
+func TestHeartbeatMergesDatasets(t *testing.T) {
+	r := New(time.Second, time.Minute)
+	r.Register(models.WorkerRegistration{ID: "w1", Addr: "a:1"})
+
+	v1 := models.DatasetRef{ID: "ml", Version: 1}
+	v2 := models.DatasetRef{ID: "ml", Version: 2}
+	v3 := models.DatasetRef{ID: "ml", Version: 3}
+	other := models.DatasetRef{ID: "ml-tune", Version: 7}
+
+	// el latido salió antes de que el coordinador empujara v2 y el otro dataset
+	r.SetDataset("w1", v2)
+	r.SetDataset("w1", other)
+	r.Heartbeat(models.Heartbeat{ID: "w1", Datasets: []models.DatasetRef{v1}})
+	for _, ref := range []models.DatasetRef{v1, v2, other} {
+		if !r.HasDataset("w1", ref) {
+			t.Errorf("se esperaba que el worker conserve %s v%d", ref.ID, ref.Version)
+		}
+	}
+
+	// el worker ya descartó v1 y v2 (informa solo v3, más nueva)
+	r.Heartbeat(models.Heartbeat{ID: "w1", Datasets: []models.DatasetRef{v3, other}})
+	if r.HasDataset("w1", v1) || r.HasDataset("w1", v2) {
+		t.Error("las versiones que el latido ya no informa deben olvidarse")
+	}
+	if !r.HasDataset("w1", v3) || !r.HasDataset("w1", other) {
+		t.Error("se esperaban las versiones informadas por el latido")
+	}
+
+	r.ForgetDataset("w1", v3)
+	if r.HasDataset("w1", v3) || !r.HasDataset("w1", other) {
+		t.Error("ForgetDataset debe olvidar solo la versión pedida")
+	}
+
+	// volver a registrarse (p. ej. tras reiniciar) descarta lo conocido
+	r.Register(models.WorkerRegistration{ID: "w1", Addr: "a:1"})
+	if r.HasDataset("w1", other) {
+		t.Error("un worker recién registrado no debe tener datasets")
+	}
+}
+
+func TestEvictExpired(t *testing.T) {
+	r := New(time.Second, 20*time.Millisecond)
+
+	var evicted []string
+	r.OnEvict = func(w Worker) { evicted = append(evicted, w.ID) }
+
+	r.Register(models.WorkerRegistration{ID: "callado", Addr: "a:1"})
+	r.Register(models.WorkerRegistration{ID: "vivo", Addr: "a:2"})
+	r.SetDataset("callado", models.DatasetRef{ID: "ml", Version: 1})
+	r.RecordLatency("callado", time.Millisecond)
+
+	time.Sleep(40 * time.Millisecond)
+	r.Heartbeat(models.Heartbeat{ID: "vivo"})
+	r.evictExpired()
+
+	if len(evicted) != 1 || evicted[0] != "callado" {
+		t.Fatalf("desalojados = %v, se esperaba [callado]", evicted)
+	}
+	live := r.Live()
+	if len(live) != 1 || live[0].ID != "vivo" {
+		t.Errorf("Live = %v, se esperaba solo el worker vivo", live)
+	}
+	if r.HasDataset("callado", models.DatasetRef{ID: "ml", Version: 1}) {
+		t.Error("el worker desalojado no debe conservar sus datasets")
+	}
+	if _, ok := r.Percentile("callado", 50); ok {
+		t.Error("el worker desalojado no debe conservar sus latencias")
+	}
+	// el desalojado tiene que volver a registrarse
+	if err := r.Heartbeat(models.Heartbeat{ID: "callado"}); err == nil {
+		t.Error("se esperaba error por latido de un worker desalojado")
+	}
+}
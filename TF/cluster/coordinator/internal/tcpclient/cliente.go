@@ -1,43 +1,79 @@
 package tcpclient
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net"
 	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"sync"
 	"time"
 )
 
-// SendTask envía un mensaje JSON al Worker y recibe su respuesta
-func SendTask(addr string, task models.TaskMessage) (models.CoordinatorResponse, error) {
-	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
-	if err != nil {
-		return models.CoordinatorResponse{}, fmt.Errorf("no se pudo conectar al worker %s: %v", addr, err)
+// Conexiones persistentes por worker reutilizadas entre solicitudes
+const connsPerWorker = 4
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]*protocol.Pool{}
+)
+
+func poolFor(addr string) *protocol.Pool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	p, ok := pools[addr]
+	if !ok {
+		p = protocol.NewPool(addr, connsPerWorker, 3*time.Second)
+		pools[addr] = p
 	}
-	defer conn.Close()
+	return p
+}
 
-	// Enviar solicitud
-	data, _ := json.Marshal(task)
-	_, err = conn.Write(data)
-	if err != nil {
-		return models.CoordinatorResponse{}, fmt.Errorf("error al enviar datos al worker %s: %v", addr, err)
+// SendTask envía un chunk (WorkerTask) al Worker y recibe su resultado parcial.
+// Si ctx se cancela se deja de esperar la respuesta.
+func SendTask(ctx context.Context, addr string, task models.WorkerTask) (models.WorkerResult, error) {
+	var resp models.WorkerResult
+	if err := poolFor(addr).CallContext(ctx, protocol.MsgTask, task, &resp); err != nil {
+		return models.WorkerResult{}, fmt.Errorf("error comunicando con el worker %s: %w", addr, err)
 	}
 
-	// Cerrar escritura para indicar fin de mensaje
-	conn.(*net.TCPConn).CloseWrite()
+	return resp, nil
+}
+
+// Forget cierra las conexiones con un worker que ya no está en el clúster
+func Forget(addr string) {
+	poolsMu.Lock()
+	p, ok := pools[addr]
+	delete(pools, addr)
+	poolsMu.Unlock()
 
-	// Leer toda la respuesta completa (evita "unexpected end of JSON input")
-	dataResp, err := io.ReadAll(conn)
-	if err != nil {
-		return models.CoordinatorResponse{}, fmt.Errorf("error al leer respuesta del worker %s: %v", addr, err)
+	if ok {
+		p.Close()
 	}
+}
 
-	// Deserializar respuesta JSON
-	var resp models.CoordinatorResponse
-	if err := json.Unmarshal(dataResp, &resp); err != nil {
-		return models.CoordinatorResponse{}, fmt.Errorf("error al parsear respuesta del worker %s: %v", addr, err)
+// PushDataset envía una versión completa del dataset al worker, que la
+// guarda en memoria para las tareas siguientes.
+func PushDataset(ctx context.Context, addr string, ds *models.Dataset) error {
+	if err := poolFor(addr).CallContext(ctx, protocol.MsgDataset, ds, nil); err != nil {
+		return fmt.Errorf("error enviando dataset %s v%d al worker %s: %w", ds.ID, ds.Version, addr, err)
 	}
+	return nil
+}
 
-	return resp, nil
+// PushPatch envía al worker los cambios que llevan una versión del dataset
+// que ya tiene a la siguiente.
+func PushPatch(ctx context.Context, addr string, patch *models.DatasetPatch) error {
+	if err := poolFor(addr).CallContext(ctx, protocol.MsgPatch, patch, nil); err != nil {
+		return fmt.Errorf("error enviando parche %s v%d -> v%d al worker %s: %w", patch.ID, patch.BaseVersion, patch.Version, addr, err)
+	}
+	return nil
+}
+
+// ForgetDataset avisa al worker que puede descartar esa versión del dataset.
+func ForgetDataset(ctx context.Context, addr string, ref models.DatasetRef) error {
+	if err := poolFor(addr).CallContext(ctx, protocol.MsgForget, ref, nil); err != nil {
+		return fmt.Errorf("error descartando dataset %s v%d en el worker %s: %w", ref.ID, ref.Version, addr, err)
+	}
+	return nil
 }
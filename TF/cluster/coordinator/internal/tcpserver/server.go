@@ -1,21 +1,27 @@
 package tcpserver
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"sdr/cluster/coordinator/internal/dispatcher"
+	"sdr/cluster/coordinator/internal/jobs"
+	"sdr/cluster/coordinator/internal/registry"
 	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"time"
 )
 
 type TCPServer struct {
-	Addr string
+	Addr       string
+	Dispatcher *dispatcher.Dispatcher
+	Registry   *registry.Registry
+	Jobs       *jobs.Manager
 }
 
-// Run inicia el servidor TCP del coordinador
+// Run inicia el servidor TCP del coordinador. Las conexiones son persistentes
+// y usan el protocolo con frames de sdr/cluster/shared/protocol.
 func (s *TCPServer) Run() error {
 	ln, err := net.Listen("tcp", s.Addr)
 	if err != nil {
@@ -24,60 +30,126 @@ func (s *TCPServer) Run() error {
 
 	log.Printf("Nodo coordinador TCP escuchando en %s", s.Addr)
 
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			log.Printf("error aceptando conexión: %v", err)
-			continue
+	return protocol.Serve(ln, s.handleFrame)
+}
+
+func (s *TCPServer) handleFrame(ctx context.Context, req protocol.Frame) (any, error) {
+	switch req.Type {
+	case protocol.MsgTask:
+		return s.handleTask(ctx, req)
+
+	case protocol.MsgRegister:
+		var reg models.WorkerRegistration
+		if err := req.Decode(&reg); err != nil {
+			return nil, fmt.Errorf("error parseando registro: %w", err)
 		}
+		s.Registry.Register(reg)
+		go s.Dispatcher.SyncWorker(reg.ID)
+		return models.RegistrationAck{HeartbeatIntervalMs: s.Registry.HeartbeatInterval.Milliseconds()}, nil
 
-		go s.handleConnection(conn)
-	}
-}
+	case protocol.MsgHeartbeat:
+		var hb models.Heartbeat
+		if err := req.Decode(&hb); err != nil {
+			return nil, fmt.Errorf("error parseando latido: %w", err)
+		}
+		return nil, s.Registry.Heartbeat(hb)
+
+	case protocol.MsgDataset:
+		var ds models.Dataset
+		if err := req.Decode(&ds); err != nil {
+			return nil, fmt.Errorf("error parseando dataset: %w", err)
+		}
+		if ds.Matrix == nil {
+			return nil, fmt.Errorf("dataset %s v%d sin matriz", ds.ID, ds.Version)
+		}
+		if err := ds.Matrix.Validate(); err != nil {
+			return nil, fmt.Errorf("matriz del dataset %s v%d inválida: %w", ds.ID, ds.Version, err)
+		}
+		s.Dispatcher.PutDataset(&ds)
+		return models.DatasetRef{ID: ds.ID, Version: ds.Version}, nil
 
-func (s *TCPServer) handleConnection(conn net.Conn) {
-	defer conn.Close()
+	case protocol.MsgPatch:
+		var patch models.DatasetPatch
+		if err := req.Decode(&patch); err != nil {
+			return nil, fmt.Errorf("error parseando parche: %w", err)
+		}
+		if err := s.Dispatcher.PatchDataset(&patch); err != nil {
+			return nil, err
+		}
+		return models.DatasetRef{ID: patch.ID, Version: patch.Version}, nil
 
-	reader := bufio.NewReader(conn)
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		log.Println("error leyendo mensaje:", err)
-		return
+	case protocol.MsgForget:
+		var ref models.DatasetRef
+		if err := req.Decode(&ref); err != nil {
+			return nil, fmt.Errorf("error parseando dataset a descartar: %w", err)
+		}
+		s.Dispatcher.ForgetDataset(ref)
+		return ref, nil
+
+	default:
+		return nil, fmt.Errorf("tipo de mensaje no soportado: %s", req.Type)
 	}
+}
 
+// handleTask procesa una solicitud de la API. ctx se cancela si la API envía
+// MsgCancel o cierra la conexión, y vence en el plazo que trae el mensaje.
+func (s *TCPServer) handleTask(ctx context.Context, req protocol.Frame) (any, error) {
 	// Deserializar el TaskMessage
 	var msg models.TaskMessage
-	err = json.Unmarshal(data, &msg)
-	if err != nil {
+	if err := req.Decode(&msg); err != nil {
 		log.Println("error parseando JSON:", err)
-		return
+		return nil, fmt.Errorf("error parseando TaskMessage: %w", err)
 	}
 
-	log.Printf("El nodo coordinador recibió una solicitud: %s", msg.Type)
+	log.Printf("El nodo coordinador recibió una solicitud %d: %s", req.RequestID, msg.Type)
+
+	switch {
+	case msg.Type == models.RequestJobStatus:
+		return s.jobResponse(s.Jobs.Status(msg.JobID))
+	case msg.Type == models.RequestJobCancel:
+		return s.jobResponse(s.Jobs.Cancel(msg.JobID))
+	case msg.Async:
+		return s.submitJob(msg)
+	}
+
+	ctx, cancel := protocol.WithDeadlineMs(ctx, msg.DeadlineMs)
+	defer cancel()
 
 	// Llamar al dispatcher para procesar la solicitud
-	resp, err := dispatcher.Process(msg)
+	start := time.Now()
+	resp, err := s.Dispatcher.Process(ctx, msg)
+	if err != nil && ctx.Err() != nil {
+		// la API canceló (su cliente se desconectó) o venció el plazo: los
+		// chunks en vuelo ya se cancelaron en los workers
+		log.Printf("Solicitud %d (%s) abortada tras %s: %v", req.RequestID, msg.Type, time.Since(start), ctx.Err())
+		return nil, err
+	}
 	if err != nil {
 		log.Println("error procesando tarea:", err)
-		return
+		return nil, err
 	}
 
-	// Serializar la respuesta
-	out, err := json.Marshal(resp)
-	if err != nil {
-		log.Println("error serializando respuesta:", err)
-		return
+	log.Printf("Respuesta de la solicitud %d enviada a la API", req.RequestID)
+	return resp, nil
+}
+
+// submitJob encola msg como job. Solo se aceptan similitudes y
+// recomendaciones. Las opciones se verifican ya y el dataset se retiene al
+// encolar (ver jobs.Manager.Acquire): así la API reenvía el dataset si falta
+// en vez de enterarse cuando el job falle.
+func (s *TCPServer) submitJob(msg models.TaskMessage) (any, error) {
+	if msg.Type != models.RequestSimilarity && msg.Type != models.RequestRecommendation {
+		return nil, fmt.Errorf("tipo de job no soportado: %s", msg.Type)
+	}
+	if err := dispatcher.Validate(msg); err != nil {
+		return nil, err
 	}
+	return s.jobResponse(s.Jobs.Submit(msg))
+}
 
-	// Enviar de vuelta a la API
-	// Enviar de vuelta a la API
-	_, err = conn.Write(out)
+func (s *TCPServer) jobResponse(status models.JobStatus, err error) (any, error) {
 	if err != nil {
-		log.Println("error enviando respuesta:", err)
-		return
+		return nil, err
 	}
-
-	conn.Close()
-	log.Println("Respuesta enviada a la API y conexión cerrada")
-
+	return models.CoordinatorResponse{Job: &status}, nil
 }
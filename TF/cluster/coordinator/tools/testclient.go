@@ -1,53 +1,55 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"sdr/cluster/shared/sparse"
 	"time"
 )
 
 func main() {
 
-	msg := models.TaskMessage{
-		Type:      models.RequestSimilarity,
-		Matrix:    [][]float64{{1, 0.5, 0}, {0.2, 0, 0.8}, {0, 0.9, 0.4}},
-		UserIndex: 0,
-		K:         2,
+	ds := models.Dataset{
+		ID:      "test",
+		Version: time.Now().Unix(),
+		Matrix:  sparse.FromDense([][]float64{{1, 0.5, 0}, {0.2, 0, 0.8}, {0, 0.9, 0.4}}),
 	}
 
-	data, _ := json.Marshal(msg)
-
-	conn, err := net.DialTimeout("tcp", "127.0.0.1:8081", 5*time.Second)
+	client, err := protocol.Dial("127.0.0.1:8081", 5*time.Second)
 	if err != nil {
 		log.Fatalf("error conectando: %v", err)
 	}
-	defer conn.Close()
+	defer client.Close()
 
-	// ENVÍO DEL MENSAJE
-	_, err = conn.Write(data)
-	if err != nil {
-		log.Fatalf("error escribiendo: %v", err)
+	// ENVÍO DEL DATASET (una sola vez; el coordinador lo reparte a los workers)
+	if err := client.Call(protocol.MsgDataset, ds, nil); err != nil {
+		log.Fatalf("error enviando dataset: %v", err)
 	}
 
-	// Cerrar el lado de escritura para que el servidor sepa que ya terminamos
-	tcpConn := conn.(*net.TCPConn)
-	tcpConn.CloseWrite()
+	msg := models.TaskMessage{
+		Type:           models.RequestSimilarity,
+		DatasetID:      ds.ID,
+		DatasetVersion: ds.Version,
+		UserIndex:      0,
+		K:              2,
+	}
 
-	// LEER RESPUESTA
-	resp, err := io.ReadAll(conn)
-	if err != nil {
-		log.Fatalf("error leyendo respuesta: %v", err)
+	// ENVÍO DEL MENSAJE Y LECTURA DE LA RESPUESTA (mismo frame requestID)
+	var out models.CoordinatorResponse
+	if err := client.Call(protocol.MsgTask, msg, &out); err != nil {
+		log.Fatalf("error en la solicitud: %v", err)
 	}
 
-	fmt.Println("Respuesta cruda:", string(resp))
+	fmt.Printf("CoordinatorResponse: %+v\n", out)
 
-	var out models.CoordinatorResponse
-	if err := json.Unmarshal(resp, &out); err != nil {
-		log.Fatalf("error parseando respuesta: %v", err)
+	// La misma conexión sirve para más solicitudes
+	msg.Type = models.RequestRecommendation
+	target := ds.Matrix.Row(msg.UserIndex)
+	msg.TargetRow = &target
+	if err := client.Call(protocol.MsgTask, msg, &out); err != nil {
+		log.Fatalf("error en la solicitud: %v", err)
 	}
 
 	fmt.Printf("CoordinatorResponse: %+v\n", out)
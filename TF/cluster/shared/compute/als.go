@@ -0,0 +1,181 @@
+package compute
+
+import (
+	"math"
+	"math/rand"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// FACTORIZACIÓN DE MATRICES (ALS)
+// La matriz usuario–película se aproxima como U·Vᵀ con factores latentes de
+// dimensión k. Con una de las dos matrices fija, cada fila de la otra se
+// obtiene resolviendo un sistema k×k de mínimos cuadrados regularizados
+// (ALS-WR: la regularización se escala con la cantidad de calificaciones).
+// ---------------------------------------------------
+
+// InitFactors crea rows vectores de dimensión k con valores aleatorios
+// pequeños y reproducibles (misma semilla, mismos factores).
+func InitFactors(rows, k int, seed int64) [][]float64 {
+	r := rand.New(rand.NewSource(seed))
+	scale := 1 / math.Sqrt(float64(k))
+
+	out := make([][]float64, rows)
+	for i := range out {
+		out[i] = make([]float64, k)
+		for j := range out[i] {
+			out[i][j] = r.Float64() * scale
+		}
+	}
+	return out
+}
+
+// SolveFactors resuelve el vector latente de cada fila [start, end) de
+// ratings con los factores fixed fijos (uno por columna de ratings). Las
+// filas sin calificaciones quedan en cero.
+func SolveFactors(ratings *sparse.Matrix, start, end int, fixed [][]float64, lambda float64) [][]float64 {
+	k := 0
+	if len(fixed) > 0 {
+		k = len(fixed[0])
+	}
+
+	out := make([][]float64, end-start)
+	a := make([]float64, k*k)
+	b := make([]float64, k)
+
+	for i := range out {
+		row := ratings.Row(start + i)
+		out[i] = make([]float64, k)
+		if row.NNZ() == 0 {
+			continue
+		}
+
+		for x := range a {
+			a[x] = 0
+		}
+		for x := range b {
+			b[x] = 0
+		}
+
+		// A = Σ f fᵀ + λ·n·I ; b = Σ r f, sobre las columnas calificadas
+		for c, j := range row.Idx {
+			r := row.Val[c]
+			f := fixed[j]
+			for p := 0; p < k; p++ {
+				b[p] += r * f[p]
+				for q := p; q < k; q++ {
+					a[p*k+q] += f[p] * f[q]
+				}
+			}
+		}
+
+		count := row.NNZ()
+		for p := 0; p < k; p++ {
+			a[p*k+p] += lambda * float64(count)
+			for q := 0; q < p; q++ {
+				a[p*k+q] = a[q*k+p]
+			}
+		}
+
+		if !solveCholesky(a, b, out[i], k) {
+			// matriz no definida positiva (solo si lambda = 0): fila en cero
+			for p := range out[i] {
+				out[i][p] = 0
+			}
+		}
+	}
+
+	return out
+}
+
+// SquaredError suma los errores al cuadrado de las calificaciones de las
+// filas [start, end) de ratings estimadas como own[i-start]·fixed[j];
+// devuelve también cuántas se sumaron.
+func SquaredError(ratings *sparse.Matrix, start, end int, own, fixed [][]float64) (float64, int) {
+	var sse float64
+	var count int
+	for i := start; i < end; i++ {
+		row := ratings.Row(i)
+		for c, j := range row.Idx {
+			e := row.Val[c] - Dot(own[i-start], fixed[j])
+			sse += e * e
+			count++
+		}
+	}
+	return sse, count
+}
+
+// Dot es el producto punto de dos vectores de igual largo.
+func Dot(u, v []float64) float64 {
+	var s float64
+	for i := range u {
+		s += u[i] * v[i]
+	}
+	return s
+}
+
+// FactorTopN puntúa cada película con el producto punto entre el vector del
+// usuario y el de la película, y devuelve las n mejores que el usuario no
+// calificó (las presentes en rated), de mayor a menor puntaje.
+func FactorTopN(user []float64, items [][]float64, rated sparse.Vector, n int) ([]int, []float64) {
+	h := &minHeap{}
+
+	next := 0 // rated.Idx es creciente: se avanza junto con movie
+	for movie, f := range items {
+		for next < len(rated.Idx) && rated.Idx[next] < movie {
+			next++
+		}
+		if next < len(rated.Idx) && rated.Idx[next] == movie {
+			continue
+		}
+		h.pushBounded(movie, Dot(user, f), n)
+	}
+
+	return h.sortedDesc()
+}
+
+// solveCholesky resuelve A x = b para A simétrica definida positiva de k×k
+// (por filas). A se sobrescribe con su factor L. Devuelve false si A no es
+// definida positiva.
+func solveCholesky(a, b, x []float64, k int) bool {
+	// A = L Lᵀ (L en el triángulo inferior de a)
+	for j := 0; j < k; j++ {
+		d := a[j*k+j]
+		for p := 0; p < j; p++ {
+			d -= a[j*k+p] * a[j*k+p]
+		}
+		if d <= 0 {
+			return false
+		}
+		d = math.Sqrt(d)
+		a[j*k+j] = d
+
+		for i := j + 1; i < k; i++ {
+			s := a[i*k+j]
+			for p := 0; p < j; p++ {
+				s -= a[i*k+p] * a[j*k+p]
+			}
+			a[i*k+j] = s / d
+		}
+	}
+
+	// L y = b
+	for i := 0; i < k; i++ {
+		s := b[i]
+		for p := 0; p < i; p++ {
+			s -= a[i*k+p] * x[p]
+		}
+		x[i] = s / a[i*k+i]
+	}
+	// Lᵀ x = y
+	for i := k - 1; i >= 0; i-- {
+		s := x[i]
+		for p := i + 1; p < k; p++ {
+			s -= a[p*k+i] * x[p]
+		}
+		x[i] = s / a[i*k+i]
+	}
+
+	return true
+}
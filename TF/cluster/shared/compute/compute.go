@@ -1,43 +1,51 @@
 package compute
 
 import (
+	"container/heap"
 	"math"
 	"sort"
+
+	"sdr/cluster/shared/sparse"
 )
 
 // --------------------------------------------
 // UTILIDAD: similitud coseno entre dos vectores
+// (solo recorre las películas calificadas)
 // --------------------------------------------
-func cosine(u, v []float64) float64 {
-	var dot, nu, nv float64
-	for i := range u {
-		dot += u[i] * v[i]
-		nu += u[i] * u[i]
-		nv += v[i] * v[i]
-	}
-
+func cosine(u, v sparse.Vector) float64 {
+	nu, nv := u.Norm(), v.Norm()
 	if nu == 0 || nv == 0 {
 		return 0
 	}
 
-	return dot / (math.Sqrt(nu) * math.Sqrt(nv))
+	return sparse.Dot(u, v) / (nu * nv)
 }
 
 // ---------------------------------------------------
 // SIMILITUD PARA UN USUARIO CONTRA TODOS LOS DEMÁS
 // ---------------------------------------------------
-func CosineSimilarityForUser(matrix [][]float64, userIndex int) []float64 {
-	n := len(matrix)
-	sims := make([]float64, n)
+func CosineSimilarityForUser(matrix *sparse.Matrix, userIndex int) []float64 {
+	return SimilarityForRange(cosine, matrix, matrix.Row(userIndex), 0, matrix.Rows, userIndex)
+}
+
+// ---------------------------------------------------
+// SIMILITUD PARA UN RANGO DE USUARIOS (CHUNK)
+// compara target con las filas [start, end) de la matriz
+// ---------------------------------------------------
+func CosineSimilarityForRange(matrix *sparse.Matrix, target sparse.Vector, start, end, userIndex int) []float64 {
+	return SimilarityForRange(cosine, matrix, target, start, end, userIndex)
+}
 
-	target := matrix[userIndex]
+// SimilarityForRange es CosineSimilarityForRange con cualquier métrica.
+func SimilarityForRange(sim Similarity, matrix *sparse.Matrix, target sparse.Vector, start, end, userIndex int) []float64 {
+	sims := make([]float64, end-start)
 
-	for i := 0; i < n; i++ {
+	for i := start; i < end; i++ {
 		if i == userIndex {
-			sims[i] = -1 // para evitar que sea elegido como su propio vecino
+			sims[i-start] = -1 // el usuario objetivo nunca es su propio vecino
 			continue
 		}
-		sims[i] = cosine(target, matrix[i])
+		sims[i-start] = sim(target, matrix.Row(i))
 	}
 
 	return sims
@@ -47,23 +55,49 @@ func CosineSimilarityForUser(matrix [][]float64, userIndex int) []float64 {
 // MATRIZ COMPLETA DE SIMILITUD
 // (solo si la API lo necesita)
 // ---------------------------------------------------
-func CosineSimilarityMatrix(matrix [][]float64) []float64 {
-	n := len(matrix)
-	result := make([]float64, 0, n*n)
+func CosineSimilarityMatrix(matrix *sparse.Matrix) []float64 {
+	return SimilarityBlock(cosine, matrix, 0, matrix.Rows, 0, matrix.Rows)
+}
 
-	for i := 0; i < n; i++ {
-		for j := 0; j < n; j++ {
-			result = append(result, cosine(matrix[i], matrix[j]))
+// ---------------------------------------------------
+// BLOQUE DE LA MATRIZ DE SIMILITUD
+// filas [rowStart, rowEnd) x columnas [colStart, colEnd), por filas.
+// En un bloque diagonal (mismo rango de filas y columnas) solo se calcula
+// el triángulo superior y se refleja, así cada par se calcula una vez.
+// ---------------------------------------------------
+func CosineSimilarityBlock(matrix *sparse.Matrix, rowStart, rowEnd, colStart, colEnd int) []float64 {
+	return SimilarityBlock(cosine, matrix, rowStart, rowEnd, colStart, colEnd)
+}
+
+// SimilarityBlock es CosineSimilarityBlock con cualquier métrica.
+func SimilarityBlock(sim Similarity, matrix *sparse.Matrix, rowStart, rowEnd, colStart, colEnd int) []float64 {
+	rows := rowEnd - rowStart
+	cols := colEnd - colStart
+	block := make([]float64, rows*cols)
+	diagonal := rowStart == colStart && rowEnd == colEnd
+
+	for i := 0; i < rows; i++ {
+		u := matrix.Row(rowStart + i)
+		j0 := 0
+		if diagonal {
+			j0 = i
+		}
+		for j := j0; j < cols; j++ {
+			v := sim(u, matrix.Row(colStart+j))
+			block[i*cols+j] = v
+			if diagonal {
+				block[j*cols+i] = v
+			}
 		}
 	}
 
-	return result
+	return block
 }
 
 // ---------------------------------------------------
 // PREDICCIÓN BASADA EN K VECINOS
 // ---------------------------------------------------
-func PredictRatings(matrix [][]float64, sims []float64, userIndex, k int) []float64 {
+func PredictRatings(matrix *sparse.Matrix, sims []float64, userIndex, k int) []float64 {
 	// 1. Obtener índices de vecinos ordenados
 	idxs := sortIndexesDescending(sims)
 
@@ -81,42 +115,135 @@ func PredictRatings(matrix [][]float64, sims []float64, userIndex, k int) []floa
 		k = len(neighbors)
 	}
 
-	// 2. Tomar los K mejores vecinos (puede ser 0)
+	// 2. Tomar los K mejores vecinos (puede ser 0) y ponderar por similitud
 	best := neighbors[:k]
+	bestSims := make([]float64, k)
+	for i, neighbor := range best {
+		bestSims[i] = sims[neighbor]
+	}
 
-	target := matrix[userIndex]
-	m := len(target)
-	preds := make([]float64, m)
+	target := matrix.Row(userIndex)
+	num, den, _ := PartialWeightedSums(matrix, target, best, bestSims)
 
-	for movie := 0; movie < m; movie++ {
+	return PredictFromSums(target, num, den)
+}
 
-		// si ya tiene valor, mantenemos su rating
-		if target[movie] > 0 {
-			preds[movie] = target[movie]
-			continue
-		}
+// ---------------------------------------------------
+// SUMAS PONDERADAS PARCIALES (CHUNK)
+// neighbors son índices globales de filas de matrix y sims[i] es la
+// similitud del vecino neighbors[i]. Solo se recorren las calificaciones
+// de los vecinos. matrix puede estar normalizada; target es la fila original
+// del usuario (solo indica qué películas ya calificó). voters cuenta los
+// vecinos que calificaron cada película.
+// ---------------------------------------------------
+func PartialWeightedSums(matrix *sparse.Matrix, target sparse.Vector, neighbors []int, sims []float64) (num, den, voters []float64) {
+	m := target.Dim
+	num = make([]float64, m)
+	den = make([]float64, m)
+	voters = make([]float64, m)
+	rated := target.Dense()
 
-		var num, den float64
+	for n, neighbor := range neighbors {
+		row := matrix.Row(neighbor)
+		sim := sims[n]
 
-		// ponderar por similitud
-		for _, neighbor := range best {
-			rating := matrix[neighbor][movie]
-			if rating == 0 {
+		for k, movie := range row.Idx {
+			// solo interesan las películas que el usuario no ha calificado
+			if rated[movie] > 0 {
 				continue
 			}
+			num[movie] += sim * row.Val[k]
+			den[movie] += math.Abs(sim)
+			voters[movie]++
+		}
+	}
 
-			num += sims[neighbor] * rating
-			den += math.Abs(sims[neighbor])
+	return num, den, voters
+}
+
+// ---------------------------------------------------
+// COMBINAR SUMAS PARCIALES EN PREDICCIONES
+// (mismo resultado que PredictRatings)
+// ---------------------------------------------------
+func PredictFromSums(target sparse.Vector, num, den []float64) []float64 {
+	return PredictFromNormalizedSums(target, identity, num, den, nil, Confidence{})
+}
+
+// PredictFromNormalizedSums es PredictFromSums cuando las sumas se
+// calcularon con calificaciones normalizadas: cada predicción vuelve a la
+// escala del usuario con stats (la transformación de target). Si se pasan
+// voters, las películas con menos de c.MinVoters vecinos no se predicen.
+func PredictFromNormalizedSums(target sparse.Vector, stats RowStats, num, den, voters []float64, c Confidence) []float64 {
+	preds, _ := predictFromNormalizedSums(target, stats, num, den, voters, c)
+	return preds
+}
+
+// predictFromNormalizedSums es PredictFromNormalizedSums que además indica
+// qué películas tienen predicción: con calificaciones normalizadas una
+// predicción puede valer 0.
+func predictFromNormalizedSums(target sparse.Vector, stats RowStats, num, den, voters []float64, c Confidence) ([]float64, []bool) {
+	preds := make([]float64, target.Dim)
+	has := make([]bool, target.Dim)
+
+	for movie := range preds {
+		if voters != nil && !c.enoughVoters(voters[movie]) {
+			continue
+		}
+		if den[movie] != 0 {
+			preds[movie] = stats.Denormalize(num[movie] / den[movie])
+			has[movie] = true
+		}
+	}
+	for k, movie := range target.Idx {
+		if target.Val[k] > 0 {
+			preds[movie] = target.Val[k]
+			has[movie] = true
 		}
+	}
+
+	return preds, has
+}
+
+// ---------------------------------------------------
+// TOP-N DE PREDICCIONES PARA UN RANGO DE PELÍCULAS
+// Predice las películas [start, end) que el usuario no calificó usando los
+// vecinos dados (índices globales en matrix, con similitud sims[i]) y
+// devuelve solo las n mejores, de mayor a menor puntaje. Las películas que
+// ningún vecino calificó (o menos de c.MinVoters) no son candidatas. Con
+// matrix normalizada los puntajes quedan en la escala normalizada (el orden
+// es el mismo).
+// ---------------------------------------------------
+func TopNPredictions(matrix *sparse.Matrix, target sparse.Vector, neighbors []int, sims []float64, start, end, n int, c Confidence) ([]int, []float64) {
+	width := end - start
+	num := make([]float64, width)
+	den := make([]float64, width)
+	voters := make([]float64, width)
 
-		if den == 0 {
-			preds[movie] = 0
-		} else {
-			preds[movie] = num / den
+	for i, neighbor := range neighbors {
+		row := matrix.Row(neighbor)
+		// primera calificación del vecino dentro del rango
+		for k := sort.SearchInts(row.Idx, start); k < len(row.Idx) && row.Idx[k] < end; k++ {
+			movie := row.Idx[k] - start
+			num[movie] += sims[i] * row.Val[k]
+			den[movie] += math.Abs(sims[i])
+			voters[movie]++
+		}
+	}
+	for k := sort.SearchInts(target.Idx, start); k < len(target.Idx) && target.Idx[k] < end; k++ {
+		if target.Val[k] > 0 {
+			den[target.Idx[k]-start] = 0 // ya calificada: no es candidata
 		}
 	}
 
-	return preds
+	h := &minHeap{}
+	for movie := 0; movie < width; movie++ {
+		if den[movie] == 0 || !c.enoughVoters(voters[movie]) {
+			continue
+		}
+		h.pushBounded(start+movie, num[movie]/den[movie], n)
+	}
+
+	return h.sortedDesc()
 }
 
 // ---------------------------------------------------
@@ -126,6 +253,20 @@ func SortIndexesByScore(scores []float64) []int {
 	return sortIndexesDescending(scores)
 }
 
+// ---------------------------------------------------
+// K MAYORES VALORES (índices ordenados de mayor a menor)
+// ---------------------------------------------------
+func TopKIndexes(values []float64, k int) []int {
+	idx := sortIndexesDescending(values)
+	if k > len(idx) {
+		k = len(idx)
+	}
+	if k < 0 {
+		k = 0
+	}
+	return idx[:k]
+}
+
 // Utilidad: ordenar de mayor a menor
 func sortIndexesDescending(values []float64) []int {
 	idx := make([]int, len(values))
@@ -139,3 +280,63 @@ func sortIndexesDescending(values []float64) []int {
 
 	return idx
 }
+
+// minHeap guarda los n mejores puntajes vistos: la raíz es el peor de
+// ellos, así cada candidato nuevo solo se compara contra la raíz.
+type minHeap struct {
+	idx    []int
+	scores []float64
+}
+
+func (h minHeap) Len() int           { return len(h.idx) }
+func (h minHeap) Less(i, j int) bool { return h.scores[i] < h.scores[j] }
+func (h minHeap) Swap(i, j int) {
+	h.idx[i], h.idx[j] = h.idx[j], h.idx[i]
+	h.scores[i], h.scores[j] = h.scores[j], h.scores[i]
+}
+
+func (h *minHeap) Push(x any) {
+	e := x.(heapEntry)
+	h.idx = append(h.idx, e.index)
+	h.scores = append(h.scores, e.score)
+}
+
+func (h *minHeap) Pop() any {
+	last := len(h.idx) - 1
+	e := heapEntry{index: h.idx[last], score: h.scores[last]}
+	h.idx = h.idx[:last]
+	h.scores = h.scores[:last]
+	return e
+}
+
+type heapEntry struct {
+	index int
+	score float64
+}
+
+// pushBounded agrega el candidato si todavía no hay n o si supera al peor.
+func (h *minHeap) pushBounded(index int, score float64, n int) {
+	if n <= 0 {
+		return
+	}
+	if h.Len() < n {
+		heap.Push(h, heapEntry{index: index, score: score})
+		return
+	}
+	if score > h.scores[0] {
+		h.idx[0], h.scores[0] = index, score
+		heap.Fix(h, 0)
+	}
+}
+
+// sortedDesc vacía el heap y devuelve los candidatos de mayor a menor.
+func (h *minHeap) sortedDesc() ([]int, []float64) {
+	n := h.Len()
+	idx := make([]int, n)
+	scores := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		e := heap.Pop(h).(heapEntry)
+		idx[i], scores[i] = e.index, e.score
+	}
+	return idx, scores
+}
@@ -0,0 +1,57 @@
+package compute
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinHeapKeepsBestN(t *testing.T) {
+	h := &minHeap{}
+	for i, s := range []float64{0.2, 0.9, 0.5, 0.7, 0.1} {
+		h.pushBounded(i, s, 2)
+	}
+
+	idx, scores := h.sortedDesc()
+	if !reflect.DeepEqual(idx, []int{1, 3}) || !reflect.DeepEqual(scores, []float64{0.9, 0.7}) {
+		t.Errorf("sortedDesc = %v %v, se esperaba [1 3] [0.9 0.7]", idx, scores)
+	}
+}
+
+func TestMinHeapFewerCandidatesThanN(t *testing.T) {
+	h := &minHeap{}
+	for i, s := range []float64{-0.3, 0, 0.9, -0.1} {
+		h.pushBounded(i, s, 10)
+	}
+
+	// los negativos y el cero también son candidatos
+	idx, scores := h.sortedDesc()
+	if !reflect.DeepEqual(idx, []int{2, 1, 3, 0}) || !reflect.DeepEqual(scores, []float64{0.9, 0, -0.1, -0.3}) {
+		t.Errorf("sortedDesc = %v %v", idx, scores)
+	}
+}
+
+func TestMinHeapZeroN(t *testing.T) {
+	h := &minHeap{}
+	h.pushBounded(0, 0.5, 0)
+
+	if idx, _ := h.sortedDesc(); len(idx) != 0 {
+		t.Errorf("con n 0 quedaron %v", idx)
+	}
+}
+
+func TestTopKIndexes(t *testing.T) {
+	values := []float64{0.3, 0.9, 0.1, 0.5}
+	want := map[int][]int{
+		-1: {},
+		0:  {},
+		2:  {1, 3},
+		4:  {1, 3, 0, 2},
+		10: {1, 3, 0, 2},
+	}
+
+	for k, w := range want {
+		if got := TopKIndexes(values, k); !reflect.DeepEqual(got, w) {
+			t.Errorf("TopKIndexes(%d) = %v, se esperaba %v", k, got, w)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package compute
+
+import (
+	"math"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// REGLAS DE CONFIANZA DE LAS PREDICCIONES
+// Un vecino con una sola película en común puede tener similitud 1 por
+// casualidad, y una película calificada por un único vecino se predice con
+// la opinión de una sola persona. Estas reglas descartan o penalizan esos
+// casos. Con el valor cero cada regla queda desactivada, salvo MinSimilarity
+// (0 es un mínimo válido), que se desactiva con nil.
+// ---------------------------------------------------
+
+// Confidence son las reglas que se aplican a los vecinos y a las películas
+// candidatas.
+type Confidence struct {
+	MinOverlap    int      // películas en común mínimas para que un vecino cuente
+	Shrinkage     float64  // significancia: la similitud se multiplica por n/(n+Shrinkage), con n películas en común
+	MinSimilarity *float64 // similitud mínima (ya penalizada) de un vecino
+	MinVoters     int      // vecinos mínimos que calificaron una película para predecirla
+}
+
+// Adjust aplica MinOverlap, Shrinkage y MinSimilarity a la similitud s entre
+// u y v; ok es falso si el vecino se descarta.
+func (c Confidence) Adjust(s float64, u, v sparse.Vector) (float64, bool) {
+	if math.IsNaN(s) {
+		return 0, false
+	}
+	if c.MinOverlap > 0 || c.Shrinkage > 0 {
+		n := overlap(u, v)
+		if n < c.MinOverlap {
+			return 0, false
+		}
+		if c.Shrinkage > 0 {
+			s *= float64(n) / (float64(n) + c.Shrinkage)
+		}
+	}
+	if !c.similarEnough(s) {
+		return 0, false
+	}
+	return s, true
+}
+
+// similarEnough indica si un vecino con similitud s alcanza MinSimilarity.
+func (c Confidence) similarEnough(s float64) bool {
+	return c.MinSimilarity == nil || s >= *c.MinSimilarity
+}
+
+// enoughVoters indica si una película calificada por voters vecinos se
+// puede predecir.
+func (c Confidence) enoughVoters(voters float64) bool {
+	return c.MinVoters <= 0 || voters >= float64(c.MinVoters)
+}
+
+// overlap cuenta las películas calificadas por ambos.
+func overlap(u, v sparse.Vector) int {
+	var n int
+	sparse.Intersect(u, v, func(int, float64, float64) { n++ })
+	return n
+}
+
+// ConfidentNeighbors devuelve los k vecinos más parecidos a target entre las
+// filas [start, end) de matrix (índices globales, de mayor a menor
+// similitud), con la similitud ya ajustada por c. Nunca incluye a userIndex.
+func ConfidentNeighbors(sim Similarity, matrix *sparse.Matrix, target sparse.Vector, start, end, userIndex, k int, c Confidence) ([]int, []float64) {
+	h := &minHeap{}
+
+	for i := start; i < end; i++ {
+		if i == userIndex {
+			continue
+		}
+		row := matrix.Row(i)
+		s, ok := c.Adjust(sim(target, row), target, row)
+		if !ok {
+			continue
+		}
+		h.pushBounded(i, s, k)
+	}
+
+	return h.sortedDesc()
+}
@@ -0,0 +1,67 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// Dos usuarios con dos películas en común (0 y 3)
+var (
+	confU = sparse.FromDenseVector([]float64{1, 1, 0, 1})
+	confV = sparse.FromDenseVector([]float64{1, 0, 1, 1})
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestAdjustWithoutRules(t *testing.T) {
+	for _, s := range []float64{0.5, 0, -0.4} {
+		if got, ok := (Confidence{}).Adjust(s, confU, confV); !ok || got != s {
+			t.Errorf("Adjust(%g) = %g, %t; sin reglas no debería cambiar", s, got, ok)
+		}
+	}
+	if _, ok := (Confidence{}).Adjust(math.NaN(), confU, confV); ok {
+		t.Error("una similitud NaN no debería contar")
+	}
+}
+
+func TestAdjustMinOverlap(t *testing.T) {
+	if _, ok := (Confidence{MinOverlap: 2}).Adjust(0.5, confU, confV); !ok {
+		t.Error("con 2 películas en común se alcanza MinOverlap 2")
+	}
+	if _, ok := (Confidence{MinOverlap: 3}).Adjust(0.5, confU, confV); ok {
+		t.Error("con 2 películas en común no se alcanza MinOverlap 3")
+	}
+}
+
+func TestAdjustShrinkage(t *testing.T) {
+	// 0.5 · 2/(2+2)
+	got, ok := Confidence{Shrinkage: 2}.Adjust(0.5, confU, confV)
+	if !ok || math.Abs(got-0.25) > 1e-12 {
+		t.Errorf("Adjust = %g, %t, se esperaba 0.25", got, ok)
+	}
+
+	// MinSimilarity se compara con la similitud ya penalizada
+	if _, ok := (Confidence{Shrinkage: 2, MinSimilarity: floatPtr(0.3)}).Adjust(0.5, confU, confV); ok {
+		t.Error("0.25 no alcanza MinSimilarity 0.3")
+	}
+}
+
+func TestAdjustMinSimilarity(t *testing.T) {
+	cases := []struct {
+		min, s float64
+		ok     bool
+	}{
+		{0.3, 0.3, true},
+		{0.3, 0.29, false},
+		// 0 es un mínimo: descarta los vecinos con similitud negativa
+		{0, 0, true},
+		{0, -0.1, false},
+	}
+	for _, c := range cases {
+		if _, ok := (Confidence{MinSimilarity: floatPtr(c.min)}).Adjust(c.s, confU, confV); ok != c.ok {
+			t.Errorf("MinSimilarity %g con similitud %g: ok = %t, se esperaba %t", c.min, c.s, ok, c.ok)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package compute
+
+import (
+	"math"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// EVALUACIÓN OFFLINE
+// Las calificaciones se separan en entrenamiento y prueba; con las de
+// entrenamiento se predicen las de prueba (RMSE, MAE) y se arma el top-k de
+// cada usuario, que se compara con las películas de prueba relevantes
+// (precision@k, recall@k, NDCG@k). Cada worker acumula EvalSums para sus
+// usuarios y el coordinador las suma.
+// ---------------------------------------------------
+
+// EvalSums son las sumas de una evaluación, parciales o totales.
+type EvalSums struct {
+	SquaredError float64 // suma de (predicción - real)² de las calificaciones predichas
+	AbsError     float64 // suma de |predicción - real|
+	Predicted    int     // calificaciones de prueba con predicción
+	TestRatings  int     // calificaciones de prueba
+	Users        int     // usuarios con calificaciones de prueba
+	RankedUsers  int     // usuarios con al menos una película de prueba relevante
+	Precision    float64 // suma de precision@k de los RankedUsers
+	Recall       float64 // suma de recall@k
+	NDCG         float64 // suma de NDCG@k
+}
+
+// EvalReport son las métricas finales de una evaluación.
+type EvalReport struct {
+	RMSE         float64
+	MAE          float64
+	Coverage     float64 // fracción de las calificaciones de prueba que se pudieron predecir
+	PrecisionAtK float64
+	RecallAtK    float64
+	NDCGAtK      float64
+	K            int // largo de las listas evaluadas
+	Users        int
+	RankedUsers  int
+	TestRatings  int
+}
+
+// Add suma las sumas parciales de o.
+func (s *EvalSums) Add(o EvalSums) {
+	s.SquaredError += o.SquaredError
+	s.AbsError += o.AbsError
+	s.Predicted += o.Predicted
+	s.TestRatings += o.TestRatings
+	s.Users += o.Users
+	s.RankedUsers += o.RankedUsers
+	s.Precision += o.Precision
+	s.Recall += o.Recall
+	s.NDCG += o.NDCG
+}
+
+// AddUser evalúa un usuario: train es su fila de entrenamiento, test la de
+// prueba y preds sus predicciones con el formato de PredictFromSums (las
+// películas de train conservan su valor) y has indica cuáles tienen
+// predicción: con calificaciones normalizadas 0 es una predicción válida.
+// Una película de prueba es relevante si su calificación es al menos
+// relevance o, con relevance en 0, al menos la media del usuario en train.
+func (s *EvalSums) AddUser(train, test sparse.Vector, preds []float64, has []bool, k int, relevance float64) {
+	if test.NNZ() == 0 {
+		return
+	}
+	s.Users++
+
+	if relevance == 0 {
+		relevance = train.Mean()
+	}
+	relevant := make(map[int]bool)
+	for n, movie := range test.Idx {
+		r := test.Val[n]
+		s.TestRatings++
+		if r >= relevance {
+			relevant[movie] = true
+		}
+		if has[movie] {
+			p := preds[movie]
+			s.Predicted++
+			s.SquaredError += (p - r) * (p - r)
+			s.AbsError += math.Abs(p - r)
+		}
+	}
+	if len(relevant) == 0 || k <= 0 {
+		return
+	}
+
+	// top-k entre las películas que no están en train
+	rated := train.Dense()
+	h := &minHeap{}
+	for movie, p := range preds {
+		if !has[movie] || rated[movie] != 0 {
+			continue
+		}
+		h.pushBounded(movie, p, k)
+	}
+	top, _ := h.sortedDesc()
+
+	var hits int
+	var dcg float64
+	for pos, movie := range top {
+		if relevant[movie] {
+			hits++
+			dcg += 1 / math.Log2(float64(pos+2))
+		}
+	}
+	var idcg float64
+	for pos := 0; pos < min(k, len(relevant)); pos++ {
+		idcg += 1 / math.Log2(float64(pos+2))
+	}
+
+	s.RankedUsers++
+	s.Precision += float64(hits) / float64(k)
+	s.Recall += float64(hits) / float64(len(relevant))
+	s.NDCG += dcg / idcg
+}
+
+// Report calcula las métricas a partir de las sumas totales.
+func (s EvalSums) Report(k int) EvalReport {
+	r := EvalReport{K: k, Users: s.Users, RankedUsers: s.RankedUsers, TestRatings: s.TestRatings}
+	if s.Predicted > 0 {
+		r.RMSE = math.Sqrt(s.SquaredError / float64(s.Predicted))
+		r.MAE = s.AbsError / float64(s.Predicted)
+	}
+	if s.TestRatings > 0 {
+		r.Coverage = float64(s.Predicted) / float64(s.TestRatings)
+	}
+	if s.RankedUsers > 0 {
+		r.PrecisionAtK = s.Precision / float64(s.RankedUsers)
+		r.RecallAtK = s.Recall / float64(s.RankedUsers)
+		r.NDCGAtK = s.NDCG / float64(s.RankedUsers)
+	}
+	return r
+}
+
+// UserBasedPredictions predice todas las películas de la fila userIndex de
+// matrix con sus k vecinos más parecidos (filtrado por usuarios, en un solo
+// proceso). matrix son las filas ya normalizadas con norm y raw las
+// originales; sim es la métrica preparada sobre matrix. has indica qué
+// películas tienen predicción.
+func UserBasedPredictions(sim Similarity, norm Normalization, matrix, raw *sparse.Matrix, userIndex, k int, c Confidence) (preds []float64, has []bool) {
+	target := raw.Row(userIndex)
+	normalized, stats := NormalizeRow(norm, target)
+	neighbors, sims := ConfidentNeighbors(sim, matrix, normalized, 0, matrix.Rows, userIndex, k, c)
+	num, den, voters := PartialWeightedSums(matrix, target, neighbors, sims)
+	return predictFromNormalizedSums(target, stats, num, den, voters, c)
+}
@@ -0,0 +1,68 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// addUser evalúa un usuario con vectores densos y devuelve las sumas.
+func addUser(train, test, preds []float64, has []bool, k int, relevance float64) EvalSums {
+	var s EvalSums
+	s.AddUser(sparse.FromDenseVector(train), sparse.FromDenseVector(test), preds, has, k, relevance)
+	return s
+}
+
+func checkSums(t *testing.T, got, want EvalSums) {
+	t.Helper()
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	if got.Predicted != want.Predicted || got.TestRatings != want.TestRatings ||
+		got.Users != want.Users || got.RankedUsers != want.RankedUsers ||
+		!near(got.SquaredError, want.SquaredError) || !near(got.AbsError, want.AbsError) ||
+		!near(got.Precision, want.Precision) || !near(got.Recall, want.Recall) || !near(got.NDCG, want.NDCG) {
+		t.Errorf("AddUser = %+v, se esperaba %+v", got, want)
+	}
+}
+
+func TestAddUserWithoutTestRatings(t *testing.T) {
+	got := addUser([]float64{1, 0, 0}, []float64{0, 0, 0}, []float64{1, 0.5, 0.5}, []bool{true, true, true}, 2, 0)
+	checkSums(t, got, EvalSums{})
+}
+
+func TestAddUserPredictionMask(t *testing.T) {
+	train := []float64{1, 0, 0}
+
+	// sin predicción la calificación de prueba no suma error
+	got := addUser(train, []float64{0, 0.9, 0}, []float64{1, 0, 0}, []bool{true, false, false}, 2, 0.5)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 1, RankedUsers: 1})
+
+	// una predicción que vale 0 sí cuenta
+	got = addUser(train, []float64{0, 0.2, 0}, []float64{1, 0, 0}, []bool{true, true, false}, 2, 0.5)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 1, Predicted: 1, SquaredError: 0.04, AbsError: 0.2})
+
+	// y entra al ranking por delante de una negativa
+	got = addUser(train, []float64{0, 0.9, 0}, []float64{1, 0, -0.5}, []bool{true, true, true}, 1, 0.5)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 1, Predicted: 1, SquaredError: 0.81, AbsError: 0.9,
+		RankedUsers: 1, Precision: 1, Recall: 1, NDCG: 1})
+}
+
+func TestAddUserRankingSkipsTrainMovies(t *testing.T) {
+	// la película 0 (de train) tiene la mejor predicción pero no se rankea;
+	// el acierto queda en la segunda posición
+	got := addUser([]float64{1, 0, 0, 0}, []float64{0, 0.9, 0.1, 0}, []float64{1, 0.8, 0.9, 0.7}, []bool{true, true, true, true}, 2, 0.5)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 2, Predicted: 2, SquaredError: 0.65, AbsError: 0.9,
+		RankedUsers: 1, Precision: 0.5, Recall: 1, NDCG: 1 / math.Log2(3)})
+}
+
+func TestAddUserRelevanceFromTrainMean(t *testing.T) {
+	// sin umbral, relevante es superar la media de train (0.6): solo lo es
+	// la película 1, y el top-1 es la 2
+	got := addUser([]float64{0.4, 0, 0, 0.8}, []float64{0, 0.7, 0.5, 0}, []float64{0.4, 0.2, 0.9, 0.8}, []bool{true, true, true, true}, 1, 0)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 2, Predicted: 2, SquaredError: 0.41, AbsError: 0.9, RankedUsers: 1})
+}
+
+func TestAddUserZeroK(t *testing.T) {
+	got := addUser([]float64{1, 0, 0}, []float64{0, 0.9, 0}, []float64{1, 0.9, 0}, []bool{true, true, false}, 0, 0.5)
+	checkSums(t, got, EvalSums{Users: 1, TestRatings: 1, Predicted: 1})
+}
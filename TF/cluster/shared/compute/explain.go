@@ -0,0 +1,77 @@
+package compute
+
+import (
+	"sort"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// EXPLICACIONES DE LAS PREDICCIONES
+// Para cada película recomendada se informan los vecinos que más aportaron
+// a su puntaje: en modo user, usuarios parecidos que la calificaron; en modo
+// item, películas parecidas que el propio usuario calificó.
+// ---------------------------------------------------
+
+// Contribution es el aporte de un vecino a la predicción de una película.
+type Contribution struct {
+	Index      int     // usuario vecino (modo user) o película calificada por el usuario (modo item)
+	Similarity float64 // similitud con el usuario objetivo (o con la película predicha)
+	Rating     float64 // calificación original
+	Weight     float64 // similitud · calificación normalizada: su sumando en el numerador
+}
+
+// NeighborContributions devuelve los k vecinos que más aportaron a la
+// predicción de movie, de mayor a menor aporte. matrix es la matriz con la
+// que se predijo (puede estar normalizada) y raw la original, de donde sale
+// la calificación que se informa; ambas comparten la estructura.
+func NeighborContributions(matrix, raw *sparse.Matrix, neighbors []int, sims []float64, movie, k int) []Contribution {
+	var out []Contribution
+	for i, neighbor := range neighbors {
+		row := matrix.Row(neighbor)
+		pos, ok := row.Find(movie)
+		if !ok {
+			continue
+		}
+		out = append(out, Contribution{
+			Index:      neighbor,
+			Similarity: sims[i],
+			Rating:     raw.Row(neighbor).Val[pos],
+			Weight:     sims[i] * row.Val[pos],
+		})
+	}
+	return topContributions(out, k)
+}
+
+// ItemContributions devuelve las k películas calificadas por el usuario que
+// más aportaron a la predicción de una película en modo item ("porque
+// calificaste bien X"). neighbors y sims son las películas más parecidas a
+// la predicha; se descartan las que itemScore descarta por c.MinSimilarity.
+func ItemContributions(row sparse.Vector, stats RowStats, neighbors []int, sims []float64, k int, c Confidence) []Contribution {
+	var out []Contribution
+	for i, j := range neighbors {
+		rating := row.Get(j)
+		if rating == 0 {
+			continue
+		}
+		if !c.similarEnough(sims[i]) {
+			continue
+		}
+		out = append(out, Contribution{
+			Index:      j,
+			Similarity: sims[i],
+			Rating:     rating,
+			Weight:     sims[i] * stats.Normalize(rating),
+		})
+	}
+	return topContributions(out, k)
+}
+
+// topContributions ordena por aporte (de mayor a menor) y se queda con k.
+func topContributions(cs []Contribution, k int) []Contribution {
+	sort.SliceStable(cs, func(a, b int) bool { return cs[a].Weight > cs[b].Weight })
+	if len(cs) > k {
+		cs = cs[:k]
+	}
+	return cs
+}
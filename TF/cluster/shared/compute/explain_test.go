@@ -0,0 +1,89 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// predictedFrom rearma el puntaje a partir de todos los aportes: la suma de
+// los pesos sobre la de las similitudes, de vuelta a la escala del usuario.
+func predictedFrom(cs []Contribution, stats RowStats) float64 {
+	var num, den float64
+	for _, c := range cs {
+		num += c.Weight
+		den += math.Abs(c.Similarity)
+	}
+	return stats.Denormalize(num / den)
+}
+
+func TestNeighborContributionsAddUpToPrediction(t *testing.T) {
+	raw := sparse.FromDense([][]float64{
+		{5, 1, 0, 0},
+		{5, 3, 4, 2},
+		{2, 0, 1, 0},
+		{4, 4, 0, 5},
+	})
+	neighbors, sims := []int{1, 2, 3}, []float64{0.8, 0.4, -0.3}
+
+	for _, name := range []string{NormalizationNone, NormalizationMeanCenter, NormalizationZScore} {
+		norm, _ := LookupNormalization(name)
+		matrix := NormalizeMatrix(norm, raw)
+		target := raw.Row(0)
+		stats := norm(target)
+
+		num, den, voters := PartialWeightedSums(matrix, target, neighbors, sims)
+		preds := PredictFromNormalizedSums(target, stats, num, den, voters, Confidence{})
+
+		for _, movie := range []int{2, 3} {
+			cs := NeighborContributions(matrix, raw, neighbors, sims, movie, 10)
+			if got := predictedFrom(cs, stats); !near(got, preds[movie]) {
+				t.Errorf("%s: los aportes de la película %d suman %g, la predicción es %g", name, movie, got, preds[movie])
+			}
+			for i, c := range cs {
+				if c.Rating != raw.Row(c.Index).Get(movie) {
+					t.Errorf("%s: el aporte de %d informa %g, su calificación original es %g", name, c.Index, c.Rating, raw.Row(c.Index).Get(movie))
+				}
+				if i > 0 && c.Weight > cs[i-1].Weight {
+					t.Errorf("%s: aportes fuera de orden: %v", name, cs)
+				}
+			}
+		}
+	}
+
+	// k acota los aportes informados a los mayores
+	cs := NeighborContributions(raw, raw, neighbors, sims, 3, 1)
+	if len(cs) != 1 || cs[0].Index != 1 {
+		t.Errorf("con k 1 = %v, se esperaba solo el vecino 1", cs)
+	}
+}
+
+func TestItemContributionsAddUpToPrediction(t *testing.T) {
+	row := vec(5, 1, 0, 3)
+	neighbors := [][]int{{1}, {0}, {0, 1, 3}, {0}}
+	sims := [][]float64{{0.3}, {0.3}, {0.5, 0.25, 0.6}, {0.2}}
+
+	for _, name := range []string{NormalizationNone, NormalizationMeanCenter, NormalizationZScore} {
+		norm, _ := LookupNormalization(name)
+		stats := norm(row)
+		preds, _ := ItemBasedPredictions(row, stats, neighbors, sims, Confidence{})
+
+		cs := ItemContributions(row, stats, neighbors[2], sims[2], 10, Confidence{})
+		if len(cs) != 3 {
+			t.Fatalf("%s: %d aportes, se esperaban 3", name, len(cs))
+		}
+		if got := predictedFrom(cs, stats); !near(got, preds[2]) {
+			t.Errorf("%s: los aportes suman %g, la predicción es %g", name, got, preds[2])
+		}
+	}
+
+	// MinSimilarity descarta las mismas vecinas que la predicción
+	minSim := 0.4
+	c := Confidence{MinSimilarity: &minSim}
+	preds, _ := ItemBasedPredictions(row, identity, neighbors, sims, c)
+	cs := ItemContributions(row, identity, neighbors[2], sims[2], 10, c)
+	if len(cs) != 2 || !near(predictedFrom(cs, identity), preds[2]) {
+		t.Errorf("con MinSimilarity 0.4: aportes %v, predicción %g", cs, preds[2])
+	}
+}
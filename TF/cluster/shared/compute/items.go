@@ -0,0 +1,107 @@
+package compute
+
+import (
+	"math"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// FILTRADO COLABORATIVO BASADO EN ÍTEMS
+// Las películas se comparan por sus columnas (las calificaciones de todos
+// los usuarios) y la predicción de una película sale de las calificaciones
+// del propio usuario a sus películas más parecidas.
+// ---------------------------------------------------
+
+// Transpose devuelve la matriz película–usuario (una fila por película).
+func Transpose(matrix *sparse.Matrix) *sparse.Matrix {
+	return matrix.Transpose()
+}
+
+// MostSimilar devuelve los k ítems más parecidos a la fila i de items (sin
+// incluirla), de mayor a menor similitud. Los ítems con similitud 0 no se
+// devuelven.
+func MostSimilar(sim Similarity, items *sparse.Matrix, i, k int) ([]int, []float64) {
+	h := &minHeap{}
+	item := items.Row(i)
+
+	for j := 0; j < items.Rows; j++ {
+		if j == i {
+			continue
+		}
+		s := sim(item, items.Row(j))
+		if s == 0 || math.IsNaN(s) {
+			continue
+		}
+		h.pushBounded(j, s, k)
+	}
+
+	return h.sortedDesc()
+}
+
+// ItemBasedPredictions predice todas las películas del usuario a partir de
+// sus propias calificaciones: neighbors[i] son las películas más parecidas a
+// la película i y sims[i] sus similitudes. Las calificaciones se ponderan
+// normalizadas con stats y el resultado vuelve a la escala del usuario. De
+// las reglas de c se aplican MinSimilarity (a cada película vecina) y
+// MinVoters (películas vecinas que el usuario calificó). Las películas ya
+// calificadas conservan su valor (mismo formato que PredictFromSums).
+// has indica qué películas tienen predicción (una predicción puede valer 0).
+func ItemBasedPredictions(row sparse.Vector, stats RowStats, neighbors [][]int, sims [][]float64, c Confidence) (preds []float64, has []bool) {
+	target := row.Dense()
+	preds = make([]float64, len(target))
+	has = make([]bool, len(target))
+
+	for movie := range target {
+		if target[movie] > 0 {
+			preds[movie], has[movie] = target[movie], true
+			continue
+		}
+		if score, ok := itemScore(target, stats, neighbors[movie], sims[movie], c); ok {
+			preds[movie], has[movie] = score, true
+		}
+	}
+
+	return preds, has
+}
+
+// ItemBasedTopN es como ItemBasedPredictions pero devuelve solo las n mejores
+// películas no calificadas, de mayor a menor puntaje.
+func ItemBasedTopN(row sparse.Vector, stats RowStats, neighbors [][]int, sims [][]float64, n int, c Confidence) ([]int, []float64) {
+	target := row.Dense()
+	h := &minHeap{}
+
+	for movie := range target {
+		if target[movie] > 0 {
+			continue
+		}
+		if score, ok := itemScore(target, stats, neighbors[movie], sims[movie], c); ok {
+			h.pushBounded(movie, score, n)
+		}
+	}
+
+	return h.sortedDesc()
+}
+
+// itemScore pondera las calificaciones del usuario a las películas vecinas;
+// ok es falso si no calificó ninguna (o menos de c.MinVoters).
+func itemScore(target []float64, stats RowStats, neighbors []int, sims []float64, c Confidence) (float64, bool) {
+	var num, den, voters float64
+	for i, j := range neighbors {
+		rating := target[j]
+		if rating == 0 {
+			continue
+		}
+		if !c.similarEnough(sims[i]) {
+			continue
+		}
+		num += sims[i] * stats.Normalize(rating)
+		den += math.Abs(sims[i])
+		voters++
+	}
+
+	if den == 0 || !c.enoughVoters(voters) {
+		return 0, false
+	}
+	return stats.Denormalize(num / den), true
+}
@@ -0,0 +1,75 @@
+package compute
+
+import (
+	"reflect"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+func TestMostSimilar(t *testing.T) {
+	// películas como filas: la 0 y la 1 las calificaron los mismos usuarios,
+	// la 3 no comparte ninguno con la 0
+	items := sparse.FromDense([][]float64{
+		{1, 1, 0},
+		{2, 2, 0},
+		{1, 0, 1},
+		{0, 0, 1},
+	})
+	idxs, sims := MostSimilar(cosine, items, 0, 5)
+
+	// sin la propia película ni las de similitud 0
+	if !reflect.DeepEqual(idxs, []int{1, 2}) || !near(sims[0], 1) || !near(sims[1], 0.5) {
+		t.Errorf("MostSimilar = %v %v, se esperaba [1 2] [1 0.5]", idxs, sims)
+	}
+}
+
+func TestItemBasedPredictions(t *testing.T) {
+	// el usuario calificó las películas 0 y 1 (media 3, desviación 2); la 2
+	// se parece a ambas y la 3 solo a una película que no calificó
+	row := vec(5, 1, 0, 0)
+	neighbors := [][]int{{1}, {0}, {0, 1}, {2}}
+	sims := [][]float64{{0.3}, {0.3}, {0.5, 0.25}, {0.9}}
+
+	tests := []struct {
+		norm string
+		want float64
+	}{
+		// (0.5·5 + 0.25·1) / 0.75
+		{NormalizationNone, 11.0 / 3},
+		// 3 + (0.5·2 + 0.25·-2) / 0.75
+		{NormalizationMeanCenter, 3 + 2.0/3},
+		// 3 + 2·(0.5·1 + 0.25·-1) / 0.75
+		{NormalizationZScore, 3 + 2.0/3},
+	}
+
+	for _, tt := range tests {
+		norm, _ := LookupNormalization(tt.norm)
+		stats := norm(row)
+
+		preds, has := ItemBasedPredictions(row, stats, neighbors, sims, Confidence{})
+		if !has[2] || !near(preds[2], tt.want) {
+			t.Errorf("%s: predicción de la película 2 = %g (%t), se esperaba %g", tt.norm, preds[2], has[2], tt.want)
+		}
+		if has[3] {
+			t.Errorf("%s: la película 3 no tiene vecinas calificadas y no debería predecirse", tt.norm)
+		}
+		if preds[0] != 5 || preds[1] != 1 {
+			t.Errorf("%s: calificadas = %v, se esperaba [5 1]", tt.norm, preds[:2])
+		}
+
+		movies, scores := ItemBasedTopN(row, stats, neighbors, sims, 5, Confidence{})
+		if !reflect.DeepEqual(movies, []int{2}) || !near(scores[0], tt.want) {
+			t.Errorf("%s: ItemBasedTopN = %v %v, se esperaba [2] [%g]", tt.norm, movies, scores, tt.want)
+		}
+	}
+
+	// con MinVoters 2 alcanza (dos vecinas calificadas); sin la de 0.25 no
+	minSim := 0.3
+	if _, has := ItemBasedPredictions(row, identity, neighbors, sims, Confidence{MinVoters: 2}); !has[2] {
+		t.Error("con dos vecinas calificadas se alcanza MinVoters 2")
+	}
+	if _, has := ItemBasedPredictions(row, identity, neighbors, sims, Confidence{MinVoters: 2, MinSimilarity: &minSim}); has[2] {
+		t.Error("MinSimilarity 0.3 descarta una vecina y ya no se alcanza MinVoters 2")
+	}
+}
@@ -0,0 +1,156 @@
+package compute
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// Similarity compara dos filas dispersas de la matriz usuario–película
+// (las películas ausentes no están calificadas).
+type Similarity func(u, v sparse.Vector) float64
+
+// Metric prepara una Similarity para una matriz concreta. Las métricas que
+// necesitan estadísticas globales (como las medias por película del coseno
+// ajustado) las calculan aquí una sola vez por versión del dataset.
+type Metric func(matrix *sparse.Matrix) Similarity
+
+// Métricas incluidas
+const (
+	MetricCosine         = "cosine"
+	MetricPearson        = "pearson"
+	MetricJaccard        = "jaccard"
+	MetricAdjustedCosine = "adjusted_cosine"
+
+	DefaultMetric = MetricCosine
+)
+
+var (
+	metricsMu sync.RWMutex
+	metrics   = map[string]Metric{
+		MetricCosine:         func(*sparse.Matrix) Similarity { return cosine },
+		MetricPearson:        func(*sparse.Matrix) Similarity { return pearson },
+		MetricJaccard:        func(*sparse.Matrix) Similarity { return jaccard },
+		MetricAdjustedCosine: adjustedCosine,
+	}
+)
+
+// RegisterMetric agrega (o reemplaza) una métrica con ese nombre.
+func RegisterMetric(name string, m Metric) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics[NormalizeMetric(name)] = m
+}
+
+// NormalizeMetric pasa el nombre a minúsculas; vacío significa DefaultMetric.
+func NormalizeMetric(name string) string {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		return DefaultMetric
+	}
+	return name
+}
+
+// LookupMetric busca una métrica por nombre (vacío = DefaultMetric).
+func LookupMetric(name string) (Metric, error) {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+
+	m, ok := metrics[NormalizeMetric(name)]
+	if !ok {
+		return nil, fmt.Errorf("métrica de similitud desconocida: %q (disponibles: %s)", name, strings.Join(metricNames(), ", "))
+	}
+	return m, nil
+}
+
+// MetricNames lista las métricas registradas, en orden alfabético.
+func MetricNames() []string {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return metricNames()
+}
+
+func metricNames() []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pearson calcula la correlación de Pearson sobre las películas que ambos
+// usuarios calificaron, centrando cada usuario en la media de todas sus
+// calificaciones.
+func pearson(u, v sparse.Vector) float64 {
+	meanU, meanV := u.Mean(), v.Mean()
+
+	var num, normU, normV float64
+	sparse.Intersect(u, v, func(_ int, a, b float64) {
+		du, dv := a-meanU, b-meanV
+		num += du * dv
+		normU += du * du
+		normV += dv * dv
+	})
+
+	if normU == 0 || normV == 0 {
+		return 0
+	}
+	return num / (math.Sqrt(normU) * math.Sqrt(normV))
+}
+
+// jaccard calcula el índice de Jaccard entre los conjuntos de películas
+// calificadas: |A ∩ B| / |A ∪ B|.
+func jaccard(u, v sparse.Vector) float64 {
+	var inter int
+	sparse.Intersect(u, v, func(int, float64, float64) { inter++ })
+
+	union := u.NNZ() + v.NNZ() - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+// adjustedCosine resta a cada calificación la media de esa película entre
+// todos los usuarios que la calificaron y calcula el coseno sobre las
+// películas calificadas por ambos.
+func adjustedCosine(matrix *sparse.Matrix) Similarity {
+	means := itemMeans(matrix)
+
+	return func(u, v sparse.Vector) float64 {
+		var num, normU, normV float64
+		sparse.Intersect(u, v, func(i int, a, b float64) {
+			du, dv := a-means[i], b-means[i]
+			num += du * dv
+			normU += du * du
+			normV += dv * dv
+		})
+
+		if normU == 0 || normV == 0 {
+			return 0
+		}
+		return num / (math.Sqrt(normU) * math.Sqrt(normV))
+	}
+}
+
+// itemMeans es la media de cada columna entre las filas que la calificaron.
+func itemMeans(matrix *sparse.Matrix) []float64 {
+	sums := make([]float64, matrix.Cols)
+	counts := make([]int, matrix.Cols)
+	for k, i := range matrix.ColIdx {
+		sums[i] += matrix.Values[k]
+		counts[i]++
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= float64(counts[i])
+		}
+	}
+	return sums
+}
@@ -0,0 +1,91 @@
+package compute
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+func vec(values ...float64) sparse.Vector { return sparse.FromDenseVector(values) }
+
+func TestMetrics(t *testing.T) {
+	// medias por película: 3, 2 y 3; centradas, las filas quedan en
+	// [2 1 _], [0 -1 1] y [-2 0 -1]
+	adjusted := sparse.FromDense([][]float64{
+		{5, 3, 0},
+		{3, 1, 4},
+		{1, 2, 2},
+	})
+
+	tests := []struct {
+		name   string
+		metric string
+		matrix *sparse.Matrix // solo para las métricas que la usan
+		u, v   sparse.Vector
+		want   float64
+	}{
+		{"coseno", MetricCosine, nil, vec(1, 0, 1), vec(1, 1, 0), 0.5},
+		{"coseno sin películas en común", MetricCosine, nil, vec(1, 0, 0), vec(0, 2, 3), 0},
+		{"coseno con una fila vacía", MetricCosine, nil, vec(0, 0, 0), vec(1, 2, 3), 0},
+
+		{"pearson proporcional", MetricPearson, nil, vec(1, 2, 3), vec(2, 4, 6), 1},
+		{"pearson opuesto", MetricPearson, nil, vec(1, 2, 3), vec(3, 2, 1), -1},
+		// medias 3 y 8/3 sobre todas sus películas; en común la 0 y la 3:
+		// (1·7/3 + 0·-2/3) / (1 · √53/3)
+		{"pearson parcial", MetricPearson, nil, vec(4, 2, 0, 3), vec(5, 0, 1, 2), 7 / math.Sqrt(53)},
+		{"pearson sin varianza", MetricPearson, nil, vec(3, 3, 3), vec(1, 2, 3), 0},
+		// v vale su media (3) en las películas en común
+		{"pearson sin varianza en común", MetricPearson, nil, vec(2, 4, 0, 0), vec(3, 3, 1, 5), 0},
+		{"pearson sin películas en común", MetricPearson, nil, vec(1, 2, 0, 0), vec(0, 0, 3, 4), 0},
+
+		{"jaccard", MetricJaccard, nil, vec(1, 1, 0, 1), vec(5, 0, 2, 1), 0.5},
+		{"jaccard ignora los valores", MetricJaccard, nil, vec(5, 0, 1), vec(1, 0, 5), 1},
+		{"jaccard sin películas en común", MetricJaccard, nil, vec(1, 0), vec(0, 1), 0},
+		{"jaccard con filas vacías", MetricJaccard, nil, vec(0, 0), vec(0, 0), 0},
+
+		{"coseno ajustado", MetricAdjustedCosine, adjusted, adjusted.Row(0), adjusted.Row(1), -1 / math.Sqrt(5)},
+		{"coseno ajustado, 3 en común", MetricAdjustedCosine, adjusted, adjusted.Row(1), adjusted.Row(2), -1 / math.Sqrt(10)},
+		{"coseno ajustado, 2 en común", MetricAdjustedCosine, adjusted, adjusted.Row(0), adjusted.Row(2), -2 / math.Sqrt(5)},
+		// la película 2 vale su media: no aporta varianza
+		{"coseno ajustado sin varianza", MetricAdjustedCosine, adjusted, vec(0, 0, 3), vec(0, 0, 4), 0},
+		{"coseno ajustado sin películas en común", MetricAdjustedCosine, adjusted, vec(5, 0, 0), vec(0, 0, 4), 0},
+	}
+
+	for _, tt := range tests {
+		m, err := LookupMetric(tt.metric)
+		if err != nil {
+			t.Fatalf("LookupMetric(%s): %v", tt.metric, err)
+		}
+		matrix := tt.matrix
+		if matrix == nil {
+			matrix = sparse.FromDense([][]float64{{0}})
+		}
+		sim := m(matrix)
+		if got := sim(tt.u, tt.v); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: similitud = %g, se esperaba %g", tt.name, got, tt.want)
+		}
+		// todas las métricas son simétricas
+		if got := sim(tt.v, tt.u); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: similitud invertida = %g, se esperaba %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLookupMetric(t *testing.T) {
+	if _, err := LookupMetric(" Pearson "); err != nil {
+		t.Errorf("el nombre debería normalizarse: %v", err)
+	}
+	if NormalizeMetric("") != DefaultMetric {
+		t.Errorf("NormalizeMetric(\"\") = %q, se esperaba %q", NormalizeMetric(""), DefaultMetric)
+	}
+	if _, err := LookupMetric("manhattan"); err == nil {
+		t.Error("se esperaba error por una métrica desconocida")
+	}
+
+	want := []string{MetricAdjustedCosine, MetricCosine, MetricJaccard, MetricPearson}
+	if got := MetricNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MetricNames = %v, se esperaba %v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package compute
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"sdr/cluster/shared/sparse"
+)
+
+// ---------------------------------------------------
+// NORMALIZACIÓN DE CALIFICACIONES
+// Antes de comparar usuarios, las calificaciones de cada uno se pueden
+// llevar a una escala común (restando su media y, en z-score, dividiendo por
+// su desviación estándar). Así, quien califica todo alto no se parece a
+// todos los demás solo por eso. Las predicciones se calculan en esa escala y
+// se devuelven a la del usuario objetivo antes de ordenarlas.
+// ---------------------------------------------------
+
+// RowStats es la transformación de una fila: z = (r - Mean) / Std.
+type RowStats struct {
+	Mean float64
+	Std  float64
+}
+
+// identity no cambia las calificaciones.
+var identity = RowStats{Mean: 0, Std: 1}
+
+// Normalize lleva una calificación a la escala normalizada.
+func (s RowStats) Normalize(r float64) float64 { return (r - s.Mean) / s.Std }
+
+// Denormalize devuelve un puntaje normalizado a la escala del usuario.
+func (s RowStats) Denormalize(z float64) float64 { return s.Mean + z*s.Std }
+
+// Normalization calcula la transformación de una fila a partir de sus
+// calificaciones (las distintas de cero).
+type Normalization func(row sparse.Vector) RowStats
+
+// Normalizaciones incluidas
+const (
+	NormalizationNone       = "none"
+	NormalizationMeanCenter = "mean_center"
+	NormalizationZScore     = "zscore"
+
+	DefaultNormalization = NormalizationNone
+)
+
+var (
+	normalizationsMu sync.RWMutex
+	normalizations   = map[string]Normalization{
+		NormalizationNone:       func(sparse.Vector) RowStats { return identity },
+		NormalizationMeanCenter: meanCenter,
+		NormalizationZScore:     zScore,
+	}
+)
+
+// RegisterNormalization agrega (o reemplaza) una normalización con ese nombre.
+func RegisterNormalization(name string, n Normalization) {
+	normalizationsMu.Lock()
+	defer normalizationsMu.Unlock()
+	normalizations[NormalizationName(name)] = n
+}
+
+// NormalizationName pasa el nombre a minúsculas; vacío significa
+// DefaultNormalization.
+func NormalizationName(name string) string {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		return DefaultNormalization
+	}
+	return name
+}
+
+// LookupNormalization busca una normalización por nombre (vacío =
+// DefaultNormalization).
+func LookupNormalization(name string) (Normalization, error) {
+	normalizationsMu.RLock()
+	defer normalizationsMu.RUnlock()
+
+	n, ok := normalizations[NormalizationName(name)]
+	if !ok {
+		return nil, fmt.Errorf("normalización desconocida: %q (disponibles: %s)", name, strings.Join(normalizationNames(), ", "))
+	}
+	return n, nil
+}
+
+// NormalizationNames lista las normalizaciones registradas, en orden
+// alfabético.
+func NormalizationNames() []string {
+	normalizationsMu.RLock()
+	defer normalizationsMu.RUnlock()
+	return normalizationNames()
+}
+
+func normalizationNames() []string {
+	names := make([]string, 0, len(normalizations))
+	for name := range normalizations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// meanCenter resta la media del usuario.
+func meanCenter(row sparse.Vector) RowStats {
+	return RowStats{Mean: row.Mean(), Std: 1}
+}
+
+// zScore resta la media del usuario y divide por su desviación estándar
+// (poblacional). Si el usuario calificó todo igual solo se centra.
+func zScore(row sparse.Vector) RowStats {
+	mean := row.Mean()
+
+	var variance float64
+	for _, r := range row.Val {
+		d := r - mean
+		variance += d * d
+	}
+	std := 1.0
+	if len(row.Val) > 0 {
+		if s := math.Sqrt(variance / float64(len(row.Val))); s > 0 {
+			std = s
+		}
+	}
+	return RowStats{Mean: mean, Std: std}
+}
+
+// NormalizeRow devuelve la fila normalizada y su transformación. La fila
+// conserva sus columnas aunque algún valor normalizado sea 0: sigue
+// contando como calificada.
+func NormalizeRow(norm Normalization, row sparse.Vector) (sparse.Vector, RowStats) {
+	stats := norm(row)
+	out := sparse.Vector{Dim: row.Dim, Idx: row.Idx, Val: make([]float64, len(row.Val))}
+	for k, r := range row.Val {
+		out.Val[k] = stats.Normalize(r)
+	}
+	return out, stats
+}
+
+// NormalizeMatrix normaliza cada fila por separado. La matriz resultante
+// comparte la estructura (RowPtr y ColIdx) con m; solo copia los valores.
+func NormalizeMatrix(norm Normalization, m *sparse.Matrix) *sparse.Matrix {
+	out := &sparse.Matrix{
+		Rows:   m.Rows,
+		Cols:   m.Cols,
+		RowPtr: m.RowPtr,
+		ColIdx: m.ColIdx,
+		Values: make([]float64, len(m.Values)),
+	}
+	for i := 0; i < m.Rows; i++ {
+		row := m.Row(i)
+		stats := norm(row)
+		for k, r := range row.Val {
+			out.Values[m.RowPtr[i]+k] = stats.Normalize(r)
+		}
+	}
+	return out
+}
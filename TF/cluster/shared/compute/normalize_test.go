@@ -0,0 +1,106 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"sdr/cluster/shared/sparse"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestNormalizationStats(t *testing.T) {
+	// las calificaciones son las distintas de cero: media 5, desviación 2
+	row := vec(2, 0, 4, 4, 4, 0, 5, 5, 7, 9)
+
+	if s := meanCenter(row); !near(s.Mean, 5) || s.Std != 1 {
+		t.Errorf("meanCenter = %+v, se esperaba {5 1}", s)
+	}
+	if s := zScore(row); !near(s.Mean, 5) || !near(s.Std, 2) {
+		t.Errorf("zScore = %+v, se esperaba {5 2}", s)
+	}
+	// todo igual: solo se centra
+	if s := zScore(vec(3, 0, 3)); !near(s.Mean, 3) || s.Std != 1 {
+		t.Errorf("zScore de una fila constante = %+v, se esperaba {3 1}", s)
+	}
+	if s := zScore(vec(0, 0)); s.Mean != 0 || s.Std != 1 {
+		t.Errorf("zScore de una fila vacía = %+v, se esperaba {0 1}", s)
+	}
+}
+
+func TestNormalizeMatrixRoundTrip(t *testing.T) {
+	m := sparse.FromDense([][]float64{
+		{4, 2, 0, 5},
+		{0, 3, 3, 0},
+		{1, 0, 5, 2},
+	})
+
+	for _, name := range []string{NormalizationMeanCenter, NormalizationZScore} {
+		norm, _ := LookupNormalization(name)
+		out := NormalizeMatrix(norm, m)
+
+		if &out.ColIdx[0] != &m.ColIdx[0] || &out.RowPtr[0] != &m.RowPtr[0] {
+			t.Errorf("%s: la matriz normalizada debe compartir la estructura", name)
+		}
+		for i := 0; i < m.Rows; i++ {
+			stats := norm(m.Row(i))
+			row, normalized := m.Row(i), out.Row(i)
+			var sum float64
+			for k := range row.Val {
+				sum += normalized.Val[k]
+				if got := stats.Denormalize(normalized.Val[k]); !near(got, row.Val[k]) {
+					t.Errorf("%s: fila %d, columna %d vuelve como %g, se esperaba %g", name, i, row.Idx[k], got, row.Val[k])
+				}
+			}
+			// la fila 1 es constante: queda en cero aunque sigue calificada
+			if !near(sum, 0) || len(normalized.Idx) != len(row.Idx) {
+				t.Errorf("%s: fila %d normalizada = %v, se esperaba media 0 con las mismas columnas", name, i, normalized)
+			}
+		}
+	}
+}
+
+func TestNormalizedPredictionRoundTrip(t *testing.T) {
+	// el usuario 0 no calificó la película 2; los vecinos 1 y 2 sí
+	m := sparse.FromDense([][]float64{
+		{5, 1, 0},
+		{5, 3, 4},
+		{2, 0, 1},
+	})
+	neighbors, sims := []int{1, 2}, []float64{0.8, 0.4}
+
+	tests := []struct {
+		norm string
+		want float64
+	}{
+		// ninguna: (0.8·4 + 0.4·1) / 1.2
+		{NormalizationNone, 3},
+		// desvíos 0 y -0.5, media del usuario 3: 3 + (0.8·0 + 0.4·-0.5) / 1.2
+		{NormalizationMeanCenter, 3 - 1.0/6},
+		// z 0 y -1, usuario con media 3 y desviación 2: 3 + 2·(0.4·-1) / 1.2
+		{NormalizationZScore, 3 - 2.0/3},
+	}
+
+	for _, tt := range tests {
+		norm, _ := LookupNormalization(tt.norm)
+		matrix := NormalizeMatrix(norm, m)
+		target := m.Row(0)
+		stats := norm(target)
+
+		num, den, voters := PartialWeightedSums(matrix, target, neighbors, sims)
+		preds := PredictFromNormalizedSums(target, stats, num, den, voters, Confidence{})
+		if !near(preds[2], tt.want) {
+			t.Errorf("%s: predicción = %g, se esperaba %g", tt.norm, preds[2], tt.want)
+		}
+		// las ya calificadas conservan su valor original
+		if preds[0] != 5 || preds[1] != 1 {
+			t.Errorf("%s: calificadas = %v, se esperaba [5 1]", tt.norm, preds[:2])
+		}
+
+		// el top-N puntúa en la escala normalizada: al volver da lo mismo
+		movies, scores := TopNPredictions(matrix, target, neighbors, sims, 0, 3, 1, Confidence{})
+		if len(movies) != 1 || movies[0] != 2 || !near(stats.Denormalize(scores[0]), tt.want) {
+			t.Errorf("%s: TopNPredictions = %v %v, se esperaba la película 2 con %g", tt.norm, movies, scores, tt.want)
+		}
+	}
+}
@@ -1,30 +1,311 @@
 package models
 
+import (
+	"fmt"
+
+	"sdr/cluster/shared/sparse"
+)
+
 // Tipo de operación que la API pide al coordinador.
 type RequestType string
 
 const (
 	RequestSimilarity     RequestType = "SIMILARITY"
 	RequestRecommendation RequestType = "RECOMMENDATION"
+	RequestTrainALS       RequestType = "TRAIN_ALS"
+	RequestEvaluate       RequestType = "EVALUATE"
+	RequestTune           RequestType = "TUNE"
+	RequestJobStatus      RequestType = "JOB_STATUS"
+	RequestJobCancel      RequestType = "JOB_CANCEL"
+)
+
+// Modo de filtrado colaborativo de una recomendación.
+// user: vecinos entre usuarios (por defecto).
+// item: vecinos entre películas, precalculados en el clúster una vez por
+// versión del dataset y métrica.
+type CFMode string
+
+const (
+	ModeUser CFMode = "user"
+	ModeItem CFMode = "item"
 )
 
-// Mensaje base que la API envía al coordinador vía TCP
+// Mensaje base que la API envía al coordinador vía TCP.
+// La matriz no viaja en cada solicitud: se referencia un dataset que los
+// workers ya tienen en memoria (ver Dataset) y solo se envía la fila
+// (dispersa) del usuario objetivo.
 type TaskMessage struct {
-	Type      RequestType `json:"type"`
-	Matrix    [][]float64 `json:"matrix"`    // matriz completa usuario–película
-	UserIndex int         `json:"userIndex"` // solo para recomendación
-	K         int         `json:"k"`         // vecinos
+	Type           RequestType    `json:"type"`
+	DatasetID      string         `json:"datasetId"`
+	DatasetVersion int64          `json:"datasetVersion"`
+	TargetRow      *sparse.Vector `json:"targetRow,omitempty"`     // fila del usuario objetivo (recomendación)
+	UserIndex      int            `json:"userIndex"`               // solo para recomendación (-1 = fuera del dataset, con TargetRow)
+	K              int            `json:"k"`                       // vecinos
+	N              int            `json:"n,omitempty"`             // películas a devolver (0 = vector completo)
+	Metric         string         `json:"metric,omitempty"`        // métrica de similitud (vacío = coseno)
+	Normalization  string         `json:"normalization,omitempty"` // normalización de las calificaciones (vacío = ninguna)
+	Mode           CFMode         `json:"mode,omitempty"`          // solo para recomendación (vacío = user)
+	DeadlineMs     int64          `json:"deadlineMs,omitempty"`    // plazo en milisegundos Unix (0 = sin plazo)
+	ALS            *ALSParams     `json:"als,omitempty"`           // solo para TRAIN_ALS
+	Eval           *EvalParams    `json:"eval,omitempty"`          // solo para EVALUATE y TUNE
+	Tune           *TuneParams    `json:"tune,omitempty"`          // solo para TUNE
+	Explain        int            `json:"explain,omitempty"`       // aportes a informar por película del top-N (0 = sin explicación)
+	Progress       bool           `json:"progress,omitempty"`      // enviar avances parciales (Progress) mientras se procesa
+	Async          bool           `json:"async,omitempty"`         // encolar como job y responder solo con su estado (ver JobStatus)
+	JobID          string         `json:"jobId,omitempty"`         // solo para JOB_STATUS y JOB_CANCEL
+
+	Confidence // reglas de confianza de la recomendación (cero = desactivadas)
+}
+
+// Reglas de confianza de las predicciones (ver compute.Confidence). Cada
+// regla en cero queda desactivada, salvo MinSimilarity, que se desactiva
+// omitiéndola (nil). En modo item solo se aplican MinSimilarity y MinVoters.
+type Confidence struct {
+	MinOverlap    int      `json:"minOverlap,omitempty"`    // películas en común mínimas con un vecino
+	Shrinkage     float64  `json:"shrinkage,omitempty"`     // similitud · n/(n+Shrinkage), n = películas en común
+	MinSimilarity *float64 `json:"minSimilarity,omitempty"` // similitud mínima de un vecino (nil = sin mínimo)
+	MinVoters     int      `json:"minVoters,omitempty"`     // vecinos mínimos que calificaron una película
+}
+
+// Parámetros del entrenamiento ALS (cero = valor por defecto del coordinador).
+// Lambda no puede pedirse en cero: sin regularización, los usuarios o
+// películas con menos calificaciones que factores no tienen solución única.
+type ALSParams struct {
+	Factors    int     `json:"factors,omitempty"`    // dimensión de los factores latentes
+	Iterations int     `json:"iterations,omitempty"` // pasadas usuarios + películas
+	Lambda     float64 `json:"lambda,omitempty"`     // regularización
+	Seed       int64   `json:"seed,omitempty"`       // semilla de los factores iniciales
+}
+
+// Parámetros de una evaluación offline (EVALUATE). El dataset referenciado
+// tiene solo las calificaciones de entrenamiento; Test, con las mismas
+// dimensiones, las retenidas para evaluar. Se evalúa con K, Metric,
+// Normalization, Mode y Confidence del mensaje (modos user e item).
+type EvalParams struct {
+	Test      *sparse.Matrix `json:"test"`
+	TopK      int            `json:"topK,omitempty"`      // largo de las listas para precision/recall/NDCG (0 = 10)
+	Relevance float64        `json:"relevance,omitempty"` // calificación mínima relevante (0 = la media de cada usuario)
+}
+
+// Sumas de una evaluación (ver compute.EvalSums); cada chunk devuelve las
+// de sus usuarios y el coordinador las suma.
+type EvalSums struct {
+	SquaredError float64 `json:"squaredError"`
+	AbsError     float64 `json:"absError"`
+	Predicted    int     `json:"predicted"`
+	TestRatings  int     `json:"testRatings"`
+	Users        int     `json:"users"`
+	RankedUsers  int     `json:"rankedUsers"`
+	Precision    float64 `json:"precision"`
+	Recall       float64 `json:"recall"`
+	NDCG         float64 `json:"ndcg"`
+}
+
+// Métricas de una evaluación (ver compute.EvalReport)
+type EvalReport struct {
+	RMSE         float64 `json:"rmse"`
+	MAE          float64 `json:"mae"`
+	Coverage     float64 `json:"coverage"` // fracción de calificaciones de prueba predichas
+	PrecisionAtK float64 `json:"precisionAtK"`
+	RecallAtK    float64 `json:"recallAtK"`
+	NDCGAtK      float64 `json:"ndcgAtK"`
+	K            int     `json:"k"`
+	Users        int     `json:"users"`
+	RankedUsers  int     `json:"rankedUsers"` // usuarios con alguna película de prueba relevante
+	TestRatings  int     `json:"testRatings"`
+}
+
+// Grilla de una búsqueda de hiperparámetros (TUNE): se evalúan todas las
+// combinaciones de los valores de cada lista con las calificaciones de
+// prueba de Eval. Una lista vacía deja el valor del mensaje (K, Metric,
+// Mode, Normalization o la regla de Confidence correspondiente).
+type TuneParams struct {
+	K              []int     `json:"k,omitempty"`
+	Metrics        []string  `json:"metrics,omitempty"`
+	Modes          []CFMode  `json:"modes,omitempty"`
+	Normalizations []string  `json:"normalizations,omitempty"`
+	MinOverlap     []int     `json:"minOverlap,omitempty"`
+	Shrinkage      []float64 `json:"shrinkage,omitempty"`
+	MinSimilarity  []float64 `json:"minSimilarity,omitempty"`
+	MinVoters      []int     `json:"minVoters,omitempty"`
+
+	Objective string `json:"objective,omitempty"` // métrica que ordena el ranking: ndcg (por defecto), precision, recall, rmse o mae
+	Parallel  int    `json:"parallel,omitempty"`  // combinaciones evaluadas a la vez (0 = una por worker vivo)
+}
+
+// Una combinación de hiperparámetros de la grilla
+type TuneConfig struct {
+	K             int    `json:"k"`
+	Metric        string `json:"metric"`
+	Mode          CFMode `json:"mode"`
+	Normalization string `json:"normalization"`
+
+	Confidence
+}
+
+// Resultado de una combinación
+type TuneTrial struct {
+	Rank      int         `json:"rank"` // 1 = la mejor; las fallidas van al final
+	Config    TuneConfig  `json:"config"`
+	Score     float64     `json:"score"` // valor del objetivo
+	Report    *EvalReport `json:"report,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ElapsedMs int64       `json:"elapsedMs"`
+}
+
+// Ranking de una búsqueda de hiperparámetros, de la mejor combinación a la peor
+type Leaderboard struct {
+	Objective string      `json:"objective"`
+	TopK      int         `json:"topK"`
+	Trials    []TuneTrial `json:"trials"`
+}
+
+// Factores latentes entrenados con ALS para una versión del dataset:
+// el puntaje de la película j para el usuario i es UserFactors[i]·ItemFactors[j].
+type FactorModel struct {
+	DatasetID      string      `json:"datasetId"`
+	DatasetVersion int64       `json:"datasetVersion"`
+	Params         ALSParams   `json:"params"`
+	UserFactors    [][]float64 `json:"userFactors"`
+	ItemFactors    [][]float64 `json:"itemFactors"`
+	RMSE           []float64   `json:"rmse"` // error de entrenamiento tras cada iteración
+}
+
+// --- Datasets residentes en los workers ---
+
+// Dataset es una versión de la matriz usuario–película, en formato CSR para
+// que solo viajen las calificaciones. La API lo envía una vez al
+// coordinador, que lo reparte a los workers; las tareas solo llevan
+// DatasetID y DatasetVersion.
+type Dataset struct {
+	ID      string         `json:"id"`
+	Version int64          `json:"version"`
+	Matrix  *sparse.Matrix `json:"matrix"`
+}
+
+// Referencia a una versión de un dataset
+type DatasetRef struct {
+	ID      string `json:"id"`
+	Version int64  `json:"version"`
+}
+
+// DatasetPatch son los cambios que llevan un dataset de BaseVersion a
+// Version (calificaciones nuevas, cambiadas o borradas, y usuarios o
+// películas nuevos al final). Viaja en vez de la matriz completa cuando el
+// destinatario ya tiene BaseVersion; si no la tiene responde
+// CodeDatasetMissing y se le envía la versión nueva completa.
+type DatasetPatch struct {
+	ID          string        `json:"id"`
+	BaseVersion int64         `json:"baseVersion"`
+	Version     int64         `json:"version"`
+	Rows        int           `json:"rows"` // dimensiones de la versión nueva
+	Cols        int           `json:"cols"`
+	Cells       []sparse.Cell `json:"cells"`
+}
+
+// Base es la versión sobre la que se aplican los cambios.
+func (p DatasetPatch) Base() DatasetRef {
+	return DatasetRef{ID: p.ID, Version: p.BaseVersion}
+}
+
+// Apply devuelve la versión nueva a partir de base (que no se modifica).
+func (p DatasetPatch) Apply(base *Dataset) (*Dataset, error) {
+	if base.ID != p.ID || base.Version != p.BaseVersion {
+		return nil, fmt.Errorf("el parche de %s v%d no aplica sobre %s v%d", p.ID, p.BaseVersion, base.ID, base.Version)
+	}
+	if p.Version <= p.BaseVersion {
+		return nil, fmt.Errorf("versión %d del parche no posterior a %d", p.Version, p.BaseVersion)
+	}
+	matrix, err := base.Matrix.Apply(p.Rows, p.Cols, p.Cells)
+	if err != nil {
+		return nil, err
+	}
+	return &Dataset{ID: p.ID, Version: p.Version, Matrix: matrix}, nil
 }
 
 // --- Chunking ---
 
+// Fase de una tarea distribuida.
+// NEIGHBORS: el worker calcula similitudes para su rango y devuelve sus K mejores vecinos.
+// PARTIAL: el worker calcula sumas ponderadas parciales con los vecinos globales de su rango.
+// TOP_N: el worker predice las películas [Start, End) con los vecinos globales y
+// devuelve solo sus N mejores candidatas.
+// SIMILARITY_BLOCK: el worker calcula un bloque filas [Start, End) x columnas [ColStart, ColEnd)
+// de la matriz de similitud usuario–usuario y devuelve solo los K vecinos
+// más parecidos de cada fila (y, fuera de la diagonal, de cada columna).
+// ITEM_NEIGHBORS: el worker calcula las K películas más parecidas a cada
+// película [Start, End) (modo item).
+// ALS_USERS / ALS_ITEMS: el worker resuelve los factores de los usuarios (o
+// películas) [Start, End) con los factores del otro lado fijos (Fixed).
+// EVALUATE: el worker predice las calificaciones de prueba de los usuarios
+// [Start, End) y arma su top-k, y devuelve las sumas de la evaluación.
+type ChunkPhase string
+
+const (
+	PhaseNeighbors       ChunkPhase = "NEIGHBORS"
+	PhasePartial         ChunkPhase = "PARTIAL"
+	PhaseTopN            ChunkPhase = "TOP_N"
+	PhaseSimilarityBlock ChunkPhase = "SIMILARITY_BLOCK"
+	PhaseItemNeighbors   ChunkPhase = "ITEM_NEIGHBORS"
+	PhaseALSUsers        ChunkPhase = "ALS_USERS"
+	PhaseALSItems        ChunkPhase = "ALS_ITEMS"
+	PhaseEvaluate        ChunkPhase = "EVALUATE"
+)
+
 type Chunk struct {
-	ID        int         `json:"id"`
-	Start     int         `json:"start"`
-	End       int         `json:"end"`
-	Matrix    [][]float64 `json:"matrix"`
-	UserIndex int         `json:"userIndex"` // solo se usa para recomendación
-	K         int         `json:"k"`
+	ID        int            `json:"id"`
+	Phase     ChunkPhase     `json:"phase"`
+	Start     int            `json:"start"`
+	End       int            `json:"end"`
+	ColStart  int            `json:"colStart,omitempty"` // solo fase SIMILARITY_BLOCK
+	ColEnd    int            `json:"colEnd,omitempty"`   // solo fase SIMILARITY_BLOCK
+	Dataset   DatasetRef     `json:"dataset"`            // el worker usa las filas [Start, End) de su copia
+	Target    *sparse.Vector `json:"target,omitempty"`   // fila del usuario objetivo
+	UserIndex int            `json:"userIndex"`          // solo se usa para recomendación
+	K         int            `json:"k"`
+	Metric    string         `json:"metric,omitempty"`    // fases NEIGHBORS, SIMILARITY_BLOCK e ITEM_NEIGHBORS
+	N         int            `json:"n,omitempty"`         // solo fase TOP_N
+	Neighbors []Neighbor     `json:"neighbors,omitempty"` // fases PARTIAL y TOP_N
+
+	Normalization string `json:"normalization,omitempty"` // normalización de las filas (todas las fases salvo las ALS)
+	Confidence           // fases NEIGHBORS (vecinos) y TOP_N (MinVoters)
+	Explain       int    `json:"explain,omitempty"` // fase TOP_N: aportes a informar por candidata
+
+	Fixed  [][]float64 `json:"fixed,omitempty"`  // fases ALS: factores del otro lado, difundidos en cada iteración
+	Lambda float64     `json:"lambda,omitempty"` // fases ALS
+
+	// fase EVALUATE
+	Mode      CFMode         `json:"mode,omitempty"`
+	Test      *sparse.Matrix `json:"test,omitempty"`      // calificaciones de prueba de las filas [Start, End)
+	TopK      int            `json:"topK,omitempty"`      // largo de las listas evaluadas
+	Relevance float64        `json:"relevance,omitempty"` // calificación mínima relevante (0 = media del usuario)
+	ItemModel [][]Neighbor   `json:"itemModel,omitempty"` // modo item: vecinos de cada película
+
+	DeadlineMs int64 `json:"deadlineMs,omitempty"` // plazo de la solicitud en milisegundos Unix
+}
+
+// Vecino de un usuario (o de una película, en modo item) con su similitud
+// (índice global en la matriz)
+type Neighbor struct {
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Película candidata con su puntaje predicho
+type ScoredItem struct {
+	Index   int            `json:"index"`
+	Score   float64        `json:"score"`
+	Because []Contribution `json:"because,omitempty"` // solo si se pidió Explain, de mayor a menor aporte
+}
+
+// Aporte de un vecino a la predicción de una película (ver
+// compute.Contribution). En modo user Index es un usuario vecino que la
+// calificó; en modo item, una película parecida que calificó el usuario.
+type Contribution struct {
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+	Rating     float64 `json:"rating"` // calificación original
+	Weight     float64 `json:"weight"` // similitud · calificación normalizada
 }
 
 // --- Worker: mensaje enviado por el coordinador ---
@@ -36,13 +317,113 @@ type WorkerTask struct {
 // --- Worker: resultado enviado al coordinador ---
 
 type WorkerResult struct {
-	ChunkID int       `json:"chunkId"`
-	Values  []float64 `json:"values"` // similitud o predicciones
+	ChunkID      int            `json:"chunkId"`
+	Neighbors    []Neighbor     `json:"neighbors,omitempty"`    // fase NEIGHBORS: K mejores vecinos locales
+	Numerators   *sparse.Vector `json:"numerators,omitempty"`   // fase PARTIAL: sum(sim * rating) por película
+	Denominators *sparse.Vector `json:"denominators,omitempty"` // fase PARTIAL: sum(|sim|) por película
+	Voters       *sparse.Vector `json:"voters,omitempty"`       // fase PARTIAL: vecinos que calificaron cada película
+	Items        []ScoredItem   `json:"items,omitempty"`        // fase TOP_N: N mejores candidatas, de mayor a menor
+
+	// fase ITEM_NEIGHBORS: vecinos de cada película Start+i, de mayor a menor
+	ItemNeighbors [][]Neighbor `json:"itemNeighbors,omitempty"`
+
+	// fase SIMILARITY_BLOCK: K vecinos de cada usuario Start+i dentro de las
+	// columnas del bloque y, fuera de la diagonal, a continuación los de cada
+	// usuario ColStart+j dentro de las filas; de mayor a menor
+	BlockNeighbors [][]Neighbor `json:"blockNeighbors,omitempty"`
+
+	// fases ALS: factores de cada fila Start+i y error cuadrático del bloque
+	Factors [][]float64 `json:"factors,omitempty"`
+	Loss    float64     `json:"loss,omitempty"`
+	Count   int         `json:"count,omitempty"`
+
+	Eval *EvalSums `json:"eval,omitempty"` // fase EVALUATE
+}
+
+// --- Registro de workers ---
+
+// Mensaje que un worker envía al coordinador al arrancar
+type WorkerRegistration struct {
+	ID       string `json:"id"`
+	Addr     string `json:"addr"`     // host:puerto donde el worker atiende tareas
+	Capacity int    `json:"capacity"` // chunks que puede procesar en paralelo
+}
+
+// Respuesta del coordinador al registro
+type RegistrationAck struct {
+	HeartbeatIntervalMs int64 `json:"heartbeatIntervalMs"`
+}
+
+// Latido periódico del worker con su carga actual
+type Heartbeat struct {
+	ID       string       `json:"id"`
+	Load     int          `json:"load"` // chunks en proceso en este momento
+	Capacity int          `json:"capacity"`
+	Datasets []DatasetRef `json:"datasets"` // versiones que tiene en memoria
+}
+
+// --- Avances parciales para la API ---
+
+// Avance de una solicitud que pidió Progress; viaja como MsgProgress cada
+// vez que un worker completa un chunk, antes de la respuesta final.
+type Progress struct {
+	Phase   ChunkPhase     `json:"phase"`           // fase del último chunk completado
+	Done    int            `json:"done"`            // chunks completados (todas las fases)
+	Total   int            `json:"total"`           // chunks previstos (puede ajustarse al pasar de fase)
+	Percent float64        `json:"percent"`         // 100·Done/Total
+	Items   []ScoredItem   `json:"items,omitempty"` // top-N combinado con las listas recibidas hasta ahora (fase TOP_N, sin aportes)
+	Workers []WorkerTiming `json:"workers"`         // tiempos por worker hasta ahora
+}
+
+// Tiempos de los chunks que completó un worker en una solicitud
+type WorkerTiming struct {
+	Worker  string `json:"worker"`
+	Chunks  int    `json:"chunks"`
+	TotalMs int64  `json:"totalMs"` // suma de los tiempos de sus chunks
+	MaxMs   int64  `json:"maxMs"`   // el chunk más lento
 }
 
 // --- Respuesta final para la API ---
 
 type CoordinatorResponse struct {
-	Result  []float64 `json:"result"`
-	Indexes []int     `json:"indexes,omitempty"` // para recomendación (top-N ordenado)
+	Result    []float64    `json:"result,omitempty"`    // vector completo (recomendación con N = 0)
+	Neighbors [][]Neighbor `json:"neighbors,omitempty"` // para SIMILARITY: K usuarios más parecidos a cada usuario, de mayor a menor
+	Indexes   []int        `json:"indexes,omitempty"`   // para recomendación (top-N ordenado)
+	Items     []ScoredItem `json:"items,omitempty"`     // para recomendación con N > 0: top-N con puntaje
+	Model     *FactorModel `json:"model,omitempty"`     // para TRAIN_ALS
+	Eval      *EvalReport  `json:"eval,omitempty"`      // para EVALUATE
+	Tune      *Leaderboard `json:"tune,omitempty"`      // para TUNE
+	Job       *JobStatus   `json:"job,omitempty"`       // para solicitudes Async, JOB_STATUS y JOB_CANCEL
+}
+
+// --- Jobs asíncronos ---
+
+// Estado de un job asíncrono
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"    // esperando un lugar para ejecutarse
+	JobRunning   JobState = "running"   // repartido a los workers
+	JobDone      JobState = "done"      // terminó; Result tiene la respuesta
+	JobFailed    JobState = "failed"    // terminó con error (Error)
+	JobCancelled JobState = "cancelled" // cancelado con JOB_CANCEL
+)
+
+// Terminal indica si el job ya no va a cambiar de estado.
+func (s JobState) Terminal() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// Estado de un job que el coordinador ejecuta en segundo plano. Result solo
+// viaja en JOB_STATUS de un job terminado.
+type JobStatus struct {
+	ID         string               `json:"id"`
+	Type       RequestType          `json:"type"`
+	State      JobState             `json:"state"`
+	Progress   *Progress            `json:"progress,omitempty"` // último avance recibido
+	Result     *CoordinatorResponse `json:"result,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	CreatedMs  int64                `json:"createdMs"`            // milisegundos Unix
+	StartedMs  int64                `json:"startedMs,omitempty"`  // 0 = todavía en cola
+	FinishedMs int64                `json:"finishedMs,omitempty"` // 0 = sin terminar
 }
@@ -0,0 +1,322 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrClosed indica que la conexión se cerró antes de recibir la respuesta.
+var ErrClosed = errors.New("conexión cerrada")
+
+// Client es una conexión persistente que permite varias solicitudes en vuelo.
+// Las escrituras se serializan con un mutex y una goroutine lectora entrega
+// cada respuesta a quien la espera según su requestID.
+type Client struct {
+	conn net.Conn
+	wmu  sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]*pendingCall
+	nextID  uint64
+	err     error // primer error de la conexión; si no es nil el cliente está cerrado
+}
+
+// pendingCall es una solicitud que espera su respuesta; progress recibe los
+// MsgProgress que lleguen antes (nil = se descartan).
+type pendingCall struct {
+	ch       chan Frame
+	progress func(Frame)
+}
+
+// Dial abre una conexión persistente con addr.
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(conn), nil
+}
+
+// newClient arranca la goroutine lectora sobre una conexión ya abierta.
+func newClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		pending: make(map[uint64]*pendingCall),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Call envía req con el tipo indicado y espera la respuesta, que se
+// deserializa en resp (puede ser nil si no interesa el contenido).
+func (c *Client) Call(t MessageType, req, resp any) error {
+	return c.CallContext(context.Background(), t, req, resp)
+}
+
+// CallContext es como Call pero deja de esperar la respuesta cuando ctx se
+// cancela y avisa al otro extremo con MsgCancel para que deje de trabajar;
+// la conexión sigue abierta y una respuesta tardía se descarta.
+func (c *Client) CallContext(ctx context.Context, t MessageType, req, resp any) error {
+	return c.CallStream(ctx, t, req, resp, nil)
+}
+
+// CallStream es como CallContext pero entrega a onProgress cada MsgProgress
+// que llegue antes de la respuesta. onProgress corre en la goroutine lectora
+// de la conexión, así que no debe bloquear.
+func (c *Client) CallStream(ctx context.Context, t MessageType, req, resp any, onProgress func(Frame)) error {
+	ch, id, err := c.register(onProgress)
+	if err != nil {
+		return err
+	}
+
+	f, err := NewFrame(t, id, req)
+	if err != nil {
+		c.unregister(id)
+		return err
+	}
+
+	c.wmu.Lock()
+	err = writeConn(c.conn, f)
+	c.wmu.Unlock()
+	if err != nil {
+		c.unregister(id)
+		c.fail(err)
+		return err
+	}
+
+	var out Frame
+	var ok bool
+	select {
+	case out, ok = <-ch:
+		if !ok {
+			return c.closeErr()
+		}
+	case <-ctx.Done():
+		c.unregister(id)
+		c.cancelRemote(id)
+		return ctx.Err()
+	}
+
+	switch out.Type {
+	case MsgResult:
+		if resp == nil {
+			return nil
+		}
+		if err := out.Decode(resp); err != nil {
+			return fmt.Errorf("error parseando respuesta: %w", err)
+		}
+		return nil
+	case MsgError:
+		var p errorPayload
+		if err := out.Decode(&p); err != nil {
+			return fmt.Errorf("error parseando mensaje de error: %w", err)
+		}
+		return &RemoteError{Code: p.Code, Message: p.Error}
+	default:
+		return fmt.Errorf("tipo de respuesta inesperado: %s", out.Type)
+	}
+}
+
+// cancelRemote envía MsgCancel para la solicitud id (mejor esfuerzo).
+func (c *Client) cancelRemote(id uint64) {
+	c.wmu.Lock()
+	err := writeConn(c.conn, Frame{Type: MsgCancel, RequestID: id})
+	c.wmu.Unlock()
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+// LocalAddr devuelve la dirección local de la conexión.
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Closed indica si la conexión ya no puede usarse.
+func (c *Client) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// Close cierra la conexión y despierta a todas las solicitudes pendientes.
+func (c *Client) Close() error {
+	c.fail(ErrClosed)
+	return nil
+}
+
+func (c *Client) register(onProgress func(Frame)) (chan Frame, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, 0, c.err
+	}
+
+	c.nextID++
+	ch := make(chan Frame, 1)
+	c.pending[c.nextID] = &pendingCall{ch: ch, progress: onProgress}
+	return ch, c.nextID, nil
+}
+
+func (c *Client) unregister(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// fail marca la conexión como rota y cierra los canales pendientes.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	for id, p := range c.pending {
+		close(p.ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) readLoop() {
+	reader := bufio.NewReader(c.conn)
+	for {
+		f, err := ReadFrame(reader)
+		if err != nil {
+			c.fail(fmt.Errorf("%w: %v", ErrClosed, err))
+			return
+		}
+
+		c.mu.Lock()
+		p, ok := c.pending[f.RequestID]
+		if f.Type != MsgProgress {
+			delete(c.pending, f.RequestID)
+		}
+		c.mu.Unlock()
+
+		switch {
+		case !ok:
+		case f.Type == MsgProgress:
+			if p.progress != nil {
+				p.progress(f)
+			}
+		default:
+			p.ch <- f
+		}
+	}
+}
+
+// Pool mantiene hasta Size conexiones persistentes con un mismo destino y
+// reparte las solicitudes entre ellas en round-robin. Las conexiones rotas
+// se reemplazan al vuelo en la siguiente solicitud.
+type Pool struct {
+	Addr        string
+	Size        int
+	DialTimeout time.Duration
+
+	mu      sync.Mutex
+	clients []*Client
+	next    int
+}
+
+func NewPool(addr string, size int, dialTimeout time.Duration) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		Addr:        addr,
+		Size:        size,
+		DialTimeout: dialTimeout,
+		clients:     make([]*Client, size),
+	}
+}
+
+// Call envía la solicitud por una de las conexiones del pool. Si la conexión
+// elegida estaba rota se reintenta una vez con una conexión nueva; los errores
+// remotos (RemoteError) no se reintentan.
+func (p *Pool) Call(t MessageType, req, resp any) error {
+	return p.CallContext(context.Background(), t, req, resp)
+}
+
+// CallContext es como Call pero respeta la cancelación de ctx.
+func (p *Pool) CallContext(ctx context.Context, t MessageType, req, resp any) error {
+	return p.CallStream(ctx, t, req, resp, nil)
+}
+
+// CallStream es como CallContext pero entrega los avances parciales a
+// onProgress (ver Client.CallStream). Si se reintenta con otra conexión,
+// onProgress puede volver a recibir avances desde el principio.
+func (p *Pool) CallStream(ctx context.Context, t MessageType, req, resp any, onProgress func(Frame)) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var c *Client
+		c, err = p.get()
+		if err != nil {
+			return err
+		}
+
+		err = c.CallStream(ctx, t, req, resp, onProgress)
+		var remote *RemoteError
+		if err == nil || errors.As(err, &remote) || ctx.Err() != nil || !c.Closed() {
+			return err
+		}
+	}
+	return err
+}
+
+// Close cierra todas las conexiones del pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, c := range p.clients {
+		if c != nil {
+			c.Close()
+			p.clients[i] = nil
+		}
+	}
+}
+
+// get devuelve la conexión del próximo lugar del pool, abriéndola si falta o
+// está rota. La conexión se abre sin tomar p.mu, así una caída del destino
+// no frena a las solicitudes que usan los otros lugares.
+func (p *Pool) get() (*Client, error) {
+	p.mu.Lock()
+	i := p.next
+	p.next = (p.next + 1) % p.Size
+	if c := p.clients[i]; c != nil && !c.Closed() {
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	c, err := Dial(p.Addr, p.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo conectar a %s: %w", p.Addr, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cur := p.clients[i]; cur != nil && !cur.Closed() {
+		// otra solicitud ocupó el lugar mientras se conectaba
+		c.Close()
+		return cur, nil
+	}
+	p.clients[i] = c
+	return c, nil
+}
@@ -0,0 +1,292 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serve atiende h en un puerto local y devuelve su dirección.
+func serve(t *testing.T, h Handler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no se pudo escuchar: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go Serve(ln, h)
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+	c, err := Dial(addr, time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []Frame{
+		{Type: MsgTask, RequestID: 7, Payload: []byte(`{"a":1}`)},
+		{Type: MsgCancel, RequestID: 1 << 40},
+	}
+	for _, f := range sent {
+		if err := WriteFrame(&buf, f); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if buf.Len() != 2*headerSize+7 {
+		t.Fatalf("se escribieron %d bytes, se esperaba %d", buf.Len(), 2*headerSize+7)
+	}
+
+	for _, want := range sent {
+		got, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if got.Type != want.Type || got.RequestID != want.RequestID || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("ReadFrame = %s/%d/%q, se esperaba %s/%d/%q",
+				got.Type, got.RequestID, got.Payload, want.Type, want.RequestID, want.Payload)
+		}
+	}
+
+	// una cabecera que anuncia más de MaxPayload se rechaza sin reservar memoria
+	bad := []byte{0xff, 0xff, 0xff, 0xff, byte(MsgTask), 0, 0, 0, 0, 0, 0, 0, 1}
+	if _, err := ReadFrame(bytes.NewReader(bad)); err == nil {
+		t.Error("se esperaba error por payload demasiado grande")
+	}
+}
+
+func TestClientMultiplexing(t *testing.T) {
+	const calls = 5
+
+	// el servidor no responde hasta tener todas las solicitudes en vuelo, así
+	// que el test solo termina si comparten la conexión de verdad en paralelo
+	var arrived sync.WaitGroup
+	arrived.Add(calls)
+	addr := serve(t, func(ctx context.Context, req Frame) (any, error) {
+		var n int
+		if err := req.Decode(&n); err != nil {
+			return nil, err
+		}
+		arrived.Done()
+		arrived.Wait()
+		// responde en orden inverso al de llegada
+		time.Sleep(time.Duration(calls-n) * 5 * time.Millisecond)
+		return n * 10, nil
+	})
+	c := dial(t, addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	got := make([]int, calls)
+	errs := make([]error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.CallContext(ctx, MsgTask, i, &got[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < calls; i++ {
+		if errs[i] != nil {
+			t.Fatalf("solicitud %d: %v", i, errs[i])
+		}
+		if got[i] != i*10 {
+			t.Errorf("solicitud %d recibió %d, se esperaba %d", i, got[i], i*10)
+		}
+	}
+}
+
+func TestRemoteErrorKeepsConnection(t *testing.T) {
+	addr := serve(t, func(ctx context.Context, req Frame) (any, error) {
+		var fail bool
+		req.Decode(&fail)
+		if fail {
+			return nil, &RemoteError{Code: CodeDatasetMissing, Message: "falta el dataset"}
+		}
+		return "ok", nil
+	})
+	c := dial(t, addr)
+
+	err := c.Call(MsgTask, true, nil)
+	if !IsCode(err, CodeDatasetMissing) {
+		t.Fatalf("Call = %v, se esperaba un RemoteError %s", err, CodeDatasetMissing)
+	}
+	if err.Error() != "falta el dataset" {
+		t.Errorf("mensaje = %q, se esperaba %q", err.Error(), "falta el dataset")
+	}
+
+	var out string
+	if err := c.Call(MsgTask, false, &out); err != nil || out != "ok" {
+		t.Errorf("después del error remoto Call = %q, %v; se esperaba la conexión sana", out, err)
+	}
+}
+
+func TestCallContextCancel(t *testing.T) {
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	addr := serve(t, func(ctx context.Context, req Frame) (any, error) {
+		var wait bool
+		req.Decode(&wait)
+		if !wait {
+			return "rápida", nil
+		}
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	c := dial(t, addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.CallContext(ctx, MsgTask, true, nil) }()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("CallContext = %v, se esperaba context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CallContext no volvió al cancelar el contexto")
+	}
+
+	// el MsgCancel tiene que llegar al handler remoto
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("el handler terminó con %v, se esperaba context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("el handler remoto no se enteró de la cancelación")
+	}
+
+	// la respuesta tardía se descarta y la conexión sigue en uso
+	var out string
+	if err := c.Call(MsgTask, false, &out); err != nil || out != "rápida" {
+		t.Errorf("Call después de cancelar = %q, %v", out, err)
+	}
+}
+
+func TestCallStreamProgress(t *testing.T) {
+	addr := serve(t, func(ctx context.Context, req Frame) (any, error) {
+		for i := 1; i <= 3; i++ {
+			if err := Progress(ctx, i); err != nil {
+				return nil, err
+			}
+		}
+		return "listo", nil
+	})
+	c := dial(t, addr)
+
+	var steps []int
+	var out string
+	err := c.CallStream(context.Background(), MsgTask, nil, &out, func(f Frame) {
+		var n int
+		f.Decode(&n)
+		steps = append(steps, n)
+	})
+	if err != nil {
+		t.Fatalf("CallStream: %v", err)
+	}
+	if out != "listo" {
+		t.Errorf("resultado = %q, se esperaba %q", out, "listo")
+	}
+	// los avances se entregan en orden y antes de la respuesta
+	if len(steps) != 3 || steps[0] != 1 || steps[2] != 3 {
+		t.Errorf("avances = %v, se esperaba [1 2 3]", steps)
+	}
+}
+
+func TestPoolRedialsBrokenConnection(t *testing.T) {
+	// listener propio para poder cortar las conexiones del lado del servidor
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no se pudo escuchar: %v", err)
+	}
+	defer ln.Close()
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go ServeConn(conn, func(ctx context.Context, req Frame) (any, error) {
+				return "pong", nil
+			})
+		}
+	}()
+
+	p := NewPool(ln.Addr().String(), 1, time.Second)
+	defer p.Close()
+
+	var out string
+	if err := p.Call(MsgTask, nil, &out); err != nil || out != "pong" {
+		t.Fatalf("primer Call = %q, %v", out, err)
+	}
+
+	mu.Lock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	mu.Unlock()
+
+	out = ""
+	if err := p.Call(MsgTask, nil, &out); err != nil || out != "pong" {
+		t.Fatalf("Call con la conexión cortada = %q, %v; se esperaba que el pool reconecte", out, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(conns) != 2 {
+		t.Errorf("el servidor recibió %d conexiones, se esperaban 2", len(conns))
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	old := WriteTimeout
+	WriteTimeout = 50 * time.Millisecond
+	defer func() { WriteTimeout = old }()
+
+	// nadie lee del otro extremo del pipe, así que la escritura no avanza
+	local, remote := net.Pipe()
+	defer remote.Close()
+	c := newClient(local)
+	defer c.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Call(MsgTask, "hola", nil) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("se esperaba un error por el plazo de escritura")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("la escritura quedó bloqueada sin plazo")
+	}
+	if !c.Closed() {
+		t.Error("se esperaba la conexión cerrada después de una escritura fallida")
+	}
+}
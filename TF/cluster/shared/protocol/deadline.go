@@ -0,0 +1,25 @@
+package protocol
+
+import (
+	"context"
+	"time"
+)
+
+// Los plazos viajan en los mensajes como milisegundos Unix (0 = sin plazo),
+// así cada nodo puede dejar de trabajar aunque no le llegue el MsgCancel.
+
+// DeadlineMs devuelve el plazo de ctx en milisegundos Unix, o 0 si no tiene.
+func DeadlineMs(ctx context.Context) int64 {
+	if d, ok := ctx.Deadline(); ok {
+		return d.UnixMilli()
+	}
+	return 0
+}
+
+// WithDeadlineMs aplica a ctx el plazo recibido en un mensaje, si lo hay.
+func WithDeadlineMs(ctx context.Context, ms int64) (context.Context, context.CancelFunc) {
+	if ms <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, time.UnixMilli(ms))
+}
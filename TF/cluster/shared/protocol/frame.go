@@ -0,0 +1,180 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Formato de cada mensaje en el cable:
+//
+//	| longitud (4 bytes) | tipo (1 byte) | requestID (8 bytes) | payload JSON |
+//
+// La longitud solo cuenta los bytes del payload. Todos los enteros van en
+// big endian. El requestID permite tener varias solicitudes en vuelo sobre
+// la misma conexión TCP y emparejar cada respuesta con su solicitud.
+const headerSize = 4 + 1 + 8
+
+// MaxPayload limita el tamaño de un mensaje para no reservar memoria sin control
+// si llega una cabecera corrupta.
+const MaxPayload = 1 << 30
+
+// Tipo de mensaje transportado en el frame.
+type MessageType uint8
+
+const (
+	MsgTask   MessageType = 1 // solicitud de trabajo (TaskMessage o WorkerTask)
+	MsgResult MessageType = 2 // respuesta exitosa
+	MsgError  MessageType = 3 // respuesta con error
+
+	MsgRegister  MessageType = 4  // worker -> coordinador: WorkerRegistration
+	MsgHeartbeat MessageType = 5  // worker -> coordinador: Heartbeat
+	MsgDataset   MessageType = 6  // API -> coordinador -> workers: Dataset versionado
+	MsgCancel    MessageType = 7  // cancela la solicitud con el mismo requestID (sin respuesta)
+	MsgProgress  MessageType = 8  // avance parcial de una solicitud en curso (cero o más, antes de MsgResult o MsgError)
+	MsgPatch     MessageType = 9  // API -> coordinador -> workers: DatasetPatch sobre una versión que ya tienen
+	MsgForget    MessageType = 10 // API -> coordinador -> workers: DatasetRef de una versión que ya nadie usa
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgTask:
+		return "TASK"
+	case MsgResult:
+		return "RESULT"
+	case MsgError:
+		return "ERROR"
+	case MsgRegister:
+		return "REGISTER"
+	case MsgHeartbeat:
+		return "HEARTBEAT"
+	case MsgDataset:
+		return "DATASET"
+	case MsgCancel:
+		return "CANCEL"
+	case MsgProgress:
+		return "PROGRESS"
+	case MsgPatch:
+		return "PATCH"
+	case MsgForget:
+		return "FORGET"
+	default:
+		return fmt.Sprintf("TYPE(%d)", uint8(t))
+	}
+}
+
+// Frame es un mensaje completo leído o escrito en la conexión.
+type Frame struct {
+	Type      MessageType
+	RequestID uint64
+	Payload   []byte
+}
+
+// Decode deserializa el payload JSON del frame en v.
+func (f Frame) Decode(v any) error {
+	return json.Unmarshal(f.Payload, v)
+}
+
+// NewFrame serializa v como JSON y arma el frame.
+func NewFrame(t MessageType, id uint64, v any) (Frame, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Frame{}, fmt.Errorf("error serializando mensaje %s: %w", t, err)
+	}
+	return Frame{Type: t, RequestID: id, Payload: payload}, nil
+}
+
+// WriteFrame escribe la cabecera y el payload del frame en w.
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Payload) > MaxPayload {
+		return fmt.Errorf("mensaje demasiado grande: %d bytes", len(f.Payload))
+	}
+
+	buf := make([]byte, headerSize+len(f.Payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(f.Payload)))
+	buf[4] = byte(f.Type)
+	binary.BigEndian.PutUint64(buf[5:13], f.RequestID)
+	copy(buf[headerSize:], f.Payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteTimeout es el plazo para escribir un frame completo en una conexión.
+// Si el otro extremo deja de leer, la escritura falla en vez de retener para
+// siempre el mutex de escritura (y con él los MsgCancel y las demás
+// solicitudes de la conexión). 0 = sin plazo.
+var WriteTimeout = 30 * time.Second
+
+// writeConn escribe f en conn con el plazo WriteTimeout. Si falla, el frame
+// pudo quedar escrito a medias y la conexión ya no sirve.
+func writeConn(conn net.Conn, f Frame) error {
+	if WriteTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(WriteTimeout)); err != nil {
+			return err
+		}
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	return WriteFrame(conn, f)
+}
+
+// ReadFrame lee un frame completo desde r.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > MaxPayload {
+		return Frame{}, fmt.Errorf("mensaje demasiado grande: %d bytes", size)
+	}
+
+	f := Frame{
+		Type:      MessageType(header[4]),
+		RequestID: binary.BigEndian.Uint64(header[5:13]),
+		Payload:   make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return Frame{}, err
+	}
+
+	return f, nil
+}
+
+// Códigos de error conocidos que viajan en un MsgError
+const (
+	// El destinatario no tiene la versión del dataset que referencia la tarea
+	CodeDatasetMissing = "DATASET_MISSING"
+	// El coordinador no conoce el job pedido (terminó hace más de la
+	// retención o el coordinador se reinició)
+	CodeJobNotFound = "JOB_NOT_FOUND"
+)
+
+// Payload de un mensaje MsgError.
+type errorPayload struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// RemoteError es un error reportado por el otro extremo de la conexión
+// (la conexión sigue sana, fue la tarea la que falló). Code permite
+// reaccionar a errores conocidos sin comparar mensajes.
+type RemoteError struct {
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// IsCode indica si err es (o envuelve) un RemoteError con el código dado.
+func IsCode(err error, code string) bool {
+	var re *RemoteError
+	return errors.As(err, &re) && re.Code == code
+}
@@ -0,0 +1,149 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Handler procesa una solicitud y devuelve el valor que se enviará como
+// MsgResult, o un error que se enviará como MsgError. ctx se cancela si el
+// cliente envía MsgCancel para esa solicitud o si se cierra la conexión.
+// Mientras procesa puede enviar avances parciales con Progress(ctx, v).
+type Handler func(ctx context.Context, req Frame) (any, error)
+
+type progressKey struct{}
+
+// WithProgress devuelve un ctx cuyos avances (ver Progress) se entregan a
+// send. ServeConn lo usa para enviarlos como MsgProgress; quien procesa una
+// tarea fuera de una conexión puede usarlo para guardarlos.
+func WithProgress(ctx context.Context, send func(any) error) context.Context {
+	return context.WithValue(ctx, progressKey{}, send)
+}
+
+// Progress envía v como MsgProgress de la solicitud que atiende ctx. Solo
+// puede llamarse mientras el Handler no retornó; fuera de ServeConn (o de
+// WithProgress) no hace nada.
+func Progress(ctx context.Context, v any) error {
+	send, ok := ctx.Value(progressKey{}).(func(any) error)
+	if !ok {
+		return nil
+	}
+	return send(v)
+}
+
+// Serve acepta conexiones persistentes en ln y atiende cada una en su goroutine.
+func Serve(ln net.Listener, h Handler) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("error aceptando conexión: %v", err)
+			continue
+		}
+
+		go ServeConn(conn, h)
+	}
+}
+
+// ServeConn lee frames de la conexión hasta que el otro extremo la cierre.
+// Cada solicitud se procesa en su propia goroutine, de modo que varias
+// solicitudes pueden estar en vuelo a la vez sobre la misma conexión.
+// Un MsgCancel cancela el contexto de la solicitud con ese requestID; al
+// cerrarse la conexión se cancelan todas las que sigan en vuelo.
+func ServeConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+
+	connCtx, cancelAll := context.WithCancel(context.Background())
+	defer cancelAll()
+
+	reader := bufio.NewReader(conn)
+	var wmu sync.Mutex // las respuestas se escriben de a una
+
+	var mu sync.Mutex
+	inflight := make(map[uint64]context.CancelFunc)
+
+	for {
+		req, err := ReadFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("error leyendo frame de %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if req.Type == MsgCancel {
+			mu.Lock()
+			if cancel, ok := inflight[req.RequestID]; ok {
+				cancel()
+			}
+			mu.Unlock()
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(connCtx)
+		id := req.RequestID
+		ctx = WithProgress(ctx, func(v any) error {
+			f, err := NewFrame(MsgProgress, id, v)
+			if err != nil {
+				return err
+			}
+			wmu.Lock()
+			defer wmu.Unlock()
+			if err := writeConn(conn, f); err != nil {
+				conn.Close()
+				return err
+			}
+			return nil
+		})
+		mu.Lock()
+		inflight[req.RequestID] = cancel
+		mu.Unlock()
+
+		go func(req Frame) {
+			resp := handle(ctx, h, req)
+
+			mu.Lock()
+			delete(inflight, req.RequestID)
+			mu.Unlock()
+			cancel()
+
+			wmu.Lock()
+			defer wmu.Unlock()
+			if err := writeConn(conn, resp); err != nil {
+				// un frame a medias deja la conexión inservible; al cerrarla
+				// el cliente falla todas sus solicitudes en vez de esperarlas
+				log.Printf("error enviando respuesta a %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+			}
+		}(req)
+	}
+}
+
+// handle ejecuta el handler y arma el frame de respuesta con el mismo requestID.
+func handle(ctx context.Context, h Handler, req Frame) Frame {
+	out, err := h(ctx, req)
+	if err == nil {
+		var resp Frame
+		resp, err = NewFrame(MsgResult, req.RequestID, out)
+		if err == nil {
+			return resp
+		}
+	}
+
+	p := errorPayload{Error: err.Error()}
+	var re *RemoteError
+	if errors.As(err, &re) {
+		p.Code = re.Code
+	}
+
+	// errorPayload siempre es serializable
+	resp, _ := NewFrame(MsgError, req.RequestID, p)
+	return resp
+}
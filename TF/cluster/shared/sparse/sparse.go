@@ -0,0 +1,369 @@
+// Package sparse implementa la matriz usuario–película en formato CSR
+// (filas comprimidas): solo se guardan las calificaciones distintas de cero,
+// tanto en memoria como en los mensajes entre la API, el coordinador y los
+// workers.
+package sparse
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Vector es una fila dispersa: índices de columna crecientes con sus valores.
+// Las columnas ausentes valen 0.
+type Vector struct {
+	Dim int       `json:"dim"`
+	Idx []int     `json:"idx"`
+	Val []float64 `json:"val"`
+}
+
+// FromDenseVector conserva solo los valores distintos de cero.
+func FromDenseVector(v []float64) Vector {
+	out := Vector{Dim: len(v)}
+	for j, x := range v {
+		if x != 0 {
+			out.Idx = append(out.Idx, j)
+			out.Val = append(out.Val, x)
+		}
+	}
+	return out
+}
+
+// NNZ es la cantidad de valores distintos de cero.
+func (v Vector) NNZ() int { return len(v.Idx) }
+
+// Get devuelve el valor de la columna j (búsqueda binaria).
+func (v Vector) Get(j int) float64 {
+	if k, ok := v.Find(j); ok {
+		return v.Val[k]
+	}
+	return 0
+}
+
+// Find devuelve la posición de la columna j en Idx; ok es falso si la
+// columna no tiene valor (distingue un valor guardado que vale 0 de uno
+// ausente).
+func (v Vector) Find(j int) (k int, ok bool) {
+	k = sort.SearchInts(v.Idx, j)
+	return k, k < len(v.Idx) && v.Idx[k] == j
+}
+
+// Dense expande el vector a Dim posiciones.
+func (v Vector) Dense() []float64 {
+	out := make([]float64, v.Dim)
+	for k, j := range v.Idx {
+		out[j] = v.Val[k]
+	}
+	return out
+}
+
+// Norm es la norma euclidiana.
+func (v Vector) Norm() float64 {
+	var s float64
+	for _, x := range v.Val {
+		s += x * x
+	}
+	return math.Sqrt(s)
+}
+
+// Mean es la media de los valores distintos de cero.
+func (v Vector) Mean() float64 {
+	if len(v.Val) == 0 {
+		return 0
+	}
+	var s float64
+	for _, x := range v.Val {
+		s += x
+	}
+	return s / float64(len(v.Val))
+}
+
+// Dot es el producto punto recorriendo solo las columnas no nulas de ambos.
+func Dot(u, v Vector) float64 {
+	var s float64
+	i, j := 0, 0
+	for i < len(u.Idx) && j < len(v.Idx) {
+		switch {
+		case u.Idx[i] < v.Idx[j]:
+			i++
+		case u.Idx[i] > v.Idx[j]:
+			j++
+		default:
+			s += u.Val[i] * v.Val[j]
+			i++
+			j++
+		}
+	}
+	return s
+}
+
+// Intersect llama a fn con cada columna presente en ambos vectores.
+func Intersect(u, v Vector, fn func(col int, a, b float64)) {
+	i, j := 0, 0
+	for i < len(u.Idx) && j < len(v.Idx) {
+		switch {
+		case u.Idx[i] < v.Idx[j]:
+			i++
+		case u.Idx[i] > v.Idx[j]:
+			j++
+		default:
+			fn(u.Idx[i], u.Val[i], v.Val[j])
+			i++
+			j++
+		}
+	}
+}
+
+// Matrix es una matriz dispersa en formato CSR: los valores de la fila i
+// son Values[RowPtr[i]:RowPtr[i+1]], en las columnas ColIdx del mismo rango
+// (crecientes dentro de cada fila).
+type Matrix struct {
+	Rows   int       `json:"rows"`
+	Cols   int       `json:"cols"`
+	RowPtr []int     `json:"rowPtr"`
+	ColIdx []int     `json:"colIdx"`
+	Values []float64 `json:"values"`
+}
+
+// FromDense convierte una matriz densa (todas las filas del mismo largo).
+func FromDense(dense [][]float64) *Matrix {
+	cols := 0
+	if len(dense) > 0 {
+		cols = len(dense[0])
+	}
+
+	b := NewBuilder(cols)
+	for _, row := range dense {
+		for j, x := range row {
+			b.Add(j, x)
+		}
+		b.EndRow()
+	}
+	return b.Build()
+}
+
+// NNZ es la cantidad de calificaciones guardadas.
+func (m *Matrix) NNZ() int { return len(m.Values) }
+
+// Row devuelve la fila i como vector disperso (comparte memoria con m).
+func (m *Matrix) Row(i int) Vector {
+	a, b := m.RowPtr[i], m.RowPtr[i+1]
+	return Vector{Dim: m.Cols, Idx: m.ColIdx[a:b], Val: m.Values[a:b]}
+}
+
+// RowRange devuelve las filas [start, end) como otra matriz (copia la
+// estructura, comparte los valores).
+func (m *Matrix) RowRange(start, end int) *Matrix {
+	a, b := m.RowPtr[start], m.RowPtr[end]
+	out := &Matrix{
+		Rows:   end - start,
+		Cols:   m.Cols,
+		RowPtr: make([]int, end-start+1),
+		ColIdx: m.ColIdx[a:b],
+		Values: m.Values[a:b],
+	}
+	for i := range out.RowPtr {
+		out.RowPtr[i] = m.RowPtr[start+i] - a
+	}
+	return out
+}
+
+// Get devuelve el valor (i, j).
+func (m *Matrix) Get(i, j int) float64 {
+	return m.Row(i).Get(j)
+}
+
+// Dense expande la matriz (solo para pruebas o matrices chicas).
+func (m *Matrix) Dense() [][]float64 {
+	out := make([][]float64, m.Rows)
+	for i := range out {
+		out[i] = m.Row(i).Dense()
+	}
+	return out
+}
+
+// Transpose devuelve la matriz traspuesta, también en CSR (por ejemplo, la
+// matriz película–usuario a partir de la usuario–película).
+func (m *Matrix) Transpose() *Matrix {
+	t := &Matrix{
+		Rows:   m.Cols,
+		Cols:   m.Rows,
+		RowPtr: make([]int, m.Cols+1),
+		ColIdx: make([]int, len(m.ColIdx)),
+		Values: make([]float64, len(m.Values)),
+	}
+
+	// contar valores por columna y acumular
+	for _, j := range m.ColIdx {
+		t.RowPtr[j+1]++
+	}
+	for j := 0; j < m.Cols; j++ {
+		t.RowPtr[j+1] += t.RowPtr[j]
+	}
+
+	// recorrer las filas en orden deja los índices de cada fila de t crecientes
+	next := make([]int, m.Cols)
+	copy(next, t.RowPtr[:m.Cols])
+	for i := 0; i < m.Rows; i++ {
+		for k := m.RowPtr[i]; k < m.RowPtr[i+1]; k++ {
+			j := m.ColIdx[k]
+			t.ColIdx[next[j]] = i
+			t.Values[next[j]] = m.Values[k]
+			next[j]++
+		}
+	}
+
+	return t
+}
+
+// Validate comprueba que la estructura sea consistente (útil al recibir
+// una matriz por la red).
+func (m *Matrix) Validate() error {
+	if m.Rows < 0 || m.Cols < 0 {
+		return fmt.Errorf("dimensiones inválidas: %dx%d", m.Rows, m.Cols)
+	}
+	if len(m.RowPtr) != m.Rows+1 {
+		return fmt.Errorf("rowPtr tiene %d elementos, se esperaban %d", len(m.RowPtr), m.Rows+1)
+	}
+	if len(m.ColIdx) != len(m.Values) {
+		return fmt.Errorf("colIdx (%d) y values (%d) de distinto largo", len(m.ColIdx), len(m.Values))
+	}
+	if m.RowPtr[0] != 0 || m.RowPtr[m.Rows] != len(m.Values) {
+		return fmt.Errorf("rowPtr no cubre los %d valores", len(m.Values))
+	}
+	for i := 0; i < m.Rows; i++ {
+		a, b := m.RowPtr[i], m.RowPtr[i+1]
+		if a > b {
+			return fmt.Errorf("rowPtr decreciente en la fila %d", i)
+		}
+		for k := a; k < b; k++ {
+			j := m.ColIdx[k]
+			if j < 0 || j >= m.Cols || (k > a && j <= m.ColIdx[k-1]) {
+				return fmt.Errorf("columna %d inválida o desordenada en la fila %d", j, i)
+			}
+		}
+	}
+	return nil
+}
+
+// Builder arma una matriz CSR fila por fila.
+type Builder struct {
+	m   *Matrix
+	row []entry
+}
+
+type entry struct {
+	col int
+	val float64
+}
+
+// NewBuilder crea un Builder para filas de cols columnas.
+func NewBuilder(cols int) *Builder {
+	return &Builder{m: &Matrix{Cols: cols, RowPtr: []int{0}}}
+}
+
+// Add agrega el valor (fila actual, col); los ceros se ignoran.
+func (b *Builder) Add(col int, val float64) {
+	if val != 0 {
+		b.row = append(b.row, entry{col, val})
+	}
+}
+
+// EndRow cierra la fila actual (ordena sus columnas; si una columna se
+// repite, queda el último valor).
+func (b *Builder) EndRow() {
+	sort.SliceStable(b.row, func(i, j int) bool { return b.row[i].col < b.row[j].col })
+	for k, e := range b.row {
+		if k+1 < len(b.row) && b.row[k+1].col == e.col {
+			continue
+		}
+		b.m.ColIdx = append(b.m.ColIdx, e.col)
+		b.m.Values = append(b.m.Values, e.val)
+	}
+	b.row = b.row[:0]
+	b.m.Rows++
+	b.m.RowPtr = append(b.m.RowPtr, len(b.m.Values))
+}
+
+// Build devuelve la matriz armada.
+func (b *Builder) Build() *Matrix {
+	return b.m
+}
+
+// Cell es un cambio puntual de la matriz: el valor nuevo de (Row, Col);
+// Val 0 borra la calificación.
+type Cell struct {
+	Row int     `json:"row"`
+	Col int     `json:"col"`
+	Val float64 `json:"val"`
+}
+
+// Apply devuelve una copia de m de rows×cols (al menos las dimensiones de
+// m: las filas y columnas nuevas empiezan vacías) con los cambios de cells
+// aplicados en orden. m no se modifica, así que quien la esté leyendo puede
+// seguir haciéndolo.
+func (m *Matrix) Apply(rows, cols int, cells []Cell) (*Matrix, error) {
+	if rows < m.Rows || cols < m.Cols {
+		return nil, fmt.Errorf("la matriz no puede achicarse de %dx%d a %dx%d", m.Rows, m.Cols, rows, cols)
+	}
+
+	// cambios por fila, el último gana
+	changes := make(map[int]map[int]float64)
+	for _, c := range cells {
+		if c.Row < 0 || c.Row >= rows || c.Col < 0 || c.Col >= cols {
+			return nil, fmt.Errorf("celda (%d, %d) fuera de la matriz de %dx%d", c.Row, c.Col, rows, cols)
+		}
+		if changes[c.Row] == nil {
+			changes[c.Row] = make(map[int]float64)
+		}
+		changes[c.Row][c.Col] = c.Val
+	}
+
+	out := &Matrix{
+		Rows:   rows,
+		Cols:   cols,
+		RowPtr: make([]int, 1, rows+1),
+		ColIdx: make([]int, 0, len(m.ColIdx)+len(cells)),
+		Values: make([]float64, 0, len(m.Values)+len(cells)),
+	}
+	for i := 0; i < rows; i++ {
+		var row Vector
+		if i < m.Rows {
+			row = m.Row(i)
+		}
+		if ch, ok := changes[i]; ok {
+			row = row.with(ch)
+		}
+		out.ColIdx = append(out.ColIdx, row.Idx...)
+		out.Values = append(out.Values, row.Val...)
+		out.RowPtr = append(out.RowPtr, len(out.Values))
+	}
+	return out, nil
+}
+
+// with devuelve una copia del vector con los valores de changes (0 = quitar).
+func (v Vector) with(changes map[int]float64) Vector {
+	vals := make(map[int]float64, len(v.Idx)+len(changes))
+	for k, j := range v.Idx {
+		vals[j] = v.Val[k]
+	}
+	for j, x := range changes {
+		if x == 0 {
+			delete(vals, j)
+		} else {
+			vals[j] = x
+		}
+	}
+
+	out := Vector{Dim: v.Dim, Idx: make([]int, 0, len(vals))}
+	for j := range vals {
+		out.Idx = append(out.Idx, j)
+	}
+	sort.Ints(out.Idx)
+	out.Val = make([]float64, len(out.Idx))
+	for k, j := range out.Idx {
+		out.Val[k] = vals[j]
+	}
+	return out
+}
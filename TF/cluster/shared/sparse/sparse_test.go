@@ -0,0 +1,187 @@
+package sparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(4)
+	// columnas desordenadas, un cero y una columna repetida
+	b.Add(3, 0.4)
+	b.Add(0, 0.1)
+	b.Add(2, 0)
+	b.Add(3, 0.9)
+	b.EndRow()
+	b.EndRow()
+	b.Add(1, 0.5)
+	b.EndRow()
+	m := b.Build()
+
+	if err := m.Validate(); err != nil {
+		t.Fatalf("matriz inválida: %v", err)
+	}
+	want := [][]float64{
+		{0.1, 0, 0, 0.9},
+		{0, 0, 0, 0},
+		{0, 0.5, 0, 0},
+	}
+	if !reflect.DeepEqual(m.Dense(), want) {
+		t.Errorf("Build = %v, se esperaba %v", m.Dense(), want)
+	}
+	if m.NNZ() != 3 {
+		t.Errorf("NNZ = %d, se esperaba 3", m.NNZ())
+	}
+}
+
+func TestDotAndIntersect(t *testing.T) {
+	u := FromDenseVector([]float64{0.5, 0, 0.2, 1})
+	v := FromDenseVector([]float64{0.4, 0.3, 0, 0.5})
+
+	if got := Dot(u, v); got != 0.7 {
+		t.Errorf("Dot = %g, se esperaba 0.7", got)
+	}
+
+	var cols []int
+	Intersect(u, v, func(col int, a, b float64) { cols = append(cols, col) })
+	if !reflect.DeepEqual(cols, []int{0, 3}) {
+		t.Errorf("Intersect recorrió %v, se esperaba [0 3]", cols)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	m := FromDense([][]float64{
+		{0.5, 0, 0.1},
+		{0, 0.2, 0.8},
+	})
+	want := [][]float64{
+		{0.5, 0},
+		{0, 0.2},
+		{0.1, 0.8},
+	}
+
+	got := m.Transpose()
+	if err := got.Validate(); err != nil {
+		t.Fatalf("traspuesta inválida: %v", err)
+	}
+	if !reflect.DeepEqual(got.Dense(), want) {
+		t.Errorf("Transpose = %v, se esperaba %v", got.Dense(), want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	base := [][]float64{
+		{0.5, 0, 0},
+		{0, 0.2, 0.8},
+	}
+
+	tests := []struct {
+		name       string
+		rows, cols int
+		cells      []Cell
+		want       [][]float64
+		wantErr    bool
+	}{
+		{
+			name:  "sin cambios",
+			rows:  2,
+			cols:  3,
+			cells: nil,
+			want:  base,
+		},
+		{
+			name:  "inserta",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 0, Col: 2, Val: 0.9}},
+			want:  [][]float64{{0.5, 0, 0.9}, {0, 0.2, 0.8}},
+		},
+		{
+			name:  "reemplaza",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 1, Col: 1, Val: 0.3}},
+			want:  [][]float64{{0.5, 0, 0}, {0, 0.3, 0.8}},
+		},
+		{
+			name:  "borra con 0",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 1, Col: 2, Val: 0}},
+			want:  [][]float64{{0.5, 0, 0}, {0, 0.2, 0}},
+		},
+		{
+			name:  "0 en una celda vacía no cambia nada",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 0, Col: 1, Val: 0}},
+			want:  base,
+		},
+		{
+			name:  "vacía la fila",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 0, Col: 0, Val: 0}},
+			want:  [][]float64{{0, 0, 0}, {0, 0.2, 0.8}},
+		},
+		{
+			name:  "la última celda gana",
+			rows:  2,
+			cols:  3,
+			cells: []Cell{{Row: 0, Col: 1, Val: 0.4}, {Row: 0, Col: 1, Val: 0}, {Row: 0, Col: 1, Val: 0.6}},
+			want:  [][]float64{{0.5, 0.6, 0}, {0, 0.2, 0.8}},
+		},
+		{
+			name:  "agrega filas y columnas",
+			rows:  3,
+			cols:  4,
+			cells: []Cell{{Row: 2, Col: 3, Val: 1}, {Row: 0, Col: 3, Val: 0.7}},
+			want:  [][]float64{{0.5, 0, 0, 0.7}, {0, 0.2, 0.8, 0}, {0, 0, 0, 1}},
+		},
+		{
+			name:    "no se achica",
+			rows:    1,
+			cols:    3,
+			wantErr: true,
+		},
+		{
+			name:    "celda fuera de la matriz",
+			rows:    2,
+			cols:    3,
+			cells:   []Cell{{Row: 2, Col: 0, Val: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "columna negativa",
+			rows:    2,
+			cols:    3,
+			cells:   []Cell{{Row: 0, Col: -1, Val: 1}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := FromDense(base)
+			got, err := m.Apply(tt.rows, tt.cols, tt.cells)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Apply no devolvió error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if err := got.Validate(); err != nil {
+				t.Fatalf("matriz inválida: %v", err)
+			}
+			if !reflect.DeepEqual(got.Dense(), tt.want) {
+				t.Errorf("Apply = %v, se esperaba %v", got.Dense(), tt.want)
+			}
+			if !reflect.DeepEqual(m.Dense(), base) {
+				t.Errorf("Apply modificó la matriz original: %v", m.Dense())
+			}
+		})
+	}
+}
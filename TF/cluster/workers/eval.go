@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+)
+
+// evaluate predice, con las calificaciones de entrenamiento del dataset, las
+// de prueba de los usuarios del chunk y acumula las sumas de la evaluación.
+func evaluate(ctx context.Context, ds *models.Dataset, chunk models.Chunk) (*models.EvalSums, error) {
+	test := chunk.Test
+	if test == nil || test.Rows != chunk.End-chunk.Start || test.Cols != ds.Matrix.Cols {
+		return nil, fmt.Errorf("calificaciones de prueba inválidas para los usuarios %d-%d", chunk.Start, chunk.End)
+	}
+	if err := test.Validate(); err != nil {
+		return nil, fmt.Errorf("calificaciones de prueba inválidas: %w", err)
+	}
+	predict, err := evalPredictor(ds, chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	var sums compute.EvalSums
+	err = forBatches(ctx, chunk.End-chunk.Start, func(s, e int) {
+		for i := s; i < e; i++ {
+			if test.Row(i).NNZ() == 0 {
+				continue
+			}
+			user := chunk.Start + i
+			preds, has := predict(user)
+			sums.AddUser(ds.Matrix.Row(user), test.Row(i), preds, has, chunk.TopK, chunk.Relevance)
+		}
+	})
+	if err != nil {
+		return nil, chunkCancelled(chunk, err)
+	}
+
+	out := models.EvalSums(sums)
+	return &out, nil
+}
+
+// evalPredictor devuelve la función que predice todas las películas de un
+// usuario del dataset en el modo del chunk (y cuáles tienen predicción).
+func evalPredictor(ds *models.Dataset, c models.Chunk) (func(user int) ([]float64, []bool), error) {
+	norm, err := compute.LookupNormalization(c.Normalization)
+	if err != nil {
+		return nil, err
+	}
+	conf := compute.Confidence(c.Confidence)
+
+	switch c.Mode {
+	case "", models.ModeUser:
+		matrix, sim, err := store.similarity(ds, c.Metric, c.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		return func(user int) ([]float64, []bool) {
+			return compute.UserBasedPredictions(sim, norm, matrix, ds.Matrix, user, c.K, conf)
+		}, nil
+
+	case models.ModeItem:
+		// el coordinador envía el modelo item–item ya recortado a K vecinos
+		if len(c.ItemModel) != ds.Matrix.Cols {
+			return nil, fmt.Errorf("el modelo item–item tiene %d películas, el dataset %d", len(c.ItemModel), ds.Matrix.Cols)
+		}
+		neighbors := make([][]int, len(c.ItemModel))
+		sims := make([][]float64, len(c.ItemModel))
+		for movie, nbs := range c.ItemModel {
+			neighbors[movie], sims[movie] = splitNeighbors(nbs)
+			for _, j := range neighbors[movie] {
+				if j < 0 || j >= ds.Matrix.Cols {
+					return nil, fmt.Errorf("película vecina %d fuera de rango", j)
+				}
+			}
+		}
+		return func(user int) ([]float64, []bool) {
+			row := ds.Matrix.Row(user)
+			return compute.ItemBasedPredictions(row, norm(row), neighbors, sims, conf)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("modo de evaluación no soportado: %s", c.Mode)
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net"
 	"os"
+	"runtime"
+	"strconv"
 
 	"sdr/cluster/shared/compute"
 	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"sdr/cluster/shared/sparse"
 )
 
 func main() {
@@ -18,68 +21,458 @@ func main() {
 	}
 
 	fmt.Printf("Worker escuchando en puerto %s...\n", port)
-	ln, err := net.Listen("tcp", ":9000")
+	ln, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		fmt.Printf("Error iniciando el listener: %v\n", err)
 		return
 	}
 	defer ln.Close()
 
-	for {
-		conn, err := ln.Accept()
+	// Registro dinámico en el coordinador
+	coordAddr := os.Getenv("COORDINATOR_ADDR")
+	if coordAddr == "" {
+		coordAddr = "sdr_coordinator:8081"
+	}
+	capacity := runtime.NumCPU()
+	if c, err := strconv.Atoi(os.Getenv("WORKER_CAPACITY")); err == nil && c > 0 {
+		capacity = c
+	}
+	go registerLoop(coordAddr, workerID(), port, os.Getenv("WORKER_ADVERTISE_ADDR"), capacity)
+
+	// Conexiones persistentes: el coordinador reutiliza la misma conexión
+	// para varios chunks y puede tener varios en vuelo a la vez.
+	if err := protocol.Serve(ln, handleFrame); err != nil {
+		fmt.Printf("Error en el listener: %v\n", err)
+	}
+}
+
+func handleFrame(ctx context.Context, req protocol.Frame) (any, error) {
+	switch req.Type {
+	case protocol.MsgTask:
+		var task models.WorkerTask
+		if err := req.Decode(&task); err != nil {
+			fmt.Printf("Error parseando JSON: %v\n", err)
+			return nil, fmt.Errorf("error parseando WorkerTask: %w", err)
+		}
+		return handleTask(ctx, task)
+
+	case protocol.MsgDataset:
+		var ds models.Dataset
+		if err := req.Decode(&ds); err != nil {
+			return nil, fmt.Errorf("error parseando dataset: %w", err)
+		}
+		if ds.Matrix == nil {
+			return nil, fmt.Errorf("dataset %s v%d sin matriz", ds.ID, ds.Version)
+		}
+		if err := ds.Matrix.Validate(); err != nil {
+			return nil, fmt.Errorf("matriz del dataset %s v%d inválida: %w", ds.ID, ds.Version, err)
+		}
+		store.put(&ds)
+		fmt.Printf("Dataset %s v%d cargado en memoria (%d usuarios, %d calificaciones)\n", ds.ID, ds.Version, ds.Matrix.Rows, ds.Matrix.NNZ())
+		return models.DatasetRef{ID: ds.ID, Version: ds.Version}, nil
+
+	case protocol.MsgPatch:
+		var patch models.DatasetPatch
+		if err := req.Decode(&patch); err != nil {
+			return nil, fmt.Errorf("error parseando parche: %w", err)
+		}
+		base, err := store.get(patch.Base())
 		if err != nil {
-			fmt.Printf("Error aceptando conexión: %v\n", err)
-			continue
+			return nil, err
+		}
+		ds, err := patch.Apply(base)
+		if err != nil {
+			return nil, err
+		}
+		store.put(ds)
+		fmt.Printf("Dataset %s v%d -> v%d con %d cambios (%d usuarios, %d calificaciones)\n", ds.ID, patch.BaseVersion, ds.Version, len(patch.Cells), ds.Matrix.Rows, ds.Matrix.NNZ())
+		return models.DatasetRef{ID: ds.ID, Version: ds.Version}, nil
+
+	case protocol.MsgForget:
+		var ref models.DatasetRef
+		if err := req.Decode(&ref); err != nil {
+			return nil, fmt.Errorf("error parseando dataset a descartar: %w", err)
+		}
+		if store.forget(ref) {
+			fmt.Printf("Dataset %s v%d descartado\n", ref.ID, ref.Version)
 		}
-		go handleConnection(conn)
+		return ref, nil
+
+	default:
+		return nil, fmt.Errorf("tipo de mensaje no soportado: %s", req.Type)
 	}
 }
 
-func handleConnection(conn net.Conn) {
-	defer conn.Close()
-
-	// Leer mensaje entrante
-	data, err := io.ReadAll(conn)
+// handleTask procesa un chunk por lotes, revisando entre lote y lote si el
+// coordinador lo canceló (MsgCancel) o si venció el plazo de la solicitud.
+func handleTask(ctx context.Context, task models.WorkerTask) (any, error) {
+	chunk := task.Chunk
+	ds, err := store.get(chunk.Dataset)
 	if err != nil {
-		fmt.Printf("Error leyendo datos: %v\n", err)
-		return
+		return nil, err
 	}
 
-	var task models.TaskMessage
-	if err := json.Unmarshal(data, &task); err != nil {
-		fmt.Printf("Error parseando JSON: %v\n", err)
-		return
-	}
+	ctx, cancel := protocol.WithDeadlineMs(ctx, chunk.DeadlineMs)
+	defer cancel()
+
+	load.Add(1)
+	defer load.Add(-1)
+
+	// Procesar el chunk según su fase
+	resp := models.WorkerResult{ChunkID: chunk.ID}
+	switch chunk.Phase {
+	case models.PhaseNeighbors:
+		if err := userRange(ds, chunk.Start, chunk.End); err != nil {
+			return nil, err
+		}
+		target, err := chunkTarget(ds, chunk)
+		if err != nil {
+			return nil, err
+		}
+		norm, err := compute.LookupNormalization(chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		target, _ = compute.NormalizeRow(norm, target)
+		matrix, sim, err := store.similarity(ds, chunk.Metric, chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		conf := compute.Confidence(chunk.Confidence)
+		var idxs []int
+		var sims []float64
+		err = forBatches(ctx, chunk.End-chunk.Start, func(s, e int) {
+			i, sc := compute.ConfidentNeighbors(sim, matrix, target, chunk.Start+s, chunk.Start+e, chunk.UserIndex, chunk.K, conf)
+			idxs = append(idxs, i...)
+			sims = append(sims, sc...)
+		})
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+		// cada lote trae sus K mejores; el chunk devuelve los K mejores de todos
+		for _, j := range compute.TopKIndexes(sims, chunk.K) {
+			resp.Neighbors = append(resp.Neighbors, models.Neighbor{
+				Index:      idxs[j],
+				Similarity: sims[j],
+			})
+		}
 
-	// Procesar la tarea
-	var resp models.CoordinatorResponse
-	switch task.Type {
-	case models.RequestRecommendation:
-		sims := compute.CosineSimilarityForUser(task.Matrix, task.UserIndex)
-		preds := compute.PredictRatings(task.Matrix, sims, task.UserIndex, task.K)
-		indexes := compute.SortIndexesByScore(preds)
+	case models.PhasePartial:
+		if err := userRange(ds, chunk.Start, chunk.End); err != nil {
+			return nil, err
+		}
+		target, err := chunkTarget(ds, chunk)
+		if err != nil {
+			return nil, err
+		}
+		matrix, err := store.normalized(ds, chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		idxs, sims := splitNeighbors(chunk.Neighbors)
+		for _, i := range idxs {
+			if i < chunk.Start || i >= chunk.End {
+				return nil, fmt.Errorf("vecino %d fuera del rango %d-%d", i, chunk.Start, chunk.End)
+			}
+		}
+		num := make([]float64, target.Dim)
+		den := make([]float64, target.Dim)
+		voters := make([]float64, target.Dim)
+		err = forBatches(ctx, len(idxs), func(s, e int) {
+			n, d, v := compute.PartialWeightedSums(matrix, target, idxs[s:e], sims[s:e])
+			for i := range n {
+				num[i] += n[i]
+				den[i] += d[i]
+				voters[i] += v[i]
+			}
+		})
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+		// solo viajan las películas que algún vecino calificó
+		numerators, denominators, votes := sparsePartials(num, den, voters)
+		resp.Numerators, resp.Denominators, resp.Voters = &numerators, &denominators, &votes
 
-		resp = models.CoordinatorResponse{
-			Result:  preds,
-			Indexes: indexes,
+	case models.PhaseTopN:
+		// aquí [Start, End) es un rango de películas
+		if chunk.Start < 0 || chunk.End > ds.Matrix.Cols || chunk.Start > chunk.End {
+			return nil, fmt.Errorf("rango de películas inválido: %d-%d", chunk.Start, chunk.End)
+		}
+		target, err := chunkTarget(ds, chunk)
+		if err != nil {
+			return nil, err
+		}
+		matrix, err := store.normalized(ds, chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		idxs, sims := splitNeighbors(chunk.Neighbors)
+		for _, i := range idxs {
+			if i < 0 || i >= ds.Matrix.Rows {
+				return nil, fmt.Errorf("vecino %d fuera del dataset (%d usuarios)", i, ds.Matrix.Rows)
+			}
+		}
+		var movies []int
+		var scores []float64
+		err = forBatches(ctx, chunk.End-chunk.Start, func(s, e int) {
+			m, sc := compute.TopNPredictions(matrix, target, idxs, sims, chunk.Start+s, chunk.Start+e, chunk.N, compute.Confidence(chunk.Confidence))
+			movies = append(movies, m...)
+			scores = append(scores, sc...)
+		})
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+		// cada lote trae sus N mejores; el chunk devuelve las N mejores de todas
+		top := compute.TopKIndexes(scores, chunk.N)
+		resp.Items = make([]models.ScoredItem, len(top))
+		for i, j := range top {
+			resp.Items[i] = models.ScoredItem{Index: movies[j], Score: scores[j]}
+			if chunk.Explain > 0 {
+				resp.Items[i].Because = contributions(compute.NeighborContributions(matrix, ds.Matrix, idxs, sims, movies[j], chunk.Explain))
+			}
 		}
 
-	case models.RequestSimilarity:
-		simMatrix := compute.CosineSimilarityMatrix(task.Matrix)
-		resp = models.CoordinatorResponse{Result: simMatrix}
+	case models.PhaseSimilarityBlock:
+		if err := userRange(ds, chunk.Start, chunk.End); err != nil {
+			return nil, err
+		}
+		if err := userRange(ds, chunk.ColStart, chunk.ColEnd); err != nil {
+			return nil, err
+		}
+		matrix, sim, err := store.similarity(ds, chunk.Metric, chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		values, err := similarityBlock(ctx, sim, matrix, chunk)
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+		resp.BlockNeighbors = blockNeighbors(values, chunk)
+
+	case models.PhaseItemNeighbors:
+		// aquí [Start, End) es un rango de películas
+		items, sim, err := store.itemSimilarity(ds, chunk.Metric, chunk.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Start < 0 || chunk.End > items.Rows || chunk.Start > chunk.End {
+			return nil, fmt.Errorf("rango de películas inválido: %d-%d", chunk.Start, chunk.End)
+		}
+		resp.ItemNeighbors = make([][]models.Neighbor, 0, chunk.End-chunk.Start)
+		err = forBatches(ctx, chunk.End-chunk.Start, func(s, e int) {
+			for movie := chunk.Start + s; movie < chunk.Start+e; movie++ {
+				idxs, sims := compute.MostSimilar(sim, items, movie, chunk.K)
+				nbs := make([]models.Neighbor, len(idxs))
+				for i := range idxs {
+					nbs[i] = models.Neighbor{Index: idxs[i], Similarity: sims[i]}
+				}
+				resp.ItemNeighbors = append(resp.ItemNeighbors, nbs)
+			}
+		})
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+
+	case models.PhaseALSUsers, models.PhaseALSItems:
+		// filas de la matriz usuario–película o de la película–usuario
+		// (ALS trabaja con las calificaciones originales)
+		matrix := ds.Matrix
+		if chunk.Phase == models.PhaseALSItems {
+			if matrix, err = store.transposed(ds, compute.NormalizationNone); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Start < 0 || chunk.End > matrix.Rows || chunk.Start > chunk.End {
+			return nil, fmt.Errorf("rango inválido para %s: %d-%d", chunk.Phase, chunk.Start, chunk.End)
+		}
+		if len(chunk.Fixed) != matrix.Cols {
+			return nil, fmt.Errorf("se recibieron %d factores fijos, se esperaban %d", len(chunk.Fixed), matrix.Cols)
+		}
+		resp.Factors = make([][]float64, 0, chunk.End-chunk.Start)
+		err := forBatches(ctx, chunk.End-chunk.Start, func(s, e int) {
+			rs, re := chunk.Start+s, chunk.Start+e
+			factors := compute.SolveFactors(matrix, rs, re, chunk.Fixed, chunk.Lambda)
+			sse, count := compute.SquaredError(matrix, rs, re, factors, chunk.Fixed)
+			resp.Factors = append(resp.Factors, factors...)
+			resp.Loss += sse
+			resp.Count += count
+		})
+		if err != nil {
+			return nil, chunkCancelled(chunk, err)
+		}
+
+	case models.PhaseEvaluate:
+		if err := userRange(ds, chunk.Start, chunk.End); err != nil {
+			return nil, err
+		}
+		if resp.Eval, err = evaluate(ctx, ds, chunk); err != nil {
+			return nil, err
+		}
 
 	default:
-		fmt.Printf("Tipo de tarea desconocido: %s\n", task.Type)
-		return
+		fmt.Printf("Fase de chunk desconocida: %s\n", chunk.Phase)
+		return nil, fmt.Errorf("fase de chunk desconocida: %s", chunk.Phase)
 	}
 
-	// Enviar respuesta al coordinador
-	jsonData, _ := json.Marshal(resp)
-	_, err = conn.Write(jsonData)
+	fmt.Printf("Chunk %d (%s, rango %d-%d) completado y enviado al Coordinador\n", chunk.ID, chunk.Phase, chunk.Start, chunk.End)
+	return resp, nil
+}
+
+// Filas (o vecinos, o películas) que se procesan entre dos revisiones de ctx
+const batchSize = 256
+
+// forBatches llama a fn con lotes [s, e) consecutivos de [0, n) y se detiene
+// con el error de ctx si la solicitud se cancela entre un lote y otro.
+func forBatches(ctx context.Context, n int, fn func(s, e int)) error {
+	for s := 0; s < n; s += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fn(s, min(s+batchSize, n))
+	}
+	return ctx.Err()
+}
+
+// similarityBlock calcula el bloque de similitudes del chunk por franjas de
+// filas. En los bloques diagonales cada franja calcula su sub-bloque diagonal
+// y el tramo a su derecha, y el resto se refleja, igual que
+// compute.SimilarityBlock.
+func similarityBlock(ctx context.Context, sim compute.Similarity, matrix *sparse.Matrix, c models.Chunk) ([]float64, error) {
+	cols := c.ColEnd - c.ColStart
+	block := make([]float64, (c.End-c.Start)*cols)
+	diagonal := c.Start == c.ColStart && c.End == c.ColEnd
+
+	put := func(rowStart, colStart, rows, width int, values []float64, mirror bool) {
+		for i := 0; i < rows; i++ {
+			for j := 0; j < width; j++ {
+				r, col := rowStart-c.Start+i, colStart-c.ColStart+j
+				block[r*cols+col] = values[i*width+j]
+				if mirror {
+					block[col*cols+r] = values[i*width+j]
+				}
+			}
+		}
+	}
+
+	err := forBatches(ctx, c.End-c.Start, func(s, e int) {
+		rs, re := c.Start+s, c.Start+e
+		if !diagonal {
+			put(rs, c.ColStart, e-s, cols, compute.SimilarityBlock(sim, matrix, rs, re, c.ColStart, c.ColEnd), false)
+			return
+		}
+		put(rs, rs, e-s, e-s, compute.SimilarityBlock(sim, matrix, rs, re, rs, re), false)
+		if re < c.ColEnd {
+			put(rs, re, e-s, c.ColEnd-re, compute.SimilarityBlock(sim, matrix, rs, re, re, c.ColEnd), true)
+		}
+	})
 	if err != nil {
-		fmt.Printf("Error enviando respuesta: %v\n", err)
-		return
+		return nil, err
 	}
+	return block, nil
+}
 
-	fmt.Println("Tarea completada y enviada al Coordinador")
+// blockNeighbors reduce un bloque de similitudes (por filas) a los
+// c.K vecinos de cada fila y, si el bloque no es de la diagonal, a
+// continuación los de cada columna: la otra mitad de la matriz simétrica
+// no se calcula. Nadie es vecino de sí mismo.
+func blockNeighbors(block []float64, c models.Chunk) [][]models.Neighbor {
+	rows, cols := c.End-c.Start, c.ColEnd-c.ColStart
+	diagonal := c.Start == c.ColStart && c.End == c.ColEnd
+
+	top := func(self, first, n int, at func(i int) float64) []models.Neighbor {
+		sims := make([]float64, 0, n)
+		idxs := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			if first+i != self {
+				sims = append(sims, at(i))
+				idxs = append(idxs, first+i)
+			}
+		}
+		best := compute.TopKIndexes(sims, c.K)
+		out := make([]models.Neighbor, len(best))
+		for i, j := range best {
+			out[i] = models.Neighbor{Index: idxs[j], Similarity: sims[j]}
+		}
+		return out
+	}
+
+	out := make([][]models.Neighbor, 0, rows+cols)
+	for r := 0; r < rows; r++ {
+		out = append(out, top(c.Start+r, c.ColStart, cols, func(j int) float64 { return block[r*cols+j] }))
+	}
+	if !diagonal {
+		for j := 0; j < cols; j++ {
+			out = append(out, top(c.ColStart+j, c.Start, rows, func(r int) float64 { return block[r*cols+j] }))
+		}
+	}
+	return out
+}
+
+// chunkCancelled registra y envuelve el error de un chunk interrumpido.
+func chunkCancelled(c models.Chunk, err error) error {
+	fmt.Printf("Chunk %d (%s, rango %d-%d) cancelado: %v\n", c.ID, c.Phase, c.Start, c.End, err)
+	return fmt.Errorf("chunk %d cancelado: %w", c.ID, err)
+}
+
+// userRange valida que [start, end) sea un rango de filas del dataset.
+func userRange(ds *models.Dataset, start, end int) error {
+	if start < 0 || end > ds.Matrix.Rows || start > end {
+		return fmt.Errorf("rango de usuarios inválido: %d-%d", start, end)
+	}
+	return nil
+}
+
+// chunkTarget devuelve la fila del usuario objetivo que trae el chunk o,
+// si no la trae, la del dataset.
+func chunkTarget(ds *models.Dataset, c models.Chunk) (sparse.Vector, error) {
+	if c.Target != nil {
+		if c.Target.Dim != ds.Matrix.Cols {
+			return sparse.Vector{}, fmt.Errorf("la fila objetivo tiene %d películas, el dataset %d", c.Target.Dim, ds.Matrix.Cols)
+		}
+		return *c.Target, nil
+	}
+	if c.UserIndex < 0 || c.UserIndex >= ds.Matrix.Rows {
+		return sparse.Vector{}, fmt.Errorf("usuario %d fuera de rango", c.UserIndex)
+	}
+	return ds.Matrix.Row(c.UserIndex), nil
+}
+
+// sparsePartials conserva solo las películas que calificó algún vecino
+// (numeradores, denominadores y votantes quedan con los mismos índices).
+func sparsePartials(num, den, voters []float64) (sparse.Vector, sparse.Vector, sparse.Vector) {
+	n := sparse.Vector{Dim: len(num)}
+	d := sparse.Vector{Dim: len(den)}
+	v := sparse.Vector{Dim: len(voters)}
+	for i := range voters {
+		if voters[i] == 0 {
+			continue
+		}
+		n.Idx = append(n.Idx, i)
+		n.Val = append(n.Val, num[i])
+		d.Idx = append(d.Idx, i)
+		d.Val = append(d.Val, den[i])
+		v.Idx = append(v.Idx, i)
+		v.Val = append(v.Val, voters[i])
+	}
+	return n, d, v
+}
+
+// splitNeighbors separa índices y similitudes de los vecinos.
+func splitNeighbors(neighbors []models.Neighbor) ([]int, []float64) {
+	idxs := make([]int, len(neighbors))
+	sims := make([]float64, len(neighbors))
+	for i, n := range neighbors {
+		idxs[i] = n.Index
+		sims[i] = n.Similarity
+	}
+	return idxs, sims
+}
+
+// contributions pasa los aportes al formato de los mensajes.
+func contributions(cs []compute.Contribution) []models.Contribution {
+	out := make([]models.Contribution, len(cs))
+	for i, c := range cs {
+		out[i] = models.Contribution(c)
+	}
+	return out
 }
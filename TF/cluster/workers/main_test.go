@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/sparse"
+)
+
+// topOf se queda con los k vecinos de mayor similitud.
+func topOf(nbs []models.Neighbor, k int) []models.Neighbor {
+	sims := make([]float64, len(nbs))
+	for i, nb := range nbs {
+		sims[i] = nb.Similarity
+	}
+	out := make([]models.Neighbor, 0, k)
+	for _, j := range compute.TopKIndexes(sims, k) {
+		out = append(out, nbs[j])
+	}
+	return out
+}
+
+func TestBlockNeighborsMatchAllPairs(t *testing.T) {
+	// más filas que batchSize: los bloques diagonales se calculan por franjas
+	// y el tramo a la derecha de cada una se refleja
+	const users, movies, k = 2*batchSize + 37, 12, 5
+	r := rand.New(rand.NewSource(1))
+	dense := make([][]float64, users)
+	for i := range dense {
+		dense[i] = make([]float64, movies)
+		for j := range dense[i] {
+			if r.Float64() < 0.5 {
+				dense[i][j] = 0.1 + 0.9*r.Float64()
+			}
+		}
+	}
+	matrix := sparse.FromDense(dense)
+	metric, _ := compute.LookupMetric(compute.MetricCosine)
+	sim := metric(matrix)
+
+	// referencia: todos contra todos
+	full := compute.SimilarityBlock(sim, matrix, 0, users, 0, users)
+	want := make([][]models.Neighbor, users)
+	for u := range want {
+		var all []models.Neighbor
+		for v := 0; v < users; v++ {
+			if v != u {
+				all = append(all, models.Neighbor{Index: v, Similarity: full[u*users+v]})
+			}
+		}
+		want[u] = topOf(all, k)
+	}
+
+	// tramos por lado; con 2, 4 y 5 los tramos quedan de distinto tamaño
+	for _, sides := range []int{1, 2, 3, 4, 5} {
+		bounds := make([]int, sides+1)
+		for i := 1; i <= sides; i++ {
+			bounds[i] = bounds[i-1] + users/sides
+			if i <= users%sides {
+				bounds[i]++
+			}
+		}
+
+		got := make([][]models.Neighbor, users)
+		for bi := 0; bi < sides; bi++ {
+			for bj := bi; bj < sides; bj++ {
+				c := models.Chunk{Start: bounds[bi], End: bounds[bi+1], ColStart: bounds[bj], ColEnd: bounds[bj+1], K: k}
+				values, err := similarityBlock(context.Background(), sim, matrix, c)
+				if err != nil {
+					t.Fatalf("similarityBlock: %v", err)
+				}
+				nbs := blockNeighbors(values, c)
+
+				rows, cols := c.End-c.Start, c.ColEnd-c.ColStart
+				wantLen := rows
+				if bi != bj {
+					wantLen += cols // el bloque también resuelve sus columnas
+				}
+				if len(nbs) != wantLen {
+					t.Fatalf("%d tramos, bloque (%d,%d): vecinos de %d usuarios, se esperaban %d", sides, bi, bj, len(nbs), wantLen)
+				}
+				for ri, list := range nbs {
+					u := c.Start + ri
+					if ri >= rows {
+						u = c.ColStart + ri - rows
+					}
+					got[u] = topOf(append(got[u], list...), k)
+				}
+			}
+		}
+
+		for u := range want {
+			if len(got[u]) != len(want[u]) {
+				t.Fatalf("%d tramos: el usuario %d tiene %d vecinos, se esperaban %d", sides, u, len(got[u]), len(want[u]))
+			}
+			for i := range want[u] {
+				if got[u][i].Index != want[u][i].Index || math.Abs(got[u][i].Similarity-want[u][i].Similarity) > 1e-12 {
+					t.Fatalf("%d tramos: vecinos del usuario %d = %v, se esperaba %v", sides, u, got[u], want[u])
+				}
+			}
+		}
+	}
+}
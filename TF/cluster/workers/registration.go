@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+)
+
+// Espera máxima entre intentos de registro
+const maxBackoff = 30 * time.Second
+
+// Chunks en proceso en este momento (se informa en cada latido)
+var load atomic.Int64
+
+// registerLoop registra el worker en el coordinador y envía latidos
+// periódicos. Si el coordinador no responde o desconoce al worker (por
+// ejemplo, tras reiniciarse), se vuelve a registrar.
+func registerLoop(coordAddr, id, port, advertise string, capacity int) {
+	backoff := time.Second
+
+	for {
+		client, err := protocol.Dial(coordAddr, 3*time.Second)
+		if err != nil {
+			fmt.Printf("No se pudo conectar al coordinador %s: %v (reintento en %s)\n", coordAddr, err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		// Si no se indicó la dirección pública, usamos la IP local con la que
+		// llegamos al coordinador (sirve con réplicas de Docker Compose).
+		addr := advertise
+		if addr == "" {
+			host, _, _ := net.SplitHostPort(client.LocalAddr().String())
+			addr = net.JoinHostPort(host, port)
+		}
+
+		reg := models.WorkerRegistration{ID: id, Addr: addr, Capacity: capacity}
+		var ack models.RegistrationAck
+		if err := client.Call(protocol.MsgRegister, reg, &ack); err != nil {
+			fmt.Printf("Error registrándose en el coordinador: %v\n", err)
+			client.Close()
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		fmt.Printf("Worker %s registrado en el coordinador como %s\n", id, addr)
+		backoff = time.Second
+
+		interval := time.Duration(ack.HeartbeatIntervalMs) * time.Millisecond
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		heartbeat(client, id, capacity, interval)
+		client.Close()
+	}
+}
+
+// heartbeat envía latidos hasta que uno falle.
+func heartbeat(client *protocol.Client, id string, capacity int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hb := models.Heartbeat{ID: id, Load: int(load.Load()), Capacity: capacity, Datasets: store.refs()}
+		if err := client.Call(protocol.MsgHeartbeat, hb, nil); err != nil {
+			fmt.Printf("Latido rechazado, reintentando registro: %v\n", err)
+			return
+		}
+	}
+}
+
+// workerID usa WORKER_ID o, si no existe, el hostname del contenedor.
+func workerID() string {
+	if id := os.Getenv("WORKER_ID"); id != "" {
+		return id
+	}
+	if h, err := os.Hostname(); err == nil {
+		return h
+	}
+	return fmt.Sprintf("worker-%d", os.Getpid())
+}
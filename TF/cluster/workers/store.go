@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"sdr/cluster/shared/compute"
+	"sdr/cluster/shared/models"
+	"sdr/cluster/shared/protocol"
+	"sdr/cluster/shared/sparse"
+)
+
+// Las versiones anteriores de cada dataset se conservan hasta que el
+// coordinador avisa con MsgForget que ya nadie las usa; maxVersions solo
+// acota la memoria si ese aviso se pierde (p. ej. con el coordinador caído).
+const maxVersions = 8
+
+// datasetStore guarda en memoria los datasets que envía el coordinador.
+type datasetStore struct {
+	mu       sync.RWMutex
+	datasets map[string][]*models.Dataset // por ID, de la versión más nueva a la más vieja
+
+	// filas normalizadas de cada versión (comparten la estructura con la
+	// original; sin normalización se usa la matriz tal cual)
+	norms map[normKey]*derived[*sparse.Matrix]
+
+	// métricas ya preparadas para cada versión (p. ej. las medias por
+	// película del coseno ajustado), para no recalcularlas en cada chunk
+	prepared map[metricKey]*derived[compute.Similarity]
+
+	// matriz película–usuario de cada versión, para el modo item
+	items map[normKey]*derived[*sparse.Matrix]
+}
+
+// normKey identifica una versión del dataset con una normalización.
+type normKey struct {
+	ref  models.DatasetRef
+	norm string
+}
+
+type metricKey struct {
+	normKey
+	metric string
+	items  bool // preparada sobre la matriz película–usuario
+}
+
+var store = &datasetStore{
+	datasets: make(map[string][]*models.Dataset),
+	norms:    make(map[normKey]*derived[*sparse.Matrix]),
+	prepared: make(map[metricKey]*derived[compute.Similarity]),
+	items:    make(map[normKey]*derived[*sparse.Matrix]),
+}
+
+// derived es algo calculado a partir de una versión del dataset (filas
+// normalizadas, matriz película–usuario o métrica preparada). Los chunks de
+// una versión nueva llegan juntos: el primero lo calcula y el resto espera
+// ese mismo cálculo.
+type derived[T any] struct {
+	done  chan struct{} // se cierra cuando termina el cálculo
+	value T
+	err   error
+}
+
+// derive devuelve el valor de key en cache, calculándolo con build si
+// todavía no existe. Solo se guarda mientras la versión siga en memoria,
+// así lo calculado para una versión descartada durante el cálculo no queda
+// retenido.
+func derive[K comparable, T any](s *datasetStore, cache map[K]*derived[T], key K, ref models.DatasetRef, build func() (T, error)) (T, error) {
+	s.mu.Lock()
+	d, ok := cache[key]
+	if !ok {
+		d = &derived[T]{done: make(chan struct{})}
+		if s.has(ref) {
+			cache[key] = d
+		}
+	}
+	s.mu.Unlock()
+
+	if ok {
+		<-d.done
+		return d.value, d.err
+	}
+
+	func() {
+		defer close(d.done)
+		d.value, d.err = build() // fuera del lock: puede recorrer toda la matriz
+	}()
+	// un error no se guarda: el próximo chunk vuelve a intentarlo
+	s.mu.Lock()
+	if cache[key] == d && (d.err != nil || !s.has(ref)) {
+		delete(cache, key)
+	}
+	s.mu.Unlock()
+	return d.value, d.err
+}
+
+// put guarda una versión del dataset y descarta las más viejas.
+func (s *datasetStore) put(ds *models.Dataset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := []*models.Dataset{ds}
+	for _, old := range s.datasets[ds.ID] {
+		if old.Version != ds.Version {
+			versions = append(versions, old)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	if len(versions) > maxVersions {
+		for _, old := range versions[maxVersions:] {
+			s.forgetMetrics(models.DatasetRef{ID: old.ID, Version: old.Version})
+		}
+		versions = versions[:maxVersions]
+	}
+	s.datasets[ds.ID] = versions
+}
+
+// forget descarta esa versión del dataset. Devuelve false si no estaba.
+func (s *datasetStore) forget(ref models.DatasetRef) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.datasets[ref.ID]
+	for i, ds := range versions {
+		if ds.Version != ref.Version {
+			continue
+		}
+		versions = append(versions[:i:i], versions[i+1:]...)
+		if len(versions) == 0 {
+			delete(s.datasets, ref.ID)
+		} else {
+			s.datasets[ref.ID] = versions
+		}
+		s.forgetMetrics(ref)
+		return true
+	}
+	return false
+}
+
+// normalized devuelve las filas de esa versión con la normalización pedida.
+func (s *datasetStore) normalized(ds *models.Dataset, norm string) (*sparse.Matrix, error) {
+	key := normKey{models.DatasetRef{ID: ds.ID, Version: ds.Version}, compute.NormalizationName(norm)}
+	if key.norm == compute.NormalizationNone {
+		return ds.Matrix, nil
+	}
+
+	return derive(s, s.norms, key, key.ref, func() (*sparse.Matrix, error) {
+		n, err := compute.LookupNormalization(norm)
+		if err != nil {
+			return nil, err
+		}
+		return compute.NormalizeMatrix(n, ds.Matrix), nil
+	})
+}
+
+// similarity devuelve las filas normalizadas de esa versión y la métrica
+// pedida preparada sobre ellas.
+func (s *datasetStore) similarity(ds *models.Dataset, metric, norm string) (*sparse.Matrix, compute.Similarity, error) {
+	matrix, err := s.normalized(ds, norm)
+	if err != nil {
+		return nil, nil, err
+	}
+	sim, err := s.prepare(ds, metric, norm, matrix, false)
+	return matrix, sim, err
+}
+
+// itemSimilarity devuelve la matriz película–usuario de esa versión y la
+// métrica pedida preparada sobre ella (para comparar películas entre sí).
+func (s *datasetStore) itemSimilarity(ds *models.Dataset, metric, norm string) (*sparse.Matrix, compute.Similarity, error) {
+	items, err := s.transposed(ds, norm)
+	if err != nil {
+		return nil, nil, err
+	}
+	sim, err := s.prepare(ds, metric, norm, items, true)
+	return items, sim, err
+}
+
+// transposed devuelve la matriz película–usuario de esa versión (con las
+// calificaciones normalizadas por usuario).
+func (s *datasetStore) transposed(ds *models.Dataset, norm string) (*sparse.Matrix, error) {
+	key := normKey{models.DatasetRef{ID: ds.ID, Version: ds.Version}, compute.NormalizationName(norm)}
+
+	return derive(s, s.items, key, key.ref, func() (*sparse.Matrix, error) {
+		matrix, err := s.normalized(ds, norm)
+		if err != nil {
+			return nil, err
+		}
+		return compute.Transpose(matrix), nil
+	})
+}
+
+func (s *datasetStore) prepare(ds *models.Dataset, metric, norm string, matrix *sparse.Matrix, items bool) (compute.Similarity, error) {
+	key := metricKey{
+		normKey: normKey{models.DatasetRef{ID: ds.ID, Version: ds.Version}, compute.NormalizationName(norm)},
+		metric:  compute.NormalizeMetric(metric),
+		items:   items,
+	}
+
+	return derive(s, s.prepared, key, key.ref, func() (compute.Similarity, error) {
+		m, err := compute.LookupMetric(metric)
+		if err != nil {
+			return nil, err
+		}
+		return m(matrix), nil
+	})
+}
+
+// forgetMetrics descarta las métricas preparadas, las filas normalizadas y
+// las matrices película–usuario de una versión (con el lock tomado).
+func (s *datasetStore) forgetMetrics(ref models.DatasetRef) {
+	for key := range s.norms {
+		if key.ref == ref {
+			delete(s.norms, key)
+		}
+	}
+	for key := range s.items {
+		if key.ref == ref {
+			delete(s.items, key)
+		}
+	}
+	for key := range s.prepared {
+		if key.ref == ref {
+			delete(s.prepared, key)
+		}
+	}
+}
+
+// has indica si esa versión sigue en memoria (con el lock tomado).
+func (s *datasetStore) has(ref models.DatasetRef) bool {
+	for _, ds := range s.datasets[ref.ID] {
+		if ds.Version == ref.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// get devuelve la versión pedida o un error CodeDatasetMissing para que el
+// coordinador la reenvíe.
+func (s *datasetStore) get(ref models.DatasetRef) (*models.Dataset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, ds := range s.datasets[ref.ID] {
+		if ds.Version == ref.Version {
+			return ds, nil
+		}
+	}
+	return nil, &protocol.RemoteError{
+		Code:    protocol.CodeDatasetMissing,
+		Message: fmt.Sprintf("dataset %s versión %d no disponible en el worker", ref.ID, ref.Version),
+	}
+}
+
+// refs lista las versiones en memoria (se informan en cada latido).
+func (s *datasetStore) refs() []models.DatasetRef {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []models.DatasetRef
+	for id, versions := range s.datasets {
+		for _, ds := range versions {
+			out = append(out, models.DatasetRef{ID: id, Version: ds.Version})
+		}
+	}
+	return out
+}